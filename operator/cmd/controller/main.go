@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/awslabs/kit/operator/pkg/awsprovider"
 	"github.com/awslabs/kit/operator/pkg/awsprovider/iam"
@@ -26,15 +27,19 @@ var (
 
 // Options for running this binary
 type Options struct {
-	EnableVerboseLogging bool
-	MetricsPort          int
-	WebhookPort          int
+	EnableVerboseLogging    bool
+	MetricsPort             int
+	WebhookPort             int
+	AddonRolloutConcurrency int
+	ResyncPeriod            time.Duration
 }
 
 func main() {
 	flag.BoolVar(&options.EnableVerboseLogging, "verbose", false, "Enable verbose logging")
 	flag.IntVar(&options.WebhookPort, "webhook-port", 9443, "The port the webhook endpoint binds to for validation and mutation of resources")
 	flag.IntVar(&options.MetricsPort, "metrics-port", 8080, "The port the metric endpoint binds to for operating metrics about the controller itself")
+	flag.IntVar(&options.AddonRolloutConcurrency, "addon-rollout-concurrency", 0, "The number of clusters rolling out add-on changes at once, 0 is unlimited")
+	flag.DurationVar(&options.ResyncPeriod, "resync-period", time.Minute, "How often control planes are reconciled without changes, correcting drift in their add-ons, 0 disables the resync")
 	flag.Parse()
 
 	logger := controllerruntimezap.NewRaw(controllerruntimezap.UseDevMode(options.EnableVerboseLogging),
@@ -57,6 +62,9 @@ func main() {
 			&awsprovider.AccountInfo{Session: session},
 			iam.NewController(awsprovider.IAMClient(session),
 				kubeprovider.New(manager.GetClient())),
+			awsprovider.ELBV2Client(session),
+			options.AddonRolloutConcurrency,
+			options.ResyncPeriod,
 		),
 		dataplane.NewController(manager.GetClient(), session),
 	).Start(controllerruntime.SetupSignalHandler())
@@ -15,6 +15,11 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -42,18 +47,227 @@ type ControlPlaneList struct {
 // master and etcd are configured to run. By default, KIT uses all the default
 // values and ControlPlaneSpec can be empty.
 type ControlPlaneSpec struct {
-	KubernetesVersion string     `json:"kubernetesVersion,omitempty"`
-	Master            MasterSpec `json:"master,omitempty"`
-	Etcd              *Component `json:"etcd,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// ImageRegistry mirrors the EKS-D repositories, i.e.
+	// 123456789012.dkr.ecr.us-west-2.amazonaws.com/eks-distro, the control
+	// plane and add-on images are pulled from it instead of public ECR
+	ImageRegistry  string          `json:"imageRegistry,omitempty"`
+	Master         MasterSpec      `json:"master,omitempty"`
+	Etcd           *Component      `json:"etcd,omitempty"`
+	KubeProxy      *KubeProxy      `json:"kubeProxy,omitempty"`
+	EtcdMonitoring *EtcdMonitoring `json:"etcdMonitoring,omitempty"`
+	EtcdDefrag     *EtcdDefrag     `json:"etcdDefrag,omitempty"`
+	// EtcdBackup snapshots etcd to S3 on a schedule
+	EtcdBackup *EtcdBackup `json:"etcdBackup,omitempty"`
+	// EtcdRestore restores etcd from a snapshot when the control plane is
+	// created, it's ignored for existing control planes
+	EtcdRestore *EtcdRestore `json:"etcdRestore,omitempty"`
+	Addons      *Addons      `json:"addons,omitempty"`
+	Bootstrap   *Bootstrap   `json:"bootstrap,omitempty"`
+	// FinalizeTimeout is how long each component may take to clean up when
+	// the ControlPlane is deleted before it's reported as stalled and retried,
+	// defaults to 10m
+	FinalizeTimeout *metav1.Duration `json:"finalizeTimeout,omitempty"`
+	// FeatureGates enables or disables feature gates, i.e. {"APIListChunking":
+	// true}. The same gates are passed to the API server, controller manager,
+	// scheduler and the data plane kubelets so the components agree on which
+	// features are on. Nodes pick up a change when their launch template is
+	// recreated.
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+}
+
+// Bootstrap configures resources created in the guest cluster once it's up.
+// They are owned by the tenant, so they're left in place on deletion.
+type Bootstrap struct {
+	Namespaces []BootstrapNamespace `json:"namespaces,omitempty"`
+}
+
+// BootstrapNamespace is a namespace with an optional ResourceQuota and
+// LimitRange. Resources are keyed by resource name, i.e. cpu or requests.memory,
+// with quantities like 500m or 2Gi.
+type BootstrapNamespace struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// ResourceQuota is the hard limit for the namespace
+	ResourceQuota map[string]string `json:"resourceQuota,omitempty"`
+	// LimitRange applies to each container in the namespace
+	LimitRange *ContainerLimitRange `json:"limitRange,omitempty"`
+}
+
+// ContainerLimitRange is the limit range applied to containers
+type ContainerLimitRange struct {
+	Default        map[string]string `json:"default,omitempty"`
+	DefaultRequest map[string]string `json:"defaultRequest,omitempty"`
+	Max            map[string]string `json:"max,omitempty"`
+	Min            map[string]string `json:"min,omitempty"`
+}
+
+// Addons configures the add-ons KIT installs in the guest cluster
+type Addons struct {
+	// Placement of the Deployment based add-ons like CoreDNS, which can be used
+	// to keep them off the nodes under test
+	Placement *Placement `json:"placement,omitempty"`
+	// ReadinessTimeout, when set, waits for the add-on DaemonSets and
+	// Deployments to roll out before the ControlPlane is reported ready. The
+	// AddonsProgressing condition is false if they aren't ready in time.
+	ReadinessTimeout *metav1.Duration `json:"readinessTimeout,omitempty"`
+	// CNI is the pod network add-on installed in the guest cluster, calico or
+	// vpc-cni.
+	// The guest cluster's CNI is left unmanaged when it's unset. Changing or
+	// unsetting it removes the add-on KIT previously installed, a CNI installed
+	// some other way is left alone.
+	CNI CNIPlugin `json:"cni,omitempty"`
+	// Calico configures the calico add-on when it's the CNI
+	Calico *Calico `json:"calico,omitempty"`
+	// VPCCNI configures the aws-node add-on when vpc-cni is the CNI
+	VPCCNI *VPCCNI `json:"vpcCNI,omitempty"`
+}
+
+// CNIPlugin is a pod network add-on
+type CNIPlugin string
+
+const (
+	// CNIPluginCalico routes pods over VXLAN and enforces NetworkPolicies
+	CNIPluginCalico CNIPlugin = "calico"
+	// CNIPluginVPCCNI gives pods addresses from the node's subnet with the
+	// Amazon VPC CNI's aws-node daemon, using the node's instance profile
+	CNIPluginVPCCNI CNIPlugin = "vpc-cni"
+)
+
+// Calico configures calico-node and its optional Typha deployment
+type Calico struct {
+	// PodCIDR is the IP pool pods are assigned addresses from, it mustn't
+	// overlap the VPC. Defaults to 192.168.0.0/16.
+	PodCIDR string `json:"podCIDR,omitempty"`
+	// TyphaReplicas runs Typha to fan out the datastore's watches to the
+	// calico-node pods, recommended above 50 nodes. Typha isn't run when 0.
+	TyphaReplicas int32 `json:"typhaReplicas,omitempty"`
+}
+
+// VPCCNI configures the Amazon VPC CNI's aws-node daemon
+type VPCCNI struct {
+	// Env overrides the aws-node container's environment to test IP
+	// allocation strategies, i.e. {"WARM_IP_TARGET": "5"} or
+	// {"ENABLE_PREFIX_DELEGATION": "true"}
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// EtcdBackup uploads snapshots of etcd to
+// s3://<bucket>/<namespace>/<name>/etcd-snapshots/<timestamp>.db, which can be
+// restored into a new control plane with EtcdRestore. The snapshots are
+// uploaded with the instance profile of the nodes the backup job runs on.
+type EtcdBackup struct {
+	// Schedule in cron format, i.e. "0 * * * *"
+	Schedule string `json:"schedule"`
+	Bucket   string `json:"bucket"`
+	// Region of the bucket, defaults to the region of the nodes
+	Region string `json:"region,omitempty"`
+	// Retention is the number of recent snapshots kept, defaults to 24
+	Retention int32 `json:"retention,omitempty"`
+}
+
+// EtcdRestore is a snapshot in S3 taken with etcdctl snapshot save, i.e. by
+// EtcdBackup. The etcd nodes download it with their instance profile.
+type EtcdRestore struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// Region of the bucket, defaults to the region of the etcd nodes
+	Region string `json:"region,omitempty"`
+}
+
+// Placement constrains the nodes pods are scheduled on
+type Placement struct {
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Affinity     *v1.Affinity      `json:"affinity,omitempty"`
+	Tolerations  []v1.Toleration   `json:"tolerations,omitempty"`
 }
 
 // MasterSpec provides a way for the user to configure master instances and
 // custom flags for components running on master nodes like apiserver, KCM and
 // scheduler.
 type MasterSpec struct {
-	Scheduler         *Component `json:"scheduler,omitempty"`
-	ControllerManager *Component `json:"controllerManager,omitempty"`
-	APIServer         *Component `json:"apiServer,omitempty"`
+	Scheduler         *Component       `json:"scheduler,omitempty"`
+	ControllerManager *Component       `json:"controllerManager,omitempty"`
+	APIServer         *Component       `json:"apiServer,omitempty"`
+	Endpoint          *Endpoint        `json:"endpoint,omitempty"`
+	APIServerConfig   *APIServerConfig `json:"apiServerConfig,omitempty"`
+	// APIServerPort is the port the API servers and the control plane
+	// Service listen on, defaults to 443. The API servers run on the host
+	// network, so the port must be free on the master nodes. Set at creation
+	// only.
+	APIServerPort int32 `json:"apiServerPort,omitempty"`
+}
+
+// APIServerConfig exposes API server settings that trade off API server memory
+// against etcd load. Unset fields use the API server defaults.
+type APIServerConfig struct {
+	Storage     *APIServerStorage     `json:"storage,omitempty"`
+	Tolerations *APIServerTolerations `json:"tolerations,omitempty"`
+}
+
+// APIServerStorage configures how the API server uses etcd
+type APIServerStorage struct {
+	// DefaultWatchCacheSize is the number of events cached per resource,
+	// rendered as --default-watch-cache-size, 0 disables the watch cache
+	DefaultWatchCacheSize *int32 `json:"defaultWatchCacheSize,omitempty"`
+	// CompactionInterval between the API server's etcd compactions, rendered as
+	// --etcd-compaction-interval, 0 disables compaction and unset leaves the
+	// API server's default of 5m.
+	// Compaction applies to the whole etcd keyspace, not the cluster's
+	// --etcd-prefix, so when tenants share an etcd each of their API servers
+	// compacts every tenant's history. Shared etcds should have compaction
+	// enabled for one tenant, or the interval lengthened, and disabled on the rest.
+	CompactionInterval *metav1.Duration `json:"compactionInterval,omitempty"`
+}
+
+// APIServerTolerations configures the tolerations added to pods by the
+// DefaultTolerationSeconds admission plugin, in whole seconds
+type APIServerTolerations struct {
+	// NotReady is rendered as --default-not-ready-toleration-seconds
+	NotReady *metav1.Duration `json:"notReady,omitempty"`
+	// Unreachable is rendered as --default-unreachable-toleration-seconds
+	Unreachable *metav1.Duration `json:"unreachable,omitempty"`
+}
+
+// EndpointAccess is where the API server endpoint can be reached from
+type EndpointAccess string
+
+const (
+	// EndpointAccessPublic exposes the API server with an internet-facing
+	// load balancer
+	EndpointAccessPublic EndpointAccess = "Public"
+	// EndpointAccessPrivate exposes the API server with an internal load
+	// balancer, only reachable from the VPC
+	EndpointAccessPrivate EndpointAccess = "Private"
+	// EndpointAccessPublicAndPrivate exposes the API server with an
+	// internet-facing load balancer and serves the Service's cluster DNS
+	// names, for clients in the substrate cluster
+	EndpointAccessPublicAndPrivate EndpointAccess = "PublicAndPrivate"
+)
+
+// Endpoint configures how the API server is exposed with an NLB Service. The
+// NLB passes TLS through, clients authenticate to the API server with their
+// certificates and verify it against the cluster CA. An ALB isn't supported as
+// it terminates TLS, so client certificates would never reach the API server.
+type Endpoint struct {
+	// ExternalTrafficPolicy of the NLB Service, defaults to Cluster. With
+	// Local, the NLB health checks the Service's healthCheckNodePort and only
+	// nodes running an API server pod receive traffic. Set at creation only.
+	// +kubebuilder:validation:Enum=Cluster;Local
+	ExternalTrafficPolicy v1.ServiceExternalTrafficPolicyType `json:"externalTrafficPolicy,omitempty"`
+	// ProxyProtocolV2 enables proxy protocol v2 on the NLB target group to
+	// preserve client IPs. The API server doesn't understand PPv2, so this
+	// breaks TLS unless the API server pods run behind a proxy that strips the
+	// header.
+	ProxyProtocolV2 bool `json:"proxyProtocolV2,omitempty"`
+	// Access sets the load balancer scheme, defaults to Public. Set at
+	// creation only.
+	// +kubebuilder:validation:Enum=Public;Private;PublicAndPrivate
+	Access EndpointAccess `json:"access,omitempty"`
+	// DeletionProtection enables deletion protection on the NLB, so it isn't
+	// deleted with the Service until protection is turned off. Protection is
+	// turned off when the control plane is deleted.
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
 }
 
 // Component provides a generic way to pass in args and images to master and etcd
@@ -64,6 +278,113 @@ type Component struct {
 	Spec     *v1.PodSpec `json:"spec,omitempty"`
 }
 
+// KubeProxy configures the kube-proxy daemonset running in the guest cluster.
+// Unset conntrack timeouts use the kube-proxy defaults.
+type KubeProxy struct {
+	// ConntrackTCPTimeoutEstablished is the idle timeout for established TCP connections
+	ConntrackTCPTimeoutEstablished *metav1.Duration `json:"conntrackTCPTimeoutEstablished,omitempty"`
+	// ConntrackTCPTimeoutCloseWait is the timeout for TCP connections in the CLOSE_WAIT state
+	ConntrackTCPTimeoutCloseWait *metav1.Duration `json:"conntrackTCPTimeoutCloseWait,omitempty"`
+	// Resources of the kube-proxy container, the CPU request defaults to 100m
+	Resources *v1.ResourceRequirements `json:"resources,omitempty"`
+	// ExtraArgs are kube-proxy flags keyed by name without the leading dashes,
+	// i.e. {"proxy-mode": "ipvs"}, they take precedence over the defaults
+	ExtraArgs map[string]string `json:"extraArgs,omitempty"`
+	// ProjectedToken authenticates kube-proxy with a bound service account
+	// token from a projected volume, instead of the legacy auto-mounted token
+	ProjectedToken *ProjectedToken `json:"projectedToken,omitempty"`
+	// Tolerations are added to the default tolerations of the standard
+	// node.kubernetes.io taints and the control plane taint
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+	// TolerateAllTaints runs kube-proxy on every node regardless of its
+	// taints, the behavior before the tolerations were narrowed
+	TolerateAllTaints bool `json:"tolerateAllTaints,omitempty"`
+}
+
+// ProjectedToken is a service account token the kubelet requests and rotates
+// for the pod, bound to the pod's lifetime and the audience
+type ProjectedToken struct {
+	// Audience of the token, one of the API server's --api-audiences, defaults
+	// to the API server's audience
+	Audience string `json:"audience,omitempty"`
+	// ExpirationSeconds of the token, at least 600, defaults to 3600
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
+}
+
+// EtcdMonitoring configures collection of the etcd database size, which is
+// reported as a metric and the EtcdDBSizeHealthy condition.
+type EtcdMonitoring struct {
+	// Disabled turns off collecting the etcd database size
+	Disabled bool `json:"disabled,omitempty"`
+	// DBSizeThresholdPercent of the backend quota at which the database size is
+	// reported as unhealthy, defaults to 80
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	DBSizeThresholdPercent int `json:"dbSizeThresholdPercent,omitempty"`
+}
+
+// EtcdDefrag schedules defragmentation of the etcd members, which releases the
+// space freed by compaction. Members are defragmented one at a time.
+type EtcdDefrag struct {
+	// Schedule in cron format, i.e. "0 */6 * * *"
+	Schedule string `json:"schedule"`
+}
+
+// DryRunAnnotationKey set to "true" on a ControlPlane reconciles it without
+// writing any objects, the changes that would be made are reported instead
+var DryRunAnnotationKey = SchemeGroupVersion.Group + "/dry-run"
+
+// FinalizeTimeout for each component's cleanup, see ControlPlaneSpec.FinalizeTimeout
+func (c *ControlPlane) FinalizeTimeout() time.Duration {
+	if c.Spec.FinalizeTimeout == nil {
+		return DefaultFinalizeTimeout
+	}
+	return c.Spec.FinalizeTimeout.Duration
+}
+
+// APIServerPort returns the API server port, defaulting to 443
+func (c *ControlPlane) APIServerPort() int32 {
+	if c.Spec.Master.APIServerPort == 0 {
+		return DefaultAPIServerPort
+	}
+	return c.Spec.Master.APIServerPort
+}
+
+// APIAudiences returns the audiences the API server accepts tokens for, the
+// --api-audiences of the API server's spec, defaulting to the service account
+// issuer as the API server does
+func (c *ControlPlane) APIAudiences() []string {
+	if apiServer := c.Spec.Master.APIServer; apiServer != nil && apiServer.Spec != nil {
+		for _, container := range apiServer.Spec.Containers {
+			for _, arg := range container.Args {
+				if strings.HasPrefix(arg, "--api-audiences=") {
+					return strings.Split(strings.TrimPrefix(arg, "--api-audiences="), ",")
+				}
+			}
+		}
+	}
+	return []string{ServiceAccountIssuer}
+}
+
+// FeatureGatesFlag returns the --feature-gates flag shared by the control plane
+// components and kubelets, sorted so it's stable across reconciles, or an
+// empty string when no gates are set
+func (c *ControlPlane) FeatureGatesFlag() string {
+	if len(c.Spec.FeatureGates) == 0 {
+		return ""
+	}
+	gates := []string{}
+	for gate, enabled := range c.Spec.FeatureGates {
+		gates = append(gates, gate+"="+strconv.FormatBool(enabled))
+	}
+	sort.Strings(gates)
+	return "--feature-gates=" + strings.Join(gates, ",")
+}
+
 func (c *ControlPlane) ClusterName() string {
 	return c.Name
 }
+
+func (c *ControlPlane) IsDryRun() bool {
+	return c.Annotations[DryRunAnnotationKey] == "true"
+}
@@ -16,8 +16,22 @@ package v1alpha1
 
 import (
 	"context"
+	"time"
 
 	"github.com/awslabs/kit/operator/pkg/apis/config"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	DefaultDBSizeThresholdPercent = 80
+	DefaultFinalizeTimeout        = 10 * time.Minute
+	DefaultAPIServerPort          = int32(443)
+	DefaultEtcdBackupRetention    = int32(24)
+	// DefaultCalicoPodCIDR is calico's default IP pool
+	DefaultCalicoPodCIDR = "192.168.0.0/16"
+	// ServiceAccountIssuer of the API server, it's also the API server's
+	// audience unless the spec sets --api-audiences
+	ServiceAccountIssuer = "https://kubernetes.default.svc.cluster.local"
 )
 
 // SetDefaults for the ControlPlane, this gets called by the kit-webhook pod
@@ -44,6 +58,18 @@ func (s ControlPlaneSpec) SetMasterDefaults() ControlPlaneSpec {
 	if s.Master.APIServer.Replicas == 0 {
 		s.Master.APIServer.Replicas = 1
 	}
+	if s.Master.APIServerPort == 0 {
+		s.Master.APIServerPort = DefaultAPIServerPort
+	}
+	if s.Master.Endpoint == nil {
+		s.Master.Endpoint = &Endpoint{}
+	}
+	if s.Master.Endpoint.ExternalTrafficPolicy == "" {
+		s.Master.Endpoint.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeCluster
+	}
+	if s.Master.Endpoint.Access == "" {
+		s.Master.Endpoint.Access = EndpointAccessPublic
+	}
 	return s
 }
 
@@ -55,5 +81,11 @@ func (s ControlPlaneSpec) SetEtcdDefaults() ControlPlaneSpec {
 	if s.Etcd.Replicas == 0 {
 		s.Etcd.Replicas = 3
 	}
+	if s.EtcdMonitoring == nil {
+		s.EtcdMonitoring = &EtcdMonitoring{}
+	}
+	if s.EtcdMonitoring.DBSizeThresholdPercent == 0 {
+		s.EtcdMonitoring.DBSizeThresholdPercent = DefaultDBSizeThresholdPercent
+	}
 	return s
 }
@@ -16,11 +16,385 @@ package v1alpha1
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"knative.dev/pkg/apis"
 )
 
+// MaxClusterNameLength keeps the names of the resources derived from the
+// cluster name within the DNS label limit, the longest derived name being
+// <name>-kube-controller-manager-config
+const MaxClusterNameLength = validation.DNS1123LabelMaxLength - len("-kube-controller-manager-config")
+
 func (c *ControlPlane) Validate(ctx context.Context) (errs *apis.FieldError) {
-	// TODO
+	return c.validateName().Also(errs.Also(
+		validateImageRegistry(c.Spec.ImageRegistry),
+		c.Spec.Master.Endpoint.validate().ViaField("master"),
+		c.Spec.Master.APIServerConfig.validate().ViaField("master", "apiServerConfig"),
+		validateAPIServerPort(c.Spec.Master.APIServerPort).ViaField("master"),
+		c.Spec.KubeProxy.validate().ViaField("kubeProxy"),
+		c.validateProjectedTokenAudience(),
+		c.Spec.validateEtcdReplicas(),
+		c.Spec.EtcdMonitoring.validate().ViaField("etcdMonitoring"),
+		c.Spec.EtcdDefrag.validate().ViaField("etcdDefrag"),
+		c.Spec.EtcdBackup.validate().ViaField("etcdBackup"),
+		c.Spec.EtcdRestore.validate().ViaField("etcdRestore"),
+		c.Spec.Bootstrap.validate().ViaField("bootstrap"),
+		c.Spec.Addons.validate().ViaField("addons"),
+		c.validateFinalizeTimeout(),
+		c.validateFeatureGates(),
+	).ViaField("spec"))
+}
+
+func (c *ControlPlane) validateName() *apis.FieldError {
+	if len(c.ClusterName()) <= MaxClusterNameLength {
+		return nil
+	}
+	err := apis.ErrInvalidValue(c.ClusterName(), "metadata.name")
+	err.Details = fmt.Sprintf("must be no more than %d characters", MaxClusterNameLength)
+	return err
+}
+
+var featureGatePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// validateFeatureGates checks the gate names. A --feature-gates arg in a
+// component's spec would replace the shared gates for that component alone, so
+// it's rejected when the gates are set.
+func (c *ControlPlane) validateFeatureGates() (errs *apis.FieldError) {
+	for gate := range c.Spec.FeatureGates {
+		if !featureGatePattern.MatchString(gate) {
+			errs = errs.Also(apis.ErrInvalidKeyName(gate, "featureGates", "must be an alphanumeric feature gate name, i.e. APIListChunking"))
+		}
+	}
+	if len(c.Spec.FeatureGates) == 0 {
+		return errs
+	}
+	for field, component := range map[string]*Component{
+		"apiServer":         c.Spec.Master.APIServer,
+		"controllerManager": c.Spec.Master.ControllerManager,
+		"scheduler":         c.Spec.Master.Scheduler,
+	} {
+		if component == nil || component.Spec == nil {
+			continue
+		}
+		for i, container := range component.Spec.Containers {
+			for _, arg := range container.Args {
+				if strings.HasPrefix(arg, "--feature-gates=") {
+					err := apis.ErrInvalidValue(arg, "args")
+					err.Details = "conflicts with featureGates, set the gates there instead"
+					errs = errs.Also(err.ViaFieldIndex("containers", i).ViaField("master", field, "spec"))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func (c *ControlPlane) validateFinalizeTimeout() *apis.FieldError {
+	if c.Spec.FinalizeTimeout == nil || c.Spec.FinalizeTimeout.Duration > 0 {
+		return nil
+	}
+	return apis.ErrInvalidValue(c.Spec.FinalizeTimeout.Duration.String(), "finalizeTimeout")
+}
+
+func (b *Bootstrap) validate() (errs *apis.FieldError) {
+	if b == nil {
+		return nil
+	}
+	names := sets.NewString()
+	for i, namespace := range b.Namespaces {
+		if namespace.Name == "" {
+			errs = errs.Also(apis.ErrMissingField("name").ViaFieldIndex("namespaces", i))
+		} else if msgs := validation.IsDNS1123Label(namespace.Name); len(msgs) > 0 {
+			errs = errs.Also(apis.ErrInvalidValue(namespace.Name, "name").ViaFieldIndex("namespaces", i))
+		} else if names.Has(namespace.Name) {
+			errs = errs.Also(apis.ErrMultipleOneOf("name").ViaFieldIndex("namespaces", i))
+		}
+		names.Insert(namespace.Name)
+		errs = errs.Also(validateQuantities(namespace.ResourceQuota).ViaField("resourceQuota").ViaFieldIndex("namespaces", i))
+		if limitRange := namespace.LimitRange; limitRange != nil {
+			for field, quantities := range map[string]map[string]string{
+				"default":        limitRange.Default,
+				"defaultRequest": limitRange.DefaultRequest,
+				"max":            limitRange.Max,
+				"min":            limitRange.Min,
+			} {
+				errs = errs.Also(validateQuantities(quantities).ViaField("limitRange", field).ViaFieldIndex("namespaces", i))
+			}
+		}
+	}
+	return errs
+}
+
+// validateImageRegistry for registries prefixed to image repositories, which
+// don't have a scheme, tag or digest
+func validateImageRegistry(registry string) *apis.FieldError {
+	if strings.ContainsAny(registry, "@ \t") || strings.Contains(registry, "://") {
+		return apis.ErrInvalidValue(registry, "imageRegistry")
+	}
 	return nil
 }
+
+func (a *Addons) validate() (errs *apis.FieldError) {
+	if a == nil {
+		return nil
+	}
+	if a.ReadinessTimeout != nil && a.ReadinessTimeout.Duration <= 0 {
+		errs = errs.Also(apis.ErrInvalidValue(a.ReadinessTimeout.Duration.String(), "readinessTimeout"))
+	}
+	if a.CNI != "" && a.CNI != CNIPluginCalico && a.CNI != CNIPluginVPCCNI {
+		errs = errs.Also(apis.ErrInvalidValue(a.CNI, "cni"))
+	}
+	return errs.Also(
+		a.Calico.validate().ViaField("calico"),
+		a.VPCCNI.validate().ViaField("vpcCNI"),
+	)
+}
+
+func (v *VPCCNI) validate() (errs *apis.FieldError) {
+	if v == nil {
+		return nil
+	}
+	for name := range v.Env {
+		for _, msg := range validation.IsEnvVarName(name) {
+			errs = errs.Also(apis.ErrInvalidKeyName(name, "env", msg))
+		}
+		if name == "MY_NODE_NAME" {
+			errs = errs.Also(apis.ErrInvalidKeyName(name, "env", "is set to the pod's node name"))
+		}
+	}
+	return errs
+}
+
+func (c *Calico) validate() (errs *apis.FieldError) {
+	if c == nil {
+		return nil
+	}
+	if c.PodCIDR != "" {
+		if ip, _, err := net.ParseCIDR(c.PodCIDR); err != nil || ip.To4() == nil {
+			errs = errs.Also(apis.ErrInvalidValue(c.PodCIDR, "podCIDR"))
+		}
+	}
+	if c.TyphaReplicas < 0 {
+		errs = errs.Also(apis.ErrInvalidValue(c.TyphaReplicas, "typhaReplicas"))
+	}
+	return errs
+}
+
+func validateQuantities(quantities map[string]string) (errs *apis.FieldError) {
+	for name, quantity := range quantities {
+		if _, err := resource.ParseQuantity(quantity); err != nil {
+			errs = errs.Also(apis.ErrInvalidValue(quantity, name))
+		}
+	}
+	return errs
+}
+
+func (e *EtcdDefrag) validate() *apis.FieldError {
+	if e == nil {
+		return nil
+	}
+	return validateSchedule(e.Schedule)
+}
+
+func (e *EtcdBackup) validate() (errs *apis.FieldError) {
+	if e == nil {
+		return nil
+	}
+	if e.Bucket == "" {
+		errs = errs.Also(apis.ErrMissingField("bucket"))
+	}
+	if e.Retention < 0 {
+		errs = errs.Also(apis.ErrInvalidValue(e.Retention, "retention"))
+	}
+	return errs.Also(validateSchedule(e.Schedule))
+}
+
+func validateSchedule(schedule string) *apis.FieldError {
+	if schedule == "" {
+		return apis.ErrMissingField("schedule")
+	}
+	// Schedules are parsed by the CronJob controller, catch the obvious mistakes here
+	if fields := strings.Fields(schedule); !strings.HasPrefix(schedule, "@") && len(fields) != 5 {
+		return apis.ErrInvalidValue(schedule, "schedule")
+	}
+	return nil
+}
+
+// validateEtcdReplicas for an odd number of members, an even member adds to
+// the quorum size without tolerating another failure
+func (s *ControlPlaneSpec) validateEtcdReplicas() *apis.FieldError {
+	if s.Etcd == nil || s.Etcd.Replicas == 0 || (s.Etcd.Replicas > 0 && s.Etcd.Replicas%2 == 1) {
+		return nil
+	}
+	err := apis.ErrInvalidValue(s.Etcd.Replicas, "replicas").ViaField("etcd")
+	err.Details = "etcd replicas must be a positive odd number"
+	return err
+}
+
+func (e *EtcdRestore) validate() (errs *apis.FieldError) {
+	if e == nil {
+		return nil
+	}
+	if e.Bucket == "" {
+		errs = errs.Also(apis.ErrMissingField("bucket"))
+	}
+	if e.Key == "" {
+		errs = errs.Also(apis.ErrMissingField("key"))
+	}
+	return errs
+}
+
+func (e *EtcdMonitoring) validate() *apis.FieldError {
+	if e == nil {
+		return nil
+	}
+	if e.DBSizeThresholdPercent < 0 || e.DBSizeThresholdPercent > 100 {
+		return apis.ErrOutOfBoundsValue(e.DBSizeThresholdPercent, 0, 100, "dbSizeThresholdPercent")
+	}
+	return nil
+}
+
+func validateAPIServerPort(port int32) *apis.FieldError {
+	if port < 0 || port > 65535 {
+		return apis.ErrOutOfBoundsValue(port, 1, 65535, "apiServerPort")
+	}
+	return nil
+}
+
+func (a *APIServerConfig) validate() (errs *apis.FieldError) {
+	if a == nil {
+		return nil
+	}
+	if storage := a.Storage; storage != nil {
+		if storage.DefaultWatchCacheSize != nil && *storage.DefaultWatchCacheSize < 0 {
+			errs = errs.Also(apis.ErrInvalidValue(*storage.DefaultWatchCacheSize, "defaultWatchCacheSize").ViaField("storage"))
+		}
+		if storage.CompactionInterval != nil && storage.CompactionInterval.Duration < 0 {
+			errs = errs.Also(apis.ErrInvalidValue(storage.CompactionInterval.Duration.String(), "compactionInterval").ViaField("storage"))
+		}
+	}
+	if tolerations := a.Tolerations; tolerations != nil {
+		for field, toleration := range map[string]*metav1.Duration{
+			"notReady":    tolerations.NotReady,
+			"unreachable": tolerations.Unreachable,
+		} {
+			if toleration != nil && toleration.Duration < 0 {
+				errs = errs.Also(apis.ErrInvalidValue(toleration.Duration.String(), field).ViaField("tolerations"))
+			}
+			errs = errs.Also(validateWholeSeconds(toleration, field).ViaField("tolerations"))
+		}
+	}
+	return errs
+}
+
+// validateWholeSeconds for durations rendered as flags in seconds
+func validateWholeSeconds(duration *metav1.Duration, field string) *apis.FieldError {
+	if duration == nil || duration.Duration%time.Second == 0 {
+		return nil
+	}
+	err := apis.ErrInvalidValue(duration.Duration.String(), field)
+	err.Details = "must be a whole number of seconds"
+	return err
+}
+
+func (k *KubeProxy) validate() (errs *apis.FieldError) {
+	if k == nil {
+		return nil
+	}
+	for field, timeout := range map[string]*metav1.Duration{
+		"conntrackTCPTimeoutEstablished": k.ConntrackTCPTimeoutEstablished,
+		"conntrackTCPTimeoutCloseWait":   k.ConntrackTCPTimeoutCloseWait,
+	} {
+		if timeout != nil && timeout.Duration < 0 {
+			errs = errs.Also(apis.ErrInvalidValue(timeout.Duration.String(), field))
+		}
+	}
+	if k.Resources != nil {
+		for name, request := range k.Resources.Requests {
+			if limit, ok := k.Resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+				err := apis.ErrInvalidValue(request.String(), string(name))
+				err.Details = fmt.Sprintf("must be less than or equal to the limit %s", limit.String())
+				errs = errs.Also(err.ViaField("resources", "requests"))
+			}
+		}
+	}
+	for flag := range k.ExtraArgs {
+		if flag == "" || strings.HasPrefix(flag, "-") || strings.ContainsAny(flag, "= ") {
+			errs = errs.Also(apis.ErrInvalidKeyName(flag, "extraArgs", "must be a flag name without leading dashes"))
+		}
+	}
+	if address, ok := k.ExtraArgs["healthz-bind-address"]; ok {
+		errs = errs.Also(validateHealthzBindAddress(address).ViaKey("healthz-bind-address").ViaField("extraArgs"))
+	}
+	if k.ProjectedToken != nil && k.ProjectedToken.ExpirationSeconds != nil && *k.ProjectedToken.ExpirationSeconds < 600 {
+		err := apis.ErrInvalidValue(*k.ProjectedToken.ExpirationSeconds, "expirationSeconds")
+		err.Details = "must be at least 600"
+		errs = errs.Also(err.ViaField("projectedToken"))
+	}
+	return errs
+}
+
+// validateHealthzBindAddress checks kube-proxy's healthz server can be probed,
+// the kubelet probes the node's address, so the server can't listen on
+// loopback, and port 0 disables it
+func validateHealthzBindAddress(address string) *apis.FieldError {
+	details := ""
+	if host, port, err := net.SplitHostPort(address); err != nil {
+		details = "must be an address and port, i.e. 0.0.0.0:10256"
+	} else if ip := net.ParseIP(host); host != "" && (ip == nil || ip.IsLoopback()) {
+		details = "must listen on all or a non-loopback address for the probes"
+	} else if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		details = "must have a port between 1 and 65535 for the probes"
+	}
+	if details == "" {
+		return nil
+	}
+	err := apis.ErrInvalidValue(address, apis.CurrentField)
+	err.Details = details
+	return err
+}
+
+// validateProjectedTokenAudience against the API server's audiences, the API
+// server rejects tokens for any other audience
+func (c *ControlPlane) validateProjectedTokenAudience() *apis.FieldError {
+	if c.Spec.KubeProxy == nil || c.Spec.KubeProxy.ProjectedToken == nil || c.Spec.KubeProxy.ProjectedToken.Audience == "" {
+		return nil
+	}
+	audience := c.Spec.KubeProxy.ProjectedToken.Audience
+	for _, apiAudience := range c.APIAudiences() {
+		if audience == apiAudience {
+			return nil
+		}
+	}
+	err := apis.ErrInvalidValue(audience, "audience")
+	err.Details = fmt.Sprintf("must be one of the API server's --api-audiences %v", c.APIAudiences())
+	return err.ViaField("kubeProxy", "projectedToken")
+}
+
+func (e *Endpoint) validate() *apis.FieldError {
+	if e == nil {
+		return nil
+	}
+	switch e.ExternalTrafficPolicy {
+	case "", v1.ServiceExternalTrafficPolicyTypeCluster, v1.ServiceExternalTrafficPolicyTypeLocal:
+	default:
+		return apis.ErrInvalidValue(e.ExternalTrafficPolicy, "externalTrafficPolicy").ViaField("endpoint")
+	}
+	switch e.Access {
+	case "", EndpointAccessPublic, EndpointAccessPrivate, EndpointAccessPublicAndPrivate:
+		return nil
+	default:
+		return apis.ErrInvalidValue(e.Access, "access").ViaField("endpoint")
+	}
+}
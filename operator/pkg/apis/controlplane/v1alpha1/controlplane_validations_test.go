@@ -0,0 +1,113 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCNIValidation(t *testing.T) {
+	ctx := context.Background()
+	for name, addons := range map[string]*Addons{
+		"unknown plugin":        {CNI: "flannel"},
+		"invalid cidr":          {CNI: CNIPluginCalico, Calico: &Calico{PodCIDR: "192.168.0.0"}},
+		"ipv6 cidr":             {CNI: CNIPluginCalico, Calico: &Calico{PodCIDR: "fd00::/64"}},
+		"negative typha":        {CNI: CNIPluginCalico, Calico: &Calico{TyphaReplicas: -1}},
+		"invalid env name":      {CNI: CNIPluginVPCCNI, VPCCNI: &VPCCNI{Env: map[string]string{"1WARM_IP_TARGET": "1"}}},
+		"env name with a space": {CNI: CNIPluginVPCCNI, VPCCNI: &VPCCNI{Env: map[string]string{"WARM IP TARGET": "1"}}},
+		"node name env":         {CNI: CNIPluginVPCCNI, VPCCNI: &VPCCNI{Env: map[string]string{"MY_NODE_NAME": "1"}}},
+	} {
+		controlPlane := &ControlPlane{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+			Spec:       ControlPlaneSpec{Addons: addons},
+		}
+		if err := controlPlane.Validate(ctx); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+	controlPlane := &ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: ControlPlaneSpec{Addons: &Addons{
+			CNI:    CNIPluginVPCCNI,
+			VPCCNI: &VPCCNI{Env: map[string]string{"WARM_IP_TARGET": "5"}},
+		}},
+	}
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Errorf("expected the vpc cni to be valid, got %v", err)
+	}
+}
+
+func TestEtcdBackupValidation(t *testing.T) {
+	ctx := context.Background()
+	for name, backup := range map[string]*EtcdBackup{
+		"missing bucket":     {Schedule: "0 * * * *"},
+		"missing schedule":   {Bucket: "test-bucket"},
+		"invalid schedule":   {Schedule: "hourly", Bucket: "test-bucket"},
+		"negative retention": {Schedule: "0 * * * *", Bucket: "test-bucket", Retention: -1},
+	} {
+		controlPlane := &ControlPlane{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+			Spec:       ControlPlaneSpec{EtcdBackup: backup},
+		}
+		if err := controlPlane.Validate(ctx); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+}
+
+func TestProjectedTokenAudienceValidation(t *testing.T) {
+	ctx := context.Background()
+	controlPlane := &ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"},
+		Spec:       ControlPlaneSpec{KubeProxy: &KubeProxy{ProjectedToken: &ProjectedToken{Audience: ServiceAccountIssuer}}},
+	}
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Errorf("expected the service account issuer audience to be valid, got %v", err)
+	}
+	// The API server only accepts tokens for its own audiences
+	controlPlane.Spec.KubeProxy.ProjectedToken.Audience = "kube-proxy"
+	if err := controlPlane.Validate(ctx); err == nil {
+		t.Errorf("expected an audience the API server doesn't accept to fail validation")
+	}
+	controlPlane.Spec.Master.APIServer = &Component{Spec: &v1.PodSpec{Containers: []v1.Container{{
+		Name: "apiserver",
+		Args: []string{"--api-audiences=kube-proxy," + ServiceAccountIssuer},
+	}}}}
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Errorf("expected an audience in --api-audiences to be valid, got %v", err)
+	}
+}
+
+func TestKubeProxyHealthzBindAddressValidation(t *testing.T) {
+	ctx := context.Background()
+	controlPlane := &ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	for _, address := range []string{"0.0.0.0:10356", ":10356", "10.0.0.1:10256"} {
+		controlPlane.Spec.KubeProxy = &KubeProxy{ExtraArgs: map[string]string{"healthz-bind-address": address}}
+		if err := controlPlane.Validate(ctx); err != nil {
+			t.Errorf("expected healthz-bind-address %s to be valid, %v", address, err)
+		}
+	}
+	// The kubelet can't probe kube-proxy on loopback or without a healthz server
+	for _, address := range []string{"127.0.0.1:10256", "[::1]:10256", "0.0.0.0:0", "0.0.0.0", "localhost:10256", "0.0.0.0:65536"} {
+		controlPlane.Spec.KubeProxy = &KubeProxy{ExtraArgs: map[string]string{"healthz-bind-address": address}}
+		if err := controlPlane.Validate(ctx); err == nil {
+			t.Errorf("expected healthz-bind-address %s to fail validation", address)
+		}
+	}
+}
@@ -50,6 +50,29 @@ const (
 	// controller is able to take actions: it's correctly configured, can make
 	// necessary API calls, and isn't disabled.
 	Active apis.ConditionType = "Active"
+	// EtcdDBSizeHealthy is false when the etcd database size is within the
+	// configured threshold of the backend quota. It is informational and does
+	// not affect readiness of the ControlPlane.
+	EtcdDBSizeHealthy apis.ConditionType = "EtcdDBSizeHealthy"
+	// EndpointReady is false when the control plane Service has had no ready
+	// endpoints for longer than a grace period, usually because the API server
+	// pods don't match the Service selector. It does not affect readiness of
+	// the ControlPlane.
+	EndpointReady apis.ConditionType = "EndpointReady"
+	// DryRun is true while the ControlPlane is annotated for dry-run, its
+	// message lists the changes the last reconcile would have made.
+	DryRun apis.ConditionType = "DryRun"
+	// AddonsProgressing is true while waiting for the add-on rollouts to be
+	// ready, and false once they haven't been ready within the readiness
+	// timeout. It's removed when they're ready.
+	AddonsProgressing apis.ConditionType = "AddonsProgressing"
+	// Finalizing is false when a finalizer hasn't completed within the
+	// finalize timeout, its message names the stalled finalizer
+	Finalizing apis.ConditionType = "Finalizing"
+	// EtcdRestored is unknown while etcd is restored from spec.etcdRestore and
+	// true once every member is running from the snapshot. It's false when the
+	// restore failed, or when etcd already existed and wasn't restored.
+	EtcdRestored apis.ConditionType = "EtcdRestored"
 )
 
 func init() {
@@ -15,6 +15,7 @@ limitations under the License.
 package awsprovider
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -27,6 +28,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
@@ -92,6 +95,47 @@ func IAMClient(sess *session.Session) *IAM {
 	return &IAM{IAM: iam.New(sess)}
 }
 
+// LoadBalancerAttributes reads the attributes of the load balancer serving a
+// DNS name, nil if there's no such load balancer
+type LoadBalancerAttributes interface {
+	Attributes(ctx context.Context, dnsName string) (map[string]string, error)
+}
+
+type ELBV2 struct {
+	elbv2iface.ELBV2API
+}
+
+func ELBV2Client(sess *session.Session) *ELBV2 {
+	return &ELBV2{ELBV2API: elbv2.New(sess)}
+}
+
+func (e *ELBV2) Attributes(ctx context.Context, dnsName string) (map[string]string, error) {
+	var arn *string
+	if err := e.DescribeLoadBalancersPagesWithContext(ctx, &elbv2.DescribeLoadBalancersInput{}, func(page *elbv2.DescribeLoadBalancersOutput, _ bool) bool {
+		for _, loadBalancer := range page.LoadBalancers {
+			if aws.StringValue(loadBalancer.DNSName) == dnsName {
+				arn = loadBalancer.LoadBalancerArn
+				return false
+			}
+		}
+		return true
+	}); err != nil {
+		return nil, fmt.Errorf("describing load balancers, %w", err)
+	}
+	if arn == nil {
+		return nil, nil
+	}
+	output, err := e.DescribeLoadBalancerAttributesWithContext(ctx, &elbv2.DescribeLoadBalancerAttributesInput{LoadBalancerArn: arn})
+	if err != nil {
+		return nil, fmt.Errorf("describing load balancer attributes, %w", err)
+	}
+	attributes := map[string]string{}
+	for _, attribute := range output.Attributes {
+		attributes[aws.StringValue(attribute.Key)] = aws.StringValue(attribute.Value)
+	}
+	return attributes, nil
+}
+
 type AccountMetadata interface {
 	ID() (string, error)
 }
@@ -18,6 +18,8 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -99,6 +101,10 @@ func (c *Controller) createLaunchTemplate(ctx context.Context, dataplane *v1alph
 	if err != nil {
 		return fmt.Errorf("getting cluster endpoint, %w", err)
 	}
+	controlPlane, err := c.controlPlaneFor(ctx, dataplane)
+	if err != nil {
+		return err
+	}
 	caSecret, err := keypairs.Reconciler(c.kubeclient).GetSecretFromServer(ctx,
 		object.NamespacedName(master.RootCASecretNameFor(dataplane.Spec.ClusterName), dataplane.Namespace))
 	if err != nil {
@@ -128,7 +134,8 @@ func (c *Controller) createLaunchTemplate(ctx context.Context, dataplane *v1alph
 			Monitoring:       &ec2.LaunchTemplatesMonitoringRequest{Enabled: ptr.Bool(true)},
 			SecurityGroupIds: []*string{ptr.String(securityGroupID)},
 			UserData: ptr.String(base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(userData,
-				dataplane.Spec.ClusterName, dnsClusterIP, base64.StdEncoding.EncodeToString(clusterCA), clusterEndpoint)))),
+				dataplane.Spec.ClusterName, dnsClusterIP, kubeletFeatureGates(controlPlane), base64.StdEncoding.EncodeToString(clusterCA),
+				net.JoinHostPort(clusterEndpoint, strconv.Itoa(int(controlPlane.APIServerPort()))))))),
 		},
 		LaunchTemplateName: ptr.String(TemplateName(dataplane.Spec.ClusterName)),
 		TagSpecifications:  generateEC2Tags("launch-template", dataplane.Spec.ClusterName),
@@ -154,11 +161,19 @@ func (c *Controller) amiID(ctx context.Context, dataplane *v1alpha1.DataPlane) (
 }
 
 func (c *Controller) desiredKubernetesVersion(ctx context.Context, dataplane *v1alpha1.DataPlane) (string, error) {
+	cp, err := c.controlPlaneFor(ctx, dataplane)
+	if err != nil {
+		return "", err
+	}
+	return cp.Spec.KubernetesVersion, nil
+}
+
+func (c *Controller) controlPlaneFor(ctx context.Context, dataplane *v1alpha1.DataPlane) (*cpv1alpha1.ControlPlane, error) {
 	cp := &cpv1alpha1.ControlPlane{}
 	if err := c.kubeclient.Get(ctx, types.NamespacedName{dataplane.GetNamespace(), dataplane.Spec.ClusterName}, cp); err != nil {
-		return "", fmt.Errorf("getting control plane object, %w", err)
+		return nil, fmt.Errorf("getting control plane object, %w", err)
 	}
-	return cp.Spec.KubernetesVersion, nil
+	return cp, nil
 }
 
 func (c *Controller) getLaunchTemplates(ctx context.Context, clusterName string) ([]*ec2.LaunchTemplate, error) {
@@ -199,6 +214,15 @@ func generateEC2Tags(svcName, clusterName string) []*ec2.TagSpecification {
 	}}
 }
 
+// kubeletFeatureGates are appended to the kubelet's extra args so the nodes
+// share the control plane's feature gates
+func kubeletFeatureGates(controlPlane *cpv1alpha1.ControlPlane) string {
+	if flag := controlPlane.FeatureGatesFlag(); flag != "" {
+		return " " + flag
+	}
+	return ""
+}
+
 func TemplateName(clusterName string) string {
 	return fmt.Sprintf("kit-%s-cluster-nodes", clusterName)
 }
@@ -209,7 +233,7 @@ var (
 yum install -y https://s3.amazonaws.com/ec2-downloads-windows/SSMAgent/latest/linux_amd64/amazon-ssm-agent.rpm
 /etc/eks/bootstrap.sh %s \
     --dns-cluster-ip %s \
-	--kubelet-extra-args '--node-labels=kit.sh/provisioned=true' \
+	--kubelet-extra-args '--node-labels=kit.sh/provisioned=true%s' \
 	--b64-cluster-ca %s \
 	--apiserver-endpoint https://%s`
 )
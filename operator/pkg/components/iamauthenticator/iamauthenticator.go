@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"strings"
 
 	"github.com/awslabs/kit/operator/pkg/utils/imageprovider"
 	v1 "k8s.io/api/core/v1"
@@ -50,6 +51,29 @@ func Config(ctx context.Context, name, ns, instanceRole, accountID string) (*v1.
 
 type Options func(v1.PodTemplateSpec) v1.PodTemplateSpec
 
+// WithImageRegistry pulls the authenticator image from a registry mirroring
+// the EKS-D repositories
+func WithImageRegistry(registry string) Options {
+	return func(template v1.PodTemplateSpec) v1.PodTemplateSpec {
+		template.Spec.Containers[0].Image = imageprovider.AWSIamAuthenticator(registry)
+		return template
+	}
+}
+
+// WithAPIServerPort points the authenticator at the API server's port on the
+// node, the API server listens on 443 unless its port is configured
+func WithAPIServerPort(port int32) Options {
+	return func(template v1.PodTemplateSpec) v1.PodTemplateSpec {
+		args := template.Spec.Containers[0].Args
+		for i, arg := range args {
+			if strings.HasPrefix(arg, "--master=") {
+				args[i] = fmt.Sprintf("--master=https://localhost:%d/", port)
+			}
+		}
+		return template
+	}
+}
+
 func PodSpec(opts ...Options) v1.PodTemplateSpec {
 	podTemplateSpec := v1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{Name: "aws-iam-authenticator", Labels: Labels()},
@@ -73,7 +97,7 @@ func PodSpec(opts ...Options) v1.PodTemplateSpec {
 			}},
 			Containers: []v1.Container{{
 				Name:  "aws-iam-authenticator",
-				Image: imageprovider.AWSIamAuthenticator(),
+				Image: imageprovider.AWSIamAuthenticator(""),
 				Args: []string{
 					"server",
 					"--master=https://localhost/",
@@ -17,6 +17,8 @@ package addons
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 
 	"github.com/awslabs/kit/operator/pkg/apis/controlplane"
 	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
@@ -28,35 +30,52 @@ import (
 	"github.com/awslabs/kit/operator/pkg/utils/scheme"
 	"github.com/awslabs/kit/operator/pkg/utils/secrets"
 	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type Controller struct {
 	substrateClient *kubeprovider.Client
+	rollouts        *RolloutLimiter
 }
 
-func New(kubeClient *kubeprovider.Client) *Controller {
-	return &Controller{substrateClient: kubeClient}
+func New(kubeClient *kubeprovider.Client, rollouts *RolloutLimiter) *Controller {
+	return &Controller{substrateClient: kubeClient, rollouts: rollouts}
 }
 
 // Reconcile adds add-ons to the guest cluster provisioned
 func (c *Controller) Reconcile(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
-	guestClusterClient, err := c.createKubeClient(ctx, object.NamespacedName(
-		controlPlane.ClusterName(), controlPlane.Namespace))
+	nn := object.NamespacedName(controlPlane.ClusterName(), controlPlane.Namespace)
+	// The add-ons are only created once the API server is reachable, before
+	// that the reconcile is requeued without creating anything
+	if err := c.endpointReady(ctx, nn); err != nil {
+		return err
+	}
+	guestClusterClient, err := c.createKubeClient(ctx, nn)
 	if err != nil {
 		return err
 	}
 	// reconcile addons to the guest cluster
-	for _, resource := range []controlplane.Controller{
-		KubeProxyController(guestClusterClient, c.substrateClient),
-		CoreDNSController(guestClusterClient),
-	} {
-		if err := resource.Reconcile(ctx, controlPlane); err != nil {
-			return err
+	if err := c.withRolloutSlot(ctx, controlPlane, guestClusterClient, func(guestClusterClient *kubeprovider.Client) error {
+		for _, resource := range []controlplane.Controller{
+			KubeProxyController(guestClusterClient, c.substrateClient),
+			CNIController(guestClusterClient),
+			CoreDNSController(guestClusterClient),
+			NamespacesController(guestClusterClient),
+			ReadinessController(guestClusterClient),
+		} {
+			if err := resource.Reconcile(ctx, controlPlane); err != nil {
+				return err
+			}
 		}
+		return nil
+	}); err != nil {
+		return err
 	}
 	zap.S().Infof("[%v] Addons reconciled", controlPlane.ClusterName())
 	return nil
@@ -75,25 +94,89 @@ func (c *Controller) createKubeClient(ctx context.Context, nn types.NamespacedNa
 	if err != nil {
 		return nil, fmt.Errorf("creating rest config for new cluster, %w", err)
 	}
+	if err := apiServerHealthy(ctx, nn, restConfig); err != nil {
+		return nil, err
+	}
 	newClient, err := client.New(restConfig, client.Options{Scheme: scheme.GuestCluster})
 	if err != nil {
-		if errors.IsDNSLookUpNoSuchHost(err) {
-			return nil, fmt.Errorf("%v control plane endpoint not ready, lookup failed, %w", nn.Name, errors.WaitingForSubResources)
-		}
-		if errors.IsNetIOTimeOut(err) {
-			// This happens 1-2 times, but if it happens more we would want to know in the logs
-			zap.S().Errorf("Creating kubeclient, net i/o timed out for control plane %s endpoint", nn.Name)
-			return nil, fmt.Errorf("net i/o timeout for %v control plane endpoint, %w", nn.Name, errors.WaitingForSubResources)
-		}
-		if errors.IsConnectionRefused(err) {
-			zap.S().Errorf("Creating kubeclient, connection refused for control plane %s endpoint", nn.Name)
-			return nil, fmt.Errorf("connection refused %v control plane endpoint, %w", nn.Name, errors.WaitingForSubResources)
+		if notReady := endpointNotReady(nn, err); notReady != nil {
+			return nil, notReady
 		}
 		return nil, fmt.Errorf("creating kubeclient for new cluster, %w", err)
 	}
 	return kubeprovider.New(newClient), nil
 }
 
-func (c *Controller) Finalize(_ context.Context, _ *v1alpha1.ControlPlane) (err error) {
+// endpointReady checks the control plane endpoint has been assigned to the
+// load balancer and its hostname resolves, the add-ons can't be reached before
+func (c *Controller) endpointReady(ctx context.Context, nn types.NamespacedName) error {
+	endpoint, err := master.GetClusterEndpoint(ctx, c.substrateClient, nn)
+	if err != nil {
+		return fmt.Errorf("getting %v control plane endpoint, %w", nn.Name, err)
+	}
+	if net.ParseIP(endpoint) != nil {
+		return nil
+	}
+	if _, err := net.DefaultResolver.LookupHost(ctx, endpoint); err != nil {
+		return fmt.Errorf("%v control plane endpoint %s not resolved, %v, %w", nn.Name, endpoint, err, errors.WaitingForSubResources)
+	}
+	return nil
+}
+
+// apiServerHealthy checks the guest cluster's API server /healthz returns 200
+// before the add-ons are created
+func apiServerHealthy(ctx context.Context, nn types.NamespacedName, restConfig *rest.Config) error {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("creating discovery client for new cluster, %w", err)
+	}
+	statusCode := 0
+	if err := discoveryClient.RESTClient().Get().AbsPath("/healthz").Do(ctx).StatusCode(&statusCode).Error(); err != nil {
+		if notReady := endpointNotReady(nn, err); notReady != nil {
+			return notReady
+		}
+		if statusCode == 0 {
+			return fmt.Errorf("checking %v api server health, %w", nn.Name, err)
+		}
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("%v api server /healthz returned %d, %w", nn.Name, statusCode, errors.WaitingForSubResources)
+	}
+	return nil
+}
+
+// endpointNotReady returns a WaitingForSubResources error when the error is
+// from the control plane endpoint not being reachable yet, otherwise nil
+func endpointNotReady(nn types.NamespacedName, err error) error {
+	if errors.IsDNSLookUpNoSuchHost(err) {
+		return fmt.Errorf("%v control plane endpoint not ready, lookup failed, %w", nn.Name, errors.WaitingForSubResources)
+	}
+	if errors.IsNetIOTimeOut(err) {
+		// This happens 1-2 times, but if it happens more we would want to know in the logs
+		zap.S().Errorf("Creating kubeclient, net i/o timed out for control plane %s endpoint", nn.Name)
+		return fmt.Errorf("net i/o timeout for %v control plane endpoint, %w", nn.Name, errors.WaitingForSubResources)
+	}
+	if errors.IsConnectionRefused(err) {
+		zap.S().Errorf("Creating kubeclient, connection refused for control plane %s endpoint", nn.Name)
+		return fmt.Errorf("connection refused %v control plane endpoint, %w", nn.Name, errors.WaitingForSubResources)
+	}
+	return nil
+}
+
+func (c *Controller) Finalize(_ context.Context, controlPlane *v1alpha1.ControlPlane) (err error) {
+	// A deleted cluster's rollout is never completed
+	c.rollouts.release(controlPlane.Namespace + "/" + controlPlane.ClusterName())
 	return nil
 }
+
+// withPlacement applies the add-on placement from the ControlPlane spec to the
+// pod spec of a Deployment based add-on
+func withPlacement(controlPlane *v1alpha1.ControlPlane, podSpec *v1.PodSpec) {
+	if controlPlane.Spec.Addons == nil || controlPlane.Spec.Addons.Placement == nil {
+		return
+	}
+	placement := controlPlane.Spec.Addons.Placement
+	podSpec.NodeSelector = placement.NodeSelector
+	podSpec.Affinity = placement.Affinity
+	podSpec.Tolerations = append(podSpec.Tolerations, placement.Tolerations...)
+}
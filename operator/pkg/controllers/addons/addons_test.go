@@ -0,0 +1,76 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/awslabs/kit/operator/pkg/controllers/master"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEndpointReady(t *testing.T) {
+	ctx := context.Background()
+	nn := types.NamespacedName{Name: "test-cluster", Namespace: "default"}
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: master.ServiceNameFor(nn.Name), Namespace: nn.Namespace}}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).WithObjects(service).Build()
+	controller := New(kubeprovider.New(kubeClient), nil)
+	// The load balancer hasn't been assigned an address yet
+	if err := controller.endpointReady(ctx, nn); !errors.IsWaitingForSubResource(err) {
+		t.Errorf("expected to wait for the endpoint, got %v", err)
+	}
+	service.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+	if err := kubeClient.Status().Update(ctx, service); err != nil {
+		t.Fatalf("updating service, %v", err)
+	}
+	if err := controller.endpointReady(ctx, nn); err != nil {
+		t.Errorf("expected the endpoint to be ready, got %v", err)
+	}
+}
+
+func TestAPIServerHealthy(t *testing.T) {
+	ctx := context.Background()
+	nn := types.NamespacedName{Name: "test-cluster", Namespace: "default"}
+	statusCode := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		w.WriteHeader(statusCode)
+	}))
+	defer server.Close()
+	if err := apiServerHealthy(ctx, nn, &rest.Config{Host: server.URL}); !errors.IsWaitingForSubResource(err) {
+		t.Errorf("expected to wait for the api server, got %v", err)
+	}
+	statusCode = http.StatusOK
+	if err := apiServerHealthy(ctx, nn, &rest.Config{Host: server.URL}); err != nil {
+		t.Errorf("expected the api server to be healthy, got %v", err)
+	}
+	// Connections are refused before the API server is listening
+	server.Close()
+	if err := apiServerHealthy(ctx, nn, &rest.Config{Host: server.URL}); !errors.IsWaitingForSubResource(err) {
+		t.Errorf("expected to wait for the api server, got %v", err)
+	}
+}
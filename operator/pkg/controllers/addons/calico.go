@@ -0,0 +1,550 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/imageprovider"
+	"knative.dev/pkg/ptr"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	calicoNode            = "calico-node"
+	calicoTypha           = "calico-typha"
+	calicoKubeControllers = "calico-kube-controllers"
+	calicoConfig          = "calico-config"
+	calicoTyphaPort       = 5473
+	calicoCRDGroup        = "crd.projectcalico.org"
+)
+
+// calicoClusterCRDs and calicoNamespacedCRDs are the plural names of the
+// crd.projectcalico.org/v1 resources calico stores its datastore in
+var (
+	calicoClusterCRDs = map[string]string{
+		"bgpconfigurations":             "BGPConfiguration",
+		"bgppeers":                      "BGPPeer",
+		"blockaffinities":               "BlockAffinity",
+		"caliconodestatuses":            "CalicoNodeStatus",
+		"clusterinformations":           "ClusterInformation",
+		"felixconfigurations":           "FelixConfiguration",
+		"globalnetworkpolicies":         "GlobalNetworkPolicy",
+		"globalnetworksets":             "GlobalNetworkSet",
+		"hostendpoints":                 "HostEndpoint",
+		"ipamblocks":                    "IPAMBlock",
+		"ipamconfigs":                   "IPAMConfig",
+		"ipamhandles":                   "IPAMHandle",
+		"ippools":                       "IPPool",
+		"ipreservations":                "IPReservation",
+		"kubecontrollersconfigurations": "KubeControllersConfiguration",
+	}
+	calicoNamespacedCRDs = map[string]string{
+		"networkpolicies": "NetworkPolicy",
+		"networksets":     "NetworkSet",
+	}
+)
+
+// calico runs calico-node with the kubernetes datastore, pods are routed over
+// VXLAN so it works without BGP peering between the nodes
+type calico struct {
+	kubeClient *kubeprovider.Client
+}
+
+func (c *calico) ensure(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	for _, reconcile := range []func(context.Context, *v1alpha1.ControlPlane) error{
+		c.customResourceDefinitions,
+		c.serviceAccount,
+		c.clusterRole,
+		c.clusterRoleBinding,
+		c.configMap,
+		c.typha,
+		c.daemonSet,
+		c.kubeControllersRBAC,
+		c.kubeControllers,
+	} {
+		if err := reconcile(ctx, controlPlane); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *calico) installed(ctx context.Context) (bool, error) {
+	return installedBy(ctx, c.kubeClient, v1alpha1.CNIPluginCalico, calicoNode)
+}
+
+// remove deletes the daemonset first so calico-node stops before its config
+// and datastore are deleted
+func (c *calico) remove(ctx context.Context) error {
+	objects := []client.Object{
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: calicoNode, Namespace: kubeSystem}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: calicoKubeControllers, Namespace: kubeSystem}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: calicoTypha, Namespace: kubeSystem}},
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: calicoTypha, Namespace: kubeSystem}},
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: calicoConfig, Namespace: kubeSystem}},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: calicoNode}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: calicoNode}},
+		&v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: calicoNode, Namespace: kubeSystem}},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: calicoKubeControllers}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: calicoKubeControllers}},
+		&v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: calicoKubeControllers, Namespace: kubeSystem}},
+	}
+	for _, crd := range calicoCRDs() {
+		objects = append(objects, crd)
+	}
+	for _, object := range objects {
+		if err := c.kubeClient.Delete(ctx, object); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("deleting %s, %w", object.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// customResourceDefinitions are created without a schema, calico validates
+// its resources itself
+func (c *calico) customResourceDefinitions(ctx context.Context, _ *v1alpha1.ControlPlane) error {
+	for _, crd := range calicoCRDs() {
+		if err := c.kubeClient.EnsureCreate(ctx, crd); err != nil {
+			return fmt.Errorf("creating custom resource definition %s, %w", crd.GetName(), err)
+		}
+	}
+	return nil
+}
+
+func calicoCRDs() []*unstructured.Unstructured {
+	crds := []*unstructured.Unstructured{}
+	for scope, kinds := range map[string]map[string]string{"Cluster": calicoClusterCRDs, "Namespaced": calicoNamespacedCRDs} {
+		for plural, kind := range kinds {
+			crd := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "apiextensions.k8s.io/v1",
+				"kind":       "CustomResourceDefinition",
+				"metadata":   map[string]interface{}{"name": plural + "." + calicoCRDGroup},
+				"spec": map[string]interface{}{
+					"group": calicoCRDGroup,
+					"scope": scope,
+					"names": map[string]interface{}{
+						"kind":     kind,
+						"listKind": kind + "List",
+						"plural":   plural,
+						"singular": strings.ToLower(kind),
+					},
+					"versions": []interface{}{map[string]interface{}{
+						"name":    "v1",
+						"served":  true,
+						"storage": true,
+						"schema": map[string]interface{}{"openAPIV3Schema": map[string]interface{}{
+							"type":                                 "object",
+							"x-kubernetes-preserve-unknown-fields": true,
+						}},
+					}},
+				},
+			}}
+			crds = append(crds, crd)
+		}
+	}
+	return crds
+}
+
+func (c *calico) serviceAccount(ctx context.Context, _ *v1alpha1.ControlPlane) error {
+	return c.kubeClient.EnsurePatch(ctx, &v1.ServiceAccount{}, &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoNode, Namespace: kubeSystem},
+	})
+}
+
+func (c *calico) clusterRole(ctx context.Context, _ *v1alpha1.ControlPlane) error {
+	return c.kubeClient.EnsurePatch(ctx, &rbacv1.ClusterRole{}, &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoNode},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"pods", "nodes", "namespaces", "serviceaccounts", "endpoints", "services", "configmaps"},
+			Verbs:     []string{"get", "list", "watch"},
+		}, {
+			APIGroups: []string{""},
+			Resources: []string{"nodes/status", "pods/status"},
+			Verbs:     []string{"patch", "update"},
+		}, {
+			APIGroups:     []string{""},
+			Resources:     []string{"serviceaccounts/token"},
+			ResourceNames: []string{calicoNode},
+			Verbs:         []string{"create"},
+		}, {
+			APIGroups: []string{"networking.k8s.io"},
+			Resources: []string{"networkpolicies"},
+			Verbs:     []string{"get", "list", "watch"},
+		}, {
+			APIGroups: []string{"discovery.k8s.io"},
+			Resources: []string{"endpointslices"},
+			Verbs:     []string{"get", "list", "watch"},
+		}, {
+			APIGroups: []string{calicoCRDGroup},
+			Resources: []string{"*"},
+			Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+		}},
+	})
+}
+
+func (c *calico) clusterRoleBinding(ctx context.Context, _ *v1alpha1.ControlPlane) error {
+	return c.kubeClient.EnsureCreate(ctx, &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoNode},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     calicoNode,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      calicoNode,
+			Namespace: kubeSystem,
+		}},
+	})
+}
+
+func (c *calico) configMap(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	typhaService := "none"
+	if calicoSpecFor(controlPlane).TyphaReplicas > 0 {
+		typhaService = calicoTypha
+	}
+	return c.kubeClient.EnsurePatch(ctx, &v1.ConfigMap{}, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoConfig, Namespace: kubeSystem},
+		Data: map[string]string{
+			"typha_service_name": typhaService,
+			"calico_backend":     "vxlan",
+			// 0 lets calico detect the MTU from the node's interfaces
+			"veth_mtu":           "0",
+			"cni_network_config": calicoCNINetworkConfig,
+		},
+	})
+}
+
+// calicoCNINetworkConfig is templated by install-cni on each node
+const calicoCNINetworkConfig = `{
+  "name": "k8s-pod-network",
+  "cniVersion": "0.3.1",
+  "plugins": [
+    {
+      "type": "calico",
+      "log_level": "info",
+      "log_file_path": "/var/log/calico/cni/cni.log",
+      "datastore_type": "kubernetes",
+      "nodename": "__KUBERNETES_NODE_NAME__",
+      "mtu": __CNI_MTU__,
+      "ipam": {"type": "calico-ipam"},
+      "policy": {"type": "k8s"},
+      "kubernetes": {"kubeconfig": "__KUBECONFIG_FILEPATH__"}
+    },
+    {"type": "portmap", "snat": true, "capabilities": {"portMappings": true}},
+    {"type": "bandwidth", "capabilities": {"bandwidth": true}}
+  ]
+}`
+
+// typha is only run when replicas are requested, otherwise it's removed so
+// lowering the replicas to 0 switches calico-node back to the API server
+func (c *calico) typha(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	replicas := calicoSpecFor(controlPlane).TyphaReplicas
+	if replicas == 0 {
+		for _, object := range []client.Object{
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: calicoTypha, Namespace: kubeSystem}},
+			&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: calicoTypha, Namespace: kubeSystem}},
+		} {
+			if err := c.kubeClient.Delete(ctx, object); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("deleting %s, %w", object.GetName(), err)
+			}
+		}
+		return nil
+	}
+	if err := c.kubeClient.EnsureCreate(ctx, &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoTypha, Namespace: kubeSystem, Labels: labelsForCalico(calicoTypha)},
+		Spec: v1.ServiceSpec{
+			Selector: labelsForCalico(calicoTypha),
+			Ports: []v1.ServicePort{{
+				Name:       calicoTypha,
+				Port:       calicoTyphaPort,
+				Protocol:   v1.ProtocolTCP,
+				TargetPort: intstr.FromString(calicoTypha),
+			}},
+		},
+	}); err != nil {
+		return fmt.Errorf("creating typha service, %w", err)
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoTypha, Namespace: kubeSystem, Labels: labelsForCalico(calicoTypha)},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.Int32(replicas),
+			Selector: &metav1.LabelSelector{MatchLabels: labelsForCalico(calicoTypha)},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labelsForCalico(calicoTypha)},
+				Spec: v1.PodSpec{
+					HostNetwork:        true,
+					ServiceAccountName: calicoNode,
+					PriorityClassName:  "system-cluster-critical",
+					Tolerations:        []v1.Toleration{{Key: "CriticalAddonsOnly", Operator: v1.TolerationOpExists}},
+					Containers: []v1.Container{{
+						Name:  calicoTypha,
+						Image: imageprovider.CalicoTypha(),
+						Ports: []v1.ContainerPort{{
+							Name:          calicoTypha,
+							ContainerPort: calicoTyphaPort,
+							Protocol:      v1.ProtocolTCP,
+						}},
+						Env: []v1.EnvVar{
+							{Name: "TYPHA_LOGSEVERITYSCREEN", Value: "info"},
+							{Name: "TYPHA_LOGFILEPATH", Value: "none"},
+							{Name: "TYPHA_LOGSEVERITYSYS", Value: "none"},
+							{Name: "TYPHA_CONNECTIONREBALANCINGMODE", Value: "kubernetes"},
+							{Name: "TYPHA_DATASTORETYPE", Value: "kubernetes"},
+							{Name: "TYPHA_HEALTHENABLED", Value: "true"},
+						},
+						LivenessProbe: &v1.Probe{
+							Handler: v1.Handler{HTTPGet: &v1.HTTPGetAction{
+								Path: "/liveness", Port: intstr.FromInt(9098), Host: "localhost",
+							}},
+							PeriodSeconds:       30,
+							InitialDelaySeconds: 30,
+						},
+						ReadinessProbe: &v1.Probe{
+							Handler: v1.Handler{HTTPGet: &v1.HTTPGetAction{
+								Path: "/readiness", Port: intstr.FromInt(9098), Host: "localhost",
+							}},
+							PeriodSeconds: 10,
+						},
+					}},
+				},
+			},
+		},
+	}
+	withPlacement(controlPlane, &deployment.Spec.Template.Spec)
+	return c.kubeClient.EnsurePatch(ctx, &appsv1.Deployment{}, deployment)
+}
+
+func (c *calico) daemonSet(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	podCIDR := calicoSpecFor(controlPlane).PodCIDR
+	if podCIDR == "" {
+		podCIDR = v1alpha1.DefaultCalicoPodCIDR
+	}
+	hostPath := func(name, path string) v1.Volume {
+		return v1.Volume{Name: name, VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: path}}}
+	}
+	fromConfig := func(name, key string) v1.EnvVar {
+		return v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{ConfigMapKeyRef: &v1.ConfigMapKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: calicoConfig}, Key: key,
+		}}}
+	}
+	return c.kubeClient.EnsurePatch(ctx, &appsv1.DaemonSet{}, &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoNode, Namespace: kubeSystem, Labels: cniLabels(v1alpha1.CNIPluginCalico, labelsForCalico(calicoNode))},
+		Spec: appsv1.DaemonSetSpec{
+			UpdateStrategy: appsv1.DaemonSetUpdateStrategy{Type: appsv1.RollingUpdateDaemonSetStrategyType},
+			Selector:       &metav1.LabelSelector{MatchLabels: labelsForCalico(calicoNode)},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labelsForCalico(calicoNode)},
+				Spec: v1.PodSpec{
+					HostNetwork:                   true,
+					ServiceAccountName:            calicoNode,
+					PriorityClassName:             "system-node-critical",
+					TerminationGracePeriodSeconds: ptr.Int64(0),
+					Tolerations:                   []v1.Toleration{{Operator: v1.TolerationOpExists}},
+					InitContainers: []v1.Container{{
+						Name:    "install-cni",
+						Image:   imageprovider.CalicoCNI(),
+						Command: []string{"/opt/cni/bin/install"},
+						Env: []v1.EnvVar{
+							{Name: "CNI_CONF_NAME", Value: "10-calico.conflist"},
+							fromConfig("CNI_NETWORK_CONFIG", "cni_network_config"),
+							fromConfig("CNI_MTU", "veth_mtu"),
+							{Name: "KUBERNETES_NODE_NAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}},
+							{Name: "SLEEP", Value: "false"},
+						},
+						SecurityContext: &v1.SecurityContext{Privileged: ptr.Bool(true)},
+						VolumeMounts: []v1.VolumeMount{
+							{Name: "cni-bin-dir", MountPath: "/host/opt/cni/bin"},
+							{Name: "cni-net-dir", MountPath: "/host/etc/cni/net.d"},
+						},
+					}},
+					Containers: []v1.Container{{
+						Name:  calicoNode,
+						Image: imageprovider.CalicoNode(),
+						Env: []v1.EnvVar{
+							{Name: "DATASTORE_TYPE", Value: "kubernetes"},
+							fromConfig("FELIX_TYPHAK8SSERVICENAME", "typha_service_name"),
+							{Name: "WAIT_FOR_DATASTORE", Value: "true"},
+							{Name: "NODENAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}},
+							fromConfig("CALICO_NETWORKING_BACKEND", "calico_backend"),
+							{Name: "CLUSTER_TYPE", Value: "k8s"},
+							{Name: "IP", Value: "autodetect"},
+							{Name: "CALICO_IPV4POOL_CIDR", Value: podCIDR},
+							{Name: "CALICO_IPV4POOL_IPIP", Value: "Never"},
+							{Name: "CALICO_IPV4POOL_VXLAN", Value: "Always"},
+							fromConfig("FELIX_VXLANMTU", "veth_mtu"),
+							{Name: "CALICO_DISABLE_FILE_LOGGING", Value: "true"},
+							{Name: "FELIX_DEFAULTENDPOINTTOHOSTACTION", Value: "ACCEPT"},
+							{Name: "FELIX_IPV6SUPPORT", Value: "false"},
+							{Name: "FELIX_HEALTHENABLED", Value: "true"},
+						},
+						SecurityContext: &v1.SecurityContext{Privileged: ptr.Bool(true)},
+						LivenessProbe: &v1.Probe{
+							Handler:             v1.Handler{Exec: &v1.ExecAction{Command: []string{"/bin/calico-node", "-felix-live"}}},
+							PeriodSeconds:       10,
+							InitialDelaySeconds: 10,
+							FailureThreshold:    6,
+							TimeoutSeconds:      10,
+						},
+						ReadinessProbe: &v1.Probe{
+							Handler:        v1.Handler{Exec: &v1.ExecAction{Command: []string{"/bin/calico-node", "-felix-ready"}}},
+							PeriodSeconds:  10,
+							TimeoutSeconds: 10,
+						},
+						VolumeMounts: []v1.VolumeMount{
+							{Name: "lib-modules", MountPath: "/lib/modules", ReadOnly: true},
+							{Name: "xtables-lock", MountPath: "/run/xtables.lock"},
+							{Name: "var-run-calico", MountPath: "/var/run/calico"},
+							{Name: "var-lib-calico", MountPath: "/var/lib/calico"},
+							{Name: "policysync", MountPath: "/var/run/nodeagent"},
+						},
+					}},
+					Volumes: []v1.Volume{
+						hostPath("lib-modules", "/lib/modules"),
+						hostPath("xtables-lock", "/run/xtables.lock"),
+						hostPath("var-run-calico", "/var/run/calico"),
+						hostPath("var-lib-calico", "/var/lib/calico"),
+						hostPath("policysync", "/var/run/nodeagent"),
+						hostPath("cni-bin-dir", "/opt/cni/bin"),
+						hostPath("cni-net-dir", "/etc/cni/net.d"),
+					},
+				},
+			},
+		},
+	})
+}
+
+// kubeControllersRBAC lets calico-kube-controllers watch the nodes and
+// release the IPAM blocks and handles of the deleted ones
+func (c *calico) kubeControllersRBAC(ctx context.Context, _ *v1alpha1.ControlPlane) error {
+	if err := c.kubeClient.EnsurePatch(ctx, &v1.ServiceAccount{}, &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoKubeControllers, Namespace: kubeSystem},
+	}); err != nil {
+		return fmt.Errorf("patching kube-controllers service account, %w", err)
+	}
+	if err := c.kubeClient.EnsurePatch(ctx, &rbacv1.ClusterRole{}, &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoKubeControllers},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"nodes", "pods"},
+			Verbs:     []string{"get", "list", "watch"},
+		}, {
+			APIGroups: []string{calicoCRDGroup},
+			Resources: []string{"ipreservations"},
+			Verbs:     []string{"list"},
+		}, {
+			APIGroups: []string{calicoCRDGroup},
+			Resources: []string{"blockaffinities", "ipamblocks", "ipamhandles"},
+			Verbs:     []string{"get", "list", "create", "update", "delete", "watch"},
+		}, {
+			APIGroups: []string{calicoCRDGroup},
+			Resources: []string{"hostendpoints"},
+			Verbs:     []string{"get", "list", "create", "update", "delete"},
+		}, {
+			APIGroups: []string{calicoCRDGroup},
+			Resources: []string{"clusterinformations"},
+			Verbs:     []string{"get", "create", "update"},
+		}, {
+			APIGroups: []string{calicoCRDGroup},
+			Resources: []string{"kubecontrollersconfigurations"},
+			Verbs:     []string{"get", "create", "update", "watch"},
+		}},
+	}); err != nil {
+		return fmt.Errorf("patching kube-controllers cluster role, %w", err)
+	}
+	return c.kubeClient.EnsureCreate(ctx, &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoKubeControllers},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     calicoKubeControllers,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      calicoKubeControllers,
+			Namespace: kubeSystem,
+		}},
+	})
+}
+
+// kubeControllers runs the node controller only, the policy, namespace and
+// service account controllers are for the etcd datastore
+func (c *calico) kubeControllers(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	checkStatus := func(flag string) v1.Handler {
+		return v1.Handler{Exec: &v1.ExecAction{Command: []string{"/usr/bin/check-status", flag}}}
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoKubeControllers, Namespace: kubeSystem, Labels: labelsForCalico(calicoKubeControllers)},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.Int32(1),
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			Selector: &metav1.LabelSelector{MatchLabels: labelsForCalico(calicoKubeControllers)},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labelsForCalico(calicoKubeControllers)},
+				Spec: v1.PodSpec{
+					ServiceAccountName: calicoKubeControllers,
+					PriorityClassName:  "system-cluster-critical",
+					Tolerations:        []v1.Toleration{{Key: "CriticalAddonsOnly", Operator: v1.TolerationOpExists}},
+					Containers: []v1.Container{{
+						Name:  calicoKubeControllers,
+						Image: imageprovider.CalicoKubeControllers(),
+						Env: []v1.EnvVar{
+							{Name: "ENABLED_CONTROLLERS", Value: "node"},
+							{Name: "DATASTORE_TYPE", Value: "kubernetes"},
+						},
+						LivenessProbe: &v1.Probe{
+							Handler:             checkStatus("-l"),
+							PeriodSeconds:       10,
+							InitialDelaySeconds: 10,
+							FailureThreshold:    6,
+							TimeoutSeconds:      10,
+						},
+						ReadinessProbe: &v1.Probe{
+							Handler:       checkStatus("-r"),
+							PeriodSeconds: 10,
+						},
+					}},
+				},
+			},
+		},
+	}
+	withPlacement(controlPlane, &deployment.Spec.Template.Spec)
+	return c.kubeClient.EnsurePatch(ctx, &appsv1.Deployment{}, deployment)
+}
+
+func calicoSpecFor(controlPlane *v1alpha1.ControlPlane) v1alpha1.Calico {
+	if controlPlane.Spec.Addons == nil || controlPlane.Spec.Addons.Calico == nil {
+		return v1alpha1.Calico{}
+	}
+	return *controlPlane.Spec.Addons.Calico
+}
+
+func labelsForCalico(name string) map[string]string {
+	return map[string]string{"k8s-app": name}
+}
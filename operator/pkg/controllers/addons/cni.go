@@ -0,0 +1,112 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"go.uber.org/zap"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cniPluginLabel is set on the DaemonSet of the CNI add-on the operator
+// installed, a CNI installed some other way doesn't have it and is left alone
+const cniPluginLabel = "kit.k8s.sh/cni"
+
+// cniAddon is a pod network add-on, at most one is installed at a time
+type cniAddon interface {
+	ensure(context.Context, *v1alpha1.ControlPlane) error
+	// installed reports whether the operator installed the add-on in the
+	// guest cluster
+	installed(context.Context) (bool, error)
+	remove(context.Context) error
+}
+
+// CNI installs the pod network add-on selected in the ControlPlane spec and
+// removes the others it installed, so switching CNIs cleans up the previous one
+type CNI struct {
+	kubeClient *kubeprovider.Client
+	plugins    map[v1alpha1.CNIPlugin]cniAddon
+}
+
+func CNIController(kubeClient *kubeprovider.Client) *CNI {
+	return &CNI{kubeClient: kubeClient, plugins: map[v1alpha1.CNIPlugin]cniAddon{
+		v1alpha1.CNIPluginCalico: &calico{kubeClient: kubeClient},
+		v1alpha1.CNIPluginVPCCNI: &vpcCNI{kubeClient: kubeClient},
+	}}
+}
+
+func (c *CNI) Reconcile(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	selected := v1alpha1.CNIPlugin("")
+	if controlPlane.Spec.Addons != nil {
+		selected = controlPlane.Spec.Addons.CNI
+	}
+	// The previous add-on is removed first, two CNIs would fight over the pods
+	for plugin, addon := range c.plugins {
+		if plugin == selected {
+			continue
+		}
+		installed, err := addon.installed(ctx)
+		if err != nil {
+			return fmt.Errorf("checking for %s, %w", plugin, err)
+		}
+		if !installed {
+			continue
+		}
+		if err := addon.remove(ctx); err != nil {
+			return fmt.Errorf("removing %s, %w", plugin, err)
+		}
+		zap.S().Infof("[%v] Removed %s CNI", controlPlane.ClusterName(), plugin)
+	}
+	if addon, ok := c.plugins[selected]; ok {
+		if err := addon.ensure(ctx, controlPlane); err != nil {
+			return fmt.Errorf("ensuring %s, %w", selected, err)
+		}
+	}
+	return nil
+}
+
+func (c *CNI) Finalize(_ context.Context, _ *v1alpha1.ControlPlane) (err error) {
+	return nil
+}
+
+// installedBy reports whether the DaemonSet exists and is labeled as the
+// plugin's by the operator
+func installedBy(ctx context.Context, kubeClient *kubeprovider.Client, plugin v1alpha1.CNIPlugin, name string) (bool, error) {
+	daemonSet := &appsv1.DaemonSet{}
+	if err := kubeClient.Get(ctx, client.ObjectKey{Namespace: kubeSystem, Name: name}, daemonSet); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return daemonSet.Labels[cniPluginLabel] == string(plugin), nil
+}
+
+// cniLabels are the labels of a CNI add-on's DaemonSet, marking it as
+// installed by the operator
+func cniLabels(plugin v1alpha1.CNIPlugin, labels map[string]string) map[string]string {
+	result := map[string]string{cniPluginLabel: string(plugin)}
+	for key, value := range labels {
+		result[key] = value
+	}
+	return result
+}
@@ -0,0 +1,188 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"testing"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCalico(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.GuestCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: v1alpha1.ControlPlaneSpec{Addons: &v1alpha1.Addons{
+			CNI:    v1alpha1.CNIPluginCalico,
+			Calico: &v1alpha1.Calico{PodCIDR: "10.244.0.0/16", TyphaReplicas: 2},
+		}},
+	}
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	controller := CNIController(kubeprovider.New(kubeClient))
+	// Applying is idempotent
+	for i := 0; i < 2; i++ {
+		if err := controller.Reconcile(ctx, controlPlane); err != nil {
+			t.Fatalf("reconciling cni, %v", err)
+		}
+	}
+	daemonSet := &appsv1.DaemonSet{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: calicoNode}, daemonSet); err != nil {
+		t.Fatalf("getting calico-node, %v", err)
+	}
+	if env := envFor(daemonSet.Spec.Template.Spec.Containers[0], "CALICO_IPV4POOL_CIDR"); env != "10.244.0.0/16" {
+		t.Errorf("expected the pod CIDR to be applied, got %q", env)
+	}
+	typha := &appsv1.Deployment{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: calicoTypha}, typha); err != nil {
+		t.Fatalf("getting typha, %v", err)
+	}
+	if *typha.Spec.Replicas != 2 {
+		t.Errorf("expected 2 typha replicas, got %d", *typha.Spec.Replicas)
+	}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: calicoKubeControllers}, &appsv1.Deployment{}); err != nil {
+		t.Fatalf("getting kube-controllers, %v", err)
+	}
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1")
+	crd.SetKind("CustomResourceDefinition")
+	if err := kubeClient.Get(ctx, types.NamespacedName{Name: "ippools." + calicoCRDGroup}, crd); err != nil {
+		t.Fatalf("getting ippools custom resource definition, %v", err)
+	}
+
+	// Typha is removed when it's no longer requested
+	controlPlane.Spec.Addons.Calico.TyphaReplicas = 0
+	if err := controller.Reconcile(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling cni, %v", err)
+	}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: calicoTypha}, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("expected typha to be removed, got %v", err)
+	}
+	config := &v1.ConfigMap{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: calicoConfig}, config); err != nil {
+		t.Fatalf("getting calico config, %v", err)
+	}
+	if config.Data["typha_service_name"] != "none" {
+		t.Errorf("expected calico-node to stop using typha, got %q", config.Data["typha_service_name"])
+	}
+
+	// Unsetting the CNI removes calico
+	controlPlane.Spec.Addons.CNI = ""
+	if err := controller.Reconcile(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling cni, %v", err)
+	}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: calicoNode}, &appsv1.DaemonSet{}); !errors.IsNotFound(err) {
+		t.Errorf("expected calico-node to be removed, got %v", err)
+	}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Name: "ippools." + calicoCRDGroup}, crd); !errors.IsNotFound(err) {
+		t.Errorf("expected the custom resource definitions to be removed, got %v", err)
+	}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: calicoKubeControllers}, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Errorf("expected kube-controllers to be removed, got %v", err)
+	}
+}
+
+func TestCNILeavesUnmanagedPlugin(t *testing.T) {
+	ctx := context.Background()
+	// calico installed in the guest cluster without the operator
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.GuestCluster).WithObjects(&appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: calicoNode, Namespace: kubeSystem, Labels: labelsForCalico(calicoNode)},
+	}).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+	}
+	if err := CNIController(kubeprovider.New(kubeClient)).Reconcile(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling cni, %v", err)
+	}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: calicoNode}, &appsv1.DaemonSet{}); err != nil {
+		t.Errorf("expected the unmanaged calico-node to be left alone, got %v", err)
+	}
+}
+
+func TestVPCCNI(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.GuestCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: v1alpha1.ControlPlaneSpec{Addons: &v1alpha1.Addons{
+			CNI:    v1alpha1.CNIPluginVPCCNI,
+			VPCCNI: &v1alpha1.VPCCNI{Env: map[string]string{"ENABLE_PREFIX_DELEGATION": "true", "WARM_IP_TARGET": "5"}},
+		}},
+	}
+	controller := CNIController(kubeprovider.New(kubeClient))
+	// Applying is idempotent
+	for i := 0; i < 2; i++ {
+		if err := controller.Reconcile(ctx, controlPlane); err != nil {
+			t.Fatalf("reconciling cni, %v", err)
+		}
+	}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: awsNode}, &v1.ServiceAccount{}); err != nil {
+		t.Errorf("getting service account, %v", err)
+	}
+	daemonSet := &appsv1.DaemonSet{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: awsNode}, daemonSet); err != nil {
+		t.Fatalf("getting aws-node, %v", err)
+	}
+	env := map[string]string{}
+	for _, variable := range daemonSet.Spec.Template.Spec.Containers[0].Env {
+		if _, ok := env[variable.Name]; ok {
+			t.Errorf("expected %s to be set once", variable.Name)
+		}
+		env[variable.Name] = variable.Value
+	}
+	for name, expected := range map[string]string{
+		"ENABLE_PREFIX_DELEGATION":           "true",
+		"WARM_IP_TARGET":                     "5",
+		"WARM_ENI_TARGET":                    "1",
+		"AWS_VPC_K8S_CNI_CUSTOM_NETWORK_CFG": "false",
+	} {
+		if env[name] != expected {
+			t.Errorf("expected %s to be %s, got %s", name, expected, env[name])
+		}
+	}
+
+	// Switching to calico removes aws-node
+	controlPlane.Spec.Addons.CNI = v1alpha1.CNIPluginCalico
+	if err := controller.Reconcile(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling cni, %v", err)
+	}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: awsNode}, &appsv1.DaemonSet{}); !errors.IsNotFound(err) {
+		t.Errorf("expected aws-node to be removed, got %v", err)
+	}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: calicoNode}, &appsv1.DaemonSet{}); err != nil {
+		t.Errorf("getting calico-node, %v", err)
+	}
+}
+
+func envFor(container v1.Container, name string) string {
+	for _, env := range container.Env {
+		if env.Name == name {
+			return env.Value
+		}
+	}
+	return ""
+}
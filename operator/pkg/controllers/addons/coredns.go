@@ -41,9 +41,9 @@ func CoreDNSController(kubeClient *kubeprovider.Client) *CoreDNS {
 	return &CoreDNS{kubeClient: kubeClient}
 }
 
-type reconcileCoreDNSResources func(context.Context) (err error)
+type reconcileCoreDNSResources func(context.Context, *v1alpha1.ControlPlane) (err error)
 
-func (c *CoreDNS) Reconcile(ctx context.Context, _ *v1alpha1.ControlPlane) error {
+func (c *CoreDNS) Reconcile(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
 	for _, reconcile := range []reconcileCoreDNSResources{
 		c.serviceAccount,
 		c.clusterRole,
@@ -52,7 +52,7 @@ func (c *CoreDNS) Reconcile(ctx context.Context, _ *v1alpha1.ControlPlane) error
 		c.configMap,
 		c.deployment,
 	} {
-		if err := reconcile(ctx); err != nil {
+		if err := reconcile(ctx, controlPlane); err != nil {
 			return err
 		}
 	}
@@ -63,7 +63,7 @@ func (c *CoreDNS) Finalize(_ context.Context, _ *v1alpha1.ControlPlane) (err err
 	return nil
 }
 
-func (c *CoreDNS) serviceAccount(ctx context.Context) error {
+func (c *CoreDNS) serviceAccount(ctx context.Context, _ *v1alpha1.ControlPlane) error {
 	return c.kubeClient.EnsurePatch(ctx, &v1.ServiceAccount{}, &v1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "coredns",
@@ -72,7 +72,7 @@ func (c *CoreDNS) serviceAccount(ctx context.Context) error {
 	})
 }
 
-func (c *CoreDNS) clusterRole(ctx context.Context) error {
+func (c *CoreDNS) clusterRole(ctx context.Context, _ *v1alpha1.ControlPlane) error {
 	return c.kubeClient.EnsureCreate(ctx, &rbacv1.ClusterRole{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "system:coredns",
@@ -93,7 +93,7 @@ func (c *CoreDNS) clusterRole(ctx context.Context) error {
 	})
 }
 
-func (c *CoreDNS) clusterRoleBinding(ctx context.Context) error {
+func (c *CoreDNS) clusterRoleBinding(ctx context.Context, _ *v1alpha1.ControlPlane) error {
 	return c.kubeClient.EnsureCreate(ctx, &rbacv1.ClusterRoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "system:coredns",
@@ -111,7 +111,7 @@ func (c *CoreDNS) clusterRoleBinding(ctx context.Context) error {
 	})
 }
 
-func (c *CoreDNS) service(ctx context.Context) error {
+func (c *CoreDNS) service(ctx context.Context, _ *v1alpha1.ControlPlane) error {
 	return c.kubeClient.EnsureCreate(ctx, &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "kube-dns",
@@ -168,7 +168,7 @@ const coreDNSConfigData = `.:53 {
 	loadbalance
 }`
 
-func (c *CoreDNS) configMap(ctx context.Context) error {
+func (c *CoreDNS) configMap(ctx context.Context, _ *v1alpha1.ControlPlane) error {
 	return c.kubeClient.EnsureCreate(ctx, &v1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "coredns",
@@ -180,8 +180,8 @@ func (c *CoreDNS) configMap(ctx context.Context) error {
 	})
 }
 
-func (c *CoreDNS) deployment(ctx context.Context) error {
-	return c.kubeClient.EnsurePatch(ctx, &appsv1.Deployment{}, &appsv1.Deployment{
+func (c *CoreDNS) deployment(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "coredns",
 			Namespace: kubeSystem,
@@ -202,7 +202,7 @@ func (c *CoreDNS) deployment(ctx context.Context) error {
 					ServiceAccountName: "coredns",
 					Containers: []v1.Container{{
 						Name:            "coredns",
-						Image:           imageprovider.CoreDNS(),
+						Image:           imageprovider.CoreDNS(controlPlane.Spec.ImageRegistry, controlPlane.Spec.KubernetesVersion),
 						ImagePullPolicy: v1.PullIfNotPresent,
 						Resources: v1.ResourceRequirements{
 							Requests: map[v1.ResourceName]resource.Quantity{
@@ -258,7 +258,9 @@ func (c *CoreDNS) deployment(ctx context.Context) error {
 				},
 			},
 		},
-	})
+	}
+	withPlacement(controlPlane, &deployment.Spec.Template.Spec)
+	return c.kubeClient.EnsurePatch(ctx, &appsv1.Deployment{}, deployment)
 }
 
 func coreDNSLabels() map[string]string {
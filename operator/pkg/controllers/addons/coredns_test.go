@@ -0,0 +1,97 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"testing"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCoreDNSPlacement(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.GuestCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: v1alpha1.ControlPlaneSpec{Addons: &v1alpha1.Addons{Placement: &v1alpha1.Placement{
+			NodeSelector: map[string]string{"kit.k8s.sh/node-group": "infra"},
+			Affinity: &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{
+					Weight:          100,
+					PodAffinityTerm: v1.PodAffinityTerm{TopologyKey: "kubernetes.io/hostname"},
+				}},
+			}},
+			Tolerations: []v1.Toleration{{Key: "infra", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}},
+		}}},
+	}
+	if err := CoreDNSController(kubeprovider.New(kubeClient)).deployment(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling coredns deployment, %v", err)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: "coredns"}, deployment); err != nil {
+		t.Fatalf("getting coredns deployment, %v", err)
+	}
+	podSpec := deployment.Spec.Template.Spec
+	if podSpec.NodeSelector["kit.k8s.sh/node-group"] != "infra" {
+		t.Errorf("expected node selector to be applied, got %v", podSpec.NodeSelector)
+	}
+	if podSpec.Affinity == nil || podSpec.Affinity.PodAntiAffinity == nil {
+		t.Errorf("expected affinity to be applied, got %v", podSpec.Affinity)
+	}
+	if len(podSpec.Tolerations) != 1 || podSpec.Tolerations[0].Key != "infra" {
+		t.Errorf("expected tolerations to be applied, got %v", podSpec.Tolerations)
+	}
+}
+
+func TestCoreDNSImageForKubernetesVersion(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.GuestCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{KubernetesVersion: "1.21"},
+	}
+	if err := CoreDNSController(kubeprovider.New(kubeClient)).Reconcile(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling coredns, %v", err)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: "coredns"}, deployment); err != nil {
+		t.Fatalf("getting coredns deployment, %v", err)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "public.ecr.aws/eks-distro/coredns/coredns:v1.8.4-eks-1-21-4" {
+		t.Errorf("expected the CoreDNS image for 1.21, got %s", image)
+	}
+	service := &v1.Service{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: "kube-dns"}, service); err != nil {
+		t.Fatalf("getting kube-dns service, %v", err)
+	}
+	if service.Spec.ClusterIP != clusterIP {
+		t.Errorf("expected kube-dns cluster IP %s, got %s", clusterIP, service.Spec.ClusterIP)
+	}
+	configMap := &v1.ConfigMap{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: kubeSystem, Name: "coredns"}, configMap); err != nil {
+		t.Fatalf("getting coredns config map, %v", err)
+	}
+	if configMap.Data["Corefile"] != coreDNSConfigData {
+		t.Errorf("expected the default Corefile, got %s", configMap.Data["Corefile"])
+	}
+}
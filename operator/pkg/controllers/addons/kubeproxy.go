@@ -17,6 +17,10 @@ package addons
 import (
 	"context"
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
@@ -34,6 +38,7 @@ import (
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
@@ -41,8 +46,13 @@ const (
 	kubeSystem             = "kube-system"
 	defaultStr             = "default"
 	KubeProxyDaemonSetName = "kubeproxy-daemonset"
+	legacyTokenFile        = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	projectedTokenDir      = "/var/run/secrets/kube-proxy"
+	kubeProxyHealthzPort   = 10256
 )
 
+var defaultKubeProxyCPURequest = resource.MustParse("100m")
+
 type KubeProxy struct {
 	kubeClient       *kubeprovider.Client
 	substrateCluster *kubeprovider.Client
@@ -95,7 +105,7 @@ func (k *KubeProxy) kubeConfig(ctx context.Context, controlPlane *v1alpha1.Contr
 	}
 	// controlPlane is nil as the owner for secret object is not required
 	if err := kubeconfigs.Reconciler(k.kubeClient).ReconcileConfigFor(ctx, nil, kubeConfigRequest(
-		endpoint, kubeSystem, authRequestFor(controlPlane.ClusterName(), caSecret))); err != nil {
+		endpoint, controlPlane.APIServerPort(), kubeSystem, authRequestFor(controlPlane, caSecret))); err != nil {
 		return fmt.Errorf("reconciling kubeconfig for kube-proxy, %w", err)
 	}
 	return nil
@@ -131,7 +141,6 @@ func (k *KubeProxy) clusterRoleBinding(ctx context.Context, _ *v1alpha1.ControlP
 
 func (k *KubeProxy) daemonsetForKubeProxy(ctx context.Context, controlPlane *v1alpha1.ControlPlane) (err error) {
 	podSpec := kubeProxyPodSpecFor(controlPlane)
-	// TODO merge custom flags from the user
 	return k.kubeClient.EnsurePatch(ctx, &appsv1.DaemonSet{},
 		&appsv1.DaemonSet{
 			ObjectMeta: metav1.ObjectMeta{
@@ -154,12 +163,67 @@ func (k *KubeProxy) daemonsetForKubeProxy(ctx context.Context, controlPlane *v1a
 	)
 }
 
-func kubeConfigRequest(endpoint, ns string, auth *authRequest) *kubeconfigs.Request {
+func kubeProxyArgsFor(controlPlane *v1alpha1.ControlPlane) []string {
+	args := []string{
+		"--kubeconfig=/var/lib/kube-proxy/kubeconfig",
+		"--iptables-min-sync-period=0s",
+		"--oom-score-adj=-998",
+	}
+	if kubeProxy := controlPlane.Spec.KubeProxy; kubeProxy != nil {
+		if kubeProxy.ConntrackTCPTimeoutEstablished != nil {
+			args = append(args, fmt.Sprintf("--conntrack-tcp-timeout-established=%s", kubeProxy.ConntrackTCPTimeoutEstablished.Duration))
+		}
+		if kubeProxy.ConntrackTCPTimeoutCloseWait != nil {
+			args = append(args, fmt.Sprintf("--conntrack-tcp-timeout-close-wait=%s", kubeProxy.ConntrackTCPTimeoutCloseWait.Duration))
+		}
+		args = mergeExtraArgs(args, kubeProxy.ExtraArgs)
+	}
+	return args
+}
+
+// kubeProxyHealthzPortFor is the port of --healthz-bind-address, when it's
+// overridden in the extra args, or kube-proxy's default
+func kubeProxyHealthzPortFor(controlPlane *v1alpha1.ControlPlane) int32 {
+	if controlPlane.Spec.KubeProxy != nil {
+		if address, ok := controlPlane.Spec.KubeProxy.ExtraArgs["healthz-bind-address"]; ok {
+			if _, port, err := net.SplitHostPort(address); err == nil {
+				if p, err := strconv.ParseInt(port, 10, 32); err == nil && p > 0 {
+					return int32(p)
+				}
+			}
+		}
+	}
+	return kubeProxyHealthzPort
+}
+
+// mergeExtraArgs overrides the default flags in place and appends the other
+// flags sorted, keeping the args stable so the pods aren't restarted
+func mergeExtraArgs(args []string, extraArgs map[string]string) []string {
+	merged := map[string]bool{}
+	for i, arg := range args {
+		flag := strings.TrimPrefix(strings.SplitN(arg, "=", 2)[0], "--")
+		if value, ok := extraArgs[flag]; ok {
+			args[i] = fmt.Sprintf("--%s=%s", flag, value)
+			merged[flag] = true
+		}
+	}
+	extra := []string{}
+	for flag, value := range extraArgs {
+		if !merged[flag] {
+			extra = append(extra, fmt.Sprintf("--%s=%s", flag, value))
+		}
+	}
+	sort.Strings(extra)
+	return append(args, extra...)
+}
+
+func kubeConfigRequest(endpoint string, port int32, ns string, auth *authRequest) *kubeconfigs.Request {
 	return &kubeconfigs.Request{
 		ClusterContext:    defaultStr,
 		ClusterName:       defaultStr,
 		Namespace:         ns,
 		ApiServerEndpoint: endpoint,
+		ApiServerPort:     port,
 		Name:              auth.name,
 		AuthInfo:          auth,
 		Contexts: map[string]*clientcmdapi.Context{
@@ -172,30 +236,51 @@ func kubeConfigRequest(endpoint, ns string, auth *authRequest) *kubeconfigs.Requ
 	}
 }
 
-func authRequestFor(clusterName string, caSecret *v1.Secret) *authRequest {
+func authRequestFor(controlPlane *v1alpha1.ControlPlane, caSecret *v1.Secret) *authRequest {
 	_, caCert := secrets.Parse(caSecret)
-	return &authRequest{
-		name:   KubeProxyConfigNameFor(clusterName),
-		caCert: caCert,
+	request := &authRequest{
+		name:      KubeProxyConfigNameFor(controlPlane.ClusterName()),
+		caCert:    caCert,
+		tokenFile: legacyTokenFile,
+	}
+	if projectedTokenFor(controlPlane) != nil {
+		request.name = kubeProxyProjectedConfigNameFor(controlPlane.ClusterName())
+		request.tokenFile = projectedTokenDir + "/token"
 	}
+	return request
 }
 
 func KubeProxyConfigNameFor(clusterName string) string {
 	return fmt.Sprintf("%s-kubeproxy-config", clusterName)
 }
 
+// kubeProxyProjectedConfigNameFor the kubeconfig referencing the projected
+// token, existing kubeconfigs aren't regenerated so it's kept separately from
+// the kubeconfig referencing the legacy token
+func kubeProxyProjectedConfigNameFor(clusterName string) string {
+	return fmt.Sprintf("%s-kubeproxy-projected-config", clusterName)
+}
+
+func projectedTokenFor(controlPlane *v1alpha1.ControlPlane) *v1alpha1.ProjectedToken {
+	if controlPlane.Spec.KubeProxy == nil {
+		return nil
+	}
+	return controlPlane.Spec.KubeProxy.ProjectedToken
+}
+
 func labelsForKubeProxy() map[string]string {
 	return map[string]string{"k8s-app": "kube-proxy"}
 }
 
 type authRequest struct {
-	name   string
-	caCert []byte
+	name      string
+	caCert    []byte
+	tokenFile string
 }
 
 func (r *authRequest) Generate() (map[string]*clientcmdapi.AuthInfo, error) {
 	return map[string]*clientcmdapi.AuthInfo{
-		defaultStr: {TokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token"},
+		defaultStr: {TokenFile: r.tokenFile},
 	}, nil
 }
 
@@ -203,34 +288,94 @@ func (r *authRequest) CACert() []byte {
 	return r.caCert
 }
 
+// kubeProxyResourcesFor defaults the CPU request, so kube-proxy fits on small nodes
+func kubeProxyResourcesFor(controlPlane *v1alpha1.ControlPlane) v1.ResourceRequirements {
+	resources := v1.ResourceRequirements{}
+	if controlPlane.Spec.KubeProxy != nil && controlPlane.Spec.KubeProxy.Resources != nil {
+		resources = *controlPlane.Spec.KubeProxy.Resources.DeepCopy()
+	}
+	if resources.Requests == nil {
+		resources.Requests = v1.ResourceList{}
+	}
+	if _, ok := resources.Requests[v1.ResourceCPU]; !ok {
+		resources.Requests[v1.ResourceCPU] = defaultKubeProxyCPURequest
+		// Requests can't exceed the limit
+		if limit, ok := resources.Limits[v1.ResourceCPU]; ok && limit.Cmp(defaultKubeProxyCPURequest) < 0 {
+			resources.Requests[v1.ResourceCPU] = limit
+		}
+	}
+	return resources
+}
+
+// kubeProxyTolerationsFor tolerates the taints the node lifecycle controller
+// and the kubelet add, so kube-proxy isn't evicted from unhealthy nodes, but
+// not the taints set on nodes deliberately kept free for experiments
+func kubeProxyTolerationsFor(controlPlane *v1alpha1.ControlPlane) []v1.Toleration {
+	kubeProxy := controlPlane.Spec.KubeProxy
+	if kubeProxy != nil && kubeProxy.TolerateAllTaints {
+		return []v1.Toleration{{Operator: v1.TolerationOpExists}}
+	}
+	tolerations := []v1.Toleration{}
+	for _, key := range []string{
+		"node.kubernetes.io/not-ready",
+		"node.kubernetes.io/unreachable",
+		"node.kubernetes.io/disk-pressure",
+		"node.kubernetes.io/memory-pressure",
+		"node.kubernetes.io/pid-pressure",
+		"node.kubernetes.io/unschedulable",
+		"node.kubernetes.io/network-unavailable",
+		"node-role.kubernetes.io/control-plane",
+	} {
+		tolerations = append(tolerations, v1.Toleration{Key: key, Operator: v1.TolerationOpExists})
+	}
+	if kubeProxy != nil {
+		tolerations = append(tolerations, kubeProxy.Tolerations...)
+	}
+	return tolerations
+}
+
 func kubeProxyPodSpecFor(controlPlane *v1alpha1.ControlPlane) v1.PodSpec {
 	hostPathFileOrCreate := v1.HostPathFileOrCreate
-	return v1.PodSpec{
+	podSpec := v1.PodSpec{
 		TerminationGracePeriodSeconds: aws.Int64(1),
 		ServiceAccountName:            "kube-proxy",
 		HostNetwork:                   true,
 		DNSPolicy:                     v1.DNSClusterFirst,
 		PriorityClassName:             "system-node-critical",
-		Tolerations: []v1.Toleration{{
-			Operator: v1.TolerationOpExists,
-		}},
+		Tolerations:                   kubeProxyTolerationsFor(controlPlane),
 		Containers: []v1.Container{
 			{
-				Name:  "kubeproxy",
-				Image: imageprovider.KubeProxy(controlPlane.Spec.KubernetesVersion),
-				Resources: v1.ResourceRequirements{
-					Requests: map[v1.ResourceName]resource.Quantity{
-						v1.ResourceCPU: resource.MustParse("1"),
-					},
-				},
+				Name:      "kubeproxy",
+				Image:     imageprovider.KubeProxy(controlPlane.Spec.ImageRegistry, controlPlane.Spec.KubernetesVersion),
+				Resources: kubeProxyResourcesFor(controlPlane),
 				SecurityContext: &v1.SecurityContext{
 					Privileged: ptr.Bool(true),
 				},
 				Command: []string{"kube-proxy"},
-				Args: []string{
-					"--kubeconfig=/var/lib/kube-proxy/kubeconfig",
-					"--iptables-min-sync-period=0s",
-					"--oom-score-adj=-998",
+				Args:    kubeProxyArgsFor(controlPlane),
+				// With the host network the kubelet probes the node's address,
+				// which kube-proxy's healthz server listens on by default
+				Ports: []v1.ContainerPort{{
+					Name:          "healthz",
+					ContainerPort: kubeProxyHealthzPortFor(controlPlane),
+					Protocol:      v1.ProtocolTCP,
+				}},
+				ReadinessProbe: &v1.Probe{
+					Handler: v1.Handler{HTTPGet: &v1.HTTPGetAction{
+						Path: "/healthz",
+						Port: intstr.FromString("healthz"),
+					}},
+					InitialDelaySeconds: 5,
+					PeriodSeconds:       10,
+				},
+				LivenessProbe: &v1.Probe{
+					Handler: v1.Handler{HTTPGet: &v1.HTTPGetAction{
+						Path: "/healthz",
+						Port: intstr.FromString("healthz"),
+					}},
+					InitialDelaySeconds: 15,
+					PeriodSeconds:       20,
+					FailureThreshold:    3,
 				},
 				VolumeMounts: []v1.VolumeMount{{
 					Name:      "varlog",
@@ -284,4 +429,42 @@ func kubeProxyPodSpecFor(controlPlane *v1alpha1.ControlPlane) v1.PodSpec {
 			},
 		}},
 	}
+	if projectedToken := projectedTokenFor(controlPlane); projectedToken != nil {
+		addProjectedToken(&podSpec, projectedToken, kubeProxyProjectedConfigNameFor(controlPlane.ClusterName()))
+	}
+	return podSpec
+}
+
+// addProjectedToken replaces the auto-mounted service account token with a
+// bound token the kubelet rotates, and the kubeconfig referencing it
+func addProjectedToken(podSpec *v1.PodSpec, projectedToken *v1alpha1.ProjectedToken, kubeConfigName string) {
+	expirationSeconds := aws.Int64(3600)
+	if projectedToken.ExpirationSeconds != nil {
+		expirationSeconds = projectedToken.ExpirationSeconds
+	}
+	podSpec.AutomountServiceAccountToken = ptr.Bool(false)
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, v1.VolumeMount{
+		Name:      "kubeproxy-token",
+		MountPath: projectedTokenDir,
+		ReadOnly:  true,
+	})
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == "kubeproxy-kubeconfig" {
+			podSpec.Volumes[i].Secret.SecretName = kubeConfigName
+		}
+	}
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name: "kubeproxy-token",
+		VolumeSource: v1.VolumeSource{
+			Projected: &v1.ProjectedVolumeSource{
+				Sources: []v1.VolumeProjection{{
+					ServiceAccountToken: &v1.ServiceAccountTokenProjection{
+						Audience:          projectedToken.Audience,
+						ExpirationSeconds: expirationSeconds,
+						Path:              "token",
+					},
+				}},
+			},
+		},
+	})
 }
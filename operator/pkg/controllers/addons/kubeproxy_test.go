@@ -0,0 +1,295 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/controllers/etcd"
+	"github.com/awslabs/kit/operator/pkg/controllers/master"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestKubeProxyConntrackTimeouts(t *testing.T) {
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"},
+		Spec: v1alpha1.ControlPlaneSpec{KubeProxy: &v1alpha1.KubeProxy{
+			ConntrackTCPTimeoutEstablished: &metav1.Duration{Duration: 48 * time.Hour},
+			ConntrackTCPTimeoutCloseWait:   &metav1.Duration{Duration: 5 * time.Minute},
+		}},
+	}
+	if err := controlPlane.Validate(context.Background()); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	args := map[string]bool{}
+	for _, arg := range kubeProxyPodSpecFor(controlPlane).Containers[0].Args {
+		args[arg] = true
+	}
+	for _, expected := range []string{
+		"--conntrack-tcp-timeout-established=48h0m0s",
+		"--conntrack-tcp-timeout-close-wait=5m0s",
+	} {
+		if !args[expected] {
+			t.Errorf("expected kube-proxy arg %s", expected)
+		}
+	}
+	controlPlane.Spec.KubeProxy.ConntrackTCPTimeoutCloseWait.Duration = -time.Minute
+	if err := controlPlane.Validate(context.Background()); err == nil {
+		t.Errorf("expected negative conntrack timeout to fail validation")
+	}
+}
+
+func TestKubeProxyResources(t *testing.T) {
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}}
+	if cpu := kubeProxyPodSpecFor(controlPlane).Containers[0].Resources.Requests[v1.ResourceCPU]; cpu.String() != "100m" {
+		t.Errorf("expected the default CPU request of 100m, got %s", cpu.String())
+	}
+	controlPlane.Spec.KubeProxy = &v1alpha1.KubeProxy{Resources: &v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m"), v1.ResourceMemory: resource.MustParse("64Mi")},
+		Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("128Mi")},
+	}}
+	if err := controlPlane.Validate(context.Background()); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	resources := kubeProxyPodSpecFor(controlPlane).Containers[0].Resources
+	for name, expected := range map[v1.ResourceName]string{v1.ResourceCPU: "250m", v1.ResourceMemory: "64Mi"} {
+		if quantity := resources.Requests[name]; quantity.String() != expected {
+			t.Errorf("expected %s request %s, got %s", name, expected, quantity.String())
+		}
+	}
+	if memory := resources.Limits[v1.ResourceMemory]; memory.String() != "128Mi" {
+		t.Errorf("expected memory limit 128Mi, got %s", memory.String())
+	}
+	// Omitting the CPU request keeps the default rather than zero
+	controlPlane.Spec.KubeProxy.Resources = &v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("128Mi")}}
+	if cpu := kubeProxyPodSpecFor(controlPlane).Containers[0].Resources.Requests[v1.ResourceCPU]; cpu.String() != "100m" {
+		t.Errorf("expected the default CPU request of 100m, got %s", cpu.String())
+	}
+	controlPlane.Spec.KubeProxy.Resources = &v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")},
+		Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("200m")},
+	}
+	if err := controlPlane.Validate(context.Background()); err == nil {
+		t.Errorf("expected a request above the limit to fail validation")
+	}
+}
+
+func TestKubeProxyImageRegistry(t *testing.T) {
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"},
+		Spec:       v1alpha1.ControlPlaneSpec{KubernetesVersion: "1.21"},
+	}
+	if image := kubeProxyPodSpecFor(controlPlane).Containers[0].Image; image != "public.ecr.aws/eks-distro/kubernetes/kube-proxy:v1.21.2-eks-1-21-4" {
+		t.Errorf("expected the default kube-proxy image, got %s", image)
+	}
+	controlPlane.Spec.ImageRegistry = "123456789012.dkr.ecr.us-west-2.amazonaws.com/eks-distro/"
+	if err := controlPlane.Validate(context.Background()); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	if image := kubeProxyPodSpecFor(controlPlane).Containers[0].Image; image != "123456789012.dkr.ecr.us-west-2.amazonaws.com/eks-distro/kubernetes/kube-proxy:v1.21.2-eks-1-21-4" {
+		t.Errorf("expected the kube-proxy image from the control plane's registry, got %s", image)
+	}
+	controlPlane.Spec.ImageRegistry = "https://mirror.example.com"
+	if err := controlPlane.Validate(context.Background()); err == nil {
+		t.Errorf("expected a registry with a scheme to fail validation")
+	}
+}
+
+func TestKubeProxyExtraArgs(t *testing.T) {
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"},
+		Spec: v1alpha1.ControlPlaneSpec{KubeProxy: &v1alpha1.KubeProxy{
+			ExtraArgs: map[string]string{"iptables-min-sync-period": "1s", "proxy-mode": "ipvs"},
+		}},
+	}
+	if err := controlPlane.Validate(context.Background()); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	args := kubeProxyPodSpecFor(controlPlane).Containers[0].Args
+	// The user's value replaces the default in place, new flags are appended
+	expected := []string{
+		"--kubeconfig=/var/lib/kube-proxy/kubeconfig",
+		"--iptables-min-sync-period=1s",
+		"--oom-score-adj=-998",
+		"--proxy-mode=ipvs",
+	}
+	if strings.Join(args, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected kube-proxy args %v, got %v", expected, args)
+	}
+	controlPlane.Spec.KubeProxy.ExtraArgs = map[string]string{"--proxy-mode": "ipvs"}
+	if err := controlPlane.Validate(context.Background()); err == nil {
+		t.Errorf("expected a flag with leading dashes to fail validation")
+	}
+}
+
+func TestKubeProxyTolerations(t *testing.T) {
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}}
+	tolerates := func(taint v1.Taint) bool {
+		for _, toleration := range kubeProxyPodSpecFor(controlPlane).Tolerations {
+			if toleration.ToleratesTaint(&taint) {
+				return true
+			}
+		}
+		return false
+	}
+	notReady := v1.Taint{Key: "node.kubernetes.io/not-ready", Effect: v1.TaintEffectNoExecute}
+	experiment := v1.Taint{Key: "experiment", Value: "cordoned", Effect: v1.TaintEffectNoSchedule}
+	if !tolerates(notReady) {
+		t.Errorf("expected kube-proxy to tolerate %s", notReady.Key)
+	}
+	if tolerates(experiment) {
+		t.Errorf("expected kube-proxy not to tolerate %s", experiment.Key)
+	}
+	controlPlane.Spec.KubeProxy = &v1alpha1.KubeProxy{Tolerations: []v1.Toleration{{
+		Key: "experiment", Operator: v1.TolerationOpEqual, Value: "cordoned", Effect: v1.TaintEffectNoSchedule,
+	}}}
+	if !tolerates(experiment) || !tolerates(notReady) {
+		t.Errorf("expected the tolerations to be added to the defaults")
+	}
+	controlPlane.Spec.KubeProxy = &v1alpha1.KubeProxy{TolerateAllTaints: true}
+	if !tolerates(v1.Taint{Key: "anything", Effect: v1.TaintEffectNoExecute}) {
+		t.Errorf("expected kube-proxy to tolerate every taint")
+	}
+}
+
+func TestKubeProxyProjectedToken(t *testing.T) {
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}}
+	// The legacy token is the default
+	if podSpec := kubeProxyPodSpecFor(controlPlane); podSpec.AutomountServiceAccountToken != nil || len(podSpec.Volumes) != 4 {
+		t.Errorf("expected the auto-mounted token without a projected token, got %v", podSpec.Volumes)
+	}
+	auth, err := authRequestFor(controlPlane, &v1.Secret{}).Generate()
+	if err != nil {
+		t.Fatalf("generating auth info, %v", err)
+	}
+	if tokenFile := auth[defaultStr].TokenFile; tokenFile != legacyTokenFile {
+		t.Errorf("expected kubeconfig token file %s, got %s", legacyTokenFile, tokenFile)
+	}
+
+	controlPlane.Spec.KubeProxy = &v1alpha1.KubeProxy{ProjectedToken: &v1alpha1.ProjectedToken{Audience: "kube-proxy"}}
+	controlPlane.Spec.Master.APIServer = &v1alpha1.Component{Spec: &v1.PodSpec{Containers: []v1.Container{{
+		Name: "apiserver",
+		Args: []string{"--api-audiences=" + v1alpha1.ServiceAccountIssuer + ",kube-proxy"},
+	}}}}
+	if err := controlPlane.Validate(context.Background()); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	podSpec := kubeProxyPodSpecFor(controlPlane)
+	if podSpec.AutomountServiceAccountToken == nil || *podSpec.AutomountServiceAccountToken {
+		t.Errorf("expected the legacy token not to be auto-mounted")
+	}
+	volumes := map[string]v1.Volume{}
+	for _, volume := range podSpec.Volumes {
+		volumes[volume.Name] = volume
+	}
+	projected := volumes["kubeproxy-token"].Projected
+	if projected == nil || projected.Sources[0].ServiceAccountToken == nil {
+		t.Fatalf("expected a projected service account token volume, got %v", podSpec.Volumes)
+	}
+	if token := projected.Sources[0].ServiceAccountToken; token.Audience != "kube-proxy" || *token.ExpirationSeconds != 3600 {
+		t.Errorf("expected a token for audience kube-proxy expiring in 3600s, got %s in %ds", token.Audience, *token.ExpirationSeconds)
+	}
+	if name := volumes["kubeproxy-kubeconfig"].Secret.SecretName; name != "test-cluster-kubeproxy-projected-config" {
+		t.Errorf("expected kubeconfig secret test-cluster-kubeproxy-projected-config, got %s", name)
+	}
+	mounted := false
+	for _, mount := range podSpec.Containers[0].VolumeMounts {
+		mounted = mounted || (mount.Name == "kubeproxy-token" && mount.MountPath == projectedTokenDir)
+	}
+	if !mounted {
+		t.Errorf("expected the projected token to be mounted at %s", projectedTokenDir)
+	}
+	request := authRequestFor(controlPlane, &v1.Secret{})
+	if auth, err = request.Generate(); err != nil {
+		t.Fatalf("generating auth info, %v", err)
+	}
+	if request.name != "test-cluster-kubeproxy-projected-config" || auth[defaultStr].TokenFile != projectedTokenDir+"/token" {
+		t.Errorf("expected kubeconfig %s to reference %s/token, got %s", request.name, projectedTokenDir, auth[defaultStr].TokenFile)
+	}
+	controlPlane.Spec.KubeProxy.ProjectedToken.ExpirationSeconds = aws.Int64(60)
+	if err := controlPlane.Validate(context.Background()); err == nil {
+		t.Errorf("expected an expiration under 600s to fail validation")
+	}
+}
+
+func TestKubeProxyProbes(t *testing.T) {
+	ctx := context.Background()
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}}
+	guestCluster := fake.NewClientBuilder().WithScheme(scheme.GuestCluster).Build()
+	if err := KubeProxyController(kubeprovider.New(guestCluster), nil).daemonsetForKubeProxy(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling kube-proxy daemonset, %v", err)
+	}
+	daemonSet := &appsv1.DaemonSet{}
+	if err := guestCluster.Get(ctx, types.NamespacedName{Name: KubeProxyDaemonSetName, Namespace: kubeSystem}, daemonSet); err != nil {
+		t.Fatalf("getting kube-proxy daemonset, %v", err)
+	}
+	container := daemonSet.Spec.Template.Spec.Containers[0]
+	if len(container.Ports) != 1 || container.Ports[0].Name != "healthz" || container.Ports[0].ContainerPort != 10256 {
+		t.Errorf("expected the healthz port 10256 to be exposed, got %v", container.Ports)
+	}
+	for name, probe := range map[string]*v1.Probe{"readiness": container.ReadinessProbe, "liveness": container.LivenessProbe} {
+		if probe == nil || probe.HTTPGet == nil {
+			t.Errorf("expected a %s probe, got %v", name, probe)
+			continue
+		}
+		if probe.HTTPGet.Path != "/healthz" || probe.HTTPGet.Port.String() != "healthz" {
+			t.Errorf("expected the %s probe to get /healthz on the healthz port, got %s on %s", name, probe.HTTPGet.Path, probe.HTTPGet.Port.String())
+		}
+	}
+	// The probes follow the healthz server when it's moved
+	controlPlane.Spec.KubeProxy = &v1alpha1.KubeProxy{ExtraArgs: map[string]string{"healthz-bind-address": "0.0.0.0:10356"}}
+	if port := kubeProxyPodSpecFor(controlPlane).Containers[0].Ports[0].ContainerPort; port != 10356 {
+		t.Errorf("expected the healthz port 10356, got %d", port)
+	}
+}
+
+func TestMaxClusterNameLength(t *testing.T) {
+	name := strings.Repeat("a", v1alpha1.MaxClusterNameLength)
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if err := controlPlane.Validate(context.Background()); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	for _, derived := range []string{
+		master.ServiceNameFor(name),
+		master.RootCASecretNameFor(name),
+		master.KubeControllerManagerSecretNameFor(name),
+		etcd.DefragCronJobNameFor(name),
+		KubeProxyConfigNameFor(name),
+		kubeProxyProjectedConfigNameFor(name),
+	} {
+		if len(derived) > validation.DNS1123LabelMaxLength {
+			t.Errorf("expected %s to be no more than %d characters", derived, validation.DNS1123LabelMaxLength)
+		}
+	}
+	controlPlane.Name += "a"
+	err := controlPlane.Validate(context.Background())
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("must be no more than %d characters", v1alpha1.MaxClusterNameLength)) {
+		t.Errorf("expected the maximum name length in the error, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// bootstrapResourceName is the name of the ResourceQuota and LimitRange created
+// in each bootstrap namespace
+const bootstrapResourceName = "kit-bootstrap"
+
+type Namespaces struct {
+	kubeClient *kubeprovider.Client
+}
+
+func NamespacesController(kubeClient *kubeprovider.Client) *Namespaces {
+	return &Namespaces{kubeClient: kubeClient}
+}
+
+func (n *Namespaces) Reconcile(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	if controlPlane.Spec.Bootstrap == nil {
+		return nil
+	}
+	for _, namespace := range controlPlane.Spec.Bootstrap.Namespaces {
+		if err := n.reconcileNamespace(ctx, namespace); err != nil {
+			return fmt.Errorf("reconciling bootstrap namespace %s, %w", namespace.Name, err)
+		}
+	}
+	return nil
+}
+
+// Finalize leaves the namespaces in place as they're owned by the tenant
+func (n *Namespaces) Finalize(_ context.Context, _ *v1alpha1.ControlPlane) (err error) {
+	return nil
+}
+
+func (n *Namespaces) reconcileNamespace(ctx context.Context, namespace v1alpha1.BootstrapNamespace) error {
+	if err := n.kubeClient.EnsurePatch(ctx, &v1.Namespace{}, &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: namespace.Name, Labels: namespace.Labels},
+	}); err != nil {
+		return err
+	}
+	if len(namespace.ResourceQuota) > 0 {
+		hard, err := resourceListFor(namespace.ResourceQuota)
+		if err != nil {
+			return fmt.Errorf("resource quota, %w", err)
+		}
+		if err := n.kubeClient.EnsurePatch(ctx, &v1.ResourceQuota{}, &v1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: bootstrapResourceName, Namespace: namespace.Name},
+			Spec:       v1.ResourceQuotaSpec{Hard: hard},
+		}); err != nil {
+			return err
+		}
+	}
+	if namespace.LimitRange != nil {
+		limits := v1.LimitRangeItem{Type: v1.LimitTypeContainer}
+		for _, limit := range []struct {
+			quantities map[string]string
+			list       *v1.ResourceList
+		}{
+			{namespace.LimitRange.Default, &limits.Default},
+			{namespace.LimitRange.DefaultRequest, &limits.DefaultRequest},
+			{namespace.LimitRange.Max, &limits.Max},
+			{namespace.LimitRange.Min, &limits.Min},
+		} {
+			list, err := resourceListFor(limit.quantities)
+			if err != nil {
+				return fmt.Errorf("limit range, %w", err)
+			}
+			*limit.list = list
+		}
+		if err := n.kubeClient.EnsurePatch(ctx, &v1.LimitRange{}, &v1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: bootstrapResourceName, Namespace: namespace.Name},
+			Spec:       v1.LimitRangeSpec{Limits: []v1.LimitRangeItem{limits}},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resourceListFor(quantities map[string]string) (v1.ResourceList, error) {
+	if len(quantities) == 0 {
+		return nil, nil
+	}
+	list := v1.ResourceList{}
+	for name, quantity := range quantities {
+		parsed, err := resource.ParseQuantity(quantity)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s quantity %s, %w", name, quantity, err)
+		}
+		list[v1.ResourceName(name)] = parsed
+	}
+	return list, nil
+}
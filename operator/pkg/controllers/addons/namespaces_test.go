@@ -0,0 +1,91 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"testing"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestBootstrapNamespaces(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.GuestCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: v1alpha1.ControlPlaneSpec{Bootstrap: &v1alpha1.Bootstrap{Namespaces: []v1alpha1.BootstrapNamespace{{
+			Name:          "team-a",
+			Labels:        map[string]string{"team": "a"},
+			ResourceQuota: map[string]string{"requests.cpu": "4", "requests.memory": "8Gi"},
+			LimitRange: &v1alpha1.ContainerLimitRange{
+				Default:        map[string]string{"cpu": "500m"},
+				DefaultRequest: map[string]string{"cpu": "250m"},
+			},
+		}, {
+			Name:          "team-b",
+			ResourceQuota: map[string]string{"pods": "10"},
+		}}}},
+	}
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	controller := NamespacesController(kubeprovider.New(kubeClient))
+	// Applying is idempotent
+	for i := 0; i < 2; i++ {
+		if err := controller.Reconcile(ctx, controlPlane); err != nil {
+			t.Fatalf("reconciling namespaces, %v", err)
+		}
+	}
+	namespace := &v1.Namespace{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Name: "team-a"}, namespace); err != nil {
+		t.Fatalf("getting namespace, %v", err)
+	}
+	if namespace.Labels["team"] != "a" {
+		t.Errorf("expected namespace labels to be applied, got %v", namespace.Labels)
+	}
+	for namespace, expected := range map[string]v1.ResourceList{
+		"team-a": {v1.ResourceRequestsCPU: resource.MustParse("4"), v1.ResourceRequestsMemory: resource.MustParse("8Gi")},
+		"team-b": {v1.ResourcePods: resource.MustParse("10")},
+	} {
+		quota := &v1.ResourceQuota{}
+		if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: bootstrapResourceName}, quota); err != nil {
+			t.Fatalf("getting resource quota in %s, %v", namespace, err)
+		}
+		for name, quantity := range expected {
+			if actual := quota.Spec.Hard[name]; actual.Cmp(quantity) != 0 {
+				t.Errorf("expected %s quota %s=%s, got %s", namespace, name, quantity.String(), actual.String())
+			}
+		}
+	}
+	limitRange := &v1.LimitRange{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "team-a", Name: bootstrapResourceName}, limitRange); err != nil {
+		t.Fatalf("getting limit range, %v", err)
+	}
+	if cpu := limitRange.Spec.Limits[0].Default[v1.ResourceCPU]; cpu.String() != "500m" {
+		t.Errorf("expected default cpu limit 500m, got %s", cpu.String())
+	}
+	controlPlane.Spec.Bootstrap.Namespaces[1].ResourceQuota["pods"] = "ten"
+	if err := controlPlane.Validate(ctx); err == nil {
+		t.Errorf("expected invalid quantity to fail validation")
+	}
+}
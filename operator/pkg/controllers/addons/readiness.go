@@ -0,0 +1,114 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/object"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/apis"
+)
+
+// Readiness waits for the add-on rollouts to be ready when the ControlPlane
+// sets a readiness timeout, the add-on objects are otherwise reconciled as
+// soon as they're applied
+type Readiness struct {
+	kubeClient *kubeprovider.Client
+}
+
+func ReadinessController(kubeClient *kubeprovider.Client) *Readiness {
+	return &Readiness{kubeClient: kubeClient}
+}
+
+func (r *Readiness) Reconcile(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	// Nothing is applied in dry-run, so there's no rollout to wait for
+	if controlPlane.Spec.Addons == nil || controlPlane.Spec.Addons.ReadinessTimeout == nil || kubeprovider.IsDryRun(ctx) {
+		return nil
+	}
+	notReady, err := r.notReady(ctx)
+	if err != nil {
+		return err
+	}
+	if len(notReady) == 0 {
+		controlPlane.StatusConditions().ClearCondition(v1alpha1.AddonsProgressing)
+		return nil
+	}
+	timeout := controlPlane.Spec.Addons.ReadinessTimeout.Duration
+	progressing := controlPlane.StatusConditions().GetCondition(v1alpha1.AddonsProgressing)
+	if progressing == nil {
+		// The condition is only set when the wait starts, its transition time starts the timeout
+		controlPlane.StatusConditions().SetCondition(apis.Condition{
+			Type:    v1alpha1.AddonsProgressing,
+			Status:  v1.ConditionTrue,
+			Reason:  "WaitingForRollout",
+			Message: fmt.Sprintf("waiting for %s to be ready", strings.Join(notReady, ", ")),
+		})
+		return fmt.Errorf("add-ons %s not ready, %w", strings.Join(notReady, ", "), errors.WaitingForSubResources)
+	}
+	if progressing.IsTrue() && time.Since(progressing.LastTransitionTime.Inner.Time) < timeout {
+		return fmt.Errorf("add-ons %s not ready, %w", strings.Join(notReady, ", "), errors.WaitingForSubResources)
+	}
+	zap.S().Errorf("[%v] Add-ons %s not ready within %s", controlPlane.ClusterName(), strings.Join(notReady, ", "), timeout)
+	controlPlane.StatusConditions().MarkFalse(v1alpha1.AddonsProgressing, "ProgressDeadlineExceeded",
+		"%s not ready within %s", strings.Join(notReady, ", "), timeout)
+	return fmt.Errorf("add-ons %s not ready within %s", strings.Join(notReady, ", "), timeout)
+}
+
+func (r *Readiness) Finalize(_ context.Context, _ *v1alpha1.ControlPlane) (err error) {
+	return nil
+}
+
+// notReady returns the add-on DaemonSets and Deployments that haven't rolled
+// out their latest generation to all of their pods
+func (r *Readiness) notReady(ctx context.Context) (notReady []string, err error) {
+	daemonSet := &appsv1.DaemonSet{}
+	if err := r.kubeClient.Get(ctx, object.NamespacedName(KubeProxyDaemonSetName, kubeSystem), daemonSet); err != nil {
+		return nil, fmt.Errorf("getting daemonset %s, %w", KubeProxyDaemonSetName, err)
+	}
+	if !daemonSetReady(daemonSet) {
+		notReady = append(notReady, "daemonset/"+daemonSet.Name)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.kubeClient.Get(ctx, object.NamespacedName("coredns", kubeSystem), deployment); err != nil {
+		return nil, fmt.Errorf("getting deployment coredns, %w", err)
+	}
+	if !deploymentReady(deployment) {
+		notReady = append(notReady, "deployment/"+deployment.Name)
+	}
+	return notReady, nil
+}
+
+func daemonSetReady(daemonSet *appsv1.DaemonSet) bool {
+	return daemonSet.Status.ObservedGeneration >= daemonSet.Generation &&
+		daemonSet.Status.NumberReady == daemonSet.Status.DesiredNumberScheduled
+}
+
+func deploymentReady(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.AvailableReplicas >= replicas
+}
@@ -0,0 +1,83 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReadinessWaitsForDaemonSet(t *testing.T) {
+	ctx := context.Background()
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: KubeProxyDaemonSetName, Namespace: kubeSystem},
+		Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, NumberReady: 0},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.GuestCluster).WithObjects(daemonSet, &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: kubeSystem},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.Int32(2)},
+		Status:     appsv1.DeploymentStatus{AvailableReplicas: 2},
+	}).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: v1alpha1.ControlPlaneSpec{Addons: &v1alpha1.Addons{
+			ReadinessTimeout: &metav1.Duration{Duration: 5 * time.Minute},
+		}},
+	}
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	controller := ReadinessController(kubeprovider.New(kubeClient))
+	if err := controller.Reconcile(ctx, controlPlane); !errors.IsWaitingForSubResource(err) {
+		t.Fatalf("expected to wait for the daemonset, got %v", err)
+	}
+	progressing := controlPlane.StatusConditions().GetCondition(v1alpha1.AddonsProgressing)
+	if progressing == nil || !progressing.IsTrue() {
+		t.Fatalf("expected add-ons to be progressing, got %v", progressing)
+	}
+	// A daemonset stuck at 0 ready past the timeout is no longer progressing
+	for i := range controlPlane.Status.Conditions {
+		if controlPlane.Status.Conditions[i].Type == v1alpha1.AddonsProgressing {
+			controlPlane.Status.Conditions[i].LastTransitionTime = apis.VolatileTime{Inner: metav1.NewTime(time.Now().Add(-10 * time.Minute))}
+		}
+	}
+	if err := controller.Reconcile(ctx, controlPlane); err == nil || errors.IsWaitingForSubResource(err) {
+		t.Fatalf("expected the readiness timeout to be exceeded, got %v", err)
+	}
+	if progressing := controlPlane.StatusConditions().GetCondition(v1alpha1.AddonsProgressing); !progressing.IsFalse() || progressing.Reason != "ProgressDeadlineExceeded" {
+		t.Errorf("expected progressing to be false after the timeout, got %v", progressing)
+	}
+	daemonSet.Status.NumberReady = 3
+	if err := kubeClient.Status().Update(ctx, daemonSet); err != nil {
+		t.Fatalf("updating daemonset status, %v", err)
+	}
+	if err := controller.Reconcile(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling readiness, %v", err)
+	}
+	if progressing := controlPlane.StatusConditions().GetCondition(v1alpha1.AddonsProgressing); progressing != nil {
+		t.Errorf("expected progressing to be removed once ready, got %v", progressing)
+	}
+}
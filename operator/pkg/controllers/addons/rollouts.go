@@ -0,0 +1,191 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// rolloutTimeout bounds how long a cluster holds a rollout slot, a cluster
+// whose add-ons never become ready would otherwise keep it forever
+const rolloutTimeout = 10 * time.Minute
+
+// RolloutLimiter bounds how many clusters roll out their add-ons at once, so
+// a change to every cluster's add-ons, i.e. a new kube-proxy image, doesn't
+// roll all of them on the shared substrate at the same time. A cluster takes a
+// slot when it changes the spec of an add-on DaemonSet or Deployment and holds
+// it until the rollouts are ready or the timeout passes, clusters without a
+// slot are requeued.
+type RolloutLimiter struct {
+	mu      sync.Mutex
+	max     int
+	timeout time.Duration
+	// holders maps the clusters holding a slot to when they acquired it
+	holders map[string]time.Time
+}
+
+// NewRolloutLimiter allows max concurrent rollouts, zero is unlimited
+func NewRolloutLimiter(max int) *RolloutLimiter {
+	return &RolloutLimiter{max: max, timeout: rolloutTimeout, holders: map[string]time.Time{}}
+}
+
+func (l *RolloutLimiter) acquire(cluster string) bool {
+	if l == nil || l.max <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Changes while holding the slot don't extend the timeout, a cluster
+	// changing its add-ons on every reconcile would otherwise never release it
+	if _, ok := l.holders[cluster]; ok {
+		return true
+	}
+	if len(l.holders) >= l.max {
+		l.expire()
+		if len(l.holders) >= l.max {
+			return false
+		}
+	}
+	l.holders[cluster] = time.Now()
+	return true
+}
+
+// expire releases the slots held for longer than the timeout
+func (l *RolloutLimiter) expire() {
+	for cluster, acquired := range l.holders {
+		if time.Since(acquired) >= l.timeout {
+			zap.S().Errorf("[%v] Add-on rollout not ready within %s, releasing its rollout slot", cluster, l.timeout)
+			delete(l.holders, cluster)
+		}
+	}
+}
+
+func (l *RolloutLimiter) holds(cluster string) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.holders[cluster]
+	return ok
+}
+
+func (l *RolloutLimiter) release(cluster string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.holders, cluster)
+}
+
+// withRolloutSlot applies the add-ons with a guest cluster client that takes a
+// rollout slot before changing a DaemonSet or Deployment, so resyncs that
+// don't change anything never wait for one. The slot is released when the
+// guest cluster's add-on rollouts are ready.
+func (c *Controller) withRolloutSlot(ctx context.Context, controlPlane *v1alpha1.ControlPlane,
+	guestClusterClient *kubeprovider.Client, apply func(*kubeprovider.Client) error) error {
+	// Nothing is applied in dry-run, so there's nothing to roll out
+	if kubeprovider.IsDryRun(ctx) {
+		return apply(guestClusterClient)
+	}
+	cluster := controlPlane.Namespace + "/" + controlPlane.ClusterName()
+	gated := &rolloutClient{Client: guestClusterClient.Client, acquire: func() error {
+		if !c.rollouts.acquire(cluster) {
+			return fmt.Errorf("add-on rollouts limited to %d clusters at once, %w", c.rollouts.max, errors.WaitingForSubResources)
+		}
+		return nil
+	}}
+	if err := apply(&kubeprovider.Client{Client: gated, ConflictBackoff: guestClusterClient.ConflictBackoff}); err != nil {
+		return err
+	}
+	if !c.rollouts.holds(cluster) {
+		return nil
+	}
+	notReady, err := ReadinessController(guestClusterClient).notReady(ctx)
+	if err != nil {
+		// The slot is kept until the rollouts are known to be ready
+		zap.S().Errorf("[%v] Checking add-on rollouts, %v", controlPlane.ClusterName(), err)
+		return nil
+	}
+	if len(notReady) == 0 {
+		c.rollouts.release(cluster)
+	}
+	return nil
+}
+
+// rolloutClient calls acquire before a create or patch changes the spec of a
+// DaemonSet or Deployment. Patches are dry-run first so the spec is compared
+// after the API server's defaulting.
+type rolloutClient struct {
+	client.Client
+	acquire func() error
+}
+
+func (r *rolloutClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := workloadSpec(obj); ok {
+		if err := r.acquire(); err != nil {
+			return err
+		}
+	}
+	return r.Client.Create(ctx, obj, opts...)
+}
+
+func (r *rolloutClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if _, ok := workloadSpec(obj); !ok {
+		return r.Client.Patch(ctx, obj, patch, opts...)
+	}
+	// Getting into a copy of obj would keep the fields missing from the existing object
+	existing := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(client.Object)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+		return err
+	}
+	patched := obj.DeepCopyObject().(client.Object)
+	if err := r.Client.Patch(ctx, patched, patch, append(opts, client.DryRunAll)...); err != nil {
+		return err
+	}
+	desired, _ := workloadSpec(patched)
+	current, _ := workloadSpec(existing)
+	if !equality.Semantic.DeepEqual(current, desired) {
+		if err := r.acquire(); err != nil {
+			return err
+		}
+	}
+	return r.Client.Patch(ctx, obj, patch, opts...)
+}
+
+// workloadSpec returns the spec of a DaemonSet or Deployment, changing it
+// rolls out new pods
+func workloadSpec(obj client.Object) (interface{}, bool) {
+	switch workload := obj.(type) {
+	case *appsv1.DaemonSet:
+		return workload.Spec, true
+	case *appsv1.Deployment:
+		return workload.Spec, true
+	}
+	return nil, false
+}
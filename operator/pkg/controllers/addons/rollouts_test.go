@@ -0,0 +1,168 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// guestClusterWithRollout returns a guest cluster client whose coredns
+// rollout is ready or in progress
+func guestClusterWithRollout(ready bool) *kubeprovider.Client {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: kubeSystem},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.Int32(2)},
+	}
+	if ready {
+		deployment.Status.AvailableReplicas = 2
+	}
+	return kubeprovider.New(fake.NewClientBuilder().WithScheme(scheme.GuestCluster).WithObjects(deployment, &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: KubeProxyDaemonSetName, Namespace: kubeSystem},
+		Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, NumberReady: 3},
+	}).Build())
+}
+
+// patchKubeProxy returns an apply that patches the kube-proxy image, an empty
+// image leaves the DaemonSet's spec unchanged
+func patchKubeProxy(image string, applied func()) func(*kubeprovider.Client) error {
+	return func(kubeClient *kubeprovider.Client) error {
+		daemonSet := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: KubeProxyDaemonSetName, Namespace: kubeSystem}}
+		if image != "" {
+			daemonSet.Spec.Template.Spec.Containers = []v1.Container{{Name: "kube-proxy", Image: image}}
+		}
+		if err := kubeClient.EnsurePatch(context.Background(), &appsv1.DaemonSet{}, daemonSet); err != nil {
+			return err
+		}
+		applied()
+		return nil
+	}
+}
+
+func TestRolloutLimiterBoundsConcurrentRollouts(t *testing.T) {
+	ctx := context.Background()
+	controller := &Controller{rollouts: NewRolloutLimiter(2)}
+	var active, maxActive int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("cluster-%d", i), Namespace: "default"}}
+			guestClusterClient := guestClusterWithRollout(true)
+			// Clusters without a slot are requeued until one is released
+			for {
+				err := controller.withRolloutSlot(ctx, controlPlane, guestClusterClient, patchKubeProxy("kube-proxy:v2", func() {
+					current := atomic.AddInt32(&active, 1)
+					for {
+						observed := atomic.LoadInt32(&maxActive)
+						if current <= observed || atomic.CompareAndSwapInt32(&maxActive, observed, current) {
+							break
+						}
+					}
+					time.Sleep(10 * time.Millisecond)
+					atomic.AddInt32(&active, -1)
+				}))
+				if err == nil {
+					return
+				}
+				if !errors.IsWaitingForSubResource(err) {
+					t.Errorf("reconciling add-ons, %v", err)
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if maxActive > 2 {
+		t.Errorf("expected at most 2 concurrent rollouts, got %d", maxActive)
+	}
+}
+
+func TestRolloutLimiterHoldsSlotUntilReady(t *testing.T) {
+	ctx := context.Background()
+	controller := &Controller{rollouts: NewRolloutLimiter(1)}
+	rolling := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "rolling", Namespace: "default"}}
+	queued := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "queued", Namespace: "default"}}
+	applied := map[string]int{}
+	apply := func(controlPlane *v1alpha1.ControlPlane) func(*kubeprovider.Client) error {
+		return patchKubeProxy("kube-proxy:v2", func() { applied[controlPlane.Name]++ })
+	}
+	if err := controller.withRolloutSlot(ctx, rolling, guestClusterWithRollout(false), apply(rolling)); err != nil {
+		t.Fatalf("reconciling add-ons, %v", err)
+	}
+	if err := controller.withRolloutSlot(ctx, queued, guestClusterWithRollout(true), apply(queued)); !errors.IsWaitingForSubResource(err) {
+		t.Fatalf("expected to wait for a rollout slot, got %v", err)
+	}
+	// The cluster holding the slot keeps reconciling while it rolls out
+	if err := controller.withRolloutSlot(ctx, rolling, guestClusterWithRollout(true), apply(rolling)); err != nil {
+		t.Fatalf("reconciling add-ons, %v", err)
+	}
+	if err := controller.withRolloutSlot(ctx, queued, guestClusterWithRollout(true), apply(queued)); err != nil {
+		t.Fatalf("expected the slot to be released, got %v", err)
+	}
+	if applied["rolling"] != 2 || applied["queued"] != 1 {
+		t.Errorf("expected add-ons to be applied only with a slot, got %v", applied)
+	}
+}
+
+func TestRolloutLimiterNeverReadyCluster(t *testing.T) {
+	ctx := context.Background()
+	controller := &Controller{rollouts: NewRolloutLimiter(1)}
+	stuck := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "stuck", Namespace: "default"}}
+	steady := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "steady", Namespace: "default"}}
+	changed := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "changed", Namespace: "default"}}
+	stuckClient := guestClusterWithRollout(false)
+	if err := controller.withRolloutSlot(ctx, stuck, stuckClient, patchKubeProxy("kube-proxy:v2", func() {})); err != nil {
+		t.Fatalf("reconciling add-ons, %v", err)
+	}
+	// Resyncs that don't change a spec never wait for a slot
+	if err := controller.withRolloutSlot(ctx, stuck, stuckClient, patchKubeProxy("kube-proxy:v2", func() {})); err != nil {
+		t.Fatalf("reconciling add-ons, %v", err)
+	}
+	if err := controller.withRolloutSlot(ctx, steady, guestClusterWithRollout(true), patchKubeProxy("", func() {})); err != nil {
+		t.Fatalf("expected an unchanged spec to reconcile without a slot, got %v", err)
+	}
+	if err := controller.withRolloutSlot(ctx, changed, guestClusterWithRollout(false), patchKubeProxy("kube-proxy:v2", func() {})); !errors.IsWaitingForSubResource(err) {
+		t.Fatalf("expected to wait for a rollout slot, got %v", err)
+	}
+	// The never-ready cluster's slot is released after the timeout, even if it
+	// keeps changing its add-ons
+	controller.rollouts.holders["default/stuck"] = time.Now().Add(-rolloutTimeout)
+	if err := controller.withRolloutSlot(ctx, stuck, stuckClient, patchKubeProxy("kube-proxy:v3", func() {})); err != nil {
+		t.Fatalf("reconciling add-ons, %v", err)
+	}
+	if err := controller.withRolloutSlot(ctx, changed, guestClusterWithRollout(false), patchKubeProxy("kube-proxy:v2", func() {})); err != nil {
+		t.Fatalf("expected the timed out slot to be released, got %v", err)
+	}
+	if controller.rollouts.holds("default/stuck") || !controller.rollouts.holds("default/changed") {
+		t.Errorf("expected the slot to move from the never-ready cluster, got %v", controller.rollouts.holders)
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/imageprovider"
+	"knative.dev/pkg/ptr"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const awsNode = "aws-node"
+
+// vpcCNIDefaultEnv is aws-node's environment in the upstream manifest. Custom
+// networking is off so no ENIConfigs are needed, pods get addresses from the
+// node's subnet.
+var vpcCNIDefaultEnv = []v1.EnvVar{
+	{Name: "ADDITIONAL_ENI_TAGS", Value: "{}"},
+	{Name: "AWS_VPC_CNI_NODE_PORT_SUPPORT", Value: "true"},
+	{Name: "AWS_VPC_ENI_MTU", Value: "9001"},
+	{Name: "AWS_VPC_K8S_CNI_CONFIGURE_RPFILTER", Value: "false"},
+	{Name: "AWS_VPC_K8S_CNI_CUSTOM_NETWORK_CFG", Value: "false"},
+	{Name: "AWS_VPC_K8S_CNI_EXTERNALSNAT", Value: "false"},
+	{Name: "AWS_VPC_K8S_CNI_LOGLEVEL", Value: "DEBUG"},
+	{Name: "AWS_VPC_K8S_CNI_LOG_FILE", Value: "/host/var/log/aws-routed-eni/ipamd.log"},
+	{Name: "AWS_VPC_K8S_CNI_RANDOMIZESNAT", Value: "prng"},
+	{Name: "AWS_VPC_K8S_CNI_VETHPREFIX", Value: "eni"},
+	{Name: "AWS_VPC_K8S_PLUGIN_LOG_FILE", Value: "/var/log/aws-routed-eni/plugin.log"},
+	{Name: "AWS_VPC_K8S_PLUGIN_LOG_LEVEL", Value: "DEBUG"},
+	{Name: "DISABLE_INTROSPECTION", Value: "false"},
+	{Name: "DISABLE_METRICS", Value: "false"},
+	{Name: "DISABLE_NETWORK_RESOURCE_PROVISIONING", Value: "false"},
+	{Name: "ENABLE_IPv4", Value: "true"},
+	{Name: "ENABLE_IPv6", Value: "false"},
+	{Name: "ENABLE_POD_ENI", Value: "false"},
+	{Name: "ENABLE_PREFIX_DELEGATION", Value: "false"},
+	{Name: "WARM_ENI_TARGET", Value: "1"},
+	{Name: "WARM_PREFIX_TARGET", Value: "1"},
+}
+
+// vpcCNI runs the Amazon VPC CNI's aws-node daemon, which allocates ENIs with
+// the instance profile of the guest cluster's nodes
+type vpcCNI struct {
+	kubeClient *kubeprovider.Client
+}
+
+func (c *vpcCNI) ensure(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	for _, reconcile := range []func(context.Context, *v1alpha1.ControlPlane) error{
+		c.serviceAccount,
+		c.clusterRole,
+		c.clusterRoleBinding,
+		c.daemonSet,
+	} {
+		if err := reconcile(ctx, controlPlane); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *vpcCNI) installed(ctx context.Context) (bool, error) {
+	return installedBy(ctx, c.kubeClient, v1alpha1.CNIPluginVPCCNI, awsNode)
+}
+
+func (c *vpcCNI) remove(ctx context.Context) error {
+	for _, object := range []client.Object{
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: awsNode, Namespace: kubeSystem}},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: awsNode}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: awsNode}},
+		&v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: awsNode, Namespace: kubeSystem}},
+	} {
+		if err := c.kubeClient.Delete(ctx, object); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("deleting %s, %w", object.GetName(), err)
+		}
+	}
+	return nil
+}
+
+func (c *vpcCNI) serviceAccount(ctx context.Context, _ *v1alpha1.ControlPlane) error {
+	return c.kubeClient.EnsurePatch(ctx, &v1.ServiceAccount{}, &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: awsNode, Namespace: kubeSystem},
+	})
+}
+
+func (c *vpcCNI) clusterRole(ctx context.Context, _ *v1alpha1.ControlPlane) error {
+	return c.kubeClient.EnsurePatch(ctx, &rbacv1.ClusterRole{}, &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: awsNode},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{"crd.k8s.amazonaws.com"},
+			Resources: []string{"*"},
+			Verbs:     []string{"list", "watch", "get"},
+		}, {
+			APIGroups: []string{""},
+			Resources: []string{"pods", "namespaces"},
+			Verbs:     []string{"list", "watch", "get"},
+		}, {
+			APIGroups: []string{""},
+			Resources: []string{"nodes"},
+			Verbs:     []string{"list", "watch", "get", "update"},
+		}, {
+			APIGroups: []string{"extensions"},
+			Resources: []string{"*"},
+			Verbs:     []string{"list", "watch"},
+		}, {
+			APIGroups: []string{"", "events.k8s.io"},
+			Resources: []string{"events"},
+			Verbs:     []string{"create", "patch", "list"},
+		}},
+	})
+}
+
+func (c *vpcCNI) clusterRoleBinding(ctx context.Context, _ *v1alpha1.ControlPlane) error {
+	return c.kubeClient.EnsureCreate(ctx, &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: awsNode},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     awsNode,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      awsNode,
+			Namespace: kubeSystem,
+		}},
+	})
+}
+
+func (c *vpcCNI) daemonSet(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	labels := map[string]string{"k8s-app": awsNode}
+	directoryOrCreate := v1.HostPathDirectoryOrCreate
+	fileOrCreate := v1.HostPathFileOrCreate
+	maxUnavailable := intstr.FromString("10%")
+	healthProbe := &v1.Probe{
+		Handler:             v1.Handler{Exec: &v1.ExecAction{Command: []string{"/app/grpc-health-probe", "-addr=:50051", "-connect-timeout=5s", "-rpc-timeout=5s"}}},
+		InitialDelaySeconds: 1,
+		TimeoutSeconds:      10,
+	}
+	hostPath := func(name, path string, pathType *v1.HostPathType) v1.Volume {
+		return v1.Volume{Name: name, VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: path, Type: pathType}}}
+	}
+	return c.kubeClient.EnsurePatch(ctx, &appsv1.DaemonSet{}, &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: awsNode, Namespace: kubeSystem, Labels: cniLabels(v1alpha1.CNIPluginVPCCNI, labels)},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			UpdateStrategy: appsv1.DaemonSetUpdateStrategy{
+				Type:          appsv1.RollingUpdateDaemonSetStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDaemonSet{MaxUnavailable: &maxUnavailable},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					ServiceAccountName: awsNode,
+					PriorityClassName:  "system-node-critical",
+					HostNetwork:        true,
+					Tolerations:        []v1.Toleration{{Operator: v1.TolerationOpExists}},
+					InitContainers: []v1.Container{{
+						Name:            "aws-vpc-cni-init",
+						Image:           imageprovider.AmazonK8sCNIInit(),
+						SecurityContext: &v1.SecurityContext{Privileged: ptr.Bool(true)},
+						Env: []v1.EnvVar{
+							{Name: "DISABLE_TCP_EARLY_DEMUX", Value: "false"},
+							{Name: "ENABLE_IPv6", Value: "false"},
+						},
+						VolumeMounts: []v1.VolumeMount{{Name: "cni-bin-dir", MountPath: "/host/opt/cni/bin"}},
+					}},
+					Containers: []v1.Container{{
+						Name:            awsNode,
+						Image:           imageprovider.AmazonK8sCNI(),
+						Ports:           []v1.ContainerPort{{Name: "metrics", ContainerPort: 61678}},
+						Env:             vpcCNIEnv(vpcCNISpecFor(controlPlane).Env),
+						SecurityContext: &v1.SecurityContext{Capabilities: &v1.Capabilities{Add: []v1.Capability{"NET_ADMIN"}}},
+						ReadinessProbe:  healthProbe,
+						LivenessProbe:   healthProbe,
+						VolumeMounts: []v1.VolumeMount{
+							{Name: "cni-bin-dir", MountPath: "/host/opt/cni/bin"},
+							{Name: "cni-net-dir", MountPath: "/host/etc/cni/net.d"},
+							{Name: "log-dir", MountPath: "/host/var/log/aws-routed-eni"},
+							{Name: "run-dir", MountPath: "/var/run/aws-node"},
+							{Name: "xtables-lock", MountPath: "/run/xtables.lock"},
+						},
+					}},
+					Volumes: []v1.Volume{
+						hostPath("cni-bin-dir", "/opt/cni/bin", nil),
+						hostPath("cni-net-dir", "/etc/cni/net.d", nil),
+						hostPath("log-dir", "/var/log/aws-routed-eni", &directoryOrCreate),
+						hostPath("run-dir", "/var/run/aws-node", &directoryOrCreate),
+						hostPath("xtables-lock", "/run/xtables.lock", &fileOrCreate),
+					},
+				},
+			},
+		},
+	})
+}
+
+// vpcCNIEnv is the default environment with the spec's overrides applied,
+// variables without a default are appended by name
+func vpcCNIEnv(overrides map[string]string) []v1.EnvVar {
+	env := []v1.EnvVar{}
+	added := sets.StringKeySet(overrides)
+	for _, variable := range vpcCNIDefaultEnv {
+		if value, ok := overrides[variable.Name]; ok {
+			variable.Value = value
+		}
+		env = append(env, variable)
+		added.Delete(variable.Name)
+	}
+	for _, name := range added.List() {
+		env = append(env, v1.EnvVar{Name: name, Value: overrides[name]})
+	}
+	return append(env, v1.EnvVar{Name: "MY_NODE_NAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}})
+}
+
+func vpcCNISpecFor(controlPlane *v1alpha1.ControlPlane) v1alpha1.VPCCNI {
+	if controlPlane.Spec.Addons == nil || controlPlane.Spec.Addons.VPCCNI == nil {
+		return v1alpha1.VPCCNI{}
+	}
+	return *controlPlane.Spec.Addons.VPCCNI
+}
@@ -17,6 +17,8 @@ package controlplane
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/awslabs/kit/operator/pkg/apis/controlplane"
 	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
@@ -27,6 +29,9 @@ import (
 	"github.com/awslabs/kit/operator/pkg/controllers/master"
 	"github.com/awslabs/kit/operator/pkg/kubeprovider"
 	"github.com/awslabs/kit/operator/pkg/results"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/apis"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -35,15 +40,25 @@ type controlPlane struct {
 	etcdController   *etcd.Controller
 	masterController *master.Controller
 	addonsController *addons.Controller
+	// components are reconciled in order
+	components   []controlplane.Controller
+	resyncPeriod time.Duration
 }
 
-// NewController returns a controller for managing controlPlane components of the cluster
-func NewController(kubeClient client.Client, account awsprovider.AccountMetadata, iamProvider controlplane.Controller) *controlPlane {
-	return &controlPlane{
+// NewController returns a controller for managing controlPlane components of
+// the cluster, at most addonRolloutConcurrency clusters roll out add-on
+// changes at once, zero is unlimited. Control planes are reconciled again
+// every resyncPeriod, re-applying the add-ons to correct changes made to them
+// in the guest cluster, zero disables the resync.
+func NewController(kubeClient client.Client, account awsprovider.AccountMetadata, iamProvider controlplane.Controller, loadBalancers awsprovider.LoadBalancerAttributes, addonRolloutConcurrency int, resyncPeriod time.Duration) *controlPlane {
+	c := &controlPlane{
 		etcdController:   etcd.New(kubeprovider.New(kubeClient)),
-		masterController: master.New(kubeprovider.New(kubeClient), account, iamProvider),
-		addonsController: addons.New(kubeprovider.New(kubeClient)),
+		masterController: master.New(kubeprovider.New(kubeClient), account, iamProvider, loadBalancers),
+		addonsController: addons.New(kubeprovider.New(kubeClient), addons.NewRolloutLimiter(addonRolloutConcurrency)),
+		resyncPeriod:     resyncPeriod,
 	}
+	c.components = []controlplane.Controller{c.etcdController, c.masterController, c.addonsController}
+	return c
 }
 
 // Name returns the name of the controller
@@ -56,22 +71,56 @@ func (c *controlPlane) For() controllers.Object {
 	return &v1alpha1.ControlPlane{}
 }
 
-// Reconcile will reconcile all the components running on the control plane
+// Reconcile will reconcile all the components running on the control plane,
+// in dry-run the objects are computed and the intended changes reported
 func (c *controlPlane) Reconcile(ctx context.Context, object controllers.Object) (res *reconcile.Result, err error) {
-	for _, resource := range []controlplane.Controller{
-		c.etcdController,
-		c.masterController,
-		c.addonsController,
-	} {
-		if err := resource.Reconcile(ctx, object.(*v1alpha1.ControlPlane)); err != nil {
-			return nil, fmt.Errorf("control plane reconciling, %w", err)
+	controlPlane := object.(*v1alpha1.ControlPlane)
+	var dryRun *kubeprovider.DryRun
+	if controlPlane.IsDryRun() {
+		ctx, dryRun = kubeprovider.WithDryRun(ctx)
+	} else {
+		controlPlane.StatusConditions().ClearCondition(v1alpha1.DryRun)
+	}
+	for _, resource := range c.components {
+		if err = resource.Reconcile(ctx, controlPlane); err != nil {
+			err = fmt.Errorf("control plane reconciling, %w", err)
+			break
 		}
 	}
-	return results.Created, nil
+	// Report the changes recorded before any error, later components may depend on objects not created in dry-run
+	if dryRun != nil {
+		reportDryRun(controlPlane, dryRun.Changes())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reconcile.Result{RequeueAfter: c.resyncPeriod}, nil
+}
+
+func reportDryRun(controlPlane *v1alpha1.ControlPlane, changes []string) {
+	for _, change := range changes {
+		zap.S().Infof("[%v] dry-run, would %s", controlPlane.ClusterName(), change)
+	}
+	message := "No changes"
+	if len(changes) > 0 {
+		message = strings.Join(changes, "; ")
+	}
+	controlPlane.StatusConditions().SetCondition(apis.Condition{
+		Type:    v1alpha1.DryRun,
+		Status:  v1.ConditionTrue,
+		Message: message,
+	})
 }
 
 func (c *controlPlane) Finalize(ctx context.Context, object controllers.Object) (*reconcile.Result, error) {
-	if err := c.masterController.Finalize(ctx, object.(*v1alpha1.ControlPlane)); err != nil {
+	controlPlane := object.(*v1alpha1.ControlPlane)
+	if err := controllers.FinalizeWithTimeout(ctx, controlPlane, controlPlane.FinalizeTimeout(), controllers.Finalizer{
+		Name:     "master",
+		Finalize: func(ctx context.Context) error { return c.masterController.Finalize(ctx, controlPlane) },
+	}, controllers.Finalizer{
+		Name:     "addons",
+		Finalize: func(ctx context.Context) error { return c.addonsController.Finalize(ctx, controlPlane) },
+	}); err != nil {
 		return results.Failed, err
 	}
 	return results.Terminated, nil
@@ -0,0 +1,105 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane"
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/controllers"
+	"github.com/awslabs/kit/operator/pkg/controllers/addons"
+	"github.com/awslabs/kit/operator/pkg/controllers/master"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestResyncCorrectsKubeProxyDrift(t *testing.T) {
+	ctx := context.Background()
+	cluster := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{KubeProxy: &v1alpha1.KubeProxy{ExtraArgs: map[string]string{"v": "2"}}},
+	}
+	substrateCluster := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).WithObjects(
+		cluster,
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: master.RootCASecretNameFor(cluster.ClusterName()), Namespace: cluster.Namespace}},
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: master.ServiceNameFor(cluster.ClusterName()), Namespace: cluster.Namespace},
+			Status:     v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.1"}}}},
+		},
+	).Build()
+	// The kubeconfig secret already exists, the test is about the daemonset
+	guestCluster := fake.NewClientBuilder().WithScheme(scheme.GuestCluster).WithObjects(
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: addons.KubeProxyConfigNameFor(cluster.ClusterName()), Namespace: "kube-system"}},
+	).Build()
+	resync := &controlPlane{
+		components:   []controlplane.Controller{addons.KubeProxyController(kubeprovider.New(guestCluster), kubeprovider.New(substrateCluster))},
+		resyncPeriod: time.Minute,
+	}
+	controller := &controllers.GenericController{Client: substrateCluster, Controller: resync}
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}}
+	daemonSet := func() *appsv1.DaemonSet {
+		daemonSet := &appsv1.DaemonSet{}
+		if err := guestCluster.Get(ctx, types.NamespacedName{Name: addons.KubeProxyDaemonSetName, Namespace: "kube-system"}, daemonSet); err != nil {
+			t.Fatalf("getting kube-proxy daemonset, %v", err)
+		}
+		return daemonSet
+	}
+	// A successful reconcile is requeued after the resync period
+	result, err := controller.Reconcile(ctx, request)
+	if err != nil {
+		t.Fatalf("reconciling control plane, %v", err)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("expected a resync after %s, got %s", time.Minute, result.RequeueAfter)
+	}
+	desired := daemonSet().Spec.Template
+	drifted := daemonSet()
+	drifted.Spec.Template.Spec.Containers[0].Image = "example.com/kube-proxy:edited"
+	drifted.Spec.Template.Spec.Containers[0].Args = append(drifted.Spec.Template.Spec.Containers[0].Args[:1], "--v=4")
+	if err := guestCluster.Update(ctx, drifted); err != nil {
+		t.Fatalf("editing kube-proxy daemonset, %v", err)
+	}
+	// The resync reconciles the unchanged control plane again
+	if _, err := controller.Reconcile(ctx, request); err != nil {
+		t.Fatalf("resyncing control plane, %v", err)
+	}
+	if template := daemonSet().Spec.Template; !equality.Semantic.DeepEqual(template, desired) {
+		t.Errorf("expected the resync to correct the edited daemonset, got image %s and args %v",
+			template.Spec.Containers[0].Image, template.Spec.Containers[0].Args)
+	}
+	// The template is stable, so kube-proxy isn't rolled out by every resync
+	if _, err := controller.Reconcile(ctx, request); err != nil {
+		t.Fatalf("resyncing control plane, %v", err)
+	}
+	if template := daemonSet().Spec.Template; !equality.Semantic.DeepEqual(template, desired) {
+		t.Errorf("expected the resync not to change the pod template")
+	}
+
+	// A zero period disables the resync
+	resync.resyncPeriod = 0
+	if result, err := controller.Reconcile(ctx, request); err != nil || result.RequeueAfter != 0 {
+		t.Errorf("expected no resync, got %s, %v", result.RequeueAfter, err)
+	}
+}
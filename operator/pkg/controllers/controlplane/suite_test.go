@@ -17,6 +17,7 @@ package controlplane_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
 	"github.com/awslabs/kit/operator/pkg/controllers"
@@ -52,6 +53,12 @@ type fakeIAMProvider struct{}
 func (f *fakeIAMProvider) Reconcile(_ context.Context, _ *v1alpha1.ControlPlane) error { return nil }
 func (f *fakeIAMProvider) Finalize(_ context.Context, _ *v1alpha1.ControlPlane) error  { return nil }
 
+type fakeLoadBalancers struct{}
+
+func (f *fakeLoadBalancers) Attributes(_ context.Context, _ string) (map[string]string, error) {
+	return nil, nil
+}
+
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "ControlPlane")
@@ -61,7 +68,7 @@ var _ = BeforeSuite(func() {
 	env = environment.New()
 	Expect(env.Start(scheme.SubstrateCluster)).To(Succeed(), "Failed to start environment")
 	kubeClient = env.Client
-	controller = controlplane.NewController(kubeClient, &fakeAccountProvider{}, &fakeIAMProvider{})
+	controller = controlplane.NewController(kubeClient, &fakeAccountProvider{}, &fakeIAMProvider{}, &fakeLoadBalancers{}, 0, time.Minute)
 })
 
 var _ = AfterSuite(func() {
@@ -0,0 +1,120 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/utils/imageprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/object"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	backupSnapshotDir = "/snapshots"
+	// backupUploadScript uploads the snapshot and deletes all but the most
+	// recent snapshots, snapshot keys are timestamps so they sort by age
+	backupUploadScript = `set -euo pipefail
+aws s3 cp "${SNAPSHOT_DIR}/snapshot.db" "s3://${BUCKET}/${PREFIX}$(date -u +%Y%m%dT%H%M%SZ).db"
+aws s3 ls "s3://${BUCKET}/${PREFIX}" | awk '{print $4}' | sort | head -n -"${RETENTION}" | while read -r snapshot; do
+  aws s3 rm "s3://${BUCKET}/${PREFIX}${snapshot}"
+done`
+)
+
+func (c *Controller) reconcileBackup(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	cronJob := backupCronJobFor(controlPlane)
+	if controlPlane.Spec.EtcdBackup == nil {
+		if err := c.kubeClient.Delete(ctx, cronJob); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("deleting etcd backup cronjob, %w", err)
+		}
+		return nil
+	}
+	return c.kubeClient.EnsurePatch(ctx, &batchv1beta1.CronJob{}, object.WithOwner(controlPlane, cronJob))
+}
+
+// backupCronJobFor saves a snapshot of the first member in an init container
+// and uploads it to S3, where it can be restored from with EtcdRestore
+func backupCronJobFor(controlPlane *v1alpha1.ControlPlane) *batchv1beta1.CronJob {
+	backup := v1alpha1.EtcdBackup{}
+	if controlPlane.Spec.EtcdBackup != nil {
+		backup = *controlPlane.Spec.EtcdBackup
+	}
+	if backup.Retention == 0 {
+		backup.Retention = v1alpha1.DefaultEtcdBackupRetention
+	}
+	env := []v1.EnvVar{
+		{Name: "SNAPSHOT_DIR", Value: backupSnapshotDir},
+		{Name: "BUCKET", Value: backup.Bucket},
+		{Name: "PREFIX", Value: BackupPrefixFor(controlPlane)},
+		{Name: "RETENTION", Value: fmt.Sprint(backup.Retention)},
+	}
+	if backup.Region != "" {
+		env = append(env, v1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: backup.Region})
+	}
+	snapshots := v1.VolumeMount{Name: "snapshots", MountPath: backupSnapshotDir}
+	// etcdctl saves the snapshot before it's uploaded
+	podSpec := etcdctlPodSpecFor(controlPlane, "etcd-snapshot",
+		"snapshot", "save", backupSnapshotDir+"/snapshot.db",
+		"--endpoints="+clientEndpointsFor(controlPlane, 1),
+	)
+	podSpec.InitContainers = podSpec.Containers
+	podSpec.InitContainers[0].VolumeMounts = append(podSpec.InitContainers[0].VolumeMounts, snapshots)
+	snapshots.ReadOnly = true
+	podSpec.Containers = []v1.Container{{
+		Name:         "etcd-snapshot-upload",
+		Image:        imageprovider.AWSCLI(),
+		Command:      []string{"/bin/bash", "-c", backupUploadScript},
+		Env:          env,
+		VolumeMounts: []v1.VolumeMount{snapshots},
+	}}
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name:         "snapshots",
+		VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+	})
+	return &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      BackupCronJobNameFor(controlPlane.ClusterName()),
+			Namespace: controlPlane.Namespace,
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:                   backup.Schedule,
+			ConcurrencyPolicy:          batchv1beta1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: aws.Int32(1),
+			FailedJobsHistoryLimit:     aws.Int32(3),
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					BackoffLimit: aws.Int32(1),
+					Template:     v1.PodTemplateSpec{Spec: podSpec},
+				},
+			},
+		},
+	}
+}
+
+func BackupCronJobNameFor(clusterName string) string {
+	return fmt.Sprintf("%s-etcd-backup", clusterName)
+}
+
+// BackupPrefixFor is the S3 key prefix of the control plane's snapshots
+func BackupPrefixFor(controlPlane *v1alpha1.ControlPlane) string {
+	return fmt.Sprintf("%s/%s/etcd-snapshots/", controlPlane.Namespace, controlPlane.ClusterName())
+}
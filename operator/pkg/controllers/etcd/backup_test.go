@@ -0,0 +1,76 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestBackupCronJob(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controller := &Controller{kubeClient: kubeprovider.New(kubeClient)}
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: v1alpha1.ControlPlaneSpec{EtcdBackup: &v1alpha1.EtcdBackup{
+			Schedule: "0 * * * *",
+			Bucket:   "test-bucket",
+		}},
+	}
+	controlPlane.SetDefaults(ctx)
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	if err := controller.reconcileBackup(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling backup, %v", err)
+	}
+	nn := types.NamespacedName{Namespace: "default", Name: BackupCronJobNameFor(controlPlane.ClusterName())}
+	cronJob := &batchv1beta1.CronJob{}
+	if err := kubeClient.Get(ctx, nn, cronJob); err != nil {
+		t.Fatalf("getting cronjob, %v", err)
+	}
+	podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	// The snapshot is saved from a single member, etcdctl snapshot save
+	// doesn't accept more than one endpoint
+	if args := strings.Join(podSpec.InitContainers[0].Args, " "); !strings.Contains(args,
+		"snapshot save /snapshots/snapshot.db --endpoints=https://test-cluster-etcd-0.test-cluster-etcd.default.svc.cluster.local:2379 ") {
+		t.Errorf("expected a snapshot of the first member, got %s", args)
+	}
+	env := map[string]string{}
+	for _, variable := range podSpec.Containers[0].Env {
+		env[variable.Name] = variable.Value
+	}
+	if env["BUCKET"] != "test-bucket" || env["PREFIX"] != "default/test-cluster/etcd-snapshots/" || env["RETENTION"] != "24" {
+		t.Errorf("expected snapshots uploaded to s3://test-bucket/default/test-cluster/etcd-snapshots/ keeping 24, got %v", env)
+	}
+
+	controlPlane.Spec.EtcdBackup = nil
+	if err := controller.reconcileBackup(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling backup, %v", err)
+	}
+	if err := kubeClient.Get(ctx, nn, &batchv1beta1.CronJob{}); err == nil {
+		t.Errorf("expected cronjob to be deleted when backups are disabled")
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// quotaBackendBytes is the etcd backend quota, etcd raises a NOSPACE alarm when exceeded
+	quotaBackendBytes = 8 * 1024 * 1024 * 1024
+	metricsPort       = 2381
+	dbSizeMetricName  = "etcd_mvcc_db_total_size_in_bytes"
+)
+
+var dbSizeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "kit",
+	Subsystem: "etcd",
+	Name:      "db_total_size_in_bytes",
+	Help:      "Size of the etcd database for each member of a control plane",
+}, []string{"namespace", "cluster", "member"})
+
+func init() {
+	metrics.Registry.MustRegister(dbSizeGauge)
+}
+
+// DBSizeSource returns the etcd database size in bytes keyed by member name
+type DBSizeSource interface {
+	DBSize(ctx context.Context, controlPlane *v1alpha1.ControlPlane) (map[string]float64, error)
+}
+
+func (c *Controller) reconcileDBSize(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	monitoring := controlPlane.Spec.EtcdMonitoring
+	if monitoring != nil && monitoring.Disabled {
+		return nil
+	}
+	sizes, err := c.dbSizeSource.DBSize(ctx, controlPlane)
+	if err != nil {
+		// etcd might not be running yet, this shouldn't block reconciling the control plane
+		zap.S().Debugf("[%v] getting etcd database size, %v", controlPlane.ClusterName(), err)
+		return nil
+	}
+	if len(sizes) == 0 {
+		return nil
+	}
+	threshold := v1alpha1.DefaultDBSizeThresholdPercent
+	if monitoring != nil && monitoring.DBSizeThresholdPercent != 0 {
+		threshold = monitoring.DBSizeThresholdPercent
+	}
+	var largest float64
+	for member, size := range sizes {
+		dbSizeGauge.WithLabelValues(controlPlane.Namespace, controlPlane.ClusterName(), member).Set(size)
+		if size > largest {
+			largest = size
+		}
+	}
+	if percent := largest * 100 / quotaBackendBytes; percent >= float64(threshold) {
+		controlPlane.StatusConditions().MarkFalse(v1alpha1.EtcdDBSizeHealthy, "DBSizeNearQuota",
+			"etcd database size %.0f bytes is %.1f%% of the %d bytes quota", largest, percent, quotaBackendBytes)
+		return nil
+	}
+	controlPlane.StatusConditions().MarkTrue(v1alpha1.EtcdDBSizeHealthy)
+	return nil
+}
+
+// metricsDBSizeSource scrapes the metrics endpoint of every running etcd member
+type metricsDBSizeSource struct {
+	kubeClient client.Client
+	httpClient *http.Client
+}
+
+func (m *metricsDBSizeSource) DBSize(ctx context.Context, controlPlane *v1alpha1.ControlPlane) (map[string]float64, error) {
+	pods := &v1.PodList{}
+	if err := m.kubeClient.List(ctx, pods, client.InNamespace(controlPlane.Namespace),
+		client.MatchingLabels(labelsFor(controlPlane.ClusterName()))); err != nil {
+		return nil, fmt.Errorf("listing etcd pods, %w", err)
+	}
+	sizes := map[string]float64{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		size, err := m.scrape(ctx, fmt.Sprintf("http://%s:%d/metrics", pod.Status.PodIP, metricsPort))
+		if err != nil {
+			return nil, fmt.Errorf("scraping etcd member %s, %w", pod.Name, err)
+		}
+		sizes[pod.Name] = size
+	}
+	return sizes, nil
+}
+
+func (m *metricsDBSizeSource) scrape(ctx context.Context, url string) (float64, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	response, err := m.httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	families, err := (&expfmt.TextParser{}).TextToMetricFamilies(response.Body)
+	if err != nil {
+		return 0, fmt.Errorf("parsing metrics, %w", err)
+	}
+	family, ok := families[dbSizeMetricName]
+	if !ok || len(family.GetMetric()) == 0 {
+		return 0, fmt.Errorf("metric %s not found", dbSizeMetricName)
+	}
+	return family.GetMetric()[0].GetGauge().GetValue(), nil
+}
+
+func newMetricsDBSizeSource(kubeClient client.Client) *metricsDBSizeSource {
+	return &metricsDBSizeSource{kubeClient: kubeClient, httpClient: &http.Client{Timeout: 5 * time.Second}}
+}
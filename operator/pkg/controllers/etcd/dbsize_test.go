@@ -0,0 +1,73 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeDBSizeSource struct {
+	sizes map[string]float64
+}
+
+func (f *fakeDBSizeSource) DBSize(_ context.Context, _ *v1alpha1.ControlPlane) (map[string]float64, error) {
+	return f.sizes, nil
+}
+
+func TestDBSizeCondition(t *testing.T) {
+	ctx := context.Background()
+	source := &fakeDBSizeSource{}
+	controller := &Controller{dbSizeSource: source}
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{EtcdMonitoring: &v1alpha1.EtcdMonitoring{DBSizeThresholdPercent: 50}},
+	}
+	for _, test := range []struct {
+		size     float64
+		expected v1.ConditionStatus
+	}{
+		{size: quotaBackendBytes * 0.49, expected: v1.ConditionTrue},
+		{size: quotaBackendBytes * 0.50, expected: v1.ConditionFalse},
+		{size: quotaBackendBytes * 0.30, expected: v1.ConditionTrue},
+	} {
+		source.sizes = map[string]float64{"test-cluster-etcd-0": quotaBackendBytes * 0.1, "test-cluster-etcd-1": test.size}
+		if err := controller.reconcileDBSize(ctx, controlPlane); err != nil {
+			t.Fatalf("reconciling db size, %v", err)
+		}
+		condition := controlPlane.StatusConditions().GetCondition(v1alpha1.EtcdDBSizeHealthy)
+		if condition == nil || condition.Status != test.expected {
+			t.Errorf("expected %s to be %s for size %.0f, got %v", v1alpha1.EtcdDBSizeHealthy, test.expected, test.size, condition)
+		}
+	}
+}
+
+func TestDBSizeDisabled(t *testing.T) {
+	controller := &Controller{dbSizeSource: &fakeDBSizeSource{sizes: map[string]float64{"test-cluster-etcd-0": quotaBackendBytes}}}
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{EtcdMonitoring: &v1alpha1.EtcdMonitoring{Disabled: true}},
+	}
+	if err := controller.reconcileDBSize(context.Background(), controlPlane); err != nil {
+		t.Fatalf("reconciling db size, %v", err)
+	}
+	if condition := controlPlane.StatusConditions().GetCondition(v1alpha1.EtcdDBSizeHealthy); condition != nil {
+		t.Errorf("expected no condition when monitoring is disabled, got %v", condition)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/utils/object"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (c *Controller) reconcileDefrag(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	cronJob := defragCronJobFor(controlPlane)
+	if controlPlane.Spec.EtcdDefrag == nil {
+		if err := c.kubeClient.Delete(ctx, cronJob); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("deleting etcd defrag cronjob, %w", err)
+		}
+		return nil
+	}
+	return c.kubeClient.EnsurePatch(ctx, &batchv1beta1.CronJob{}, object.WithOwner(controlPlane, cronJob))
+}
+
+// defragCronJobFor runs etcdctl defrag against all the members, etcdctl
+// defragments the endpoints sequentially so only one member is blocked at a
+// time, and the job doesn't run concurrently with a previous run.
+func defragCronJobFor(controlPlane *v1alpha1.ControlPlane) *batchv1beta1.CronJob {
+	schedule := ""
+	if controlPlane.Spec.EtcdDefrag != nil {
+		schedule = controlPlane.Spec.EtcdDefrag.Schedule
+	}
+	return &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DefragCronJobNameFor(controlPlane.ClusterName()),
+			Namespace: controlPlane.Namespace,
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:                   schedule,
+			ConcurrencyPolicy:          batchv1beta1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: aws.Int32(1),
+			FailedJobsHistoryLimit:     aws.Int32(3),
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					BackoffLimit: aws.Int32(0),
+					Template: v1.PodTemplateSpec{
+						Spec: etcdctlPodSpecFor(controlPlane, "etcd-defrag",
+							"defrag",
+							"--endpoints="+clientEndpointsFor(controlPlane, controlPlane.Spec.Etcd.Replicas),
+							"--command-timeout=5m",
+						),
+					},
+				},
+			},
+		},
+	}
+}
+
+func DefragCronJobNameFor(clusterName string) string {
+	return fmt.Sprintf("%s-etcd-defrag", clusterName)
+}
+
+// clientEndpointsFor the first members of the etcd cluster
+func clientEndpointsFor(controlPlane *v1alpha1.ControlPlane, members int) string {
+	endpoints := []string{}
+	for i := 0; i < members; i++ {
+		endpoints = append(endpoints, fmt.Sprintf("https://%s.%s:2379",
+			memberNameFor(controlPlane, i), SvcFQDN(controlPlane.ClusterName(), controlPlane.Namespace)))
+	}
+	return strings.Join(endpoints, ",")
+}
@@ -0,0 +1,73 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDefragCronJob(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controller := &Controller{kubeClient: kubeprovider.New(kubeClient)}
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{EtcdDefrag: &v1alpha1.EtcdDefrag{Schedule: "0 */6 * * *"}},
+	}
+	controlPlane.SetDefaults(ctx)
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	if err := controller.reconcileDefrag(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling defrag, %v", err)
+	}
+	nn := types.NamespacedName{Namespace: "default", Name: DefragCronJobNameFor(controlPlane.ClusterName())}
+	cronJob := &batchv1beta1.CronJob{}
+	if err := kubeClient.Get(ctx, nn, cronJob); err != nil {
+		t.Fatalf("getting cronjob, %v", err)
+	}
+	if cronJob.Spec.Schedule != "0 */6 * * *" {
+		t.Errorf("expected schedule 0 */6 * * *, got %s", cronJob.Spec.Schedule)
+	}
+	if cronJob.Spec.ConcurrencyPolicy != batchv1beta1.ForbidConcurrent {
+		t.Errorf("expected concurrent defrags to be forbidden, got %s", cronJob.Spec.ConcurrencyPolicy)
+	}
+	args := strings.Join(cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Args, " ")
+	if !strings.Contains(args, "https://test-cluster-etcd-2.test-cluster-etcd.default.svc.cluster.local:2379") {
+		t.Errorf("expected defrag of every member, got %s", args)
+	}
+
+	controlPlane.Spec.EtcdDefrag = nil
+	if err := controller.reconcileDefrag(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling defrag, %v", err)
+	}
+	if err := kubeClient.Get(ctx, nn, &batchv1beta1.CronJob{}); err == nil {
+		t.Errorf("expected cronjob to be deleted when defrag is disabled")
+	}
+	controlPlane.Spec.EtcdDefrag = &v1alpha1.EtcdDefrag{Schedule: "every six hours"}
+	if err := controlPlane.Validate(ctx); err == nil {
+		t.Errorf("expected invalid schedule to fail validation")
+	}
+}
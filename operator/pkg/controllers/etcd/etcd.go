@@ -29,21 +29,32 @@ const (
 )
 
 type Controller struct {
-	kubeClient *kubeprovider.Client
-	keypairs   *keypairs.Provider
+	kubeClient    *kubeprovider.Client
+	keypairs      *keypairs.Provider
+	dbSizeSource  DBSizeSource
+	memberRemover MemberRemover
 }
 
 type reconciler func(ctx context.Context, controlPlane *v1alpha1.ControlPlane) (err error)
 
 func New(kubeclient *kubeprovider.Client) *Controller {
-	return &Controller{kubeClient: kubeclient, keypairs: keypairs.Reconciler(kubeclient)}
+	return &Controller{
+		kubeClient:    kubeclient,
+		keypairs:      keypairs.Reconciler(kubeclient),
+		dbSizeSource:  newMetricsDBSizeSource(kubeclient),
+		memberRemover: &gatewayMemberRemover{kubeClient: kubeclient},
+	}
 }
 
 func (c *Controller) Reconcile(ctx context.Context, controlPlane *v1alpha1.ControlPlane) (err error) {
 	for _, reconcile := range []reconciler{
 		c.reconcileService,
 		c.reconcileSecrets,
+		c.reconcileRestore,
 		c.reconcileStatefulSet,
+		c.reconcileDefrag,
+		c.reconcileBackup,
+		c.reconcileDBSize,
 	} {
 		if err := reconcile(ctx, controlPlane); err != nil {
 			return err
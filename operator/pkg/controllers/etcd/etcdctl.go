@@ -0,0 +1,78 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/utils/imageprovider"
+	v1 "k8s.io/api/core/v1"
+)
+
+// etcdctlPodSpecFor runs etcdctl once with the etcd client certificate, for
+// maintenance jobs against the etcd cluster
+func etcdctlPodSpecFor(controlPlane *v1alpha1.ControlPlane, name string, args ...string) v1.PodSpec {
+	return v1.PodSpec{
+		RestartPolicy: v1.RestartPolicyNever,
+		Containers: []v1.Container{{
+			Name:    name,
+			Image:   imageprovider.ETCD(controlPlane.Spec.ImageRegistry),
+			Command: []string{"etcdctl"},
+			Args: append(args,
+				"--cacert=/etc/kubernetes/pki/etcd-ca/ca.crt",
+				"--cert=/etc/kubernetes/pki/etcd/etcd-client.crt",
+				"--key=/etc/kubernetes/pki/etcd/etcd-client.key",
+			),
+			Env: []v1.EnvVar{{Name: "ETCDCTL_API", Value: "3"}},
+			VolumeMounts: []v1.VolumeMount{{
+				Name:      "etcd-ca",
+				MountPath: "/etc/kubernetes/pki/etcd-ca",
+				ReadOnly:  true,
+			}, {
+				Name:      "etcd-client",
+				MountPath: "/etc/kubernetes/pki/etcd",
+				ReadOnly:  true,
+			}},
+		}},
+		Volumes: []v1.Volume{{
+			Name: "etcd-ca",
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{
+					SecretName:  CASecretNameFor(controlPlane.ClusterName()),
+					DefaultMode: aws.Int32(0400),
+					Items: []v1.KeyToPath{{
+						Key:  "public",
+						Path: "ca.crt",
+					}},
+				},
+			},
+		}, {
+			Name: "etcd-client",
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{
+					SecretName:  EtcdAPIClientSecretNameFor(controlPlane.ClusterName()),
+					DefaultMode: aws.Int32(0400),
+					Items: []v1.KeyToPath{{
+						Key:  "public",
+						Path: "etcd-client.crt",
+					}, {
+						Key:  "private",
+						Path: "etcd-client.key",
+					}},
+				},
+			},
+		}},
+	}
+}
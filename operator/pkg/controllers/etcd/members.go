@@ -0,0 +1,277 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/object"
+	"github.com/awslabs/kit/operator/pkg/utils/secrets"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	clusterStateNew      = "new"
+	clusterStateExisting = "existing"
+
+	initialClusterKey      = "ETCD_INITIAL_CLUSTER"
+	initialClusterStateKey = "ETCD_INITIAL_CLUSTER_STATE"
+)
+
+// MemberRemover removes the named member from the etcd cluster through the
+// client endpoint, removing a member that isn't in the cluster succeeds
+type MemberRemover interface {
+	RemoveMember(ctx context.Context, controlPlane *v1alpha1.ControlPlane, name, endpoint string) error
+}
+
+// membersFor returns the number of etcd members to run and the initial cluster
+// state for their pods. A new cluster starts with all of the replicas, an
+// existing cluster is scaled one member at a time, each member is added
+// through the member API before its pod is started so it joins the quorum
+// instead of bootstrapping a cluster of its own, and removed through the
+// member API before its pod is stopped so the quorum shrinks with it.
+func (c *Controller) membersFor(ctx context.Context, controlPlane *v1alpha1.ControlPlane) (int, string, error) {
+	desired := controlPlane.Spec.Etcd.Replicas
+	statefulSet := &appsv1.StatefulSet{}
+	if err := c.kubeClient.Get(ctx, object.NamespacedName(ServiceNameFor(controlPlane.ClusterName()), controlPlane.Namespace), statefulSet); err != nil {
+		if errors.IsNotFound(err) {
+			return desired, clusterStateNew, nil
+		}
+		return 0, "", fmt.Errorf("getting etcd statefulset, %w", err)
+	}
+	current := int(aws.Int32Value(statefulSet.Spec.Replicas))
+	clusterState, err := c.clusterStateFor(ctx, controlPlane)
+	if err != nil {
+		return 0, "", err
+	}
+	if desired == current {
+		return desired, clusterState, nil
+	}
+	if desired < current {
+		name := memberNameFor(controlPlane, current-1)
+		if kubeprovider.IsDryRun(ctx) {
+			return current, clusterState, nil
+		}
+		if err := c.memberRemover.RemoveMember(ctx, controlPlane, name, clientEndpointsFor(controlPlane, 1)); err != nil {
+			return current, clusterState, fmt.Errorf("removing etcd member %s, %w", name, err)
+		}
+		zap.S().Infof("[%v] Removed etcd member %s", controlPlane.ClusterName(), name)
+		return current - 1, clusterStateExisting, nil
+	}
+	// Adding a member changes the quorum, only add one once the existing members are healthy
+	if int(statefulSet.Status.ReadyReplicas) < current {
+		return current, clusterState, fmt.Errorf("etcd has %d of %d members ready, %w",
+			statefulSet.Status.ReadyReplicas, current, errors.WaitingForSubResources)
+	}
+	if err := c.addMember(ctx, controlPlane, current); err != nil {
+		return current, clusterState, err
+	}
+	if kubeprovider.IsDryRun(ctx) {
+		return current, clusterState, nil
+	}
+	zap.S().Infof("[%v] Added etcd member %s", controlPlane.ClusterName(), memberNameFor(controlPlane, current))
+	return current + 1, clusterStateExisting, nil
+}
+
+// clusterStateFor returns the initial cluster state the etcd pods were last
+// configured with
+func (c *Controller) clusterStateFor(ctx context.Context, controlPlane *v1alpha1.ControlPlane) (string, error) {
+	configMap := &v1.ConfigMap{}
+	if err := c.kubeClient.Get(ctx, object.NamespacedName(MembersConfigMapNameFor(controlPlane.ClusterName()), controlPlane.Namespace), configMap); err != nil {
+		if errors.IsNotFound(err) {
+			return clusterStateNew, nil
+		}
+		return "", fmt.Errorf("getting etcd members configmap, %w", err)
+	}
+	if configMap.Data[initialClusterStateKey] == clusterStateExisting {
+		return clusterStateExisting, nil
+	}
+	return clusterStateNew, nil
+}
+
+// membersConfigMapFor holds the initial cluster the etcd pods start with. The
+// pods read it from their environment rather than their args, so changing it
+// while scaling only applies to the members started after the change and
+// doesn't roll the statefulset's existing members. etcd ignores the initial
+// cluster once its data dir has been initialized.
+func membersConfigMapFor(controlPlane *v1alpha1.ControlPlane, members int, clusterState string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      MembersConfigMapNameFor(controlPlane.ClusterName()),
+			Namespace: controlPlane.Namespace,
+		},
+		Data: map[string]string{
+			initialClusterKey:      initialClusterFlag(controlPlane, members),
+			initialClusterStateKey: clusterState,
+		},
+	}
+}
+
+func MembersConfigMapNameFor(clusterName string) string {
+	return fmt.Sprintf("%s-etcd-members", clusterName)
+}
+
+// addMember runs etcdctl member add for the member with the ordinal against the
+// members before it, it returns once the job has succeeded
+func (c *Controller) addMember(ctx context.Context, controlPlane *v1alpha1.ControlPlane, ordinal int) error {
+	job := memberAddJobFor(controlPlane, ordinal)
+	if err := c.kubeClient.EnsureCreate(ctx, object.WithOwner(controlPlane, job)); err != nil {
+		return fmt.Errorf("creating etcd member add job, %w", err)
+	}
+	if kubeprovider.IsDryRun(ctx) {
+		return nil
+	}
+	if err := c.kubeClient.Get(ctx, object.NamespacedName(job.Name, job.Namespace), job); err != nil {
+		return fmt.Errorf("getting etcd member add job, %w", err)
+	}
+	if job.Status.Succeeded > 0 {
+		return nil
+	}
+	if job.Status.Failed > 0 {
+		return fmt.Errorf("adding etcd member %s failed, see job %s", memberNameFor(controlPlane, ordinal), job.Name)
+	}
+	return fmt.Errorf("adding etcd member %s, %w", memberNameFor(controlPlane, ordinal), errors.WaitingForSubResources)
+}
+
+// cleanupMemberAdd deletes the job that added the last member once its pod is
+// part of the statefulset
+func (c *Controller) cleanupMemberAdd(ctx context.Context, controlPlane *v1alpha1.ControlPlane, members int) error {
+	if err := c.kubeClient.Delete(ctx, memberAddJobFor(controlPlane, members-1),
+		client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("deleting etcd member add job, %w", err)
+	}
+	return nil
+}
+
+func memberAddJobFor(controlPlane *v1alpha1.ControlPlane, ordinal int) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-member-add", memberNameFor(controlPlane, ordinal)),
+			Namespace: controlPlane.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: aws.Int32(0),
+			Template: v1.PodTemplateSpec{
+				Spec: etcdctlPodSpecFor(controlPlane, "etcd-member-add",
+					"member", "add", memberNameFor(controlPlane, ordinal),
+					"--peer-urls="+peerURLFor(controlPlane, ordinal),
+					"--endpoints="+clientEndpointsFor(controlPlane, ordinal),
+				),
+			},
+		},
+	}
+}
+
+// gatewayMemberRemover removes members through etcd's gRPC gateway with the
+// etcd API client certificate, etcdctl can only remove a member by its ID
+// which isn't known until the member has been added
+type gatewayMemberRemover struct {
+	kubeClient client.Client
+}
+
+type etcdMember struct {
+	ID   string `json:"ID"`
+	Name string `json:"name"`
+}
+
+func (g *gatewayMemberRemover) RemoveMember(ctx context.Context, controlPlane *v1alpha1.ControlPlane, name, endpoint string) error {
+	httpClient, err := g.httpClientFor(ctx, controlPlane)
+	if err != nil {
+		return err
+	}
+	list := struct {
+		Members []etcdMember `json:"members"`
+	}{}
+	if err := post(ctx, httpClient, endpoint+"/v3/cluster/member/list", struct{}{}, &list); err != nil {
+		return fmt.Errorf("listing members, %w", err)
+	}
+	for _, member := range list.Members {
+		if member.Name != name {
+			continue
+		}
+		if err := post(ctx, httpClient, endpoint+"/v3/cluster/member/remove", struct {
+			ID string `json:"ID"`
+		}{member.ID}, nil); err != nil {
+			return fmt.Errorf("removing member %s, %w", member.ID, err)
+		}
+	}
+	return nil
+}
+
+func (g *gatewayMemberRemover) httpClientFor(ctx context.Context, controlPlane *v1alpha1.ControlPlane) (*http.Client, error) {
+	ca := &v1.Secret{}
+	if err := g.kubeClient.Get(ctx, object.NamespacedName(CASecretNameFor(controlPlane.ClusterName()), controlPlane.Namespace), ca); err != nil {
+		return nil, fmt.Errorf("getting etcd CA, %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca.Data[secrets.SecretPublicKey]) {
+		return nil, fmt.Errorf("parsing etcd CA")
+	}
+	apiClient := &v1.Secret{}
+	if err := g.kubeClient.Get(ctx, object.NamespacedName(EtcdAPIClientSecretNameFor(controlPlane.ClusterName()), controlPlane.Namespace), apiClient); err != nil {
+		return nil, fmt.Errorf("getting etcd API client certificate, %w", err)
+	}
+	certificate, err := tls.X509KeyPair(apiClient.Data[secrets.SecretPublicKey], apiClient.Data[secrets.SecretPrivateKey])
+	if err != nil {
+		return nil, fmt.Errorf("parsing etcd API client certificate, %w", err)
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{certificate},
+		}},
+	}, nil
+}
+
+func post(ctx context.Context, httpClient *http.Client, url string, body, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
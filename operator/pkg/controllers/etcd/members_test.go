@@ -0,0 +1,267 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/pki"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	"github.com/awslabs/kit/operator/pkg/utils/secrets"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	certutil "k8s.io/client-go/util/cert"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestScaleUpAddsOneMember(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controller := &Controller{kubeClient: kubeprovider.New(kubeClient)}
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	controlPlane.SetDefaults(ctx)
+	controlPlane.Spec.Etcd.Replicas = 1
+	if err := controller.reconcileStatefulSet(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling statefulset, %v", err)
+	}
+	statefulSet := readyStatefulSet(ctx, t, kubeClient)
+	template := statefulSet.Spec.Template.DeepCopy()
+
+	// The member is added before the statefulset is scaled
+	controlPlane.Spec.Etcd.Replicas = 3
+	if err := controller.reconcileStatefulSet(ctx, controlPlane); !errors.IsWaitingForSubResource(err) {
+		t.Fatalf("expected to wait for the member to be added, got %v", err)
+	}
+	job := &batchv1.Job{}
+	jobName := types.NamespacedName{Namespace: "default", Name: "test-cluster-etcd-1-member-add"}
+	if err := kubeClient.Get(ctx, jobName, job); err != nil {
+		t.Fatalf("getting member add job, %v", err)
+	}
+	args := strings.Join(job.Spec.Template.Spec.Containers[0].Args, " ")
+	for _, expected := range []string{
+		"member add test-cluster-etcd-1",
+		"--peer-urls=https://test-cluster-etcd-1.test-cluster-etcd.default.svc.cluster.local:2380",
+		"--endpoints=https://test-cluster-etcd-0.test-cluster-etcd.default.svc.cluster.local:2379 ",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("expected member add job args to contain %s, got %s", expected, args)
+		}
+	}
+
+	job.Status.Succeeded = 1
+	if err := kubeClient.Update(ctx, job); err != nil {
+		t.Fatalf("updating member add job, %v", err)
+	}
+	if err := controller.reconcileStatefulSet(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling statefulset, %v", err)
+	}
+	statefulSet = readyStatefulSet(ctx, t, kubeClient)
+	if replicas := aws.Int32Value(statefulSet.Spec.Replicas); replicas != 2 {
+		t.Errorf("expected 2 replicas, got %d", replicas)
+	}
+	// The existing member keeps running with the args it was started with
+	if !reflect.DeepEqual(template, &statefulSet.Spec.Template) {
+		t.Errorf("expected the pod template to be unchanged while scaling")
+	}
+	members := membersConfigMap(ctx, t, kubeClient)
+	if state := members.Data[initialClusterStateKey]; state != clusterStateExisting {
+		t.Errorf("expected the added member to join the existing cluster, got %s", state)
+	}
+	if initialCluster := members.Data[initialClusterKey]; !strings.Contains(initialCluster, "test-cluster-etcd-1=https://") ||
+		strings.Contains(initialCluster, "test-cluster-etcd-2=https://") {
+		t.Errorf("expected an initial cluster of 2 members, got %s", initialCluster)
+	}
+	if err := kubeClient.Get(ctx, jobName, &batchv1.Job{}); !errors.IsNotFound(err) {
+		t.Errorf("expected member add job to be deleted, got %v", err)
+	}
+}
+
+func TestScaleDownRemovesOneMember(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	remover := &fakeMemberRemover{}
+	controller := &Controller{kubeClient: kubeprovider.New(kubeClient), memberRemover: remover}
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	controlPlane.SetDefaults(ctx)
+	if err := controller.reconcileStatefulSet(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling statefulset, %v", err)
+	}
+	template := readyStatefulSet(ctx, t, kubeClient).Spec.Template.DeepCopy()
+
+	// The member is removed from the cluster before its pod is stopped
+	controlPlane.Spec.Etcd.Replicas = 1
+	remover.err = fmt.Errorf("etcdserver: unhealthy cluster")
+	if err := controller.reconcileStatefulSet(ctx, controlPlane); err == nil {
+		t.Fatalf("expected removing the member to fail")
+	}
+	if replicas := aws.Int32Value(readyStatefulSet(ctx, t, kubeClient).Spec.Replicas); replicas != 3 {
+		t.Errorf("expected 3 replicas until the member is removed, got %d", replicas)
+	}
+	remover.err = nil
+	if err := controller.reconcileStatefulSet(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling statefulset, %v", err)
+	}
+	statefulSet := readyStatefulSet(ctx, t, kubeClient)
+	if replicas := aws.Int32Value(statefulSet.Spec.Replicas); replicas != 2 {
+		t.Errorf("expected 2 replicas, got %d", replicas)
+	}
+	if err := controller.reconcileStatefulSet(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling statefulset, %v", err)
+	}
+	statefulSet = readyStatefulSet(ctx, t, kubeClient)
+	if replicas := aws.Int32Value(statefulSet.Spec.Replicas); replicas != 1 {
+		t.Errorf("expected 1 replica, got %d", replicas)
+	}
+	if expected := []string{"test-cluster-etcd-2", "test-cluster-etcd-2", "test-cluster-etcd-1"}; !reflect.DeepEqual(remover.removed, expected) {
+		t.Errorf("expected members %v to be removed, got %v", expected, remover.removed)
+	}
+	if !reflect.DeepEqual(template, &statefulSet.Spec.Template) {
+		t.Errorf("expected the pod template to be unchanged while scaling")
+	}
+	if initialCluster := membersConfigMap(ctx, t, kubeClient).Data[initialClusterKey]; strings.Contains(initialCluster, "test-cluster-etcd-1=https://") {
+		t.Errorf("expected an initial cluster of 1 member, got %s", initialCluster)
+	}
+}
+
+func TestGatewayMemberRemover(t *testing.T) {
+	ctx := context.Background()
+	removed := ""
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/cluster/member/list":
+			fmt.Fprint(w, `{"members":[{"ID":"1","name":"test-cluster-etcd-0"},{"ID":"12345678901234567890","name":"test-cluster-etcd-2"}]}`)
+		case "/v3/cluster/member/remove":
+			member := etcdMember{}
+			if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+				t.Errorf("decoding member remove request, %v", err)
+			}
+			removed = member.ID
+			fmt.Fprint(w, `{}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	caKey, caCert, err := pki.RootCA(&certutil.Config{CommonName: "etcd/ca"})
+	if err != nil {
+		t.Fatalf("generating CA, %v", err)
+	}
+	clientKey, clientCert, err := pki.GenerateSignedCertAndKey(&certutil.Config{
+		CommonName: "etcd-client", Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, caKey)
+	if err != nil {
+		t.Fatalf("generating client certificate, %v", err)
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).WithObjects(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: CASecretNameFor("test-cluster"), Namespace: "default"},
+		Data: map[string][]byte{secrets.SecretPublicKey: pem.EncodeToMemory(&pem.Block{
+			Type: "CERTIFICATE", Bytes: server.Certificate().Raw,
+		})},
+	}, &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: EtcdAPIClientSecretNameFor("test-cluster"), Namespace: "default"},
+		Data:       map[string][]byte{secrets.SecretPublicKey: clientCert, secrets.SecretPrivateKey: clientKey},
+	}).Build()
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	remover := &gatewayMemberRemover{kubeClient: kubeClient}
+	if err := remover.RemoveMember(ctx, controlPlane, "test-cluster-etcd-2", server.URL); err != nil {
+		t.Fatalf("removing member, %v", err)
+	}
+	if removed != "12345678901234567890" {
+		t.Errorf("expected member 12345678901234567890 to be removed, got %q", removed)
+	}
+	// A member that was already removed isn't removed again
+	removed = ""
+	if err := remover.RemoveMember(ctx, controlPlane, "test-cluster-etcd-1", server.URL); err != nil {
+		t.Fatalf("removing member, %v", err)
+	}
+	if removed != "" {
+		t.Errorf("expected no member to be removed, got %q", removed)
+	}
+}
+
+func TestNewClusterStartsAllMembers(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controller := &Controller{kubeClient: kubeprovider.New(kubeClient)}
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	controlPlane.SetDefaults(ctx)
+	if err := controller.reconcileStatefulSet(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling statefulset, %v", err)
+	}
+	statefulSet := &appsv1.StatefulSet{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test-cluster-etcd"}, statefulSet); err != nil {
+		t.Fatalf("getting statefulset, %v", err)
+	}
+	if replicas := aws.Int32Value(statefulSet.Spec.Replicas); replicas != 3 {
+		t.Errorf("expected 3 replicas, got %d", replicas)
+	}
+	if state := membersConfigMap(ctx, t, kubeClient).Data[initialClusterStateKey]; state != clusterStateNew {
+		t.Errorf("expected a new cluster, got %s", state)
+	}
+	controlPlane.Spec.Etcd.Replicas = 2
+	if err := controlPlane.Validate(ctx); err == nil {
+		t.Errorf("expected an even number of etcd replicas to fail validation")
+	}
+}
+
+type fakeMemberRemover struct {
+	removed []string
+	err     error
+}
+
+func (f *fakeMemberRemover) RemoveMember(_ context.Context, _ *v1alpha1.ControlPlane, name, _ string) error {
+	f.removed = append(f.removed, name)
+	return f.err
+}
+
+// readyStatefulSet marks all of the etcd statefulset's replicas ready
+func readyStatefulSet(ctx context.Context, t *testing.T, kubeClient client.Client) *appsv1.StatefulSet {
+	t.Helper()
+	statefulSet := &appsv1.StatefulSet{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test-cluster-etcd"}, statefulSet); err != nil {
+		t.Fatalf("getting statefulset, %v", err)
+	}
+	statefulSet.Status.ReadyReplicas = aws.Int32Value(statefulSet.Spec.Replicas)
+	if err := kubeClient.Status().Update(ctx, statefulSet); err != nil {
+		t.Fatalf("updating statefulset status, %v", err)
+	}
+	return statefulSet
+}
+
+func membersConfigMap(ctx context.Context, t *testing.T, kubeClient client.Client) *v1.ConfigMap {
+	t.Helper()
+	configMap := &v1.ConfigMap{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "test-cluster-etcd-members"}, configMap); err != nil {
+		t.Fatalf("getting members configmap, %v", err)
+	}
+	return configMap
+}
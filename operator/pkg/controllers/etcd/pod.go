@@ -34,7 +34,14 @@ const (
 	instanceTypeLabelDefaultValue = "m5.16xlarge"
 )
 
+// podSpecFor the members of the etcd cluster, the initial cluster comes from
+// the members configmap as it changes while scaling
 func podSpecFor(controlPlane *v1alpha1.ControlPlane) *v1.PodSpec {
+	fromMembers := func(key string) v1.EnvVar {
+		return v1.EnvVar{Name: key, ValueFrom: &v1.EnvVarSource{ConfigMapKeyRef: &v1.ConfigMapKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: MembersConfigMapNameFor(controlPlane.ClusterName())}, Key: key,
+		}}}
+	}
 	return &v1.PodSpec{
 		TerminationGracePeriodSeconds: aws.Int64(1),
 		HostNetwork:                   true,
@@ -57,7 +64,7 @@ func podSpecFor(controlPlane *v1alpha1.ControlPlane) *v1.PodSpec {
 		}},
 		Containers: []v1.Container{{
 			Name:  "etcd",
-			Image: imageprovider.ETCD(),
+			Image: imageprovider.ETCD(controlPlane.Spec.ImageRegistry),
 			Ports: []v1.ContainerPort{{
 				ContainerPort: 2379,
 				Name:          "etcd",
@@ -81,15 +88,13 @@ func podSpecFor(controlPlane *v1alpha1.ControlPlane) *v1.PodSpec {
 			Command: []string{"etcd"},
 			Args: []string{
 				"--cert-file=/etc/kubernetes/pki/etcd/server/server.crt",
-				"--initial-cluster=" + initialClusterFlag(controlPlane),
 				"--data-dir=/var/lib/etcd",
-				"--initial-cluster-state=new",
 				"--initial-cluster-token=etcd-cluster-1",
 				"--key-file=/etc/kubernetes/pki/etcd/server/server.key",
 				"--advertise-client-urls=" + advertizeClusterURL(controlPlane),
 				"--initial-advertise-peer-urls=" + advertizePeerURL(controlPlane),
 				"--listen-client-urls=https://$(NODE_IP):2379,https://127.0.0.1:2379",
-				"--listen-metrics-urls=http://127.0.0.1:2381",
+				"--listen-metrics-urls=http://$(NODE_IP):2381,http://127.0.0.1:2381",
 				"--listen-peer-urls=https://$(NODE_IP):2380",
 				"--name=$(NODE_ID)",
 				"--peer-cert-file=/etc/kubernetes/pki/etcd/peer/peer.crt",
@@ -99,7 +104,7 @@ func podSpecFor(controlPlane *v1alpha1.ControlPlane) *v1.PodSpec {
 				"--snapshot-count=10000",
 				"--trusted-ca-file=/etc/kubernetes/pki/ca.crt",
 				"--logger=zap",
-				"--quota-backend-bytes=8589934592",
+				fmt.Sprintf("--quota-backend-bytes=%d", quotaBackendBytes),
 			},
 			Env: []v1.EnvVar{{
 				Name: "NODE_IP",
@@ -115,7 +120,7 @@ func podSpecFor(controlPlane *v1alpha1.ControlPlane) *v1.PodSpec {
 						FieldPath: "metadata.name",
 					},
 				},
-			}},
+			}, fromMembers(initialClusterKey), fromMembers(initialClusterStateKey)},
 			LivenessProbe: &v1.Probe{
 				Handler: v1.Handler{
 					HTTPGet: &v1.HTTPGetAction{
@@ -187,14 +192,22 @@ func podSpecFor(controlPlane *v1alpha1.ControlPlane) *v1.PodSpec {
 	}
 }
 
-func initialClusterFlag(controlPlane *v1alpha1.ControlPlane) string {
+func initialClusterFlag(controlPlane *v1alpha1.ControlPlane, members int) string {
 	nodes := make([]string, 0)
-	for i := 0; i < controlPlane.Spec.Etcd.Replicas; i++ {
-		nodes = append(nodes, fmt.Sprintf("%[1]s-etcd-%[2]d=https://%[1]s-etcd-%[2]d.%[1]s-etcd.%[3]s.svc.cluster.local:2380", controlPlane.ClusterName(), i, controlPlane.Namespace))
+	for i := 0; i < members; i++ {
+		nodes = append(nodes, fmt.Sprintf("%s=%s", memberNameFor(controlPlane, i), peerURLFor(controlPlane, i)))
 	}
 	return strings.Join(nodes, ",")
 }
 
+func memberNameFor(controlPlane *v1alpha1.ControlPlane, ordinal int) string {
+	return fmt.Sprintf("%s-%d", ServiceNameFor(controlPlane.ClusterName()), ordinal)
+}
+
+func peerURLFor(controlPlane *v1alpha1.ControlPlane, ordinal int) string {
+	return fmt.Sprintf("https://%s.%s:2380", memberNameFor(controlPlane, ordinal), SvcFQDN(controlPlane.ClusterName(), controlPlane.Namespace))
+}
+
 func advertizeClusterURL(controlPlane *v1alpha1.ControlPlane) string {
 	return fmt.Sprintf("https://%s:2379,https://%s:2379", podFQDN(controlPlane), serviceFQDN(controlPlane))
 }
@@ -0,0 +1,175 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/utils/imageprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/object"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	restoreDir           = "/restore"
+	restoreFailedReason  = "RestoreFailed"
+	restoreFetchName     = "etcd-restore-fetch"
+	restoreSnapshotName  = "etcd-restore"
+	restoreInstallName   = "etcd-restore-install"
+	restoreVolumeName    = "etcd-restore"
+	restoreSnapshotPath  = restoreDir + "/snapshot.db"
+	restoreDataDir       = restoreDir + "/data"
+	restoreInstallScript = `if [ -d /var/lib/etcd/member ]; then
+  echo "/var/lib/etcd/member exists, skipping restore"
+else
+  mv ` + restoreDataDir + `/member /var/lib/etcd/member
+fi`
+)
+
+// reconcileRestore tracks restoring a new etcd cluster from a snapshot in the
+// EtcdRestored condition. The etcd pods restore the snapshot in init
+// containers while the restore is in progress, which are removed once all of
+// the members are ready.
+func (c *Controller) reconcileRestore(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	restore := controlPlane.Spec.EtcdRestore
+	if restore == nil {
+		controlPlane.StatusConditions().ClearCondition(v1alpha1.EtcdRestored)
+		return nil
+	}
+	statefulSet := &appsv1.StatefulSet{}
+	if err := c.kubeClient.Get(ctx, object.NamespacedName(ServiceNameFor(controlPlane.ClusterName()), controlPlane.Namespace), statefulSet); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("getting etcd statefulset, %w", err)
+		}
+		statefulSet = nil
+	}
+	if controlPlane.StatusConditions().GetCondition(v1alpha1.EtcdRestored) == nil {
+		// Restoring replaces the data, so it's only done for a new cluster
+		if statefulSet != nil {
+			controlPlane.StatusConditions().MarkFalse(v1alpha1.EtcdRestored, "ClusterExists",
+				"etcd already exists, snapshots are only restored when the control plane is created")
+			return nil
+		}
+		controlPlane.StatusConditions().MarkUnknown(v1alpha1.EtcdRestored, "Restoring",
+			"restoring etcd from s3://%s/%s", restore.Bucket, restore.Key)
+		return nil
+	}
+	if !restoring(controlPlane) || statefulSet == nil {
+		return nil
+	}
+	if int(statefulSet.Status.ReadyReplicas) >= controlPlane.Spec.Etcd.Replicas {
+		zap.S().Infof("[%v] Restored etcd from s3://%s/%s", controlPlane.ClusterName(), restore.Bucket, restore.Key)
+		controlPlane.StatusConditions().MarkTrue(v1alpha1.EtcdRestored)
+		return nil
+	}
+	pods := &v1.PodList{}
+	if err := c.kubeClient.List(ctx, pods, client.InNamespace(controlPlane.Namespace),
+		client.MatchingLabels(labelsFor(controlPlane.ClusterName()))); err != nil {
+		return fmt.Errorf("listing etcd pods, %w", err)
+	}
+	for _, pod := range pods.Items {
+		if message := restoreFailure(pod); message != "" {
+			zap.S().Errorf("[%v] Restoring etcd pod %s failed, %s", controlPlane.ClusterName(), pod.Name, message)
+			controlPlane.StatusConditions().MarkFalse(v1alpha1.EtcdRestored, restoreFailedReason,
+				"restoring etcd pod %s from s3://%s/%s failed, %s", pod.Name, restore.Bucket, restore.Key, message)
+			return nil
+		}
+	}
+	return nil
+}
+
+// restoring is true until the restore has succeeded, a failed restore is
+// retried by the pods' init containers
+func restoring(controlPlane *v1alpha1.ControlPlane) bool {
+	if controlPlane.Spec.EtcdRestore == nil {
+		return false
+	}
+	condition := controlPlane.StatusConditions().GetCondition(v1alpha1.EtcdRestored)
+	return condition != nil && (condition.IsUnknown() || (condition.IsFalse() && condition.Reason == restoreFailedReason))
+}
+
+// restoreFailure describes the last failure of a restore init container
+func restoreFailure(pod v1.Pod) string {
+	names := sets.NewString(restoreFetchName, restoreSnapshotName, restoreInstallName)
+	for _, status := range pod.Status.InitContainerStatuses {
+		if !names.Has(status.Name) {
+			continue
+		}
+		for _, terminated := range []*v1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+			if terminated != nil && terminated.ExitCode != 0 {
+				if terminated.Message != "" {
+					return fmt.Sprintf("%s exited with %d, %s", status.Name, terminated.ExitCode, terminated.Message)
+				}
+				return fmt.Sprintf("%s exited with %d", status.Name, terminated.ExitCode)
+			}
+		}
+	}
+	return ""
+}
+
+// withRestore adds the init containers restoring the snapshot into the data
+// dir before etcd starts. The snapshot is restored into a scratch volume and
+// only moved into the data dir when it's empty, so existing data is never
+// replaced, i.e. when a member restarts before the restore has completed.
+func withRestore(podSpec *v1.PodSpec, controlPlane *v1alpha1.ControlPlane, members int) *v1.PodSpec {
+	restore := controlPlane.Spec.EtcdRestore
+	fetchEnv := []v1.EnvVar{}
+	if restore.Region != "" {
+		fetchEnv = append(fetchEnv, v1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: restore.Region})
+	}
+	restoreMount := v1.VolumeMount{Name: restoreVolumeName, MountPath: restoreDir}
+	podSpec.InitContainers = append(podSpec.InitContainers, v1.Container{
+		Name:         restoreFetchName,
+		Image:        imageprovider.AWSCLI(),
+		Command:      []string{"aws"},
+		Args:         []string{"s3", "cp", fmt.Sprintf("s3://%s/%s", restore.Bucket, restore.Key), restoreSnapshotPath},
+		Env:          fetchEnv,
+		VolumeMounts: []v1.VolumeMount{restoreMount},
+	}, v1.Container{
+		Name:    restoreSnapshotName,
+		Image:   imageprovider.ETCD(controlPlane.Spec.ImageRegistry),
+		Command: []string{"etcdctl"},
+		Args: []string{
+			"snapshot", "restore", restoreSnapshotPath,
+			"--data-dir=" + restoreDataDir,
+			"--name=$(NODE_ID)",
+			"--initial-cluster=" + initialClusterFlag(controlPlane, members),
+			"--initial-cluster-token=etcd-cluster-1",
+			"--initial-advertise-peer-urls=" + advertizePeerURL(controlPlane),
+		},
+		Env: []v1.EnvVar{{Name: "ETCDCTL_API", Value: "3"}, {
+			Name:      "NODE_ID",
+			ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+		}},
+		VolumeMounts: []v1.VolumeMount{restoreMount},
+	}, v1.Container{
+		Name:         restoreInstallName,
+		Image:        imageprovider.BusyBox(),
+		Command:      []string{"sh", "-c", restoreInstallScript},
+		VolumeMounts: []v1.VolumeMount{restoreMount, {Name: "etcd-data", MountPath: "/var/lib/etcd"}},
+	})
+	podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+		Name:         restoreVolumeName,
+		VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+	})
+	return podSpec
+}
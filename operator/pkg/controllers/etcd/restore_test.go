@@ -0,0 +1,139 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRestoreNewCluster(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controller := &Controller{kubeClient: kubeprovider.New(kubeClient)}
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: v1alpha1.ControlPlaneSpec{EtcdRestore: &v1alpha1.EtcdRestore{
+			Bucket: "backups", Key: "test-cluster/snapshot.db", Region: "us-west-2",
+		}},
+	}
+	controlPlane.SetDefaults(ctx)
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	if err := controller.reconcileRestore(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling restore, %v", err)
+	}
+	if condition := controlPlane.StatusConditions().GetCondition(v1alpha1.EtcdRestored); condition == nil || !condition.IsUnknown() {
+		t.Fatalf("expected etcd to be restoring, got %v", condition)
+	}
+	if err := controller.reconcileStatefulSet(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling statefulset, %v", err)
+	}
+	statefulSet := &appsv1.StatefulSet{}
+	statefulSetName := types.NamespacedName{Namespace: "default", Name: "test-cluster-etcd"}
+	if err := kubeClient.Get(ctx, statefulSetName, statefulSet); err != nil {
+		t.Fatalf("getting statefulset, %v", err)
+	}
+	initContainers := map[string]bool{}
+	for _, container := range statefulSet.Spec.Template.Spec.InitContainers {
+		initContainers[container.Name] = true
+	}
+	for _, name := range []string{restoreFetchName, restoreSnapshotName, restoreInstallName} {
+		if !initContainers[name] {
+			t.Errorf("expected init container %s", name)
+		}
+	}
+
+	// A failed restore is reported from the pod's init container status
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster-etcd-0", Namespace: "default", Labels: labelsFor("test-cluster")},
+		Status: v1.PodStatus{InitContainerStatuses: []v1.ContainerStatus{{
+			Name:                 restoreFetchName,
+			LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1, Message: "access denied"}},
+		}}},
+	}
+	if err := kubeClient.Create(ctx, pod); err != nil {
+		t.Fatalf("creating pod, %v", err)
+	}
+	if err := controller.reconcileRestore(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling restore, %v", err)
+	}
+	if condition := controlPlane.StatusConditions().GetCondition(v1alpha1.EtcdRestored); !condition.IsFalse() || condition.Reason != restoreFailedReason {
+		t.Fatalf("expected restore to fail, got %v", condition)
+	}
+
+	// The restore init containers are removed once all the members are ready
+	statefulSet.Status.ReadyReplicas = 3
+	if err := kubeClient.Status().Update(ctx, statefulSet); err != nil {
+		t.Fatalf("updating statefulset, %v", err)
+	}
+	if err := controller.reconcileRestore(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling restore, %v", err)
+	}
+	if condition := controlPlane.StatusConditions().GetCondition(v1alpha1.EtcdRestored); !condition.IsTrue() {
+		t.Fatalf("expected etcd to be restored, got %v", condition)
+	}
+	if err := controller.reconcileStatefulSet(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling statefulset, %v", err)
+	}
+	statefulSet = &appsv1.StatefulSet{}
+	if err := kubeClient.Get(ctx, statefulSetName, statefulSet); err != nil {
+		t.Fatalf("getting statefulset, %v", err)
+	}
+	for _, container := range statefulSet.Spec.Template.Spec.InitContainers {
+		if container.Name == restoreFetchName {
+			t.Errorf("expected restore init containers to be removed")
+		}
+	}
+}
+
+func TestRestoreExistingCluster(t *testing.T) {
+	ctx := context.Background()
+	existing := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster-etcd", Namespace: "default"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: aws.Int32(3)},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).WithObjects(existing).Build()
+	controller := &Controller{kubeClient: kubeprovider.New(kubeClient)}
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{EtcdRestore: &v1alpha1.EtcdRestore{Bucket: "backups"}},
+	}
+	controlPlane.SetDefaults(ctx)
+	if err := controlPlane.Validate(ctx); err == nil {
+		t.Errorf("expected a missing snapshot key to fail validation")
+	}
+	controlPlane.Spec.EtcdRestore.Key = "test-cluster/snapshot.db"
+	if err := controller.reconcileRestore(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling restore, %v", err)
+	}
+	if condition := controlPlane.StatusConditions().GetCondition(v1alpha1.EtcdRestored); !condition.IsFalse() || condition.Reason != "ClusterExists" {
+		t.Errorf("expected the restore to be skipped for an existing cluster, got %v", condition)
+	}
+	if restoring(controlPlane) {
+		t.Errorf("expected an existing cluster not to be restored")
+	}
+}
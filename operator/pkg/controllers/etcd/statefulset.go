@@ -29,14 +29,26 @@ import (
 )
 
 func (c *Controller) reconcileStatefulSet(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	members, clusterState, err := c.membersFor(ctx, controlPlane)
+	if err != nil {
+		return err
+	}
+	if err := c.kubeClient.EnsurePatch(ctx, &v1.ConfigMap{}, object.WithOwner(controlPlane,
+		membersConfigMapFor(controlPlane, members, clusterState))); err != nil {
+		return fmt.Errorf("patching etcd members configmap, %w", err)
+	}
 	// Generate the default pod spec for the given control plane, if user has
 	// provided custom config for the etcd pod spec, patch this user
 	// provided config to the default spec
-	etcdSpec, err := patch.PodSpec(podSpecFor(controlPlane), controlPlane.Spec.Etcd.Spec)
+	podSpec := podSpecFor(controlPlane)
+	if restoring(controlPlane) {
+		podSpec = withRestore(podSpec, controlPlane, members)
+	}
+	etcdSpec, err := patch.PodSpec(podSpec, controlPlane.Spec.Etcd.Spec)
 	if err != nil {
 		return fmt.Errorf("failed to patch pod spec, %w", err)
 	}
-	return c.kubeClient.EnsurePatch(ctx, &appsv1.StatefulSet{}, object.WithOwner(controlPlane, &appsv1.StatefulSet{
+	if err := c.kubeClient.EnsurePatch(ctx, &appsv1.StatefulSet{}, object.WithOwner(controlPlane, &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      ServiceNameFor(controlPlane.ClusterName()),
 			Namespace: controlPlane.Namespace,
@@ -47,7 +59,7 @@ func (c *Controller) reconcileStatefulSet(ctx context.Context, controlPlane *v1a
 			},
 			PodManagementPolicy: appsv1.ParallelPodManagement,
 			ServiceName:         ServiceNameFor(controlPlane.ClusterName()),
-			Replicas:            aws.Int32(int32(controlPlane.Spec.Etcd.Replicas)),
+			Replicas:            aws.Int32(int32(members)),
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labelsFor(controlPlane.ClusterName()),
@@ -55,5 +67,8 @@ func (c *Controller) reconcileStatefulSet(ctx context.Context, controlPlane *v1a
 				Spec: etcdSpec,
 			},
 		},
-	}))
+	})); err != nil {
+		return err
+	}
+	return c.cleanupMemberAdd(ctx, controlPlane, members)
 }
@@ -0,0 +1,59 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"go.uber.org/zap"
+)
+
+// Finalizer is a named step in finalizing a resource, i.e. a sub controller's
+// Finalize
+type Finalizer struct {
+	Name     string
+	Finalize func(context.Context) error
+}
+
+// FinalizeWithTimeout runs the finalizers in order, abandoning a finalizer that
+// hasn't returned within the timeout so the resource isn't stuck terminating
+// without explanation. The stalled finalizer is recorded in the Finalizing
+// condition and an error is returned for the finalize to be retried.
+func FinalizeWithTimeout(ctx context.Context, resource Object, timeout time.Duration, finalizers ...Finalizer) error {
+	for _, finalizer := range finalizers {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		// Buffered so a finalizer returning after the timeout doesn't block forever
+		done := make(chan error, 1)
+		go func(finalize func(context.Context) error) { done <- finalize(ctx) }(finalizer.Finalize)
+		select {
+		case err := <-done:
+			cancel()
+			if err != nil {
+				return fmt.Errorf("finalizing %s, %w", finalizer.Name, err)
+			}
+		case <-ctx.Done():
+			cancel()
+			zap.S().Errorf("[%s] Finalizer %s didn't complete within %s", resource.GetName(), finalizer.Name, timeout)
+			resource.StatusConditions().MarkFalse(v1alpha1.Finalizing, "FinalizeTimeout",
+				"finalizer %s didn't complete within %s", finalizer.Name, timeout)
+			return fmt.Errorf("finalizer %s didn't complete within %s", finalizer.Name, timeout)
+		}
+	}
+	resource.StatusConditions().ClearCondition(v1alpha1.Finalizing)
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFinalizeWithTimeout(t *testing.T) {
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	// The stalled finalizer ignores its context, like a call without a deadline
+	release := make(chan struct{})
+	defer close(release)
+	finalized := false
+	start := time.Now()
+	err := FinalizeWithTimeout(context.Background(), controlPlane, 100*time.Millisecond, Finalizer{
+		Name:     "master",
+		Finalize: func(context.Context) error { <-release; return nil },
+	}, Finalizer{
+		Name:     "etcd",
+		Finalize: func(context.Context) error { finalized = true; return nil },
+	})
+	if err == nil || !strings.Contains(err.Error(), "master") {
+		t.Fatalf("expected the master finalizer to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected finalize to return after the timeout, took %s", elapsed)
+	}
+	if finalized {
+		t.Errorf("expected finalizers after the stalled finalizer not to run")
+	}
+	condition := controlPlane.StatusConditions().GetCondition(v1alpha1.Finalizing)
+	if condition == nil || !condition.IsFalse() || condition.Reason != "FinalizeTimeout" || !strings.Contains(condition.Message, "master") {
+		t.Fatalf("expected the finalizing condition to name the stalled finalizer, got %v", condition)
+	}
+	// The condition is cleared once finalizing completes
+	if err := FinalizeWithTimeout(context.Background(), controlPlane, 100*time.Millisecond, Finalizer{
+		Name:     "etcd",
+		Finalize: func(context.Context) error { finalized = true; return nil },
+	}); err != nil {
+		t.Fatalf("finalizing, %v", err)
+	}
+	if condition := controlPlane.StatusConditions().GetCondition(v1alpha1.Finalizing); !finalized || condition != nil {
+		t.Errorf("expected finalizing to complete and clear the condition, got %v", condition)
+	}
+}
@@ -62,7 +62,7 @@ func (c *Controller) ensureDaemonSet(ctx context.Context, controlPlane *v1alpha1
 					}},
 				})
 				return template
-			}),
+			}, iamauthenticator.WithImageRegistry(controlPlane.Spec.ImageRegistry), iamauthenticator.WithAPIServerPort(controlPlane.APIServerPort())),
 		},
 	}))
 }
@@ -39,7 +39,8 @@ const (
 // and key required to run master API server
 func (c *Controller) reconcileCertificates(ctx context.Context, cp *v1alpha1.ControlPlane) error {
 	nn := object.NamespacedName(cp.ClusterName(), cp.Namespace)
-	endpoint, err := c.getClusterEndpoint(ctx, nn)
+	// The certificate is valid for all of the load balancer's addresses
+	hostnames, ips, err := GetClusterEndpointAddresses(ctx, c.kubeClient, nn)
 	if err != nil {
 		return err
 	}
@@ -47,7 +48,7 @@ func (c *Controller) reconcileCertificates(ctx context.Context, cp *v1alpha1.Con
 	frontProxyCA := frontProxyCACertConfig(object.NamespacedName(cp.ClusterName(), cp.Namespace))
 	certsTreeMap := keypairs.CertTree{
 		controlPlaneCA: {
-			kubeAPIServerCertConfig(endpoint, nn),
+			kubeAPIServerCertConfig(append(hostnames, privateDNSNamesFor(cp)...), ips, nn),
 			kubeletClientCertConfig(nn),
 		},
 		frontProxyCA: {
@@ -68,7 +69,13 @@ func rootCACertConfig(nn types.NamespacedName) *secrets.Request {
 	}
 }
 
-func kubeAPIServerCertConfig(hostname string, nn types.NamespacedName) *secrets.Request {
+func kubeAPIServerCertConfig(hostnames, ips []string, nn types.NamespacedName) *secrets.Request {
+	altIPs := []net.IP{net.IPv4(127, 0, 0, 1), apiServerVirtualIP()}
+	for _, ip := range ips {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			altIPs = append(altIPs, parsed)
+		}
+	}
 	return &secrets.Request{
 		Name:      KubeAPIServerSecretNameFor(nn.Name),
 		Namespace: nn.Namespace,
@@ -77,9 +84,9 @@ func kubeAPIServerCertConfig(hostname string, nn types.NamespacedName) *secrets.
 			Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 			CommonName: "kube-apiserver",
 			AltNames: certutil.AltNames{
-				DNSNames: []string{hostname, "localhost", "kubernetes", "kubernetes.default",
-					"kubernetes.default.svc", "kubernetes.default.svc.cluster.local"},
-				IPs: []net.IP{net.IPv4(127, 0, 0, 1), apiServerVirtualIP()},
+				DNSNames: append(hostnames, "localhost", "kubernetes", "kubernetes.default",
+					"kubernetes.default.svc", "kubernetes.default.svc.cluster.local"),
+				IPs: altIPs,
 			},
 		},
 	}
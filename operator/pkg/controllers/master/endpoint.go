@@ -17,6 +17,7 @@ package master
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
 	"github.com/awslabs/kit/operator/pkg/errors"
@@ -28,53 +29,212 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	loadBalancerAttributesAnnotation = "service.beta.kubernetes.io/aws-load-balancer-attributes"
+	deletionProtectionAttribute      = "deletion_protection.enabled"
+)
+
 func (c *Controller) reconcileEndpoint(ctx context.Context, cp *v1alpha1.ControlPlane) (err error) {
-	return c.kubeClient.EnsureCreate(ctx, object.WithOwner(cp, &v1.Service{
+	endpoint := cp.Spec.Master.Endpoint
+	externalTrafficPolicy := v1.ServiceExternalTrafficPolicyTypeCluster
+	if endpoint != nil && endpoint.ExternalTrafficPolicy != "" {
+		externalTrafficPolicy = endpoint.ExternalTrafficPolicy
+	}
+	annotations := map[string]string{
+		"service.beta.kubernetes.io/aws-load-balancer-scheme":                  schemeFor(endpoint),
+		"service.beta.kubernetes.io/aws-load-balancer-type":                    "nlb-ip",
+		"service.beta.kubernetes.io/aws-load-balancer-target-group-attributes": "stickiness.enabled=true,stickiness.type=source_ip",
+	}
+	if endpoint != nil && endpoint.ProxyProtocolV2 {
+		// Targets receive a PPv2 header ahead of the TLS handshake
+		annotations["service.beta.kubernetes.io/aws-load-balancer-proxy-protocol"] = "*"
+	}
+	deletionProtection := endpoint != nil && endpoint.DeletionProtection
+	if deletionProtection {
+		annotations[loadBalancerAttributesAnnotation] = deletionProtectionAttribute + "=true"
+	}
+	if err := c.kubeClient.EnsureCreate(ctx, object.WithOwner(cp, &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      ServiceNameFor(cp.ClusterName()),
-			Namespace: cp.Namespace,
-			Annotations: map[string]string{
-				"service.beta.kubernetes.io/aws-load-balancer-scheme":                  "internet-facing",
-				"service.beta.kubernetes.io/aws-load-balancer-type":                    "nlb-ip",
-				"service.beta.kubernetes.io/aws-load-balancer-target-group-attributes": "stickiness.enabled=true,stickiness.type=source_ip",
-			},
+			Name:        ServiceNameFor(cp.ClusterName()),
+			Namespace:   cp.Namespace,
+			Annotations: annotations,
 		},
 		Spec: v1.ServiceSpec{
-			Type:     v1.ServiceTypeLoadBalancer,
-			Selector: APIServerLabels(cp.ClusterName()),
-			Ports: []v1.ServicePort{{
-				Port:       443,
-				Name:       apiserverPortName(cp.ClusterName()),
-				TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: 443},
-				Protocol:   "TCP",
-			}},
+			Type:                  v1.ServiceTypeLoadBalancer,
+			ExternalTrafficPolicy: externalTrafficPolicy,
+			Selector:              APIServerLabels(cp.ClusterName()),
+			Ports:                 apiserverServicePorts(cp),
 		},
-	}))
+	})); err != nil {
+		return err
+	}
+	// EnsureCreate doesn't update an existing Service, so toggling protection
+	// is patched into its attributes
+	return c.ensureDeletionProtection(ctx, cp, deletionProtection)
+}
+
+// ensureDeletionProtection merges the deletion protection attribute into the
+// Service's load balancer attributes, leaving the other attributes as is. The
+// attribute is only added to Services without it when enabling protection.
+func (c *Controller) ensureDeletionProtection(ctx context.Context, cp *v1alpha1.ControlPlane, enabled bool) error {
+	svc := &v1.Service{}
+	if err := c.kubeClient.Get(ctx, types.NamespacedName{Namespace: cp.Namespace, Name: ServiceNameFor(cp.ClusterName())}, svc); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("getting control plane service, %w", err)
+	}
+	existing := svc.Annotations[loadBalancerAttributesAnnotation]
+	attributes := []string{}
+	found := false
+	for _, attribute := range strings.Split(existing, ",") {
+		if attribute == "" {
+			continue
+		}
+		if strings.HasPrefix(attribute, deletionProtectionAttribute+"=") {
+			attribute = fmt.Sprintf("%s=%t", deletionProtectionAttribute, enabled)
+			found = true
+		}
+		attributes = append(attributes, attribute)
+	}
+	if !found {
+		if !enabled {
+			return nil
+		}
+		attributes = append(attributes, fmt.Sprintf("%s=%t", deletionProtectionAttribute, enabled))
+	}
+	if desired := strings.Join(attributes, ","); desired != existing {
+		patched := svc.DeepCopy()
+		if patched.Annotations == nil {
+			patched.Annotations = map[string]string{}
+		}
+		patched.Annotations[loadBalancerAttributesAnnotation] = desired
+		return c.kubeClient.EnsurePatch(ctx, &v1.Service{}, patched)
+	}
+	return nil
+}
+
+// deletionProtectionDisabled returns an error until the NLB of a Service that
+// had deletion protection reports it as disabled, so finalizing is retried
+func (c *Controller) deletionProtectionDisabled(ctx context.Context, cp *v1alpha1.ControlPlane) error {
+	svc := &v1.Service{}
+	if err := c.kubeClient.Get(ctx, types.NamespacedName{Namespace: cp.Namespace, Name: ServiceNameFor(cp.ClusterName())}, svc); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("getting control plane service, %w", err)
+	}
+	if !strings.Contains(svc.Annotations[loadBalancerAttributesAnnotation], deletionProtectionAttribute+"=") {
+		return nil
+	}
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		attributes, err := c.loadBalancers.Attributes(ctx, ingress.Hostname)
+		if err != nil {
+			return err
+		}
+		if attributes[deletionProtectionAttribute] == "true" {
+			return fmt.Errorf("waiting for deletion protection to be disabled on %s", ingress.Hostname)
+		}
+	}
+	return nil
+}
+
+// schemeFor returns the load balancer scheme for the endpoint's access
+func schemeFor(endpoint *v1alpha1.Endpoint) string {
+	if endpoint != nil && endpoint.Access == v1alpha1.EndpointAccessPrivate {
+		return "internal"
+	}
+	return "internet-facing"
+}
+
+// privateDNSNamesFor are the cluster DNS names of the control plane Service,
+// served for private access from within the substrate cluster
+func privateDNSNamesFor(cp *v1alpha1.ControlPlane) []string {
+	endpoint := cp.Spec.Master.Endpoint
+	if endpoint == nil || endpoint.Access == "" || endpoint.Access == v1alpha1.EndpointAccessPublic {
+		return nil
+	}
+	service := ServiceNameFor(cp.ClusterName())
+	return []string{
+		service,
+		fmt.Sprintf("%s.%s", service, cp.Namespace),
+		fmt.Sprintf("%s.%s.svc", service, cp.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", service, cp.Namespace),
+	}
+}
+
+func apiserverServicePorts(cp *v1alpha1.ControlPlane) []v1.ServicePort {
+	return []v1.ServicePort{{
+		Port:       cp.APIServerPort(),
+		Name:       apiserverPortName(cp.ClusterName()),
+		TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: cp.APIServerPort()},
+		Protocol:   "TCP",
+	}}
 }
 
 func (c *Controller) getClusterEndpoint(ctx context.Context, nn types.NamespacedName) (string, error) {
 	return GetClusterEndpoint(ctx, c.kubeClient, nn)
 }
 
+// GetClusterEndpoint returns the load balancer hostname of the control plane,
+// or its IP for load balancers that only report an IP
 func GetClusterEndpoint(ctx context.Context, client client.Client, nn types.NamespacedName) (string, error) {
-	svc := &v1.Service{}
-	if err := client.Get(ctx, types.NamespacedName{nn.Namespace, ServiceNameFor(nn.Name)}, svc); err != nil {
-		if errors.IsNotFound(err) {
-			return "", fmt.Errorf("getting control plane endpoint, %w", errors.WaitingForSubResources)
+	ingresses, err := loadBalancerIngressFor(ctx, client, nn)
+	if err != nil {
+		return "", err
+	}
+	for _, ingress := range ingresses {
+		if ingress.Hostname != "" {
+			return ingress.Hostname, nil
 		}
-		return "", fmt.Errorf("getting cluster endpoint, %w", err)
 	}
-	if len(svc.Status.LoadBalancer.Ingress) > 0 {
-		return svc.Status.LoadBalancer.Ingress[0].Hostname, nil
+	for _, ingress := range ingresses {
+		if ingress.IP != "" {
+			return ingress.IP, nil
+		}
 	}
 	return "", fmt.Errorf("endpoint name, %w", errors.WaitingForSubResources)
 }
 
+// GetClusterEndpointAddresses returns all of the hostnames and IPs the control
+// plane load balancer reports
+func GetClusterEndpointAddresses(ctx context.Context, client client.Client, nn types.NamespacedName) (hostnames []string, ips []string, err error) {
+	ingresses, err := loadBalancerIngressFor(ctx, client, nn)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, ingress := range ingresses {
+		if ingress.Hostname != "" {
+			hostnames = append(hostnames, ingress.Hostname)
+		}
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
+		}
+	}
+	if len(hostnames) == 0 && len(ips) == 0 {
+		return nil, nil, fmt.Errorf("endpoint name, %w", errors.WaitingForSubResources)
+	}
+	return hostnames, ips, nil
+}
+
+func loadBalancerIngressFor(ctx context.Context, client client.Client, nn types.NamespacedName) ([]v1.LoadBalancerIngress, error) {
+	key := types.NamespacedName{Namespace: nn.Namespace, Name: ServiceNameFor(nn.Name)}
+	svc := &v1.Service{}
+	if err := client.Get(ctx, key, svc); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("getting control plane endpoint, %w", errors.WaitingForSubResources)
+		}
+		return nil, fmt.Errorf("getting cluster endpoint, %w", err)
+	}
+	return svc.Status.LoadBalancer.Ingress, nil
+}
+
 func apiserverPortName(clusterName string) string {
 	return fmt.Sprintf("%s-port", ServiceNameFor(clusterName))
 }
 
-// service name length needs to be <63 for DNS names
+// service name length needs to be <63 for DNS names, enforced by
+// v1alpha1.MaxClusterNameLength
 // https://github.com/awslabs/kubernetes-iteration-toolkit/issues/70
 func ServiceNameFor(clusterName string) string {
 	return fmt.Sprintf("%s-cp", clusterName)
@@ -0,0 +1,365 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package master
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/kubeprovider"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileEndpointDefaultsToNLB(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	controlPlane.SetDefaults(ctx)
+	if err := (&Controller{kubeClient: kubeprovider.New(kubeClient)}).reconcileEndpoint(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling endpoint, %v", err)
+	}
+	nn := types.NamespacedName{Namespace: "default", Name: ServiceNameFor(controlPlane.ClusterName())}
+	svc := &v1.Service{}
+	if err := kubeClient.Get(ctx, nn, svc); err != nil {
+		t.Fatalf("getting service, %v", err)
+	}
+	if svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+		t.Errorf("expected service type %s, got %s", v1.ServiceTypeLoadBalancer, svc.Spec.Type)
+	}
+	if svc.Spec.ExternalTrafficPolicy != v1.ServiceExternalTrafficPolicyTypeCluster {
+		t.Errorf("expected default external traffic policy %s, got %s", v1.ServiceExternalTrafficPolicyTypeCluster, svc.Spec.ExternalTrafficPolicy)
+	}
+	if _, ok := svc.Annotations["service.beta.kubernetes.io/aws-load-balancer-proxy-protocol"]; ok {
+		t.Errorf("expected proxy protocol to be disabled by default")
+	}
+}
+
+func TestReconcileEndpointProxyProtocolV2(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{Master: v1alpha1.MasterSpec{Endpoint: &v1alpha1.Endpoint{ProxyProtocolV2: true}}},
+	}
+	controlPlane.SetDefaults(ctx)
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	if err := (&Controller{kubeClient: kubeprovider.New(kubeClient)}).reconcileEndpoint(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling endpoint, %v", err)
+	}
+	svc := &v1.Service{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: ServiceNameFor(controlPlane.ClusterName())}, svc); err != nil {
+		t.Fatalf("getting service, %v", err)
+	}
+	if actual := svc.Annotations["service.beta.kubernetes.io/aws-load-balancer-proxy-protocol"]; actual != "*" {
+		t.Errorf("expected proxy protocol annotation *, got %q", actual)
+	}
+}
+
+func TestReconcileEndpointExternalTrafficPolicy(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: v1alpha1.ControlPlaneSpec{Master: v1alpha1.MasterSpec{Endpoint: &v1alpha1.Endpoint{
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeLocal,
+		}}},
+	}
+	controlPlane.SetDefaults(ctx)
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	if err := (&Controller{kubeClient: kubeprovider.New(kubeClient)}).reconcileEndpoint(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling endpoint, %v", err)
+	}
+	svc := &v1.Service{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: ServiceNameFor(controlPlane.ClusterName())}, svc); err != nil {
+		t.Fatalf("getting service, %v", err)
+	}
+	if svc.Spec.ExternalTrafficPolicy != v1.ServiceExternalTrafficPolicyTypeLocal {
+		t.Errorf("expected external traffic policy %s, got %s", v1.ServiceExternalTrafficPolicyTypeLocal, svc.Spec.ExternalTrafficPolicy)
+	}
+}
+
+func TestReconcileEndpointReadinessWithoutMatchingPods(t *testing.T) {
+	ctx := context.Background()
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              ServiceNameFor(controlPlane.ClusterName()),
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * endpointReadyGracePeriod)),
+		},
+		Spec: v1.ServiceSpec{Selector: APIServerLabels(controlPlane.ClusterName())},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).WithObjects(svc).Build()
+	controller := &Controller{kubeClient: kubeprovider.New(kubeClient)}
+	if err := controller.reconcileEndpointReadiness(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling endpoint readiness, %v", err)
+	}
+	condition := controlPlane.StatusConditions().GetCondition(v1alpha1.EndpointReady)
+	if condition == nil || !condition.IsFalse() || condition.Reason != "NoReadyEndpoints" {
+		t.Fatalf("expected %s to be false with reason NoReadyEndpoints, got %+v", v1alpha1.EndpointReady, condition)
+	}
+	if err := kubeClient.Create(ctx, &discoveryv1beta1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      svc.Name + "-abcde",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1beta1.LabelServiceName: svc.Name},
+		},
+		AddressType: discoveryv1beta1.AddressTypeIPv4,
+		Endpoints:   []discoveryv1beta1.Endpoint{{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1beta1.EndpointConditions{Ready: aws.Bool(true)}}},
+	}); err != nil {
+		t.Fatalf("creating endpoint slice, %v", err)
+	}
+	if err := controller.reconcileEndpointReadiness(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling endpoint readiness, %v", err)
+	}
+	if condition := controlPlane.StatusConditions().GetCondition(v1alpha1.EndpointReady); condition == nil || !condition.IsTrue() {
+		t.Errorf("expected %s to be true, got %+v", v1alpha1.EndpointReady, condition)
+	}
+}
+
+func TestReconcileEndpointReadinessWithinGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).WithObjects(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              ServiceNameFor(controlPlane.ClusterName()),
+			Namespace:         "default",
+			CreationTimestamp: metav1.Now(),
+		},
+	}).Build()
+	if err := (&Controller{kubeClient: kubeprovider.New(kubeClient)}).reconcileEndpointReadiness(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling endpoint readiness, %v", err)
+	}
+	if condition := controlPlane.StatusConditions().GetCondition(v1alpha1.EndpointReady); condition != nil && condition.IsFalse() {
+		t.Errorf("expected %s not to be false within the grace period, got %+v", v1alpha1.EndpointReady, condition)
+	}
+}
+
+func TestReconcileEndpointPrivateAccess(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{Master: v1alpha1.MasterSpec{Endpoint: &v1alpha1.Endpoint{Access: v1alpha1.EndpointAccessPrivate}}},
+	}
+	controlPlane.SetDefaults(ctx)
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	if err := (&Controller{kubeClient: kubeprovider.New(kubeClient)}).reconcileEndpoint(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling endpoint, %v", err)
+	}
+	svc := &v1.Service{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: ServiceNameFor(controlPlane.ClusterName())}, svc); err != nil {
+		t.Fatalf("getting service, %v", err)
+	}
+	if actual := svc.Annotations["service.beta.kubernetes.io/aws-load-balancer-scheme"]; actual != "internal" {
+		t.Errorf("expected an internal load balancer, got %q", actual)
+	}
+	dnsNames := kubeAPIServerCertConfig(append([]string{"internal.elb.amazonaws.com"}, privateDNSNamesFor(controlPlane)...), nil,
+		types.NamespacedName{Namespace: "default", Name: controlPlane.ClusterName()}).Config.AltNames.DNSNames
+	for _, expected := range []string{"internal.elb.amazonaws.com", "test-cluster-cp.default.svc", "test-cluster-cp.default.svc.cluster.local"} {
+		found := false
+		for _, name := range dnsNames {
+			found = found || name == expected
+		}
+		if !found {
+			t.Errorf("expected API server certificate to include %s, got %v", expected, dnsNames)
+		}
+	}
+
+	controlPlane.Spec.Master.Endpoint.Access = v1alpha1.EndpointAccessPublic
+	if names := privateDNSNamesFor(controlPlane); len(names) != 0 {
+		t.Errorf("expected no private DNS names for a public endpoint, got %v", names)
+	}
+	if actual := schemeFor(controlPlane.Spec.Master.Endpoint); actual != "internet-facing" {
+		t.Errorf("expected an internet-facing load balancer by default, got %q", actual)
+	}
+	controlPlane.Spec.Master.Endpoint.Access = "Internal"
+	if err := controlPlane.Validate(ctx); err == nil {
+		t.Errorf("expected an unknown endpoint access to fail validation")
+	}
+}
+
+func TestGetClusterEndpointFallsBackToIP(t *testing.T) {
+	ctx := context.Background()
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: ServiceNameFor("test-cluster"), Namespace: "default"},
+		Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{
+			{IP: "10.0.0.10"}, {IP: "10.0.0.11"},
+		}}},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).WithObjects(svc).Build()
+	nn := types.NamespacedName{Namespace: "default", Name: "test-cluster"}
+	endpoint, err := GetClusterEndpoint(ctx, kubeClient, nn)
+	if err != nil {
+		t.Fatalf("getting cluster endpoint, %v", err)
+	}
+	if endpoint != "10.0.0.10" {
+		t.Errorf("expected the load balancer IP without a hostname, got %q", endpoint)
+	}
+
+	svc.Status.LoadBalancer.Ingress = append(svc.Status.LoadBalancer.Ingress, v1.LoadBalancerIngress{Hostname: "test.elb.amazonaws.com"})
+	if err := kubeClient.Status().Update(ctx, svc); err != nil {
+		t.Fatalf("updating service status, %v", err)
+	}
+	if endpoint, err := GetClusterEndpoint(ctx, kubeClient, nn); err != nil || endpoint != "test.elb.amazonaws.com" {
+		t.Errorf("expected the hostname to be preferred, got %q, %v", endpoint, err)
+	}
+	hostnames, ips, err := GetClusterEndpointAddresses(ctx, kubeClient, nn)
+	if err != nil {
+		t.Fatalf("getting cluster endpoint addresses, %v", err)
+	}
+	if len(hostnames) != 1 || len(ips) != 2 {
+		t.Errorf("expected all of the load balancer addresses, got %v and %v", hostnames, ips)
+	}
+	if ips := kubeAPIServerCertConfig(hostnames, ips, nn).Config.AltNames.IPs; len(ips) != 4 || ips[2].String() != "10.0.0.10" {
+		t.Errorf("expected the load balancer IPs in the API server certificate, got %v", ips)
+	}
+
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{}}
+	if err := kubeClient.Status().Update(ctx, svc); err != nil {
+		t.Fatalf("updating service status, %v", err)
+	}
+	if _, err := GetClusterEndpoint(ctx, kubeClient, nn); !errors.IsWaitingForSubResource(err) {
+		t.Errorf("expected to wait for an address, got %v", err)
+	}
+}
+
+func TestReconcileEndpointAPIServerPort(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{Master: v1alpha1.MasterSpec{APIServerPort: 6443}},
+	}
+	controlPlane.SetDefaults(ctx)
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	if err := (&Controller{kubeClient: kubeprovider.New(kubeClient)}).reconcileEndpoint(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling endpoint, %v", err)
+	}
+	svc := &v1.Service{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: ServiceNameFor(controlPlane.ClusterName())}, svc); err != nil {
+		t.Fatalf("getting service, %v", err)
+	}
+	if len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].Port != 6443 || svc.Spec.Ports[0].TargetPort.IntValue() != 6443 {
+		t.Errorf("expected service port 6443, got %v", svc.Spec.Ports)
+	}
+	found := false
+	for _, arg := range apiServerPodSpecFor(controlPlane).Containers[0].Args {
+		found = found || arg == "--secure-port=6443"
+	}
+	if !found {
+		t.Errorf("expected the API server to listen on 6443")
+	}
+	controlPlane.Spec.Master.APIServerPort = 70000
+	if err := controlPlane.Validate(ctx); err == nil {
+		t.Errorf("expected an invalid port to fail validation")
+	}
+}
+
+// finalizedIAM stands in for the IAM controller in Finalize
+type finalizedIAM struct{}
+
+func (finalizedIAM) Reconcile(context.Context, *v1alpha1.ControlPlane) error { return nil }
+func (finalizedIAM) Finalize(context.Context, *v1alpha1.ControlPlane) error  { return nil }
+
+// protectedLoadBalancer reports deletion protection as enabled until it has
+// been read the given number of times
+type protectedLoadBalancer struct {
+	reads int
+}
+
+func (p *protectedLoadBalancer) Attributes(_ context.Context, _ string) (map[string]string, error) {
+	p.reads--
+	return map[string]string{deletionProtectionAttribute: fmt.Sprint(p.reads >= 0)}, nil
+}
+
+func TestReconcileEndpointDeletionProtection(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).Build()
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{Master: v1alpha1.MasterSpec{Endpoint: &v1alpha1.Endpoint{DeletionProtection: true}}},
+	}
+	controlPlane.SetDefaults(ctx)
+	if err := controlPlane.Validate(ctx); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	loadBalancer := &protectedLoadBalancer{reads: 1}
+	controller := &Controller{kubeClient: kubeprovider.New(kubeClient), iamController: finalizedIAM{}, loadBalancers: loadBalancer}
+	if err := controller.reconcileEndpoint(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling endpoint, %v", err)
+	}
+	provisioned := &v1.Service{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: ServiceNameFor(controlPlane.ClusterName())}, provisioned); err != nil {
+		t.Fatalf("getting service, %v", err)
+	}
+	provisioned.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{Hostname: "test.elb.amazonaws.com"}}
+	if err := kubeClient.Status().Update(ctx, provisioned); err != nil {
+		t.Fatalf("updating service status, %v", err)
+	}
+	attributes := func() string {
+		svc := &v1.Service{}
+		if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: ServiceNameFor(controlPlane.ClusterName())}, svc); err != nil {
+			t.Fatalf("getting service, %v", err)
+		}
+		return svc.Annotations[loadBalancerAttributesAnnotation]
+	}
+	if actual := attributes(); actual != "deletion_protection.enabled=true" {
+		t.Errorf("expected deletion protection to be enabled, got %q", actual)
+	}
+	// Finalizing is retried until the NLB has protection disabled
+	if err := controller.Finalize(ctx, controlPlane); err == nil {
+		t.Errorf("expected finalizing to wait for the load balancer")
+	}
+	if actual := attributes(); actual != "deletion_protection.enabled=false" {
+		t.Errorf("expected deletion protection to be disabled on finalize, got %q", actual)
+	}
+	if err := controller.Finalize(ctx, controlPlane); err != nil {
+		t.Fatalf("finalizing control plane, %v", err)
+	}
+	// Enabling protection on an existing Service keeps its other attributes
+	svc := &v1.Service{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: ServiceNameFor(controlPlane.ClusterName())}, svc); err != nil {
+		t.Fatalf("getting service, %v", err)
+	}
+	svc.Annotations[loadBalancerAttributesAnnotation] = "load_balancing.cross_zone.enabled=true"
+	if err := kubeClient.Update(ctx, svc); err != nil {
+		t.Fatalf("updating service, %v", err)
+	}
+	if err := controller.reconcileEndpoint(ctx, controlPlane); err != nil {
+		t.Fatalf("reconciling endpoint, %v", err)
+	}
+	if actual := attributes(); actual != "load_balancing.cross_zone.enabled=true,deletion_protection.enabled=true" {
+		t.Errorf("expected deletion protection to be merged into the attributes, got %q", actual)
+	}
+}
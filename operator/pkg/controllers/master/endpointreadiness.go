@@ -0,0 +1,75 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package master
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	"github.com/awslabs/kit/operator/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// endpointReadyGracePeriod is how long a new Service may have no ready
+// endpoints while the API server pods are scheduled and started
+const endpointReadyGracePeriod = 5 * time.Minute
+
+// reconcileEndpointReadiness surfaces a Service without ready endpoints, which
+// leaves the load balancer without targets and otherwise fails silently
+func (c *Controller) reconcileEndpointReadiness(ctx context.Context, cp *v1alpha1.ControlPlane) error {
+	svc := &v1.Service{}
+	if err := c.kubeClient.Get(ctx, types.NamespacedName{Namespace: cp.Namespace, Name: ServiceNameFor(cp.ClusterName())}, svc); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("getting control plane service, %w", err)
+	}
+	ready, err := c.hasReadyEndpoints(ctx, svc)
+	if err != nil {
+		return err
+	}
+	if ready {
+		cp.StatusConditions().MarkTrue(v1alpha1.EndpointReady)
+		return nil
+	}
+	if time.Since(svc.CreationTimestamp.Time) < endpointReadyGracePeriod {
+		return nil
+	}
+	cp.StatusConditions().MarkFalse(v1alpha1.EndpointReady, "NoReadyEndpoints",
+		"service %s has no ready endpoints, check the API server pods match the selector %v", svc.Name, svc.Spec.Selector)
+	return nil
+}
+
+func (c *Controller) hasReadyEndpoints(ctx context.Context, svc *v1.Service) (bool, error) {
+	endpointSlices := &discoveryv1beta1.EndpointSliceList{}
+	if err := c.kubeClient.List(ctx, endpointSlices, client.InNamespace(svc.Namespace),
+		client.MatchingLabels{discoveryv1beta1.LabelServiceName: svc.Name}); err != nil {
+		return false, fmt.Errorf("listing endpoint slices, %w", err)
+	}
+	for _, endpointSlice := range endpointSlices.Items {
+		for _, endpoint := range endpointSlice.Endpoints {
+			// A nil ready condition is interpreted as ready
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -68,6 +68,40 @@ func (c *Controller) reconcileApiServer(ctx context.Context, controlPlane *v1alp
 		}))
 }
 
+// apiServerConfigFlagsFor renders the flags configured in the APIServerConfig
+func apiServerConfigFlagsFor(controlPlane *v1alpha1.ControlPlane) (flags []string) {
+	config := controlPlane.Spec.Master.APIServerConfig
+	if config == nil {
+		return flags
+	}
+	if storage := config.Storage; storage != nil {
+		if storage.DefaultWatchCacheSize != nil {
+			flags = append(flags, fmt.Sprintf("--default-watch-cache-size=%d", *storage.DefaultWatchCacheSize))
+		}
+		if storage.CompactionInterval != nil {
+			flags = append(flags, "--etcd-compaction-interval="+storage.CompactionInterval.Duration.String())
+		}
+	}
+	if tolerations := config.Tolerations; tolerations != nil {
+		if tolerations.NotReady != nil {
+			flags = append(flags, fmt.Sprintf("--default-not-ready-toleration-seconds=%d", int64(tolerations.NotReady.Seconds())))
+		}
+		if tolerations.Unreachable != nil {
+			flags = append(flags, fmt.Sprintf("--default-unreachable-toleration-seconds=%d", int64(tolerations.Unreachable.Seconds())))
+		}
+	}
+	return flags
+}
+
+// featureGatesFlagsFor renders the feature gates shared by the control plane
+// components
+func featureGatesFlagsFor(controlPlane *v1alpha1.ControlPlane) []string {
+	if flag := controlPlane.FeatureGatesFlag(); flag != "" {
+		return []string{flag}
+	}
+	return nil
+}
+
 func APIServerDeploymentName(clusterName string) string {
 	return fmt.Sprintf("%s-apiserver", clusterName)
 }
@@ -105,14 +139,14 @@ func apiServerPodSpecFor(controlPlane *v1alpha1.ControlPlane) v1.PodSpec {
 		Containers: []v1.Container{
 			{
 				Name:    "apiserver",
-				Image:   imageprovider.APIServer(controlPlane.Spec.KubernetesVersion),
+				Image:   imageprovider.APIServer(controlPlane.Spec.ImageRegistry, controlPlane.Spec.KubernetesVersion),
 				Command: []string{"kube-apiserver"},
 				Resources: v1.ResourceRequirements{
 					Requests: map[v1.ResourceName]resource.Quantity{
 						v1.ResourceCPU: resource.MustParse("1"),
 					},
 				},
-				Args: []string{
+				Args: append([]string{
 					"--advertise-address=$(NODE_IP)",
 					"--allow-privileged=true",
 					"--authorization-mode=Node,RBAC",
@@ -134,15 +168,15 @@ func apiServerPodSpecFor(controlPlane *v1alpha1.ControlPlane) v1.PodSpec {
 					"--requestheader-extra-headers-prefix=X-Remote-Extra-",
 					"--requestheader-group-headers=X-Remote-Group",
 					"--requestheader-username-headers=X-Remote-User",
-					"--secure-port=443",
-					"--service-account-issuer=https://kubernetes.default.svc.cluster.local",
+					fmt.Sprintf("--secure-port=%d", controlPlane.APIServerPort()),
+					"--service-account-issuer=" + v1alpha1.ServiceAccountIssuer,
 					"--service-account-key-file=/etc/kubernetes/pki/sa/sa.pub",
 					"--service-account-signing-key-file=/etc/kubernetes/pki/sa/sa.key",
 					"--service-cluster-ip-range=" + serviceClusterIPRange,
 					"--tls-cert-file=/etc/kubernetes/pki/apiserver/apiserver.crt",
 					"--tls-private-key-file=/etc/kubernetes/pki/apiserver/apiserver.key",
 					"--authentication-token-webhook-config-file=/var/aws-iam-authenticator/kubeconfig/kubeconfig.yaml",
-				},
+				}, append(apiServerConfigFlagsFor(controlPlane), featureGatesFlagsFor(controlPlane)...)...),
 				Env: []v1.EnvVar{{
 					Name: "NODE_IP",
 					ValueFrom: &v1.EnvVarSource{
@@ -205,7 +239,7 @@ func apiServerPodSpecFor(controlPlane *v1alpha1.ControlPlane) v1.PodSpec {
 							Host:   "127.0.0.1",
 							Scheme: v1.URISchemeHTTPS,
 							Path:   "/livez",
-							Port:   intstr.FromInt(443),
+							Port:   intstr.FromInt(int(controlPlane.APIServerPort())),
 						},
 					},
 					InitialDelaySeconds: 10,
@@ -219,7 +253,7 @@ func apiServerPodSpecFor(controlPlane *v1alpha1.ControlPlane) v1.PodSpec {
 							Host:   "127.0.0.1",
 							Scheme: v1.URISchemeHTTPS,
 							Path:   "/readyz",
-							Port:   intstr.FromInt(443),
+							Port:   intstr.FromInt(int(controlPlane.APIServerPort())),
 						},
 					},
 					InitialDelaySeconds: 0,
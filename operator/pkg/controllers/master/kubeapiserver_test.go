@@ -0,0 +1,120 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package master
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/ptr"
+)
+
+func TestAPIServerConfigFlags(t *testing.T) {
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: v1alpha1.ControlPlaneSpec{Master: v1alpha1.MasterSpec{APIServerConfig: &v1alpha1.APIServerConfig{
+			Storage: &v1alpha1.APIServerStorage{
+				DefaultWatchCacheSize: ptr.Int32(0),
+				CompactionInterval:    &metav1.Duration{Duration: 20 * time.Minute},
+			},
+			Tolerations: &v1alpha1.APIServerTolerations{
+				NotReady:    &metav1.Duration{Duration: 30 * time.Second},
+				Unreachable: &metav1.Duration{Duration: time.Minute},
+			},
+		}}},
+	}
+	controlPlane.SetDefaults(context.Background())
+	if err := controlPlane.Validate(context.Background()); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	args := map[string]bool{}
+	for _, arg := range apiServerPodSpecFor(controlPlane).Containers[0].Args {
+		args[arg] = true
+	}
+	for _, expected := range []string{
+		"--default-watch-cache-size=0",
+		"--etcd-compaction-interval=20m0s",
+		"--default-not-ready-toleration-seconds=30",
+		"--default-unreachable-toleration-seconds=60",
+	} {
+		if !args[expected] {
+			t.Errorf("expected api server arg %s", expected)
+		}
+	}
+	controlPlane.Spec.Master.APIServerConfig.Tolerations.NotReady.Duration = 1500 * time.Millisecond
+	if err := controlPlane.Validate(context.Background()); err == nil {
+		t.Errorf("expected fractional toleration seconds to fail validation")
+	}
+}
+
+func TestAPIServerCompactionInterval(t *testing.T) {
+	controlPlane := &v1alpha1.ControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	controlPlane.SetDefaults(context.Background())
+	if flags := apiServerConfigFlagsFor(controlPlane); len(flags) != 0 {
+		t.Errorf("expected no compaction interval when unset, got %v", flags)
+	}
+	// Tenants sharing an etcd disable compaction on all but one API server
+	controlPlane.Spec.Master.APIServerConfig = &v1alpha1.APIServerConfig{Storage: &v1alpha1.APIServerStorage{
+		CompactionInterval: &metav1.Duration{},
+	}}
+	if flags := apiServerConfigFlagsFor(controlPlane); len(flags) != 1 || flags[0] != "--etcd-compaction-interval=0s" {
+		t.Errorf("expected compaction to be disabled, got %v", flags)
+	}
+	controlPlane.Spec.Master.APIServerConfig.Storage.CompactionInterval.Duration = -time.Minute
+	if err := controlPlane.Validate(context.Background()); err == nil {
+		t.Errorf("expected a negative compaction interval to fail validation")
+	}
+}
+
+func TestFeatureGates(t *testing.T) {
+	controlPlane := &v1alpha1.ControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       v1alpha1.ControlPlaneSpec{FeatureGates: map[string]bool{"APIListChunking": true, "CSIMigration": false}},
+	}
+	controlPlane.SetDefaults(context.Background())
+	if err := controlPlane.Validate(context.Background()); err != nil {
+		t.Fatalf("validating control plane, %v", err)
+	}
+	for component, podSpec := range map[string]func(*v1alpha1.ControlPlane) v1.PodSpec{
+		"api server":         apiServerPodSpecFor,
+		"controller manager": kcmPodSpecFor,
+		"scheduler":          schedulerPodSpecFor,
+	} {
+		args := map[string]bool{}
+		for _, arg := range podSpec(controlPlane).Containers[0].Args {
+			args[arg] = true
+		}
+		if !args["--feature-gates=APIListChunking=true,CSIMigration=false"] {
+			t.Errorf("expected the %s to share the feature gates", component)
+		}
+	}
+	// A component's own gates would drift from the others
+	controlPlane.Spec.Master.Scheduler = &v1alpha1.Component{Spec: &v1.PodSpec{Containers: []v1.Container{{
+		Name: "scheduler",
+		Args: []string{"--feature-gates=APIListChunking=false"},
+	}}}}
+	if err := controlPlane.Validate(context.Background()); err == nil {
+		t.Errorf("expected a scheduler --feature-gates arg to conflict with the feature gates")
+	}
+	controlPlane.Spec.FeatureGates = map[string]bool{"api-list-chunking": true}
+	controlPlane.Spec.Master.Scheduler = nil
+	if err := controlPlane.Validate(context.Background()); err == nil {
+		t.Errorf("expected an invalid gate name to fail validation")
+	}
+}
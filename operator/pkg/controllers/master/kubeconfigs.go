@@ -51,9 +51,9 @@ func (c *Controller) reconcileKubeConfigs(ctx context.Context, controlPlane *v1a
 	clusterName := controlPlane.ClusterName()
 	ns := controlPlane.Namespace
 	for _, request := range []*kubeconfigs.Request{
-		kubeConfigRequest(clusterName, ns, endpoint, kubeAdminAuthRequest(clusterName, caSecret)),
-		kubeConfigRequest(clusterName, ns, localhostEndpoint, kubeSchedulerAuthRequest(clusterName, caSecret)),
-		kubeConfigRequest(clusterName, ns, localhostEndpoint, kubeControllerManagerAuthRequest(clusterName, caSecret)),
+		kubeConfigRequest(clusterName, ns, endpoint, controlPlane.APIServerPort(), kubeAdminAuthRequest(clusterName, caSecret)),
+		kubeConfigRequest(clusterName, ns, localhostEndpoint, controlPlane.APIServerPort(), kubeSchedulerAuthRequest(clusterName, caSecret)),
+		kubeConfigRequest(clusterName, ns, localhostEndpoint, controlPlane.APIServerPort(), kubeControllerManagerAuthRequest(clusterName, caSecret)),
 	} {
 		if err := c.kubeConfigs.ReconcileConfigFor(ctx, controlPlane, request); err != nil {
 			return err
@@ -70,11 +70,12 @@ type authRequest struct {
 	caKey  []byte
 }
 
-func kubeConfigRequest(clusterName, ns, endpoint string, clientAuth *authRequest) *kubeconfigs.Request {
+func kubeConfigRequest(clusterName, ns, endpoint string, port int32, clientAuth *authRequest) *kubeconfigs.Request {
 	contextName := fmt.Sprintf("%s@%s", clientAuth.name, clusterName)
 	return &kubeconfigs.Request{
 		ClusterContext:    contextName,
 		ApiServerEndpoint: endpoint,
+		ApiServerPort:     port,
 		Name:              clientAuth.name,
 		ClusterName:       clusterName,
 		Namespace:         ns,
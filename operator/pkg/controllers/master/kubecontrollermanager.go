@@ -88,14 +88,14 @@ func kcmPodSpecFor(controlPlane *v1alpha1.ControlPlane) v1.PodSpec {
 		NodeSelector:                  nodeSelector(controlPlane.ClusterName()),
 		Containers: []v1.Container{{
 			Name:    "controller-manager",
-			Image:   imageprovider.KubeControllerManager(controlPlane.Spec.KubernetesVersion),
+			Image:   imageprovider.KubeControllerManager(controlPlane.Spec.ImageRegistry, controlPlane.Spec.KubernetesVersion),
 			Command: []string{"kube-controller-manager"},
 			Resources: v1.ResourceRequirements{
 				Requests: map[v1.ResourceName]resource.Quantity{
 					v1.ResourceCPU: resource.MustParse("1"),
 				},
 			},
-			Args: []string{
+			Args: append([]string{
 				"--authentication-kubeconfig=/etc/kubernetes/config/kcm/controller-manager.conf",
 				"--authorization-kubeconfig=/etc/kubernetes/config/kcm/controller-manager.conf",
 				"--bind-address=127.0.0.1",
@@ -111,7 +111,7 @@ func kcmPodSpecFor(controlPlane *v1alpha1.ControlPlane) v1.PodSpec {
 				"--use-service-account-credentials=true",
 				"--cloud-provider=aws",
 				"--cloud-config=/etc/kubernetes/cloud-config/aws.config",
-			},
+			}, featureGatesFlagsFor(controlPlane)...),
 			VolumeMounts: []v1.VolumeMount{{
 				Name:      "ca-certs",
 				MountPath: "/etc/ssl/certs",
@@ -77,20 +77,20 @@ func schedulerPodSpecFor(controlPlane *v1alpha1.ControlPlane) v1.PodSpec {
 		NodeSelector:                  nodeSelector(controlPlane.ClusterName()),
 		Containers: []v1.Container{{
 			Name:    "scheduler",
-			Image:   imageprovider.KubeScheduler(controlPlane.Spec.KubernetesVersion),
+			Image:   imageprovider.KubeScheduler(controlPlane.Spec.ImageRegistry, controlPlane.Spec.KubernetesVersion),
 			Command: []string{"kube-scheduler"},
 			Resources: v1.ResourceRequirements{
 				Requests: map[v1.ResourceName]resource.Quantity{
 					v1.ResourceCPU: resource.MustParse("1"),
 				},
 			},
-			Args: []string{
+			Args: append([]string{
 				"--authentication-kubeconfig=/etc/kubernetes/config/scheduler/scheduler.conf",
 				"--authorization-kubeconfig=/etc/kubernetes/config/scheduler/scheduler.conf",
 				"--bind-address=127.0.0.1",
 				"--kubeconfig=/etc/kubernetes/config/scheduler/scheduler.conf",
 				"--leader-elect=true",
-			},
+			}, featureGatesFlagsFor(controlPlane)...),
 			VolumeMounts: []v1.VolumeMount{{
 				Name:      "ca-certs",
 				MountPath: "/etc/ssl/certs",
@@ -34,15 +34,17 @@ type Controller struct {
 	kubeConfigs   *kubeconfigs.Provider
 	iamController controlplane.Controller
 	cloudProvider awsprovider.AccountMetadata
+	loadBalancers awsprovider.LoadBalancerAttributes
 }
 
-func New(kubeclient *kubeprovider.Client, account awsprovider.AccountMetadata, iamController controlplane.Controller) *Controller {
+func New(kubeclient *kubeprovider.Client, account awsprovider.AccountMetadata, iamController controlplane.Controller, loadBalancers awsprovider.LoadBalancerAttributes) *Controller {
 	return &Controller{
 		kubeClient:    kubeclient,
 		keypairs:      keypairs.Reconciler(kubeclient),
 		kubeConfigs:   kubeconfigs.Reconciler(kubeclient),
 		iamController: iamController,
 		cloudProvider: account,
+		loadBalancers: loadBalancers,
 	}
 }
 
@@ -55,11 +57,12 @@ func (c *Controller) Reconcile(ctx context.Context, controlPlane *v1alpha1.Contr
 		c.reconcileKubeConfigs,
 		c.reconcileSAKeyPair,
 		c.reconcileApiServer,
+		c.reconcileEndpointReadiness,
 		c.reconcileKCMCloudConfig,
 		c.reconcileKCM,
 		c.reconcileScheduler,
 		c.reconcileAuthenticator,
-		c.iamController.Reconcile,
+		c.reconcileIAM,
 	} {
 		if err := reconcile(ctx, controlPlane); err != nil {
 			return err
@@ -69,7 +72,26 @@ func (c *Controller) Reconcile(ctx context.Context, controlPlane *v1alpha1.Contr
 	return nil
 }
 
+// reconcileIAM is skipped in dry-run, as the IAM resources are created in AWS
+func (c *Controller) reconcileIAM(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	if kubeprovider.IsDryRun(ctx) {
+		zap.S().Infof("[%v] dry-run, skipping IAM resources", controlPlane.ClusterName())
+		return nil
+	}
+	return c.iamController.Reconcile(ctx, controlPlane)
+}
+
+// Finalize turns off the NLB's deletion protection, so it's deleted with the
+// Service when the control plane's owned objects are garbage collected. The
+// control plane isn't finalized until the load balancer controller has
+// applied the attribute to the NLB.
 func (c *Controller) Finalize(ctx context.Context, controlPlane *v1alpha1.ControlPlane) error {
+	if err := c.ensureDeletionProtection(ctx, controlPlane, false); err != nil {
+		return err
+	}
+	if err := c.deletionProtectionDisabled(ctx, controlPlane); err != nil {
+		return err
+	}
 	return c.iamController.Finalize(ctx, controlPlane)
 }
 
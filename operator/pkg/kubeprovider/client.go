@@ -19,15 +19,21 @@ import (
 	"fmt"
 
 	"github.com/awslabs/kit/operator/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 type Client struct {
 	client.Client
+	// ConflictBackoff bounds the retries of a create or patch that conflicts
+	// with a concurrent update, before the conflict is returned
+	ConflictBackoff wait.Backoff
 }
 
 func New(client client.Client) *Client {
-	return &Client{client}
+	return &Client{Client: client, ConflictBackoff: retry.DefaultBackoff}
 }
 
 // EnsureCreate creates the object if not exist, some of the objects can't be
@@ -37,30 +43,71 @@ func New(client client.Client) *Client {
 // revisit both these to define what all users can change in an existing
 // cluster.
 func (c *Client) EnsureCreate(ctx context.Context, desired client.Object) error {
-	existingObject := desired.DeepCopyObject().(client.Object)
-	if err := c.Get(ctx, client.ObjectKeyFromObject(desired), existingObject); err != nil {
-		if errors.IsNotFound(err) {
-			return c.Create(ctx, desired)
+	return retry.RetryOnConflict(c.ConflictBackoff, func() error {
+		existingObject := desired.DeepCopyObject().(client.Object)
+		if err := c.Get(ctx, client.ObjectKeyFromObject(desired), existingObject); err != nil {
+			if errors.IsNotFound(err) {
+				return c.create(ctx, desired)
+			}
+			return fmt.Errorf("getting object when creating %v, name %v, %w",
+				desired.GetObjectKind().GroupVersionKind().GroupKind().String(), desired.GetName(), err)
 		}
-		return fmt.Errorf("getting object when creating %v, name %v, %w",
-			desired.GetObjectKind().GroupVersionKind().GroupKind().String(), desired.GetName(), err)
-	}
-	return nil
+		return nil
+	})
 }
 
 // EnsurePatch creates if not exist, else will patch the existing object. Its
 // used for deployments, statefulsets to provide configurability for flags.
+// The patch is retried against the latest object when it conflicts with a
+// concurrent update, i.e. overlapping reconciles.
 func (c *Client) EnsurePatch(ctx context.Context, object, desired client.Object) error {
-	if err := c.Get(ctx, client.ObjectKeyFromObject(desired), object); err != nil {
-		if errors.IsNotFound(err) {
-			return c.Create(ctx, desired)
+	return retry.RetryOnConflict(c.ConflictBackoff, func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(desired), object); err != nil {
+			if errors.IsNotFound(err) {
+				return c.create(ctx, desired)
+			}
+			return fmt.Errorf("getting object %v, name %v, %w",
+				desired.GetObjectKind().GroupVersionKind().GroupKind().String(), desired.GetName(), err)
+		}
+		if dryRun := dryRunFrom(ctx); dryRun != nil {
+			dryRun.record("patch", c.describe(desired))
+			return nil
 		}
-		return fmt.Errorf("getting object %v, name %v, %w",
-			desired.GetObjectKind().GroupVersionKind().GroupKind().String(), desired.GetName(), err)
+		desired.SetResourceVersion(object.GetResourceVersion())
+		if err := c.Patch(ctx, desired, client.StrategicMergeFrom(object)); err != nil {
+			return fmt.Errorf("failed to patch, %v, %w", desired.GetName(), err)
+		}
+		return nil
+	})
+}
+
+// Delete deletes the object, in dry-run the deletion is recorded if the object exists
+func (c *Client) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	dryRun := dryRunFrom(ctx)
+	if dryRun == nil {
+		return c.Client.Delete(ctx, obj, opts...)
 	}
-	desired.SetResourceVersion(object.GetResourceVersion())
-	if err := c.Patch(ctx, desired, client.StrategicMergeFrom(object)); err != nil {
-		return fmt.Errorf("failed to patch, %v, %w", desired.GetName(), err)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj.DeepCopyObject().(client.Object)); err != nil {
+		return err
 	}
+	dryRun.record("delete", c.describe(obj))
 	return nil
 }
+
+func (c *Client) create(ctx context.Context, desired client.Object) error {
+	if dryRun := dryRunFrom(ctx); dryRun != nil {
+		dryRun.record("create", c.describe(desired))
+		return nil
+	}
+	return c.Create(ctx, desired)
+}
+
+// describe returns the kind and name of the object, the kind isn't always set
+// on typed objects so it's looked up from the scheme
+func (c *Client) describe(obj client.Object) string {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	return fmt.Sprintf("%s %s", kind, client.ObjectKeyFromObject(obj))
+}
@@ -0,0 +1,134 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeprovider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/awslabs/kit/operator/pkg/errors"
+	"github.com/awslabs/kit/operator/pkg/utils/scheme"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDryRun(t *testing.T) {
+	existing := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+		Data:       map[string]string{"key": "value"},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).WithObjects(existing.DeepCopy()).Build()
+	ctx, dryRun := WithDryRun(context.Background())
+	if !IsDryRun(ctx) || IsDryRun(context.Background()) {
+		t.Fatalf("expected only the dry-run context to be in dry-run")
+	}
+	c := New(kubeClient)
+	if err := c.EnsureCreate(ctx, &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "created", Namespace: "default"}}); err != nil {
+		t.Fatalf("ensuring created, %v", err)
+	}
+	if err := c.EnsurePatch(ctx, &v1.ConfigMap{}, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+		Data:       map[string]string{"key": "patched"},
+	}); err != nil {
+		t.Fatalf("ensuring patched, %v", err)
+	}
+	if err := c.EnsurePatch(ctx, &v1.Secret{}, &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "patched", Namespace: "default"}}); err != nil {
+		t.Fatalf("ensuring patched, %v", err)
+	}
+	if err := c.Delete(ctx, &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"}}); err != nil {
+		t.Fatalf("deleting, %v", err)
+	}
+	if err := c.Delete(ctx, &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "missing", Namespace: "default"}}); !errors.IsNotFound(err) {
+		t.Errorf("expected deleting a missing object to be not found, got %v", err)
+	}
+
+	// Nothing is written
+	configMap := &v1.ConfigMap{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "existing"}, configMap); err != nil {
+		t.Fatalf("getting config map, %v", err)
+	}
+	if !reflect.DeepEqual(configMap.Data, existing.Data) {
+		t.Errorf("expected config map data %v to be unchanged, got %v", existing.Data, configMap.Data)
+	}
+	for _, name := range []string{"created", "patched"} {
+		if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, &v1.ConfigMap{}); !errors.IsNotFound(err) {
+			t.Errorf("expected %s not to be created, got %v", name, err)
+		}
+	}
+	// Intended changes are reported
+	expected := []string{
+		"create ConfigMap default/created",
+		"patch ConfigMap default/existing",
+		"create Secret default/patched",
+		"delete ConfigMap default/existing",
+	}
+	if changes := dryRun.Changes(); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %v, got %v", expected, changes)
+	}
+}
+
+// conflictingClient fails the first patches with a conflict, as if another
+// reconcile updated the object in between
+type conflictingClient struct {
+	client.Client
+	conflicts int
+	patches   int
+}
+
+func (c *conflictingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.patches++
+	if c.patches <= c.conflicts {
+		return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, obj.GetName(), nil)
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestEnsurePatchRetriesConflicts(t *testing.T) {
+	ctx := context.Background()
+	existing := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+		Data:       map[string]string{"key": "value"},
+	}
+	kubeClient := &conflictingClient{
+		Client:    fake.NewClientBuilder().WithScheme(scheme.SubstrateCluster).WithObjects(existing).Build(),
+		conflicts: 1,
+	}
+	if err := New(kubeClient).EnsurePatch(ctx, &v1.ConfigMap{}, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+		Data:       map[string]string{"key": "patched"},
+	}); err != nil {
+		t.Fatalf("ensuring patched, %v", err)
+	}
+	configMap := &v1.ConfigMap{}
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "existing"}, configMap); err != nil {
+		t.Fatalf("getting config map, %v", err)
+	}
+	if configMap.Data["key"] != "patched" || kubeClient.patches != 2 {
+		t.Errorf("expected the patch to apply on the retry, got %v after %d patches", configMap.Data, kubeClient.patches)
+	}
+	// Conflicts are returned once the retries are exhausted
+	kubeClient.patches, kubeClient.conflicts = 0, 100
+	if err := New(kubeClient).EnsurePatch(ctx, &v1.ConfigMap{}, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+	}); !apierrors.IsConflict(err) {
+		t.Errorf("expected a conflict after retrying, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeprovider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type dryRunKey struct{}
+
+// DryRun records the changes skipped by the client while reconciling in dry-run
+type DryRun struct {
+	mu      sync.Mutex
+	changes []string
+}
+
+// WithDryRun returns a context in which the client records the objects it
+// would create, patch or delete instead of writing them
+func WithDryRun(ctx context.Context) (context.Context, *DryRun) {
+	dryRun := &DryRun{}
+	return context.WithValue(ctx, dryRunKey{}, dryRun), dryRun
+}
+
+// IsDryRun returns true if writes are skipped for this context
+func IsDryRun(ctx context.Context) bool {
+	return dryRunFrom(ctx) != nil
+}
+
+// Changes returns the intended changes in the order they were recorded
+func (d *DryRun) Changes() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.changes...)
+}
+
+func (d *DryRun) record(operation, object string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.changes = append(d.changes, fmt.Sprintf("%s %s", operation, object))
+}
+
+func dryRunFrom(ctx context.Context) *DryRun {
+	dryRun, _ := ctx.Value(dryRunKey{}).(*DryRun)
+	return dryRun
+}
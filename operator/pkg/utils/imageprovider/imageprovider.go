@@ -14,12 +14,20 @@ limitations under the License.
 
 package imageprovider
 
+import "strings"
+
 var (
 	imageTags = map[string]string{
 		"1.19": kubeVersion119Tag,
 		"1.20": kubeVersion120Tag,
 		"1.21": kubeVersion121Tag,
 	}
+	// coreDNSTags are the CoreDNS versions released with each EKS-D release
+	coreDNSTags = map[string]string{
+		"1.19": "v1.8.0-eks-1-19-9",
+		"1.20": "v1.8.3-eks-1-20-4",
+		"1.21": "v1.8.4-eks-1-21-4",
+	}
 )
 
 func IsKubeVersionSupported(version string) bool {
@@ -33,36 +41,82 @@ const (
 	kubeVersion121Tag = "v1.21.2-eks-1-21-4"
 	repositoryName    = "public.ecr.aws/eks-distro/"
 	busyBoxImage      = "public.ecr.aws/docker/library/busybox:stable"
+	awsCLIImage       = "public.ecr.aws/aws-cli/aws-cli:2.4.6"
+	vpcCNIVersionTag  = "v1.10.1"
+	calicoRepository  = "quay.io/calico/"
+	calicoVersionTag  = "v3.21.2"
 )
 
-func APIServer(version string) string {
-	return repositoryName + "kubernetes/kube-apiserver:" + imageTags[version]
+// Registry is the registry mirroring the EKS-D repositories, the images are
+// pulled from public ECR when it's empty
+func Registry(registry string) string {
+	if registry == "" {
+		return repositoryName
+	}
+	return strings.TrimSuffix(registry, "/") + "/"
+}
+
+func APIServer(registry, version string) string {
+	return Registry(registry) + "kubernetes/kube-apiserver:" + imageTags[version]
 }
 
-func KubeControllerManager(version string) string {
-	return repositoryName + "kubernetes/kube-controller-manager:" + imageTags[version]
+func KubeControllerManager(registry, version string) string {
+	return Registry(registry) + "kubernetes/kube-controller-manager:" + imageTags[version]
 }
 
-func KubeScheduler(version string) string {
-	return repositoryName + "kubernetes/kube-scheduler:" + imageTags[version]
+func KubeScheduler(registry, version string) string {
+	return Registry(registry) + "kubernetes/kube-scheduler:" + imageTags[version]
 }
 
-func KubeProxy(version string) string {
-	return repositoryName + "kubernetes/kube-proxy:" + imageTags[version]
+func KubeProxy(registry, version string) string {
+	return Registry(registry) + "kubernetes/kube-proxy:" + imageTags[version]
 }
 
-func ETCD() string {
-	return repositoryName + "etcd-io/etcd:v3.4.16-eks-1-21-4"
+func ETCD(registry string) string {
+	return Registry(registry) + "etcd-io/etcd:v3.4.16-eks-1-21-4"
 }
 
-func CoreDNS() string {
-	return repositoryName + "coredns/coredns:v1.8.3-eks-1-20-4"
+func CoreDNS(registry, version string) string {
+	return Registry(registry) + "coredns/coredns:" + coreDNSTags[version]
 }
 
-func AWSIamAuthenticator() string {
-	return repositoryName + "kubernetes-sigs/aws-iam-authenticator:v0.5.3-eks-1-21-8"
+func AWSIamAuthenticator(registry string) string {
+	return Registry(registry) + "kubernetes-sigs/aws-iam-authenticator:v0.5.3-eks-1-21-8"
 }
 
 func BusyBox() string {
 	return busyBoxImage
 }
+
+func AWSCLI() string {
+	return awsCLIImage
+}
+
+// AmazonK8sCNI is the image of the VPC CNI's aws-node daemon
+func AmazonK8sCNI() string {
+	return "public.ecr.aws/eks/amazon-k8s-cni:" + vpcCNIVersionTag
+}
+
+// AmazonK8sCNIInit is the image installing the VPC CNI's plugin binaries
+func AmazonK8sCNIInit() string {
+	return "public.ecr.aws/eks/amazon-k8s-cni-init:" + vpcCNIVersionTag
+}
+
+func CalicoNode() string {
+	return calicoRepository + "node:" + calicoVersionTag
+}
+
+// CalicoCNI is the image installing calico's plugin binaries and network config
+func CalicoCNI() string {
+	return calicoRepository + "cni:" + calicoVersionTag
+}
+
+func CalicoTypha() string {
+	return calicoRepository + "typha:" + calicoVersionTag
+}
+
+// CalicoKubeControllers is the image garbage collecting calico's IPAM
+// allocations of deleted nodes
+func CalicoKubeControllers() string {
+	return calicoRepository + "kube-controllers:" + calicoVersionTag
+}
@@ -17,6 +17,8 @@ package kubeconfigs
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/awslabs/kit/operator/pkg/apis/controlplane/v1alpha1"
 	"github.com/awslabs/kit/operator/pkg/errors"
@@ -46,8 +48,10 @@ type Request struct {
 	Namespace         string
 	ClusterContext    string
 	ApiServerEndpoint string
-	Contexts          map[string]*clientcmdapi.Context
-	AuthInfo          ClientAuthInfo
+	// ApiServerPort defaults to 443
+	ApiServerPort int32
+	Contexts      map[string]*clientcmdapi.Context
+	AuthInfo      ClientAuthInfo
 }
 
 func Reconciler(kubeClient *kubeprovider.Client) *Provider {
@@ -55,6 +59,10 @@ func Reconciler(kubeClient *kubeprovider.Client) *Provider {
 }
 
 func (p *Provider) ReconcileConfigFor(ctx context.Context, controlPlane *v1alpha1.ControlPlane, request *Request) error {
+	// A kubeconfig without a server can't be used, wait for the endpoint
+	if request.ApiServerEndpoint == "" {
+		return fmt.Errorf("api server endpoint for %v, %w", request.Name, errors.WaitingForSubResources)
+	}
 	// Check if this secret for kubeconfig exists in the api server
 	_, err := p.keypairs.GetSecretFromServer(ctx, object.NamespacedName(request.Name, request.Namespace))
 	if err != nil && errors.IsNotFound(err) {
@@ -83,12 +91,19 @@ func (p *Provider) ReconcileConfigFor(ctx context.Context, controlPlane *v1alpha
 	return err
 }
 
+func apiServerPortFor(request *Request) string {
+	if request.ApiServerPort == 0 {
+		return "443"
+	}
+	return strconv.Itoa(int(request.ApiServerPort))
+}
+
 func kubeConfigFor(request *Request, clusterName string, auth map[string]*clientcmdapi.AuthInfo) *clientcmdapi.Config {
 	return &clientcmdapi.Config{
 		Kind: "Config",
 		Clusters: map[string]*clientcmdapi.Cluster{
 			clusterName: {
-				Server:                   fmt.Sprintf("https://%s:443", request.ApiServerEndpoint),
+				Server:                   "https://" + net.JoinHostPort(request.ApiServerEndpoint, apiServerPortFor(request)),
 				CertificateAuthorityData: request.AuthInfo.CACert(),
 			},
 		},
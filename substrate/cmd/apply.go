@@ -26,19 +26,21 @@ import (
 )
 
 func init() {
-	rootCmd.AddCommand(&cobra.Command{
+	applyCmd := &cobra.Command{
 		Use:   "apply",
 		Short: "Apply an environment for testing. Will reconnect if the environment already exists.",
 		Long:  ``,
 		Run:   Apply,
-	})
+	}
+	applyCmd.Flags().DurationVar(&options.KubeConfigURLTTL, "kubeconfig-url-ttl", 0, "Print a presigned URL downloading the admin kubeconfig, valid for this long")
+	rootCmd.AddCommand(applyCmd)
 }
 
 func Apply(cmd *cobra.Command, args []string) {
 	ctx := cmd.Context()
 	start := time.Now()
 	name := "test-substrate"
-	if err := substrate.NewController(ctx).Reconcile(ctx, &v1alpha1.Substrate{
+	applied := &v1alpha1.Substrate{
 		ObjectMeta: metav1.ObjectMeta{Name: name},
 		Spec: v1alpha1.SubstrateSpec{
 			VPC:          &v1alpha1.VPCSpec{CIDR: "10.0.0.0/16"},
@@ -52,9 +54,17 @@ func Apply(cmd *cobra.Command, args []string) {
 				{Zone: "us-west-2c", CIDR: "10.0.102.0/24", Public: true},
 			},
 		},
-	}); err != nil {
+	}
+	if options.KubeConfigURLTTL != 0 {
+		applied.Spec.KubeConfigURLTTL = &metav1.Duration{Duration: options.KubeConfigURLTTL}
+	}
+	if err := substrate.NewController(ctx).Reconcile(ctx, applied); err != nil {
 		logging.FromContext(ctx).Error(err.Error())
 		return
 	}
 	logging.FromContext(ctx).Infof("Applied substrate %s after %s", name, time.Since(start))
+	// The status only lives as long as the command, so the URL is printed
+	if url := applied.Status.Cluster.KubeConfigURL; url != nil {
+		logging.FromContext(ctx).Infof("Admin kubeconfig is downloadable until %s from %s", applied.Status.Cluster.KubeConfigURLExpiry.Format(time.RFC3339), aws.StringValue(url))
+	}
 }
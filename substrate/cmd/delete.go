@@ -27,21 +27,30 @@ import (
 func init() {
 	rootCmd.LocalFlags().StringVar(&options.File, "name", "", "Name for the environment")
 	rootCmd.LocalFlags().StringVarP(&options.File, "file", "f", "", "Configuration file for the environment")
-	rootCmd.AddCommand(&cobra.Command{
+	deleteCmd := &cobra.Command{
 		Use:   "delete",
 		Short: "Delete the environment",
 		Long:  ``,
 		Run:   Delete,
-	})
+	}
+	deleteCmd.Flags().DurationVar(&options.DeleteTimeout, "timeout", substrate.DefaultDeleteTimeout, "How long deleting the environment may take, 0 waits indefinitely")
+	deleteCmd.Flags().BoolVar(&options.KeepWarmPool, "keep-warm-pool", false, "Keep the idle warm pool instances and the infrastructure they run in for the next substrate")
+	rootCmd.AddCommand(deleteCmd)
 }
 
 func Delete(cmd *cobra.Command, args []string) {
 	ctx := cmd.Context()
 	start := time.Now()
 	name := "test-substrate"
-	if err := substrate.NewController(ctx).Reconcile(ctx, &v1alpha1.Substrate{
+	controller := substrate.NewController(ctx)
+	controller.DeleteTimeout = options.DeleteTimeout
+	deleting := &v1alpha1.Substrate{
 		ObjectMeta: metav1.ObjectMeta{Name: name, DeletionTimestamp: &metav1.Time{Time: time.Now()}},
-	}); err != nil {
+	}
+	if options.KeepWarmPool {
+		deleting.Spec.WarmPool = &v1alpha1.WarmPoolSpec{}
+	}
+	if err := controller.Reconcile(ctx, deleting); err != nil {
 		logging.FromContext(ctx).Error(err.Error())
 		return
 	}
@@ -0,0 +1,52 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"time"
+
+	"github.com/awslabs/kit/substrate/pkg/controller/substrate"
+	"github.com/spf13/cobra"
+	"knative.dev/pkg/logging"
+)
+
+func init() {
+	reapCmd := &cobra.Command{
+		Use:   "reap",
+		Short: "Delete the AWS resources tagged for an environment, even if its configuration is lost",
+		Long:  ``,
+		Run:   Reap,
+	}
+	reapCmd.Flags().StringVar(&options.Name, "name", "test-substrate", "Name of the environment to reap")
+	reapCmd.Flags().BoolVar(&options.DryRun, "dry-run", false, "List the resources that would be deleted without deleting them")
+	rootCmd.AddCommand(reapCmd)
+}
+
+func Reap(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	start := time.Now()
+	reaper := substrate.NewReaper(ctx)
+	reaper.DryRun = options.DryRun
+	arns, err := reaper.Reap(ctx, options.Name)
+	if err != nil {
+		logging.FromContext(ctx).Error(err.Error())
+		return
+	}
+	if options.DryRun {
+		logging.FromContext(ctx).Infof("Found %d resources for substrate %s", len(arns), options.Name)
+		return
+	}
+	logging.FromContext(ctx).Infof("Reaped %d resources for substrate %s after %s", len(arns), options.Name, time.Since(start))
+}
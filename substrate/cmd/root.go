@@ -17,6 +17,7 @@ package main
 
 import (
 	"context"
+	"time"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -41,7 +42,13 @@ It also supports configuring the cloud provider environment to get started easil
 var options = Options{}
 
 type Options struct {
-	File string
+	File          string
+	DeleteTimeout time.Duration
+	Name          string
+	DryRun        bool
+	KeepWarmPool  bool
+	// KubeConfigURLTTL presigns the admin kubeconfig URL printed by apply
+	KubeConfigURLTTL time.Duration
 }
 
 func init() {
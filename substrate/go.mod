@@ -13,9 +13,12 @@ require (
 	k8s.io/api v0.23.1
 	k8s.io/apimachinery v0.23.1
 	k8s.io/client-go v0.23.1
+	k8s.io/cluster-bootstrap v0.0.0
+	k8s.io/kubelet v0.0.0
 	k8s.io/kubernetes v1.23.1
 	knative.dev/pkg v0.0.0-20211215065729-552319d4f55b
 	sigs.k8s.io/controller-runtime v0.11.0
+	sigs.k8s.io/yaml v1.3.0
 )
 
 replace (
@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"strings"
+
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"knative.dev/pkg/apis"
@@ -28,6 +30,607 @@ type SubstrateSpec struct {
 	Subnets []*SubnetSpec `json:"subnets,omitempty"`
 	// +optional
 	InstanceType *string `json:"instanceType,omitempty"`
+	// DetailedMonitoring publishes the substrate node's CloudWatch metrics
+	// every minute instead of every 5 minutes, defaults to true
+	// +optional
+	DetailedMonitoring *bool `json:"detailedMonitoring,omitempty"`
+	// WarmPool keeps idle instances booted from the launch template, a new
+	// substrate node is claimed from the pool instead of launched
+	// +optional
+	WarmPool *WarmPoolSpec `json:"warmPool,omitempty"`
+	// ContainerRuntime the kubelet runs pods with, docker or containerd.
+	// Defaults to docker.
+	// +optional
+	ContainerRuntime string `json:"containerRuntime,omitempty"`
+	// CgroupDriver the kubelet and container runtime manage cgroups with,
+	// systemd or cgroupfs. Defaults to systemd.
+	// +optional
+	CgroupDriver string `json:"cgroupDriver,omitempty"`
+	// OperatingSystem of the substrate node, AmazonLinux2 or Bottlerocket.
+	// Defaults to AmazonLinux2.
+	// +optional
+	OperatingSystem string `json:"operatingSystem,omitempty"`
+	// Bottlerocket configures the substrate node when the operating system is
+	// Bottlerocket
+	// +optional
+	Bottlerocket *BottlerocketSpec `json:"bottlerocket,omitempty"`
+	// NodeLabels are registered by the substrate node's kubelet in addition
+	// to kit.aws/substrate=control-plane. Labels in the kubernetes.io and
+	// k8s.io namespaces are limited to the ones the kubelet may set, and
+	// node-role.kubernetes.io labels which are applied through the API once
+	// the node has registered.
+	// +optional
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+	// NodeTaints are registered by the substrate node's kubelet
+	// +optional
+	NodeTaints []v1.Taint `json:"nodeTaints,omitempty"`
+	// BucketNamePrefix and BucketNameSuffix are added to the name of the S3
+	// bucket storing the cluster configuration, for orgs that enforce bucket
+	// naming conventions
+	// +optional
+	BucketNamePrefix string `json:"bucketNamePrefix,omitempty"`
+	// +optional
+	BucketNameSuffix string `json:"bucketNameSuffix,omitempty"`
+	// BucketKMSKeyARN encrypts the cluster configuration bucket with a KMS
+	// key, the substrate node is allowed to decrypt with it. Defaults to S3
+	// managed keys (AES256).
+	// +optional
+	BucketKMSKeyARN *string `json:"bucketKMSKeyARN,omitempty"`
+	// BucketTransferAcceleration enables S3 Transfer Acceleration on the
+	// cluster configuration bucket and uploads through the accelerate
+	// endpoint, for substrates applied far from their region. False suspends
+	// acceleration, unset leaves the bucket's configuration unchanged.
+	// +optional
+	BucketTransferAcceleration *bool `json:"bucketTransferAcceleration,omitempty"`
+	// +optional
+	FlowLogs *FlowLogsSpec `json:"flowLogs,omitempty"`
+	// EventTTL is the amount of time the API server retains events, defaults to 1h
+	// +optional
+	EventTTL *metav1.Duration `json:"eventTTL,omitempty"`
+	// KubeConfigEndpoint overrides the host:port of the server in the admin
+	// kubeconfig, for clusters accessed through a tunnel or a different port.
+	// Components on the substrate node continue to use the internal endpoint.
+	// +optional
+	KubeConfigEndpoint *string `json:"kubeConfigEndpoint,omitempty"`
+	// APIServerPort is the port the API server binds and is advertised on,
+	// defaults to 443
+	// +optional
+	APIServerPort *int32 `json:"apiServerPort,omitempty"`
+	// ServiceCIDR is the API server's --service-cluster-ip-range, the
+	// kubernetes service is the range's first address. Defaults to
+	// 10.96.0.0/12.
+	// +optional
+	ServiceCIDR string `json:"serviceCIDR,omitempty"`
+	// AdditionalCertSANs are added to the API server's serving certificate,
+	// i.e. a DNS name pointing at the substrate's address. The certificate is
+	// reissued when a SAN is missing from it.
+	// +optional
+	AdditionalCertSANs []string `json:"additionalCertSANs,omitempty"`
+	// CertificateRenewBefore regenerates the certificates signed by the
+	// cluster's CAs when they expire within the duration, the CAs are kept.
+	// Defaults to 720h.
+	// +optional
+	CertificateRenewBefore *metav1.Duration `json:"certificateRenewBefore,omitempty"`
+	// ForceCertificateRenewal regenerates the certificates signed by the
+	// cluster's CAs that were issued before the time, so setting it to now
+	// renews them once on the next apply. It can't be in the future.
+	// +optional
+	ForceCertificateRenewal *metav1.Time `json:"forceCertificateRenewal,omitempty"`
+	// ElasticIPAllocationID is a pre-allocated elastic IP to associate with the
+	// substrate node instead of allocating one, keeping the address stable
+	// across substrates. The elastic IP is not released on delete.
+	// +optional
+	ElasticIPAllocationID *string `json:"elasticIPAllocationID,omitempty"`
+	// Region to store the substrate's configuration in, defaults to the controller's region
+	// +optional
+	Region *string `json:"region,omitempty"`
+	// ReplicaBucket is an existing bucket the configuration is copied to after
+	// it's uploaded, i.e. in another region for disaster recovery. Failing to
+	// copy the configuration doesn't fail the substrate.
+	// +optional
+	ReplicaBucket *ReplicaBucketSpec `json:"replicaBucket,omitempty"`
+	// UploadTimeout bounds uploading the configuration to the buckets, the
+	// upload is retried on the next reconcile. Defaults to 2m.
+	// +optional
+	UploadTimeout *metav1.Duration `json:"uploadTimeout,omitempty"`
+	// KubeConfigURLTTL publishes a presigned URL of the admin kubeconfig in
+	// the status, for clients without access to the controller's filesystem.
+	// The URL grants admin access to the cluster until it expires, it's
+	// reissued on every apply. Must be between 1m and 12h.
+	// +optional
+	KubeConfigURLTTL *metav1.Duration `json:"kubeConfigURLTTL,omitempty"`
+	// AuditLog enables file based audit logging for the API server
+	// +optional
+	AuditLog *AuditLogSpec `json:"auditLog,omitempty"`
+	// ComponentSidecars are appended to the static pod of the control plane
+	// component they're keyed by, i.e. etcd or kube-apiserver. Sidecars may only
+	// mount volumes already defined in the component's pod.
+	// +optional
+	ComponentSidecars map[string][]v1.Container `json:"componentSidecars,omitempty"`
+	// ComponentArgs sets flags on the control plane components, taking
+	// precedence over the flags set by the substrate
+	// +optional
+	ComponentArgs *ComponentArgsSpec `json:"componentArgs,omitempty"`
+	// Schedulers are run as static pods next to the default scheduler, pods
+	// choose a scheduler with spec.schedulerName
+	// +optional
+	Schedulers []SchedulerSpec `json:"schedulers,omitempty"`
+	// AnonymousAuth enables anonymous requests to the API server, defaults to true
+	// +optional
+	AnonymousAuth *bool `json:"anonymousAuth,omitempty"`
+	// ClientCertAuth set to false authenticates users through a token
+	// authenticator, aws-iam-authenticator or OIDC, which must be enabled.
+	// The API server keeps its client CA alongside it, the kubelet, controller
+	// manager, scheduler and admin kubeconfigs authenticate with client
+	// certificates and the API server always tries them before tokens.
+	// +optional
+	ClientCertAuth *bool `json:"clientCertAuth,omitempty"`
+	// EnableBootstrapTokenAuth allows bootstrap tokens to authenticate to the
+	// API server, i.e. for nodes joining with kubeadm. Defaults to true when
+	// clusterInfo has bootstrap tokens, otherwise false.
+	// +optional
+	EnableBootstrapTokenAuth *bool `json:"enableBootstrapTokenAuth,omitempty"`
+	// EnableIAMAuthenticator runs aws-iam-authenticator on the substrate node as
+	// the API server's token authentication webhook, defaults to true. Disable
+	// it for clusters authenticating with OIDC or client certificates only.
+	// +optional
+	EnableIAMAuthenticator *bool `json:"enableIAMAuthenticator,omitempty"`
+	// EBSCSIDriver installs the EBS CSI driver and a default gp3 StorageClass,
+	// using the EBS permissions of the substrate node's IAM role
+	// +optional
+	EBSCSIDriver bool `json:"ebsCSIDriver,omitempty"`
+	// RuntimeConfig enables or disables API groups on the API server, keyed by
+	// group/version, i.e. {"batch/v2alpha1": "true"}
+	// +optional
+	RuntimeConfig map[string]string `json:"runtimeConfig,omitempty"`
+	// AuthCache tunes how long the API server caches webhook authentication and
+	// authorization decisions, i.e. for the IAM authenticator
+	// +optional
+	AuthCache *AuthCacheSpec `json:"authCache,omitempty"`
+	// SecretsEncryption encrypts secrets at rest in etcd
+	// +optional
+	SecretsEncryption *SecretsEncryptionSpec `json:"secretsEncryption,omitempty"`
+	// DHCPOptions creates a DHCP options set for the VPC, i.e. to integrate
+	// with a corporate DNS domain
+	// +optional
+	DHCPOptions *DHCPOptionsSpec `json:"dhcpOptions,omitempty"`
+	// ServiceAccountExtendTokenExpiration extends projected service account
+	// tokens to a year to ease the migration from legacy tokens, defaults to
+	// true. Disable it for tokens to expire at their requested TTL.
+	// +optional
+	ServiceAccountExtendTokenExpiration *bool `json:"serviceAccountExtendTokenExpiration,omitempty"`
+	// ServiceAccountKey rotates the key signing service account tokens
+	// +optional
+	ServiceAccountKey *ServiceAccountKeySpec `json:"serviceAccountKey,omitempty"`
+	// Hostname configures the name the substrate node's kubelet registers
+	// with, defaults to the substrate's name
+	// +optional
+	Hostname *HostnameSpec `json:"hostname,omitempty"`
+	// RequestHeader overrides the headers and client certificate names the API
+	// server trusts on requests proxied to aggregated API servers
+	// +optional
+	RequestHeader *RequestHeaderSpec `json:"requestHeader,omitempty"`
+	// OIDC configures the API server to authenticate OIDC ID tokens, alongside
+	// the tokens authenticated by aws-iam-authenticator
+	// +optional
+	OIDC *OIDCSpec `json:"oidc,omitempty"`
+	// WatchCacheEnabled enables the API server's watch cache, defaults to true.
+	// Disabling it reduces the memory used by the API server on small instances.
+	// +optional
+	WatchCacheEnabled *bool `json:"watchCacheEnabled,omitempty"`
+	// WatchCacheSizes overrides the watch cache size of resources, keyed by
+	// resource[.group], i.e. {"pods": 100, "deployments.apps": 50}. A size of
+	// zero disables the cache for the resource. Requires the watch cache.
+	// +optional
+	WatchCacheSizes map[string]int32 `json:"watchCacheSizes,omitempty"`
+	// StorageBackend is the API server's --storage-backend, only etcd3 is
+	// supported. Unset keeps the API server's default.
+	// +optional
+	StorageBackend string `json:"storageBackend,omitempty"`
+	// StorageMediaType is the API server's --storage-media-type, the encoding
+	// of objects in etcd, one of application/json or
+	// application/vnd.kubernetes.protobuf. Unset keeps the API server's
+	// default of protobuf.
+	// +optional
+	StorageMediaType string `json:"storageMediaType,omitempty"`
+	// HTTP2MaxStreamsPerConnection is the API server's
+	// --http2-max-streams-per-connection, the number of concurrent streams,
+	// i.e. watches, multiplexed on a client's connection. Defaults to 1000.
+	// +optional
+	HTTP2MaxStreamsPerConnection *int32 `json:"http2MaxStreamsPerConnection,omitempty"`
+	// FeatureGates enables or disables feature gates, i.e. {"APIListChunking":
+	// true}. The same gates are passed to the API server, controller manager,
+	// scheduler and kubelet so the components agree on which features are on.
+	// Guest control planes take their gates from the ControlPlane's
+	// spec.featureGates instead.
+	// +optional
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+	// NATGateway is the strategy for outbound traffic from private subnets,
+	// one of single, per-az or none. Defaults to none when all subnets are
+	// public, otherwise single.
+	// +optional
+	NATGateway string `json:"natGateway,omitempty"`
+	// ClusterInfo generates the kube-public/cluster-info ConfigMap nodes use to
+	// discover the control plane's CA and endpoint when joining with a
+	// bootstrap token
+	// +optional
+	ClusterInfo *ClusterInfoSpec `json:"clusterInfo,omitempty"`
+	// Egress restricts the substrate node's outbound traffic to the rules,
+	// replacing the security group's default allow-all egress. The rules must
+	// allow HTTPS for the node to reach the config bucket and image registry.
+	// +optional
+	Egress []EgressRuleSpec `json:"egress,omitempty"`
+	// EtcdBackup periodically snapshots etcd to the cluster configuration
+	// bucket, so the cluster's state can be restored after the substrate node
+	// is recycled
+	// +optional
+	EtcdBackup *EtcdBackupSpec `json:"etcdBackup,omitempty"`
+	// EgressSelector routes the API server's connections to each destination
+	// directly or through a proxy on the substrate node, i.e.
+	// konnectivity-server, with the API server's --egress-selector-config-file
+	// +optional
+	EgressSelector *EgressSelectorSpec `json:"egressSelector,omitempty"`
+}
+
+const (
+	// EgressSelectionCluster is the API server's traffic to the cluster's
+	// nodes and pods, i.e. logs, exec and port-forward
+	EgressSelectionCluster = "cluster"
+	// EgressSelectionControlPlane is the API server's traffic to the control
+	// plane, i.e. webhooks and aggregated API servers
+	EgressSelectionControlPlane = "controlplane"
+	// EgressSelectionEtcd is the API server's traffic to etcd
+	EgressSelectionEtcd = "etcd"
+)
+
+const (
+	// ProxyProtocolDirect connects to the destination without a proxy
+	ProxyProtocolDirect = "Direct"
+	// ProxyProtocolHTTPConnect tunnels connections with HTTP CONNECT
+	ProxyProtocolHTTPConnect = "HTTPConnect"
+	// ProxyProtocolGRPC tunnels connections through konnectivity's agents
+	ProxyProtocolGRPC = "GRPC"
+)
+
+// EgressSelectorSpec configures the API server's EgressSelectorConfiguration,
+// destinations that aren't listed are connected to directly
+type EgressSelectorSpec struct {
+	Selections []EgressSelectionSpec `json:"selections"`
+}
+
+// EgressSelectionSpec is the connection to one destination
+type EgressSelectionSpec struct {
+	// Name of the destination, one of cluster, controlplane or etcd
+	Name string `json:"name"`
+	// ProxyProtocol is one of Direct, HTTPConnect or GRPC, defaults to Direct
+	// +optional
+	ProxyProtocol string `json:"proxyProtocol,omitempty"`
+	// UDSName is the absolute path of the proxy's unix domain socket on the
+	// substrate node, required by HTTPConnect and GRPC
+	// +optional
+	UDSName string `json:"udsName,omitempty"`
+}
+
+// EtcdBackupSpec configures the etcd snapshots uploaded to
+// s3://<bucket>/tmp/<name>/etcd-snapshots/
+type EtcdBackupSpec struct {
+	// Interval between snapshots, at least a minute, defaults to 1h
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Retention is the number of most recent snapshots kept in the bucket,
+	// defaults to 24
+	// +optional
+	Retention *int32 `json:"retention,omitempty"`
+}
+
+// EgressRuleSpec allows outbound traffic to either a CIDR or a managed prefix
+// list, i.e. the S3 prefix list used by a gateway endpoint
+type EgressRuleSpec struct {
+	// CIDR is the IPv4 destination range, i.e. 10.0.0.0/8 for a corporate proxy
+	// +optional
+	CIDR string `json:"cidr,omitempty"`
+	// PrefixListID is the destination managed prefix list, i.e. pl-63a5400a
+	// +optional
+	PrefixListID string `json:"prefixListID,omitempty"`
+	// Protocol is one of tcp, udp or all, defaults to tcp
+	// +optional
+	Protocol string `json:"protocol,omitempty"`
+	// Port is the destination port, defaults to all ports
+	// +optional
+	Port *int64 `json:"port,omitempty"`
+}
+
+// ComponentArgsSpec are flags keyed by name without the leading dashes, i.e.
+// {"max-requests-inflight": "800"}
+type ComponentArgsSpec struct {
+	// +optional
+	APIServer map[string]string `json:"apiServer,omitempty"`
+	// +optional
+	ControllerManager map[string]string `json:"controllerManager,omitempty"`
+	// +optional
+	Scheduler map[string]string `json:"scheduler,omitempty"`
+	// +optional
+	Etcd map[string]string `json:"etcd,omitempty"`
+	// +optional
+	Kubelet map[string]string `json:"kubelet,omitempty"`
+}
+
+// ClusterInfoSpec configures the cluster-info ConfigMap, which is uploaded with
+// the rest of the cluster configuration to /etc/kubernetes/cluster-info.yaml
+type ClusterInfoSpec struct {
+	// BootstrapTokens sign the cluster-info with a JWS per token, in the form
+	// [a-z0-9]{6}.[a-z0-9]{16}, for nodes to verify the control plane with
+	// their token before trusting its CA
+	// +optional
+	BootstrapTokens []string `json:"bootstrapTokens,omitempty"`
+}
+
+const (
+	// NATGatewaySingle routes all private subnets through one NAT gateway
+	NATGatewaySingle = "single"
+	// NATGatewayPerAZ routes private subnets through a NAT gateway in their zone
+	NATGatewayPerAZ = "per-az"
+	// NATGatewayNone doesn't create NAT gateways, all subnets must be public
+	NATGatewayNone = "none"
+)
+
+const (
+	// ContainerRuntimeDocker runs pods through the kubelet's dockershim
+	ContainerRuntimeDocker = "docker"
+	// ContainerRuntimeContainerd runs pods through containerd's CRI plugin
+	ContainerRuntimeContainerd = "containerd"
+)
+
+const (
+	// OperatingSystemAmazonLinux2 boots the EKS optimized Amazon Linux 2 AMI,
+	// the kubelet runs from a systemd unit synced from the bucket
+	OperatingSystemAmazonLinux2 = "AmazonLinux2"
+	// OperatingSystemBottlerocket boots Bottlerocket, the kubelet is
+	// configured through Bottlerocket's settings
+	OperatingSystemBottlerocket = "Bottlerocket"
+)
+
+// BottlerocketSpec configures a Bottlerocket substrate node. Bottlerocket has
+// no shell or AWS CLI on the host, so a superpowered host container associates
+// the elastic IP and syncs the configuration from the bucket.
+type BottlerocketSpec struct {
+	// SyncImage is the host container's image, it must run the container's
+	// user data with bash and the AWS CLI
+	SyncImage string `json:"syncImage"`
+}
+
+const (
+	// SubstrateNodeLabelKey is always registered on the substrate node with
+	// the value control-plane
+	SubstrateNodeLabelKey = "kit.aws/substrate"
+	// NodeRoleLabelPrefix labels can't be registered by the kubelet, they're
+	// applied to the substrate node through the API
+	NodeRoleLabelPrefix = "node-role.kubernetes.io/"
+)
+
+const (
+	// CgroupDriverSystemd manages cgroups through systemd, the node's init system
+	CgroupDriverSystemd = "systemd"
+	// CgroupDriverCgroupfs manages cgroups through the cgroup filesystem
+	CgroupDriverCgroupfs = "cgroupfs"
+)
+
+const (
+	// StorageBackendEtcd3 stores objects in etcd using the v3 API
+	StorageBackendEtcd3 = "etcd3"
+	// StorageMediaTypeJSON stores objects in etcd as JSON
+	StorageMediaTypeJSON = "application/json"
+	// StorageMediaTypeProtobuf stores objects in etcd as protobuf
+	StorageMediaTypeProtobuf = "application/vnd.kubernetes.protobuf"
+)
+
+const (
+	EgressProtocolTCP = "tcp"
+	EgressProtocolUDP = "udp"
+	EgressProtocolAll = "all"
+)
+
+// RequestHeaderSpec configures the API server's --requestheader flags, unset
+// fields keep kubeadm's defaults. Requests are proxied with the
+// front-proxy-client certificate signed by the front-proxy CA.
+type RequestHeaderSpec struct {
+	// AllowedNames are the common names of the client certificates allowed to
+	// set the headers, defaults to front-proxy-client
+	// +optional
+	AllowedNames []string `json:"allowedNames,omitempty"`
+	// UsernameHeaders are the headers to read the username from, defaults to X-Remote-User
+	// +optional
+	UsernameHeaders []string `json:"usernameHeaders,omitempty"`
+	// GroupHeaders are the headers to read groups from, defaults to X-Remote-Group
+	// +optional
+	GroupHeaders []string `json:"groupHeaders,omitempty"`
+	// ExtraHeadersPrefix are the prefixes of the headers carrying extra user
+	// info, defaults to X-Remote-Extra-
+	// +optional
+	ExtraHeadersPrefix []string `json:"extraHeadersPrefix,omitempty"`
+}
+
+// SchedulerSpec is a scheduler run next to the default scheduler
+type SchedulerSpec struct {
+	// Name of the scheduler, matched against the pods' spec.schedulerName
+	Name string `json:"name"`
+	// Image of the scheduler, defaults to the default scheduler's image. The
+	// image must run kube-scheduler with the default scheduler's flags.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Config is the KubeSchedulerConfiguration passed to the scheduler,
+	// defaults to a profile and leader election lease named after the
+	// scheduler. It should connect with /etc/kubernetes/scheduler.conf.
+	// +optional
+	Config string `json:"config,omitempty"`
+}
+
+const (
+	// WarmPoolReusePolicySameVersion only claims instances booted from the
+	// current launch template version's AMI and instance type, idle instances
+	// are replaced when either changes. A claimed instance runs the user data
+	// of the current version.
+	WarmPoolReusePolicySameVersion = "SameVersion"
+	// WarmPoolReusePolicyAnyVersion claims idle instances launched from any
+	// version of the launch template, trading launch template changes (i.e.
+	// the instance type) for faster iteration. The configuration synced from
+	// the bucket is always current.
+	WarmPoolReusePolicyAnyVersion = "AnyVersion"
+)
+
+// WarmPoolSpec is a pool of instances that have booted and wait to be claimed
+// before associating the elastic IP and syncing the configuration. Pooled
+// instances live in the substrate's VPC and are terminated with it, unless
+// the substrate is deleted with --keep-warm-pool, which keeps the VPC and the
+// idle instances for the next substrate of the same name.
+type WarmPoolSpec struct {
+	// Size is the number of idle instances kept in the pool
+	Size int32 `json:"size"`
+	// ReusePolicy decides which idle instances may be claimed, defaults to SameVersion
+	// +optional
+	ReusePolicy string `json:"reusePolicy,omitempty"`
+}
+
+// ReplicaBucketSpec is a bucket holding a copy of the substrate's configuration
+type ReplicaBucketSpec struct {
+	// Name of the bucket
+	Name string `json:"name"`
+	// Region of the bucket, defaults to the substrate's region
+	// +optional
+	Region *string `json:"region,omitempty"`
+}
+
+// OIDCSpec configures the API server's --oidc flags, unset fields keep the API
+// server's defaults. Only a single issuer is supported, several JWT issuers
+// need the AuthenticationConfiguration passed with --authentication-config,
+// which the substrate's EKS-D 1.21 API server doesn't have.
+type OIDCSpec struct {
+	// IssuerURL is the https URL of the provider, used to discover its signing keys
+	IssuerURL string `json:"issuerURL"`
+	// ClientID is the audience ID tokens must be issued for
+	ClientID string `json:"clientID"`
+	// UsernameClaim is the claim to use as the username, defaults to sub
+	// +optional
+	UsernameClaim string `json:"usernameClaim,omitempty"`
+	// UsernamePrefix is prepended to usernames, "-" disables the prefix
+	// +optional
+	UsernamePrefix string `json:"usernamePrefix,omitempty"`
+	// GroupsClaim is the claim to read the user's groups from
+	// +optional
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+	// GroupsPrefix is prepended to groups
+	// +optional
+	GroupsPrefix string `json:"groupsPrefix,omitempty"`
+	// CA is the PEM encoded CA bundle used to verify the provider, defaults to
+	// the node's trusted CAs
+	// +optional
+	CA string `json:"ca,omitempty"`
+	// SigningAlgs are the JOSE algorithms ID tokens may be signed with,
+	// defaults to RS256
+	// +optional
+	SigningAlgs []string `json:"signingAlgs,omitempty"`
+}
+
+const (
+	// HostnameStrategySubstrateName registers the node with the substrate's name
+	HostnameStrategySubstrateName = "SubstrateName"
+	// HostnameStrategyPrivateDNSName registers the node with the instance's private DNS name
+	HostnameStrategyPrivateDNSName = "PrivateDNSName"
+	// HostnameStrategyIMDSHostname registers the node with the hostname from instance metadata
+	HostnameStrategyIMDSHostname = "IMDSHostname"
+	// HostnameStrategyTemplate registers the node with a name rendered from Template
+	HostnameStrategyTemplate = "Template"
+)
+
+// HostnameSpec configures the kubelet's --hostname-override. Every strategy
+// other than SubstrateName is resolved by the node on boot, so nodes sharing
+// the launch template register with distinct names. Those nodes sign their
+// kubelet's client certificate for the resolved name with the cluster CA, as
+// the Node authorizer checks it against the name the node registers with.
+type HostnameSpec struct {
+	// Strategy is one of SubstrateName, PrivateDNSName, IMDSHostname or
+	// Template, defaults to SubstrateName
+	// +optional
+	Strategy string `json:"strategy,omitempty"`
+	// Template is a text/template with the substrate's {{.Name}} and the node's
+	// {{.Ordinal}}, its launch index, i.e. "{{.Name}}-{{.Ordinal}}". Required
+	// for the Template strategy.
+	// +optional
+	Template string `json:"template,omitempty"`
+}
+
+// DHCPOptionsSpec configures the DHCP options set associated with the VPC
+type DHCPOptionsSpec struct {
+	// DomainName is the domain name instances use to resolve unqualified names
+	// +optional
+	DomainName string `json:"domainName,omitempty"`
+	// DomainNameServers are up to 4 IP addresses or AmazonProvidedDNS
+	// +optional
+	DomainNameServers []string `json:"domainNameServers,omitempty"`
+	// NTPServers are up to 4 IP addresses of NTP servers
+	// +optional
+	NTPServers []string `json:"ntpServers,omitempty"`
+}
+
+// SecretsEncryptionSpec configures the aescbc key used to encrypt secrets.
+// Changing KeyName rotates the key, the new key is added ahead of the retired
+// keys and all secrets are rewritten once the API server has loaded it. The
+// keys are stored as SSM SecureString parameters under
+// /<substrate>/secrets-encryption/. Removing the spec disables encryption,
+// secrets are rewritten unencrypted before the keys are removed.
+type SecretsEncryptionSpec struct {
+	// KeyName is the name of the active encryption key, defaults to key1.
+	// identity is reserved for disabling encryption.
+	// +optional
+	KeyName string `json:"keyName,omitempty"`
+	// RemoveRetiredKeys removes the retired keys once all secrets are rewritten
+	// with the active key
+	// +optional
+	RemoveRetiredKeys bool `json:"removeRetiredKeys,omitempty"`
+}
+
+// ServiceAccountKeySpec names the key signing service account tokens.
+// Changing KeyName generates a new key and restarts the API server and
+// controller manager to load it.
+type ServiceAccountKeySpec struct {
+	// KeyName is the name of the active signing key, defaults to key1
+	// +optional
+	KeyName string `json:"keyName,omitempty"`
+	// KeepPreviousKey keeps verifying tokens signed with the previous key
+	// after a rotation, until the next rotation
+	// +optional
+	KeepPreviousKey bool `json:"keepPreviousKey,omitempty"`
+}
+
+// AuthCacheSpec configures the API server webhook cache TTLs, a TTL of zero
+// disables caching
+type AuthCacheSpec struct {
+	// TokenWebhookTTL is the duration to cache responses from the token authenticator webhook
+	// +optional
+	TokenWebhookTTL *metav1.Duration `json:"tokenWebhookTTL,omitempty"`
+	// AuthorizedTTL is the duration to cache 'authorized' responses from the authorization webhook
+	// +optional
+	AuthorizedTTL *metav1.Duration `json:"authorizedTTL,omitempty"`
+	// UnauthorizedTTL is the duration to cache 'unauthorized' responses from the authorization webhook
+	// +optional
+	UnauthorizedTTL *metav1.Duration `json:"unauthorizedTTL,omitempty"`
+}
+
+// AuditLogSpec configures rotation of the API server audit log files
+type AuditLogSpec struct {
+	// MaxAge is the maximum number of days to retain old audit log files
+	// +optional
+	MaxAge *int32 `json:"maxAge,omitempty"`
+	// MaxBackup is the maximum number of old audit log files to retain
+	// +optional
+	MaxBackup *int32 `json:"maxBackup,omitempty"`
+	// MaxSize is the maximum size in megabytes of an audit log file before it's rotated
+	// +optional
+	MaxSize *int32 `json:"maxSize,omitempty"`
+	// Policy is an audit.k8s.io/v1 Policy in YAML, defaults to logging the
+	// metadata of all requests except events
+	// +optional
+	Policy string `json:"policy,omitempty"`
 }
 
 // Substrate is the Schema for the Substrates API
@@ -47,20 +650,161 @@ type VPCSpec struct {
 	CIDR string `json:"cidr,omitempty"`
 }
 
+// FlowLogsSpec enables VPC flow logs for the substrate, delivered to either an
+// existing S3 bucket or a CloudWatch log group created for the substrate.
+type FlowLogsSpec struct {
+	// DestinationType is one of s3 or cloud-watch-logs
+	DestinationType string `json:"destinationType"`
+	// Destination is the ARN of the S3 bucket, required for s3
+	// +optional
+	Destination *string `json:"destination,omitempty"`
+	// DeliverLogsPermissionARN is the IAM role used to publish to the log
+	// group, required for cloud-watch-logs
+	// +optional
+	DeliverLogsPermissionARN *string `json:"deliverLogsPermissionARN,omitempty"`
+	// RetentionInDays for the log group, only applies to cloud-watch-logs
+	// +optional
+	RetentionInDays *int64 `json:"retentionInDays,omitempty"`
+	// TrafficType is one of ACCEPT, REJECT or ALL, defaults to ALL
+	// +optional
+	TrafficType *string `json:"trafficType,omitempty"`
+}
+
+// SubnetSpec is a subnet of the substrate's VPC. The keys were capitalized
+// before they were tagged, manifests using them still decode as JSON keys are
+// matched case-insensitively.
 type SubnetSpec struct {
-	Zone   string
-	CIDR   string
-	Public bool
+	// Zone is the availability zone of the subnet, i.e. us-west-2a
+	Zone string `json:"zone"`
+	// CIDR is the subnet's range within the VPC's CIDR
+	CIDR string `json:"cidr"`
+	// Public subnets route to the internet gateway
+	Public bool `json:"public"`
 }
 
+const (
+	// ConditionVPCReady is true once the substrate's VPC exists
+	ConditionVPCReady apis.ConditionType = "VPCReady"
+	// ConditionSubnetsReady is true once all of the spec's subnets exist
+	ConditionSubnetsReady apis.ConditionType = "SubnetsReady"
+	// ConditionClusterConfigUploaded is true once the certificates, manifests
+	// and kubeconfigs are uploaded to the substrate's bucket
+	ConditionClusterConfigUploaded apis.ConditionType = "ClusterConfigUploaded"
+	// ConditionEndpointReady is true once the API server reports ready
+	ConditionEndpointReady apis.ConditionType = "EndpointReady"
+)
+
 var (
-	substrateConditionSet = apis.NewLivingConditionSet()
+	// substrateConditionSet rolls the conditions up into ConditionReady
+	substrateConditionSet = apis.NewLivingConditionSet(
+		ConditionVPCReady,
+		ConditionSubnetsReady,
+		ConditionClusterConfigUploaded,
+		ConditionEndpointReady,
+	)
 )
 
+// APIServerPort returns the API server port, defaulting to 443
+func (s *Substrate) APIServerPort() int32 {
+	if s.Spec.APIServerPort == nil {
+		return DefaultAPIServerPort
+	}
+	return *s.Spec.APIServerPort
+}
+
+// BucketName returns the name of the S3 bucket holding the cluster
+// configuration, kit-<name> wrapped with the optional prefix and suffix
+func (s *Substrate) BucketName() string {
+	parts := []string{"kit", s.Name}
+	if s.Spec.BucketNamePrefix != "" {
+		parts = append([]string{s.Spec.BucketNamePrefix}, parts...)
+	}
+	if s.Spec.BucketNameSuffix != "" {
+		parts = append(parts, s.Spec.BucketNameSuffix)
+	}
+	return strings.Join(parts, "-")
+}
+
+// ServiceCIDR returns the service cluster IP range, defaulting to 10.96.0.0/12
+func (s *Substrate) ServiceCIDR() string {
+	if s.Spec.ServiceCIDR == "" {
+		return DefaultServiceCIDR
+	}
+	return s.Spec.ServiceCIDR
+}
+
+// IAMAuthenticatorEnabled returns whether aws-iam-authenticator is deployed,
+// defaulting to true
+func (s *Substrate) IAMAuthenticatorEnabled() bool {
+	return s.Spec.EnableIAMAuthenticator == nil || *s.Spec.EnableIAMAuthenticator
+}
+
+// KubeletNodeLabels returns the node labels registered by the kubelet, all
+// but the node-role labels
+func (s *Substrate) KubeletNodeLabels() map[string]string {
+	labels := map[string]string{}
+	for key, value := range s.Spec.NodeLabels {
+		if !strings.HasPrefix(key, NodeRoleLabelPrefix) {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// NodeRoleLabels returns the node-role labels applied through the API
+func (s *Substrate) NodeRoleLabels() map[string]string {
+	labels := map[string]string{}
+	for key, value := range s.Spec.NodeLabels {
+		if strings.HasPrefix(key, NodeRoleLabelPrefix) {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// KeepsWarmPool returns whether the substrate is being deleted without its
+// idle warm pool instances and the infrastructure they run in
+func (s *Substrate) KeepsWarmPool() bool {
+	return s.DeletionTimestamp != nil && s.Spec.WarmPool != nil
+}
+
 func (s *Substrate) IsReady() bool {
 	return substrateConditionSet.Manage(&s.Status).GetCondition(apis.ConditionReady).IsTrue()
 }
 
-func (s *Substrate) Ready() {
-	s.Status.SetConditions([]apis.Condition{{Type: apis.ConditionReady, Status: v1.ConditionTrue}})
+// StatusConditions manages the substrate's conditions, ConditionReady is
+// true once all of the others are
+func (s *Substrate) StatusConditions() apis.ConditionManager {
+	return substrateConditionSet.Manage(&s.Status)
+}
+
+// InitializeConditions sets the conditions not yet reported to unknown
+func (s *Substrate) InitializeConditions() {
+	s.StatusConditions().InitializeConditions()
+}
+
+// MergeConditions applies the conditions changed in from since before, the
+// conditions from's reconcile didn't touch may be stale and are left as is
+func (s *Substrate) MergeConditions(before apis.Conditions, from *Substrate) {
+	previous := map[apis.ConditionType]apis.Condition{}
+	for _, condition := range before {
+		previous[condition.Type] = condition
+	}
+	for _, condition := range from.Status.Conditions {
+		if condition.Type == apis.ConditionReady {
+			continue
+		}
+		if last, ok := previous[condition.Type]; ok && last.Status == condition.Status &&
+			last.Reason == condition.Reason && last.Message == condition.Message {
+			continue
+		}
+		switch condition.Status {
+		case v1.ConditionTrue:
+			s.StatusConditions().MarkTrue(condition.Type)
+		case v1.ConditionFalse:
+			s.StatusConditions().MarkFalse(condition.Type, condition.Reason, "%s", condition.Message)
+		default:
+			s.StatusConditions().MarkUnknown(condition.Type, condition.Reason, "%s", condition.Message)
+		}
+	}
 }
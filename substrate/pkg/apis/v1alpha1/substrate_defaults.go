@@ -16,13 +16,116 @@ package v1alpha1
 
 import (
 	"context"
+	"time"
 
+	"github.com/aws/aws-sdk-go/service/ec2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"knative.dev/pkg/ptr"
 )
 
+const (
+	// DefaultAPIServerPort is the port the substrate's API server listens on
+	DefaultAPIServerPort = int32(443)
+	// DefaultServiceCIDR is kubeadm's default service subnet
+	DefaultServiceCIDR = "10.96.0.0/12"
+	// DefaultHTTP2MaxStreamsPerConnection raises the API server's default of
+	// 250 streams for clients multiplexing many watches
+	DefaultHTTP2MaxStreamsPerConnection = int32(1000)
+	// DefaultUploadTimeout is ample for the configuration's small files
+	DefaultUploadTimeout = 2 * time.Minute
+	// DefaultCertificateRenewBefore renews certificates a month before they expire
+	DefaultCertificateRenewBefore = 30 * 24 * time.Hour
+)
+
 // SetDefaults for the resource
 func (s *Substrate) SetDefaults(ctx context.Context) {
 	if s.Spec.InstanceType == nil {
 		s.Spec.InstanceType = ptr.String("t4g.nano")
 	}
+	if s.Spec.DetailedMonitoring == nil {
+		s.Spec.DetailedMonitoring = ptr.Bool(true)
+	}
+	if s.Spec.WarmPool != nil && s.Spec.WarmPool.ReusePolicy == "" {
+		s.Spec.WarmPool.ReusePolicy = WarmPoolReusePolicySameVersion
+	}
+	if s.Spec.CertificateRenewBefore == nil {
+		s.Spec.CertificateRenewBefore = &metav1.Duration{Duration: DefaultCertificateRenewBefore}
+	}
+	if s.Spec.UploadTimeout == nil {
+		s.Spec.UploadTimeout = &metav1.Duration{Duration: DefaultUploadTimeout}
+	}
+	if s.Spec.OperatingSystem == "" {
+		s.Spec.OperatingSystem = OperatingSystemAmazonLinux2
+	}
+	// Bottlerocket only ships containerd
+	if s.Spec.ContainerRuntime == "" && s.Spec.OperatingSystem == OperatingSystemBottlerocket {
+		s.Spec.ContainerRuntime = ContainerRuntimeContainerd
+	}
+	if s.Spec.ContainerRuntime == "" {
+		s.Spec.ContainerRuntime = ContainerRuntimeDocker
+	}
+	if s.Spec.CgroupDriver == "" {
+		s.Spec.CgroupDriver = CgroupDriverSystemd
+	}
+	if s.Spec.NATGateway == "" {
+		s.Spec.NATGateway = NATGatewayNone
+		for _, subnet := range s.Spec.Subnets {
+			if !subnet.Public {
+				s.Spec.NATGateway = NATGatewaySingle
+			}
+		}
+	}
+	if s.Spec.FlowLogs != nil && s.Spec.FlowLogs.TrafficType == nil {
+		s.Spec.FlowLogs.TrafficType = ptr.String(ec2.TrafficTypeAll)
+	}
+	if s.Spec.Hostname != nil && s.Spec.Hostname.Strategy == "" {
+		s.Spec.Hostname.Strategy = HostnameStrategySubstrateName
+	}
+	if s.Spec.SecretsEncryption != nil && s.Spec.SecretsEncryption.KeyName == "" {
+		s.Spec.SecretsEncryption.KeyName = "key1"
+	}
+	if s.Spec.ServiceAccountKey != nil && s.Spec.ServiceAccountKey.KeyName == "" {
+		s.Spec.ServiceAccountKey.KeyName = "key1"
+	}
+	if s.Spec.APIServerPort == nil {
+		s.Spec.APIServerPort = ptr.Int32(DefaultAPIServerPort)
+	}
+	if s.Spec.ServiceCIDR == "" {
+		s.Spec.ServiceCIDR = DefaultServiceCIDR
+	}
+	if s.Spec.HTTP2MaxStreamsPerConnection == nil {
+		s.Spec.HTTP2MaxStreamsPerConnection = ptr.Int32(DefaultHTTP2MaxStreamsPerConnection)
+	}
+	if s.Spec.EnableIAMAuthenticator == nil {
+		s.Spec.EnableIAMAuthenticator = ptr.Bool(true)
+	}
+	if s.Spec.EnableBootstrapTokenAuth == nil {
+		s.Spec.EnableBootstrapTokenAuth = ptr.Bool(s.Spec.ClusterInfo != nil && len(s.Spec.ClusterInfo.BootstrapTokens) > 0)
+	}
+	if s.Spec.EtcdBackup != nil {
+		if s.Spec.EtcdBackup.Interval == nil {
+			s.Spec.EtcdBackup.Interval = &metav1.Duration{Duration: time.Hour}
+		}
+		if s.Spec.EtcdBackup.Retention == nil {
+			s.Spec.EtcdBackup.Retention = ptr.Int32(24)
+		}
+	}
+	if s.Spec.EgressSelector != nil {
+		for i := range s.Spec.EgressSelector.Selections {
+			if s.Spec.EgressSelector.Selections[i].ProxyProtocol == "" {
+				s.Spec.EgressSelector.Selections[i].ProxyProtocol = ProxyProtocolDirect
+			}
+		}
+	}
+	if s.Spec.AuditLog != nil {
+		if s.Spec.AuditLog.MaxAge == nil {
+			s.Spec.AuditLog.MaxAge = ptr.Int32(7)
+		}
+		if s.Spec.AuditLog.MaxBackup == nil {
+			s.Spec.AuditLog.MaxBackup = ptr.Int32(10)
+		}
+		if s.Spec.AuditLog.MaxSize == nil {
+			s.Spec.AuditLog.MaxSize = ptr.Int32(100)
+		}
+	}
 }
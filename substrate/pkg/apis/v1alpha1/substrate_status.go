@@ -15,6 +15,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"knative.dev/pkg/apis"
 )
 
@@ -22,6 +23,33 @@ type ClusterStatus struct {
 	Address               *string `json:"address,omitempty"`
 	KubeConfig            *string `json:"kubeConfig,omitempty"`
 	LaunchTemplateVersion *string `json:"launchTemplateVersion,omitempty"`
+	// ImageID is the AMI of the current launch template version, idle warm
+	// pool instances booted from it can be claimed under SameVersion
+	ImageID *string `json:"imageID,omitempty"`
+	// KubeConfigURL is a presigned URL downloading the admin kubeconfig,
+	// set when spec.kubeConfigURLTTL is
+	KubeConfigURL *string `json:"kubeConfigURL,omitempty"`
+	// KubeConfigURLExpiry is when KubeConfigURL stops working
+	KubeConfigURLExpiry *metav1.Time `json:"kubeConfigURLExpiry,omitempty"`
+	// SecretsEncryptionKey is the key all secrets were last rewritten with
+	SecretsEncryptionKey *string `json:"secretsEncryptionKey,omitempty"`
+	// ServiceAccountKey is the name of the key signing service account tokens
+	ServiceAccountKey *string `json:"serviceAccountKey,omitempty"`
+	// ConfigLocations are the buckets the configuration was last uploaded to,
+	// the substrate's bucket followed by the replica bucket
+	ConfigLocations []string `json:"configLocations,omitempty"`
+	// WarmPool is the state of the warm pool when it was last reconciled
+	WarmPool *WarmPoolStatus `json:"warmPool,omitempty"`
+	// CertificateExpiry is when the first of the control plane's certificates
+	// expires, unset when the certificates couldn't be read
+	CertificateExpiry *metav1.Time `json:"certificateExpiry,omitempty"`
+}
+
+type WarmPoolStatus struct {
+	// ClaimedInstanceID is the substrate node claimed from the pool
+	ClaimedInstanceID *string `json:"claimedInstanceID,omitempty"`
+	// IdleInstanceIDs are the instances waiting to be claimed
+	IdleInstanceIDs []string `json:"idleInstanceIDs,omitempty"`
 }
 
 type InfrastructureStatus struct {
@@ -31,6 +59,9 @@ type InfrastructureStatus struct {
 	SecurityGroupID     *string  `json:"securityGroupID,omitempty"`
 	PrivateSubnetIDs    []string `json:"privateSubnetIDs,omitempty"`
 	PublicSubnetIDs     []string `json:"publicSubnetIDs,omitempty"`
+	FlowLogID           *string  `json:"flowLogID,omitempty"`
+	DHCPOptionsID       *string  `json:"dhcpOptionsID,omitempty"`
+	NATGatewayIDs       []string `json:"natGatewayIDs,omitempty"`
 }
 
 type SubstrateStatus struct {
@@ -0,0 +1,59 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestSubnetSpecKeys(t *testing.T) {
+	expected := []*SubnetSpec{{Zone: "us-west-2a", CIDR: "10.0.1.0/24"}, {Zone: "us-west-2b", CIDR: "10.0.101.0/24", Public: true}}
+	for _, manifest := range []string{`
+subnets:
+- zone: us-west-2a
+  cidr: 10.0.1.0/24
+- zone: us-west-2b
+  cidr: 10.0.101.0/24
+  public: true
+`, `
+subnets:
+- Zone: us-west-2a
+  CIDR: 10.0.1.0/24
+- Zone: us-west-2b
+  CIDR: 10.0.101.0/24
+  Public: true
+`} {
+		spec := SubstrateSpec{}
+		if err := yaml.Unmarshal([]byte(manifest), &spec); err != nil {
+			t.Fatalf("unmarshalling substrate spec, %v", err)
+		}
+		if !reflect.DeepEqual(spec.Subnets, expected) {
+			t.Errorf("expected subnets %v, got %v", expected, spec.Subnets)
+		}
+	}
+	data, err := yaml.Marshal(SubstrateSpec{Subnets: expected})
+	if err != nil {
+		t.Fatalf("marshalling substrate spec, %v", err)
+	}
+	for _, key := range []string{"zone: us-west-2a", "cidr: 10.0.1.0/24", "public: true"} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("expected %q in %s", key, data)
+		}
+	}
+}
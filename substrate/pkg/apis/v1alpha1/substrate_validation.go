@@ -16,13 +16,1002 @@ package v1alpha1
 
 import (
 	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	bootstraputil "k8s.io/cluster-bootstrap/token/util"
+	kubeletapis "k8s.io/kubelet/pkg/apis"
 	"knative.dev/pkg/apis"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	maxBucketNameLength = 63
+	// maxDHCPServers is the number of servers supported per DHCP option
+	maxDHCPServers = 4
+	// maxEventTTL caps event retention as events are stored in etcd
+	maxEventTTL = 24 * time.Hour
+	// maxHTTP2MaxStreamsPerConnection caps the streams a single client can
+	// hold open on the API server
+	maxHTTP2MaxStreamsPerConnection = 10000
+	// defaultSchedulerName is the name of kube-scheduler's default profile
+	defaultSchedulerName = "default-scheduler"
+	// defaultSchedulerLease is the default scheduler's leader election lease
+	defaultSchedulerLease = "kube-scheduler"
+	// maxCertificateRenewBefore is the year kubeadm signs certificates for, a
+	// threshold as long would renew them on every apply
+	maxCertificateRenewBefore = 365 * 24 * time.Hour
+	// minKubeConfigURLTTL leaves time to download the kubeconfig and
+	// maxKubeConfigURLTTL is the longest the controller's credentials can
+	// presign for, i.e. an assumed role's session
+	minKubeConfigURLTTL = time.Minute
+	maxKubeConfigURLTTL = 12 * time.Hour
+	// minServiceCIDRPrefix is the largest service range the API server
+	// accepts and maxServiceCIDRPrefix the smallest holding the cluster DNS's
+	// tenth address
+	minServiceCIDRPrefix = 12
+	maxServiceCIDRPrefix = 28
+	// maxWarmPoolSize bounds the idle instances paid for while waiting
+	maxWarmPoolSize = 10
+	// MaxNameLength keeps the names derived from the substrate name within the
+	// DNS label limit, the longest being kit-<name>-tenant-controlplane-node-role
+	MaxNameLength = validation.DNS1123LabelMaxLength - len("kit--tenant-controlplane-node-role")
+)
+
+var (
+	// sidecarComponents are the control plane components running as static pods
+	sidecarComponents = sets.NewString("etcd", "kube-apiserver", "kube-controller-manager", "kube-scheduler")
+	// logRetentionInDays are the retention periods supported by CloudWatch Logs
+	logRetentionInDays = []int64{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1827, 3653}
+	// apiVersion matches Kubernetes API versions, i.e. v1, v2beta1 or v1alpha2
+	apiVersion = regexp.MustCompile(`^v[1-9][0-9]*((alpha|beta)[1-9][0-9]*)?$`)
+	// runtimeConfigAPIVersions are the versions of the special api/<version> keys
+	runtimeConfigAPIVersions = sets.NewString("all", "ga", "beta", "alpha")
+	hostnameStrategies       = sets.NewString(HostnameStrategySubstrateName, HostnameStrategyPrivateDNSName, HostnameStrategyIMDSHostname, HostnameStrategyTemplate)
+	// featureGatePattern matches feature gate names, i.e. APIListChunking
+	featureGatePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+	storageBackends    = sets.NewString(StorageBackendEtcd3)
+	storageMediaTypes  = sets.NewString(StorageMediaTypeJSON, StorageMediaTypeProtobuf)
+	reusePolicies      = sets.NewString(WarmPoolReusePolicySameVersion, WarmPoolReusePolicyAnyVersion)
+	containerRuntimes  = sets.NewString(ContainerRuntimeDocker, ContainerRuntimeContainerd)
+	cgroupDrivers      = sets.NewString(CgroupDriverSystemd, CgroupDriverCgroupfs)
+	taintEffects       = sets.NewString(string(v1.TaintEffectNoSchedule), string(v1.TaintEffectPreferNoSchedule), string(v1.TaintEffectNoExecute))
+	operatingSystems   = sets.NewString(OperatingSystemAmazonLinux2, OperatingSystemBottlerocket)
+	egressSelections   = sets.NewString(EgressSelectionCluster, EgressSelectionControlPlane, EgressSelectionEtcd)
+	proxyProtocols     = sets.NewString(ProxyProtocolDirect, ProxyProtocolHTTPConnect, ProxyProtocolGRPC)
+	// oidcSigningAlgs are the algorithms supported by the API server's --oidc-signing-algs
+	oidcSigningAlgs = sets.NewString("RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "PS256", "PS384", "PS512")
+	// gravitonFamilyPattern matches the Graviton instance families, i.e. t4g,
+	// m6gd or im4gn, the substrate node's AMIs are arm64. a1 predates the
+	// naming and is matched separately.
+	gravitonFamilyPattern = regexp.MustCompile(`^([a-z]+[0-9]+g[a-z]*|a1)$`)
+	// gravitonFamilies are suggested when the family isn't a Graviton family
+	gravitonFamilies = sets.NewString("a1", "c6g", "c6gd", "c6gn", "c7g", "c7gd", "c7gn", "c8g", "g5g", "i4g", "im4gn", "is4gen",
+		"m6g", "m6gd", "m7g", "m7gd", "m8g", "r6g", "r6gd", "r7g", "r7gd", "r8g", "t4g", "x2gd", "x8g")
+	// instanceSizePattern matches instance sizes, i.e. nano, large, xlarge, 2xlarge or metal
+	instanceSizePattern = regexp.MustCompile(`^(nano|micro|small|medium|large|([2-9]|[1-9][0-9]+)?xlarge|metal)$`)
 )
 
 func (s *Substrate) Validate(ctx context.Context) (errs *apis.FieldError) {
 	if len(s.Name) == 0 {
 		return errs.Also(apis.ErrMissingField("name"))
 	}
+	if len(s.Name) > MaxNameLength {
+		return errs.Also(apis.ErrInvalidValue(s.Name, "name", fmt.Sprintf("must be no more than %d characters", MaxNameLength)))
+	}
+	return errs.Also(
+		s.validateInstanceType(),
+		s.validateBucketName(),
+		s.validateBucketKMSKeyARN(),
+		s.Spec.ReplicaBucket.validate().ViaField("replicaBucket"),
+		s.Spec.WarmPool.validate().ViaField("warmPool"),
+		s.validateContainerRuntime(),
+		s.validateCgroupDriver(),
+		s.validateOperatingSystem(),
+		s.validateNodeLabels().ViaField("nodeLabels"),
+		s.validateNodeTaints(),
+		s.Spec.FlowLogs.validate().ViaField("flowLogs"),
+		s.validateEventTTL(),
+		s.validateUploadTimeout(),
+		s.validateKubeConfigEndpoint(),
+		s.validateKubeConfigURLTTL(),
+		s.validateAPIServerPort(),
+		s.validateServiceCIDR(),
+		s.validateAdditionalCertSANs(),
+		s.validateCertificateRenewBefore(),
+		s.validateElasticIPAllocationID(),
+		s.Spec.AuditLog.validate().ViaField("auditLog"),
+		s.validateComponentSidecars().ViaField("componentSidecars"),
+		s.Spec.ComponentArgs.validate().ViaField("componentArgs"),
+		s.validateSchedulers().ViaField("schedulers"),
+		s.validateRuntimeConfig().ViaField("runtimeConfig"),
+		s.Spec.AuthCache.validate().ViaField("authCache"),
+		s.Spec.SecretsEncryption.validate().ViaField("secretsEncryption"),
+		s.Spec.ServiceAccountKey.validate().ViaField("serviceAccountKey"),
+		s.Spec.DHCPOptions.validate().ViaField("dhcpOptions"),
+		s.Spec.Hostname.validate().ViaField("hostname"),
+		s.Spec.RequestHeader.validate().ViaField("requestHeader"),
+		s.Spec.OIDC.validate().ViaField("oidc"),
+		s.validateWatchCache(),
+		s.validateStorage(),
+		s.validateHTTP2MaxStreamsPerConnection(),
+		s.validateFeatureGates().ViaField("featureGates"),
+		s.validateSubnets(),
+		s.validateNATGateway(),
+		s.Spec.ClusterInfo.validate().ViaField("clusterInfo"),
+		s.validateBootstrapTokenAuth(),
+		s.validateClientCertAuth(),
+		s.validateEgress(),
+		s.Spec.EtcdBackup.validate().ViaField("etcdBackup"),
+		s.Spec.EgressSelector.validate().ViaField("egressSelector"),
+	).ViaField("spec")
+}
+
+// validateInstanceType checks the instance type is a Graviton family and a
+// size, suggesting the families starting with the same letter otherwise
+func (s *Substrate) validateInstanceType() *apis.FieldError {
+	if s.Spec.InstanceType == nil {
+		return nil
+	}
+	instanceType := *s.Spec.InstanceType
+	parts := strings.SplitN(instanceType, ".", 2)
+	if len(parts) != 2 || !gravitonFamilyPattern.MatchString(parts[0]) {
+		suggestions := []string{}
+		for _, family := range gravitonFamilies.List() {
+			if instanceType != "" && family[0] == instanceType[0] {
+				suggestions = append(suggestions, family)
+			}
+		}
+		if len(suggestions) == 0 {
+			suggestions = []string{"t4g", "m6g", "c6g", "r6g"}
+		}
+		return apis.ErrInvalidValue(instanceType, "instanceType", fmt.Sprintf("must be an arm64 instance type, i.e. one of the families %v", suggestions))
+	}
+	if !instanceSizePattern.MatchString(parts[1]) {
+		return apis.ErrInvalidValue(instanceType, "instanceType", fmt.Sprintf("must be a size of %s, i.e. %s.medium, %s.large or %s.2xlarge", parts[0], parts[0], parts[0], parts[0]))
+	}
+	return nil
+}
+
+// validateBucketName checks the bucket name is a valid S3 bucket name once
+// the optional prefix and suffix are applied
+func (s *Substrate) validateBucketName() (errs *apis.FieldError) {
+	bucket := s.BucketName()
+	if len(bucket) > maxBucketNameLength {
+		errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("bucket name %s must be no more than %d characters", bucket, maxBucketNameLength),
+			"bucketNamePrefix", "bucketNameSuffix"))
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(bucket) {
+		errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("bucket name %s, %s", bucket, msg), "bucketNamePrefix", "bucketNameSuffix"))
+	}
+	// The accelerate endpoint is virtual hosted, a dot would break its TLS certificate
+	if aws.BoolValue(s.Spec.BucketTransferAcceleration) && strings.Contains(bucket, ".") {
+		errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("bucket name %s must not contain dots with transfer acceleration", bucket), "bucketNamePrefix", "bucketNameSuffix"))
+	}
+	return errs
+}
+
+func (r *ReplicaBucketSpec) validate() (errs *apis.FieldError) {
+	if r == nil {
+		return nil
+	}
+	if len(r.Name) > maxBucketNameLength {
+		errs = errs.Also(apis.ErrInvalidValue(r.Name, "name", fmt.Sprintf("must be no more than %d characters", maxBucketNameLength)))
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(r.Name) {
+		errs = errs.Also(apis.ErrInvalidValue(r.Name, "name", msg))
+	}
+	if r.Region != nil && len(*r.Region) == 0 {
+		errs = errs.Also(apis.ErrInvalidValue(*r.Region, "region"))
+	}
+	return errs
+}
+
+func (w *WarmPoolSpec) validate() (errs *apis.FieldError) {
+	if w == nil {
+		return nil
+	}
+	if w.Size < 0 || w.Size > maxWarmPoolSize {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(w.Size, 0, maxWarmPoolSize, "size"))
+	}
+	if w.ReusePolicy != "" && !reusePolicies.Has(w.ReusePolicy) {
+		errs = errs.Also(apis.ErrInvalidValue(w.ReusePolicy, "reusePolicy", fmt.Sprintf("must be one of %v", reusePolicies.List())))
+	}
+	return errs
+}
+
+func (s *Substrate) validateBucketKMSKeyARN() *apis.FieldError {
+	if s.Spec.BucketKMSKeyARN == nil {
+		return nil
+	}
+	// The ARN, rather than a key ID or alias, is needed to allow the substrate node to decrypt
+	if parsed, err := arn.Parse(*s.Spec.BucketKMSKeyARN); err != nil || parsed.Service != "kms" || !strings.HasPrefix(parsed.Resource, "key/") {
+		return apis.ErrInvalidValue(*s.Spec.BucketKMSKeyARN, "bucketKMSKeyARN")
+	}
+	return nil
+}
+
+func (s *Substrate) validateEventTTL() (errs *apis.FieldError) {
+	if s.Spec.EventTTL == nil {
+		return nil
+	}
+	if s.Spec.EventTTL.Duration <= 0 || s.Spec.EventTTL.Duration > maxEventTTL {
+		return apis.ErrOutOfBoundsValue(s.Spec.EventTTL.Duration, 0, maxEventTTL, "eventTTL")
+	}
+	return nil
+}
+
+func (s *Substrate) validateUploadTimeout() (errs *apis.FieldError) {
+	if s.Spec.UploadTimeout != nil && s.Spec.UploadTimeout.Duration <= 0 {
+		return apis.ErrInvalidValue(s.Spec.UploadTimeout.Duration, "uploadTimeout", "must be positive")
+	}
+	return nil
+}
+
+func (s *Substrate) validateKubeConfigEndpoint() (errs *apis.FieldError) {
+	if s.Spec.KubeConfigEndpoint == nil {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(*s.Spec.KubeConfigEndpoint)
+	if err != nil {
+		return apis.ErrInvalidValue(*s.Spec.KubeConfigEndpoint, "kubeConfigEndpoint", err.Error())
+	}
+	if len(host) == 0 {
+		return apis.ErrInvalidValue(*s.Spec.KubeConfigEndpoint, "kubeConfigEndpoint", "host must not be empty")
+	}
+	for _, msg := range validation.IsValidPortNum(portNumber(port)) {
+		errs = errs.Also(apis.ErrInvalidValue(*s.Spec.KubeConfigEndpoint, "kubeConfigEndpoint", msg))
+	}
+	return errs
+}
+
+// validateElasticIPAllocationID checks the format of the allocation ID, the
+// elastic IP itself is checked when the substrate's address is created
+func (s *Substrate) validateElasticIPAllocationID() *apis.FieldError {
+	if s.Spec.ElasticIPAllocationID == nil {
+		return nil
+	}
+	if !strings.HasPrefix(*s.Spec.ElasticIPAllocationID, "eipalloc-") {
+		return apis.ErrInvalidValue(*s.Spec.ElasticIPAllocationID, "elasticIPAllocationID", "must be an elastic IP allocation ID, i.e. eipalloc-0123456789abcdef0")
+	}
+	return nil
+}
+
+func (s *Substrate) validateKubeConfigURLTTL() (errs *apis.FieldError) {
+	if ttl := s.Spec.KubeConfigURLTTL; ttl != nil && (ttl.Duration < minKubeConfigURLTTL || ttl.Duration > maxKubeConfigURLTTL) {
+		return apis.ErrOutOfBoundsValue(ttl.Duration, minKubeConfigURLTTL, maxKubeConfigURLTTL, "kubeConfigURLTTL")
+	}
+	return nil
+}
+
+func (s *Substrate) validateCertificateRenewBefore() (errs *apis.FieldError) {
+	if renewBefore := s.Spec.CertificateRenewBefore; renewBefore != nil && (renewBefore.Duration <= 0 || renewBefore.Duration >= maxCertificateRenewBefore) {
+		return apis.ErrOutOfBoundsValue(renewBefore.Duration, 0, maxCertificateRenewBefore, "certificateRenewBefore")
+	}
+	// Certificates reissued now would still be issued before a future time, and
+	// renewed on every apply until then
+	if force := s.Spec.ForceCertificateRenewal; force != nil && force.Time.After(time.Now()) {
+		err := apis.ErrInvalidValue(force.Time.Format(time.RFC3339), "forceCertificateRenewal")
+		err.Details = "must not be in the future"
+		return err
+	}
+	return nil
+}
+
+// validateAdditionalCertSANs checks the SANs are IPs or DNS names, wildcards
+// aren't supported as kubeadm can't verify existing certificates cover them
+func (s *Substrate) validateAdditionalCertSANs() (errs *apis.FieldError) {
+	for i, san := range s.Spec.AdditionalCertSANs {
+		if net.ParseIP(san) == nil && len(validation.IsDNS1123Subdomain(san)) > 0 {
+			errs = errs.Also(apis.ErrInvalidArrayValue(san, "additionalCertSANs", i))
+		}
+	}
+	return errs
+}
+
+// validateServiceCIDR checks the range is IPv4 and sized between the API
+// server's largest range and one holding the cluster DNS's tenth address
+func (s *Substrate) validateServiceCIDR() (errs *apis.FieldError) {
+	if s.Spec.ServiceCIDR == "" {
+		return nil
+	}
+	ip, ipNet, err := net.ParseCIDR(s.Spec.ServiceCIDR)
+	if err != nil || ip.To4() == nil {
+		return apis.ErrInvalidValue(s.Spec.ServiceCIDR, "serviceCIDR", "must be an IPv4 CIDR")
+	}
+	if ones, _ := ipNet.Mask.Size(); ones < minServiceCIDRPrefix || ones > maxServiceCIDRPrefix {
+		return apis.ErrOutOfBoundsValue(ones, minServiceCIDRPrefix, maxServiceCIDRPrefix, "serviceCIDR")
+	}
+	return nil
+}
+
+func (s *Substrate) validateAPIServerPort() (errs *apis.FieldError) {
+	if s.Spec.APIServerPort == nil {
+		return nil
+	}
+	for _, msg := range validation.IsValidPortNum(int(*s.Spec.APIServerPort)) {
+		errs = errs.Also(apis.ErrInvalidValue(*s.Spec.APIServerPort, "apiServerPort", msg))
+	}
+	return errs
+}
+
+func portNumber(port string) int {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func (s *Substrate) validateSchedulers() (errs *apis.FieldError) {
+	names := sets.NewString(defaultSchedulerName)
+	for i, scheduler := range s.Spec.Schedulers {
+		for _, msg := range validation.IsDNS1123Label(scheduler.Name) {
+			errs = errs.Also(apis.ErrInvalidValue(scheduler.Name, "name", msg).ViaIndex(i))
+		}
+		if names.Has(scheduler.Name) {
+			errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("scheduler name %s is already used", scheduler.Name), "name").ViaIndex(i))
+		}
+		names.Insert(scheduler.Name)
+		config := struct {
+			LeaderElection struct {
+				ResourceName string `json:"resourceName"`
+			} `json:"leaderElection"`
+		}{}
+		if err := yaml.Unmarshal([]byte(scheduler.Config), &config); err != nil {
+			errs = errs.Also(apis.ErrInvalidValue(scheduler.Config, "config", err.Error()).ViaIndex(i))
+		} else if config.LeaderElection.ResourceName == defaultSchedulerLease {
+			errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("leader election lease %s is used by the default scheduler", defaultSchedulerLease), "config").ViaIndex(i))
+		}
+	}
+	return errs
+}
+
+func (s *Substrate) validateComponentSidecars() (errs *apis.FieldError) {
+	for component, sidecars := range s.Spec.ComponentSidecars {
+		if !sidecarComponents.Has(component) {
+			errs = errs.Also(apis.ErrInvalidKeyName(component, apis.CurrentField, fmt.Sprintf("must be one of %v", sidecarComponents.List())))
+			continue
+		}
+		// The component's own container is named after the component
+		names := sets.NewString(component)
+		for i, sidecar := range sidecars {
+			if len(sidecar.Name) == 0 {
+				errs = errs.Also(apis.ErrMissingField("name").ViaFieldIndex(component, i))
+			} else if names.Has(sidecar.Name) {
+				errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("container name %s is already used", sidecar.Name), "name").ViaFieldIndex(component, i))
+			}
+			if len(sidecar.Image) == 0 {
+				errs = errs.Also(apis.ErrMissingField("image").ViaFieldIndex(component, i))
+			}
+			names.Insert(sidecar.Name)
+		}
+	}
+	return errs
+}
+
+func (c *ComponentArgsSpec) validate() (errs *apis.FieldError) {
+	if c == nil {
+		return nil
+	}
+	for field, args := range map[string]map[string]string{
+		"apiServer":         c.APIServer,
+		"controllerManager": c.ControllerManager,
+		"scheduler":         c.Scheduler,
+		"etcd":              c.Etcd,
+		"kubelet":           c.Kubelet,
+	} {
+		for flag := range args {
+			if flag == "" || strings.HasPrefix(flag, "-") || strings.ContainsAny(flag, "= ") {
+				errs = errs.Also(apis.ErrInvalidKeyName(flag, field, "must be a flag name without leading dashes"))
+			}
+		}
+	}
+	return errs
+}
+
+func (s *Substrate) validateRuntimeConfig() (errs *apis.FieldError) {
+	for key, value := range s.Spec.RuntimeConfig {
+		if !isGroupVersion(key) {
+			errs = errs.Also(apis.ErrInvalidKeyName(key, apis.CurrentField, "must be of the form group/version"))
+			continue
+		}
+		if _, err := strconv.ParseBool(value); err != nil {
+			errs = errs.Also(apis.ErrInvalidValue(value, key, "must be true or false"))
+		}
+	}
+	return errs
+}
+
+func isGroupVersion(key string) bool {
+	parts := strings.Split(key, "/")
+	if len(parts) != 2 {
+		return false
+	}
+	group, version := parts[0], parts[1]
+	if group == "api" && runtimeConfigAPIVersions.Has(version) {
+		return true
+	}
+	return len(validation.IsDNS1123Subdomain(group)) == 0 && apiVersion.MatchString(version)
+}
+
+func (a *AuthCacheSpec) validate() (errs *apis.FieldError) {
+	if a == nil {
+		return nil
+	}
+	for field, ttl := range map[string]*metav1.Duration{"tokenWebhookTTL": a.TokenWebhookTTL, "authorizedTTL": a.AuthorizedTTL, "unauthorizedTTL": a.UnauthorizedTTL} {
+		if ttl != nil && ttl.Duration < 0 {
+			errs = errs.Also(apis.ErrInvalidValue(ttl.Duration, field, "must not be negative"))
+		}
+	}
+	return errs
+}
+
+func (e *SecretsEncryptionSpec) validate() (errs *apis.FieldError) {
+	if e == nil {
+		return nil
+	}
+	for _, msg := range validation.IsDNS1123Label(e.KeyName) {
+		errs = errs.Also(apis.ErrInvalidValue(e.KeyName, "keyName", msg))
+	}
+	if e.KeyName == "identity" {
+		errs = errs.Also(apis.ErrInvalidValue(e.KeyName, "keyName", "identity is reserved for disabling encryption"))
+	}
+	return errs
+}
+
+func (k *ServiceAccountKeySpec) validate() (errs *apis.FieldError) {
+	if k == nil {
+		return nil
+	}
+	for _, msg := range validation.IsDNS1123Label(k.KeyName) {
+		errs = errs.Also(apis.ErrInvalidValue(k.KeyName, "keyName", msg))
+	}
+	return errs
+}
+
+func (s *Substrate) validateContainerRuntime() *apis.FieldError {
+	if s.Spec.ContainerRuntime != "" && !containerRuntimes.Has(s.Spec.ContainerRuntime) {
+		return apis.ErrInvalidValue(s.Spec.ContainerRuntime, "containerRuntime", fmt.Sprintf("must be one of %v", containerRuntimes.List()))
+	}
+	return nil
+}
+
+func (s *Substrate) validateCgroupDriver() *apis.FieldError {
+	if s.Spec.CgroupDriver != "" && !cgroupDrivers.Has(s.Spec.CgroupDriver) {
+		return apis.ErrInvalidValue(s.Spec.CgroupDriver, "cgroupDriver", fmt.Sprintf("must be one of %v", cgroupDrivers.List()))
+	}
+	return nil
+}
+
+// validateOperatingSystem rejects the options Bottlerocket can't run, the
+// warm pool and hostname strategies are shell scripts in the user data
+func (s *Substrate) validateOperatingSystem() (errs *apis.FieldError) {
+	if s.Spec.OperatingSystem != "" && !operatingSystems.Has(s.Spec.OperatingSystem) {
+		return apis.ErrInvalidValue(s.Spec.OperatingSystem, "operatingSystem", fmt.Sprintf("must be one of %v", operatingSystems.List()))
+	}
+	if s.Spec.OperatingSystem != OperatingSystemBottlerocket {
+		if s.Spec.Bottlerocket != nil {
+			errs = errs.Also(apis.ErrGeneric("bottlerocket is only supported for the Bottlerocket operating system", "bottlerocket"))
+		}
+		return errs
+	}
+	if s.Spec.Bottlerocket == nil || s.Spec.Bottlerocket.SyncImage == "" {
+		errs = errs.Also(apis.ErrMissingField("bottlerocket.syncImage"))
+	}
+	if s.Spec.ContainerRuntime != "" && s.Spec.ContainerRuntime != ContainerRuntimeContainerd {
+		errs = errs.Also(apis.ErrGeneric("Bottlerocket only supports the containerd runtime", "containerRuntime"))
+	}
+	if s.Spec.CgroupDriver != "" && s.Spec.CgroupDriver != CgroupDriverSystemd {
+		errs = errs.Also(apis.ErrGeneric("Bottlerocket only supports the systemd cgroup driver", "cgroupDriver"))
+	}
+	if s.Spec.WarmPool != nil {
+		errs = errs.Also(apis.ErrGeneric("warmPool is not supported on Bottlerocket", "warmPool"))
+	}
+	if s.Spec.Hostname != nil && s.Spec.Hostname.Strategy != HostnameStrategySubstrateName {
+		errs = errs.Also(apis.ErrGeneric("Bottlerocket only supports the SubstrateName hostname strategy", "hostname.strategy"))
+	}
+	return errs
+}
+
+func (s *Substrate) validateNodeLabels() (errs *apis.FieldError) {
+	for key, value := range s.Spec.NodeLabels {
+		if key == SubstrateNodeLabelKey {
+			errs = errs.Also(apis.ErrInvalidKeyName(key, apis.CurrentField, "is reserved for the substrate"))
+			continue
+		}
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs = errs.Also(apis.ErrInvalidKeyName(key, apis.CurrentField, msg))
+		}
+		// The kubelet refuses to start with other labels in the kubernetes.io
+		// and k8s.io namespaces
+		if isKubernetesLabel(key) && !kubeletapis.IsKubeletLabel(key) && !strings.HasPrefix(key, NodeRoleLabelPrefix) {
+			errs = errs.Also(apis.ErrInvalidKeyName(key, apis.CurrentField,
+				"kubernetes.io and k8s.io labels are limited to the kubelet's labels and "+NodeRoleLabelPrefix))
+		}
+		for _, msg := range validation.IsValidLabelValue(value) {
+			errs = errs.Also(apis.ErrInvalidValue(value, key, msg))
+		}
+	}
+	return errs
+}
+
+func isKubernetesLabel(key string) bool {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	for _, namespace := range []string{"kubernetes.io", "k8s.io"} {
+		if parts[0] == namespace || strings.HasSuffix(parts[0], "."+namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Substrate) validateNodeTaints() (errs *apis.FieldError) {
+	for i, taint := range s.Spec.NodeTaints {
+		for _, msg := range validation.IsQualifiedName(taint.Key) {
+			errs = errs.Also(apis.ErrInvalidValue(taint.Key, "key", msg).ViaFieldIndex("nodeTaints", i))
+		}
+		for _, msg := range validation.IsValidLabelValue(taint.Value) {
+			errs = errs.Also(apis.ErrInvalidValue(taint.Value, "value", msg).ViaFieldIndex("nodeTaints", i))
+		}
+		if !taintEffects.Has(string(taint.Effect)) {
+			errs = errs.Also(apis.ErrInvalidValue(taint.Effect, "effect", fmt.Sprintf("must be one of %v", taintEffects.List())).ViaFieldIndex("nodeTaints", i))
+		}
+	}
+	return errs
+}
+
+func (s *Substrate) validateStorage() (errs *apis.FieldError) {
+	if s.Spec.StorageBackend != "" && !storageBackends.Has(s.Spec.StorageBackend) {
+		errs = errs.Also(apis.ErrInvalidValue(s.Spec.StorageBackend, "storageBackend", fmt.Sprintf("must be one of %v", storageBackends.List())))
+	}
+	if s.Spec.StorageMediaType != "" && !storageMediaTypes.Has(s.Spec.StorageMediaType) {
+		errs = errs.Also(apis.ErrInvalidValue(s.Spec.StorageMediaType, "storageMediaType", fmt.Sprintf("must be one of %v", storageMediaTypes.List())))
+	}
+	return errs
+}
+
+func (s *Substrate) validateHTTP2MaxStreamsPerConnection() *apis.FieldError {
+	if streams := s.Spec.HTTP2MaxStreamsPerConnection; streams != nil && (*streams < 1 || *streams > maxHTTP2MaxStreamsPerConnection) {
+		return apis.ErrOutOfBoundsValue(*streams, 1, maxHTTP2MaxStreamsPerConnection, "http2MaxStreamsPerConnection")
+	}
 	return nil
 }
+
+// validateSubnets checks the subnets are IPv4 ranges within the VPC's CIDR
+// that don't overlap, with at most one public and one private subnet per zone
+func (s *Substrate) validateSubnets() (errs *apis.FieldError) {
+	var vpc *net.IPNet
+	if s.Spec.VPC != nil {
+		ip, ipNet, err := net.ParseCIDR(s.Spec.VPC.CIDR)
+		if err != nil || ip.To4() == nil {
+			return apis.ErrInvalidValue(s.Spec.VPC.CIDR, "vpc.cidr", "must be an IPv4 CIDR")
+		}
+		vpc = ipNet
+	}
+	ranges := make([]*net.IPNet, len(s.Spec.Subnets))
+	zones := map[string]int{}
+	for i, subnet := range s.Spec.Subnets {
+		name := fmt.Sprintf("subnet %s in %s", subnet.CIDR, subnet.Zone)
+		visibility := "private"
+		if subnet.Public {
+			visibility = "public"
+		}
+		if j, ok := zones[visibility+"/"+subnet.Zone]; ok {
+			errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("%s is the zone's second %s subnet after subnets[%d]", name, visibility, j), "zone").ViaFieldIndex("subnets", i))
+		} else {
+			zones[visibility+"/"+subnet.Zone] = i
+		}
+		ip, ipNet, err := net.ParseCIDR(subnet.CIDR)
+		if err != nil || ip.To4() == nil {
+			errs = errs.Also(apis.ErrInvalidValue(subnet.CIDR, "cidr", fmt.Sprintf("%s must be an IPv4 CIDR", name)).ViaFieldIndex("subnets", i))
+			continue
+		}
+		ranges[i] = ipNet
+		if vpc != nil {
+			ones, _ := ipNet.Mask.Size()
+			if vpcOnes, _ := vpc.Mask.Size(); !vpc.Contains(ipNet.IP) || ones < vpcOnes {
+				errs = errs.Also(apis.ErrInvalidValue(subnet.CIDR, "cidr", fmt.Sprintf("%s is outside the VPC CIDR %s", name, vpc)).ViaFieldIndex("subnets", i))
+			}
+		}
+		for j, other := range ranges[:i] {
+			if other != nil && (other.Contains(ipNet.IP) || ipNet.Contains(other.IP)) {
+				errs = errs.Also(apis.ErrInvalidValue(subnet.CIDR, "cidr", fmt.Sprintf("%s overlaps subnets[%d] %s", name, j, other)).ViaFieldIndex("subnets", i))
+			}
+		}
+	}
+	return errs
+}
+
+func (s *Substrate) validateNATGateway() (errs *apis.FieldError) {
+	publicZones := sets.NewString()
+	privateZones := sets.NewString()
+	for _, subnet := range s.Spec.Subnets {
+		if subnet.Public {
+			publicZones.Insert(subnet.Zone)
+		} else {
+			privateZones.Insert(subnet.Zone)
+		}
+	}
+	switch s.Spec.NATGateway {
+	case "", NATGatewayNone:
+		if privateZones.Len() > 0 {
+			return apis.ErrGeneric("private subnets require a NAT gateway for outbound traffic", "natGateway")
+		}
+	case NATGatewaySingle:
+		if privateZones.Len() == 0 {
+			return apis.ErrGeneric("NAT gateways require a private subnet, use none when all subnets are public", "natGateway")
+		}
+		if publicZones.Len() == 0 {
+			return apis.ErrGeneric("NAT gateways require a public subnet", "natGateway")
+		}
+	case NATGatewayPerAZ:
+		if privateZones.Len() == 0 {
+			return apis.ErrGeneric("NAT gateways require a private subnet, use none when all subnets are public", "natGateway")
+		}
+		if missing := privateZones.Difference(publicZones); missing.Len() > 0 {
+			return apis.ErrGeneric(fmt.Sprintf("NAT gateways require a public subnet in zones %v", missing.List()), "natGateway")
+		}
+	default:
+		return apis.ErrInvalidValue(s.Spec.NATGateway, "natGateway", fmt.Sprintf("must be one of %v", []string{NATGatewaySingle, NATGatewayPerAZ, NATGatewayNone}))
+	}
+	return nil
+}
+
+func (s *Substrate) validateWatchCache() (errs *apis.FieldError) {
+	if len(s.Spec.WatchCacheSizes) == 0 {
+		return nil
+	}
+	if s.Spec.WatchCacheEnabled != nil && !*s.Spec.WatchCacheEnabled {
+		return apis.ErrGeneric("watch cache sizes require the watch cache to be enabled", "watchCacheEnabled", "watchCacheSizes")
+	}
+	for resource, size := range s.Spec.WatchCacheSizes {
+		// Resources are lower case plural names, optionally qualified by their group
+		if len(validation.IsDNS1123Subdomain(resource)) != 0 {
+			errs = errs.Also(apis.ErrInvalidKeyName(resource, "watchCacheSizes", "must be of the form resource[.group]"))
+			continue
+		}
+		if size < 0 {
+			errs = errs.Also(apis.ErrInvalidValue(size, resource, "must not be negative").ViaField("watchCacheSizes"))
+		}
+	}
+	return errs
+}
+
+// validateFeatureGates checks the gate names, a single set of gates is shared
+// by all components so their values can't conflict
+func (s *Substrate) validateFeatureGates() (errs *apis.FieldError) {
+	for gate := range s.Spec.FeatureGates {
+		if !featureGatePattern.MatchString(gate) {
+			errs = errs.Also(apis.ErrInvalidKeyName(gate, apis.CurrentField, "must be an alphanumeric feature gate name, i.e. APIListChunking"))
+		}
+	}
+	return errs
+}
+
+func (r *RequestHeaderSpec) validate() (errs *apis.FieldError) {
+	if r == nil {
+		return nil
+	}
+	for i, name := range r.AllowedNames {
+		if len(name) == 0 {
+			errs = errs.Also(apis.ErrInvalidArrayValue(name, "allowedNames", i))
+		}
+	}
+	for field, headers := range map[string][]string{"usernameHeaders": r.UsernameHeaders, "groupHeaders": r.GroupHeaders, "extraHeadersPrefix": r.ExtraHeadersPrefix} {
+		for i, header := range headers {
+			for _, msg := range validation.IsHTTPHeaderName(header) {
+				errs = errs.Also(apis.ErrInvalidValue(header, apis.CurrentField, msg).ViaFieldIndex(field, i))
+			}
+		}
+	}
+	return errs
+}
+
+func (o *OIDCSpec) validate() (errs *apis.FieldError) {
+	if o == nil {
+		return nil
+	}
+	if o.IssuerURL == "" {
+		errs = errs.Also(apis.ErrMissingField("issuerURL"))
+	} else if strings.ContainsAny(o.IssuerURL, ", ") {
+		// A list of issuers needs --authentication-config, which EKS-D 1.21 doesn't have
+		errs = errs.Also(apis.ErrInvalidValue(o.IssuerURL, "issuerURL", "must be a single issuer"))
+	} else if issuer, err := url.Parse(o.IssuerURL); err != nil || issuer.Scheme != "https" || issuer.Host == "" {
+		errs = errs.Also(apis.ErrInvalidValue(o.IssuerURL, "issuerURL", "must be an https URL"))
+	}
+	if o.ClientID == "" {
+		errs = errs.Also(apis.ErrMissingField("clientID"))
+	} else if strings.ContainsAny(o.ClientID, ", ") {
+		errs = errs.Also(apis.ErrInvalidValue(o.ClientID, "clientID", "must be a single client ID"))
+	}
+	if o.CA != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(o.CA)) {
+		errs = errs.Also(apis.ErrGeneric("ca must be PEM encoded certificates", "ca"))
+	}
+	for i, alg := range o.SigningAlgs {
+		if !oidcSigningAlgs.Has(alg) {
+			err := apis.ErrInvalidArrayValue(alg, "signingAlgs", i)
+			err.Details = fmt.Sprintf("must be one of %v", oidcSigningAlgs.List())
+			errs = errs.Also(err)
+		}
+	}
+	return errs
+}
+
+func (h *HostnameSpec) validate() (errs *apis.FieldError) {
+	if h == nil {
+		return nil
+	}
+	if !hostnameStrategies.Has(h.Strategy) {
+		return apis.ErrInvalidValue(h.Strategy, "strategy", fmt.Sprintf("must be one of %v", hostnameStrategies.List()))
+	}
+	if h.Strategy != HostnameStrategyTemplate {
+		if h.Template != "" {
+			errs = errs.Also(apis.ErrGeneric("template is only supported for the Template strategy", "template"))
+		}
+		return errs
+	}
+	if h.Template == "" {
+		return apis.ErrMissingField("template")
+	}
+	// Render the template for the first node to check it produces a valid node name
+	hostname, err := RenderHostname(h.Template, "substrate", "0")
+	if err != nil {
+		return apis.ErrInvalidValue(h.Template, "template", err.Error())
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(hostname) {
+		errs = errs.Also(apis.ErrInvalidValue(h.Template, "template", fmt.Sprintf("hostname %s, %s", hostname, msg)))
+	}
+	return errs
+}
+
+// RenderHostname executes the hostname template for a node, the ordinal is a
+// string so it can be a variable expanded by the node
+func RenderHostname(hostnameTemplate string, name string, ordinal string) (string, error) {
+	t, err := template.New("hostname").Option("missingkey=error").Parse(hostnameTemplate)
+	if err != nil {
+		return "", err
+	}
+	hostname := strings.Builder{}
+	if err := t.Execute(&hostname, struct{ Name, Ordinal string }{Name: name, Ordinal: ordinal}); err != nil {
+		return "", err
+	}
+	return hostname.String(), nil
+}
+
+// validateEgress checks the rules still allow HTTPS, which the node needs to
+// download its config from S3 and pull images from ECR
+func (s *Substrate) validateEgress() (errs *apis.FieldError) {
+	if len(s.Spec.Egress) == 0 {
+		return nil
+	}
+	https := false
+	for i, rule := range s.Spec.Egress {
+		errs = errs.Also(rule.validate().ViaFieldIndex("egress", i))
+		if rule.Protocol != EgressProtocolUDP && (rule.Port == nil || *rule.Port == 443) {
+			https = true
+		}
+	}
+	if !https {
+		errs = errs.Also(apis.ErrGeneric("must allow tcp/443 for the node to reach the config bucket and image registry", "egress"))
+	}
+	return errs
+}
+
+func (e *EgressRuleSpec) validate() (errs *apis.FieldError) {
+	switch {
+	case e.CIDR == "" && e.PrefixListID == "":
+		errs = errs.Also(apis.ErrMissingOneOf("cidr", "prefixListID"))
+	case e.CIDR != "" && e.PrefixListID != "":
+		errs = errs.Also(apis.ErrMultipleOneOf("cidr", "prefixListID"))
+	}
+	if e.CIDR != "" {
+		if ip, _, err := net.ParseCIDR(e.CIDR); err != nil || ip.To4() == nil {
+			errs = errs.Also(apis.ErrInvalidValue(e.CIDR, "cidr", "must be an IPv4 CIDR"))
+		}
+	}
+	if e.PrefixListID != "" && !strings.HasPrefix(e.PrefixListID, "pl-") {
+		errs = errs.Also(apis.ErrInvalidValue(e.PrefixListID, "prefixListID", "must be a prefix list id, i.e. pl-63a5400a"))
+	}
+	switch e.Protocol {
+	case "", EgressProtocolTCP, EgressProtocolUDP:
+	case EgressProtocolAll:
+		if e.Port != nil {
+			errs = errs.Also(apis.ErrGeneric("port can't be set for all protocols", "port"))
+		}
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(e.Protocol, "protocol", fmt.Sprintf("must be one of %v", []string{EgressProtocolTCP, EgressProtocolUDP, EgressProtocolAll})))
+	}
+	if e.Port != nil && (*e.Port < 1 || *e.Port > 65535) {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(*e.Port, 1, 65535, "port"))
+	}
+	return errs
+}
+
+func (c *ClusterInfoSpec) validate() (errs *apis.FieldError) {
+	if c == nil {
+		return nil
+	}
+	for i, token := range c.BootstrapTokens {
+		// The token is a secret, so it's left out of the error
+		if !bootstraputil.IsValidBootstrapToken(token) {
+			errs = errs.Also(apis.ErrGeneric("must be of the form [a-z0-9]{6}.[a-z0-9]{16}", apis.CurrentField).ViaFieldIndex("bootstrapTokens", i))
+		}
+	}
+	return errs
+}
+
+// validateBootstrapTokenAuth rejects bootstrap tokens the API server won't
+// accept, nodes would discover the cluster but fail to authenticate to join
+// validateClientCertAuth checks users have a token authenticator when client
+// certificates aren't meant for them, the components keep their certificates
+func (s *Substrate) validateClientCertAuth() *apis.FieldError {
+	if s.Spec.ClientCertAuth == nil || *s.Spec.ClientCertAuth || s.IAMAuthenticatorEnabled() || s.Spec.OIDC != nil {
+		return nil
+	}
+	return apis.ErrGeneric("disabling client certificate auth requires enableIAMAuthenticator or oidc", "clientCertAuth")
+}
+
+func (s *Substrate) validateBootstrapTokenAuth() *apis.FieldError {
+	if s.Spec.ClusterInfo == nil || len(s.Spec.ClusterInfo.BootstrapTokens) == 0 || s.Spec.EnableBootstrapTokenAuth == nil || *s.Spec.EnableBootstrapTokenAuth {
+		return nil
+	}
+	return apis.ErrGeneric("bootstrap tokens require bootstrap token auth", "enableBootstrapTokenAuth", "clusterInfo.bootstrapTokens")
+}
+
+func (d *DHCPOptionsSpec) validate() (errs *apis.FieldError) {
+	if d == nil {
+		return nil
+	}
+	if d.DomainName == "" && len(d.DomainNameServers) == 0 && len(d.NTPServers) == 0 {
+		return apis.ErrMissingOneOf("domainName", "domainNameServers", "ntpServers")
+	}
+	if d.DomainName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(d.DomainName) {
+			errs = errs.Also(apis.ErrInvalidValue(d.DomainName, "domainName", msg))
+		}
+	}
+	for field, servers := range map[string][]string{"domainNameServers": d.DomainNameServers, "ntpServers": d.NTPServers} {
+		if len(servers) > maxDHCPServers {
+			errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("must have at most %d servers", maxDHCPServers), field))
+		}
+		for i, server := range servers {
+			// AmazonProvidedDNS is the Route 53 Resolver
+			if field == "domainNameServers" && server == "AmazonProvidedDNS" {
+				continue
+			}
+			if net.ParseIP(server) == nil {
+				errs = errs.Also(apis.ErrInvalidArrayValue(server, field, i))
+			}
+		}
+	}
+	return errs
+}
+
+func (a *AuditLogSpec) validate() (errs *apis.FieldError) {
+	if a == nil {
+		return nil
+	}
+	for field, value := range map[string]*int32{"maxAge": a.MaxAge, "maxBackup": a.MaxBackup, "maxSize": a.MaxSize} {
+		if value != nil && *value <= 0 {
+			errs = errs.Also(apis.ErrInvalidValue(*value, field, "must be a positive integer"))
+		}
+	}
+	if a.Policy != "" {
+		// The API server fails to start with an invalid policy, so at least
+		// check it's a policy with rules
+		policy := struct {
+			APIVersion string        `json:"apiVersion"`
+			Kind       string        `json:"kind"`
+			Rules      []interface{} `json:"rules"`
+		}{}
+		if err := yaml.Unmarshal([]byte(a.Policy), &policy); err != nil || policy.APIVersion != "audit.k8s.io/v1" || policy.Kind != "Policy" || len(policy.Rules) == 0 {
+			errs = errs.Also(apis.ErrGeneric("must be an audit.k8s.io/v1 Policy with at least one rule", "policy"))
+		}
+	}
+	return errs
+}
+
+func (f *FlowLogsSpec) validate() (errs *apis.FieldError) {
+	if f == nil {
+		return nil
+	}
+	switch f.DestinationType {
+	case ec2.LogDestinationTypeS3:
+		if f.Destination == nil {
+			errs = errs.Also(apis.ErrMissingField("destination"))
+		}
+		if f.RetentionInDays != nil {
+			errs = errs.Also(apis.ErrGeneric("retention is only supported for cloud-watch-logs, use a bucket lifecycle policy for s3", "retentionInDays"))
+		}
+	case ec2.LogDestinationTypeCloudWatchLogs:
+		if f.Destination != nil {
+			errs = errs.Also(apis.ErrGeneric("log group is created by the substrate for cloud-watch-logs", "destination"))
+		}
+		if f.DeliverLogsPermissionARN == nil {
+			errs = errs.Also(apis.ErrMissingField("deliverLogsPermissionARN"))
+		}
+		if f.RetentionInDays != nil && !sets.NewInt64(logRetentionInDays...).Has(*f.RetentionInDays) {
+			errs = errs.Also(apis.ErrInvalidValue(*f.RetentionInDays, "retentionInDays"))
+		}
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(f.DestinationType, "destinationType"))
+	}
+	if f.TrafficType != nil && !sets.NewString(ec2.TrafficType_Values()...).Has(*f.TrafficType) {
+		errs = errs.Also(apis.ErrInvalidValue(*f.TrafficType, "trafficType"))
+	}
+	return errs
+}
+
+func (e *EtcdBackupSpec) validate() (errs *apis.FieldError) {
+	if e == nil {
+		return nil
+	}
+	if e.Interval != nil && e.Interval.Duration < time.Minute {
+		errs = errs.Also(apis.ErrInvalidValue(e.Interval.Duration.String(), "interval", "must be at least 1m"))
+	}
+	if e.Retention != nil && *e.Retention < 1 {
+		errs = errs.Also(apis.ErrInvalidValue(*e.Retention, "retention", "must keep at least one snapshot"))
+	}
+	return errs
+}
+
+func (e *EgressSelectorSpec) validate() (errs *apis.FieldError) {
+	if e == nil {
+		return nil
+	}
+	names := sets.NewString()
+	for i, selection := range e.Selections {
+		if names.Has(selection.Name) {
+			errs = errs.Also(apis.ErrMultipleOneOf(fmt.Sprintf("selections[%d].name", i)))
+		}
+		names.Insert(selection.Name)
+		errs = errs.Also(selection.validate().ViaFieldIndex("selections", i))
+	}
+	return errs
+}
+
+// validate the destination and connection combination. GRPC tunnels through
+// konnectivity's agents, which run on the cluster's nodes and can't reach the
+// control plane or etcd.
+func (e EgressSelectionSpec) validate() (errs *apis.FieldError) {
+	if !egressSelections.Has(e.Name) {
+		errs = errs.Also(apis.ErrInvalidValue(e.Name, "name", fmt.Sprintf("must be one of %v", egressSelections.List())))
+	}
+	if e.ProxyProtocol != "" && !proxyProtocols.Has(e.ProxyProtocol) {
+		return errs.Also(apis.ErrInvalidValue(e.ProxyProtocol, "proxyProtocol", fmt.Sprintf("must be one of %v", proxyProtocols.List())))
+	}
+	if e.ProxyProtocol == "" || e.ProxyProtocol == ProxyProtocolDirect {
+		if e.UDSName != "" {
+			errs = errs.Also(apis.ErrGeneric("udsName is not supported for Direct connections", "udsName"))
+		}
+		return errs
+	}
+	if e.ProxyProtocol == ProxyProtocolGRPC && e.Name != EgressSelectionCluster {
+		errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("GRPC is only supported for the %s destination", EgressSelectionCluster), "proxyProtocol"))
+	}
+	if e.UDSName == "" {
+		errs = errs.Also(apis.ErrMissingField("udsName"))
+	} else if !path.IsAbs(e.UDSName) {
+		errs = errs.Also(apis.ErrInvalidValue(e.UDSName, "udsName", "must be an absolute path"))
+	}
+	return errs
+}
@@ -0,0 +1,233 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBottlerocketValidation(t *testing.T) {
+	ctx := context.Background()
+	bottlerocket := &BottlerocketSpec{SyncImage: "public.ecr.aws/kit/sync:latest"}
+	substrate := &Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-bottlerocket"},
+		Spec:       SubstrateSpec{OperatingSystem: OperatingSystemBottlerocket, Bottlerocket: bottlerocket},
+	}
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if substrate.Spec.ContainerRuntime != ContainerRuntimeContainerd {
+		t.Errorf("expected Bottlerocket to default to containerd, got %s", substrate.Spec.ContainerRuntime)
+	}
+	for _, spec := range []SubstrateSpec{
+		{OperatingSystem: OperatingSystemBottlerocket},
+		{OperatingSystem: OperatingSystemBottlerocket, Bottlerocket: bottlerocket, ContainerRuntime: ContainerRuntimeDocker},
+		{OperatingSystem: OperatingSystemBottlerocket, Bottlerocket: bottlerocket, WarmPool: &WarmPoolSpec{Size: 1}},
+		{OperatingSystem: OperatingSystemAmazonLinux2, Bottlerocket: bottlerocket},
+		{OperatingSystem: "Ubuntu"},
+	} {
+		invalid := &Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-bottlerocket"}, Spec: spec}
+		if err := invalid.Validate(ctx); err == nil {
+			t.Errorf("expected %+v to fail validation", spec)
+		}
+	}
+}
+
+func TestSecretsEncryptionValidation(t *testing.T) {
+	ctx := context.Background()
+	for _, keyName := range []string{"identity", "Key_1"} {
+		substrate := &Substrate{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-secrets-encryption"},
+			Spec:       SubstrateSpec{SecretsEncryption: &SecretsEncryptionSpec{KeyName: keyName}},
+		}
+		if err := substrate.Validate(ctx); err == nil {
+			t.Errorf("expected key name %q to fail validation", keyName)
+		}
+	}
+}
+
+func TestNodeLabelsValidation(t *testing.T) {
+	ctx := context.Background()
+	substrate := &Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node-labels"},
+		Spec: SubstrateSpec{NodeLabels: map[string]string{
+			"tier": "iteration",
+			"node.kubernetes.io/exclude-from-external-load-balancers": "",
+			"topology.kubernetes.io/zone":                             "us-west-2a",
+			"node-role.kubernetes.io/substrate":                       "",
+		}},
+	}
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if labels := substrate.NodeRoleLabels(); len(labels) != 1 {
+		t.Errorf("expected the node-role label to be applied through the API, got %v", labels)
+	}
+	if _, ok := substrate.KubeletNodeLabels()["node-role.kubernetes.io/substrate"]; ok {
+		t.Errorf("expected the kubelet not to register the node-role label")
+	}
+	for _, spec := range []SubstrateSpec{
+		{NodeLabels: map[string]string{"kit.aws/substrate": "worker"}},
+		{NodeLabels: map[string]string{"not a key": "value"}},
+		{NodeLabels: map[string]string{"tier": "not a value"}},
+		{NodeLabels: map[string]string{"kubernetes.io/experiment": "churn"}},
+		{NodeLabels: map[string]string{"k8s.io/experiment": "churn"}},
+		{NodeLabels: map[string]string{"kit.kubernetes.io/experiment": "churn"}},
+		{NodeTaints: []v1.Taint{{Key: "dedicated", Effect: "Evict"}}},
+		{NodeTaints: []v1.Taint{{Key: "-dedicated", Effect: v1.TaintEffectNoExecute}}},
+	} {
+		invalid := &Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-node-labels"}, Spec: spec}
+		if err := invalid.Validate(ctx); err == nil {
+			t.Errorf("expected %+v to fail validation", spec)
+		}
+	}
+}
+
+func TestInstanceTypeValidation(t *testing.T) {
+	substrate := &Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	for _, instanceType := range []string{"t4g.nano", "r6g.medium", "m6gd.16xlarge", "c7g.metal", "a1.large", "i4g.2xlarge", "c8g.48xlarge", "x8g.large", "im4gn.xlarge"} {
+		substrate.Spec.InstanceType = &instanceType
+		if err := substrate.Validate(context.Background()); err != nil {
+			t.Errorf("expected instance type %s to be valid, %v", instanceType, err)
+		}
+	}
+	for instanceType, message := range map[string]string{
+		"t4g.mediumm": "must be a size of t4g, i.e. t4g.medium, t4g.large or t4g.2xlarge",
+		"t4g.1xlarge": "must be a size of t4g",
+		"t3.medium":   "must be an arm64 instance type, i.e. one of the families [t4g]",
+		"m6i.large":   "must be an arm64 instance type",
+		"r6g":         "one of the families [r6g r6gd r7g r7gd r8g]",
+		"":            "one of the families [t4g m6g c6g r6g]",
+	} {
+		substrate.Spec.InstanceType = &instanceType
+		if err := substrate.Validate(context.Background()); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expected instance type %q to fail validation with %q, got %v", instanceType, message, err)
+		}
+	}
+}
+
+func TestSubnetValidation(t *testing.T) {
+	substrate := &Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec: SubstrateSpec{
+			VPC: &VPCSpec{CIDR: "10.0.0.0/16"},
+			Subnets: []*SubnetSpec{
+				{Zone: "us-west-2a", CIDR: "10.0.1.0/24"},
+				{Zone: "us-west-2a", CIDR: "10.0.100.0/24", Public: true},
+				{Zone: "us-west-2b", CIDR: "10.0.101.0/24", Public: true},
+			},
+		},
+	}
+	substrate.SetDefaults(context.Background())
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	for _, test := range []struct {
+		subnet   *SubnetSpec
+		messages []string
+	}{
+		{&SubnetSpec{Zone: "us-west-2b", CIDR: "10.1.0.0/24"}, []string{"subnet 10.1.0.0/24 in us-west-2b is outside the VPC CIDR 10.0.0.0/16", "spec.subnets[3].cidr"}},
+		{&SubnetSpec{Zone: "us-west-2b", CIDR: "10.0.0.0/8"}, []string{"outside the VPC CIDR", "overlaps subnets[0] 10.0.1.0/24"}},
+		{&SubnetSpec{Zone: "us-west-2b", CIDR: "10.0.1.128/25"}, []string{"subnet 10.0.1.128/25 in us-west-2b overlaps subnets[0] 10.0.1.0/24"}},
+		{&SubnetSpec{Zone: "us-west-2a", CIDR: "10.0.2.0/24"}, []string{"subnet 10.0.2.0/24 in us-west-2a is the zone's second private subnet after subnets[0]", "spec.subnets[3].zone"}},
+		{&SubnetSpec{Zone: "us-west-2b", CIDR: "10.0.1"}, []string{"subnet 10.0.1 in us-west-2b must be an IPv4 CIDR"}},
+	} {
+		invalid := substrate.DeepCopy()
+		invalid.Spec.Subnets = append(invalid.Spec.Subnets, test.subnet)
+		err := invalid.Validate(context.Background())
+		if err == nil {
+			t.Errorf("expected subnet %s in %s to fail validation", test.subnet.CIDR, test.subnet.Zone)
+			continue
+		}
+		for _, message := range test.messages {
+			if !strings.Contains(err.Error(), message) {
+				t.Errorf("expected %q in the error, got %v", message, err)
+			}
+		}
+	}
+}
+
+func TestDHCPOptionsValidation(t *testing.T) {
+	for _, options := range []*DHCPOptionsSpec{
+		{},
+		{DomainName: "Not A Domain"},
+		{DomainNameServers: []string{"dns.example.com"}},
+		{NTPServers: []string{"AmazonProvidedDNS"}},
+		{DomainNameServers: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}},
+	} {
+		substrate := &Substrate{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+			Spec:       SubstrateSpec{DHCPOptions: options},
+		}
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected %+v to fail validation", options)
+		}
+	}
+}
+
+func TestFlowLogsValidation(t *testing.T) {
+	substrate := &Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec: SubstrateSpec{FlowLogs: &FlowLogsSpec{
+			DestinationType: ec2.LogDestinationTypeCloudWatchLogs,
+			RetentionInDays: aws.Int64(2),
+		}},
+	}
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected missing permission and invalid retention to fail validation")
+	}
+}
+
+func TestSecurityGroupEgressValidation(t *testing.T) {
+	for _, egress := range [][]EgressRuleSpec{
+		// Without HTTPS the node can't reach S3 or ECR
+		{{CIDR: "10.0.0.0/8", Port: aws.Int64(3128)}},
+		{{Port: aws.Int64(443)}},
+		{{CIDR: "10.0.0.0/8", PrefixListID: "pl-63a5400a"}},
+		{{CIDR: "fd00::/8"}},
+		{{CIDR: "0.0.0.0/0", Protocol: "icmp"}},
+	} {
+		substrate := &Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}, Spec: SubstrateSpec{Egress: egress}}
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected egress %v to fail validation", egress)
+		}
+	}
+}
+
+func TestHostnameValidation(t *testing.T) {
+	for _, hostname := range []*HostnameSpec{
+		{Strategy: "Unknown"},
+		{Strategy: HostnameStrategyTemplate},
+		{Strategy: HostnameStrategyTemplate, Template: "{{.Name"},
+		{Strategy: HostnameStrategyTemplate, Template: "{{.Name}}_{{.Ordinal}}"},
+		{Strategy: HostnameStrategyPrivateDNSName, Template: "{{.Name}}"},
+	} {
+		substrate := &Substrate{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-hostname-validation"},
+			Spec:       SubstrateSpec{Hostname: hostname},
+		}
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected hostname %v to be invalid", *hostname)
+		}
+	}
+}
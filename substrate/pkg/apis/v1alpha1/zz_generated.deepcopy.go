@@ -20,10 +20,92 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	"knative.dev/pkg/apis"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditLogSpec) DeepCopyInto(out *AuditLogSpec) {
+	*out = *in
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxBackup != nil {
+		in, out := &in.MaxBackup, &out.MaxBackup
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditLogSpec.
+func (in *AuditLogSpec) DeepCopy() *AuditLogSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditLogSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthCacheSpec) DeepCopyInto(out *AuthCacheSpec) {
+	*out = *in
+	if in.TokenWebhookTTL != nil {
+		in, out := &in.TokenWebhookTTL, &out.TokenWebhookTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.AuthorizedTTL != nil {
+		in, out := &in.AuthorizedTTL, &out.AuthorizedTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.UnauthorizedTTL != nil {
+		in, out := &in.UnauthorizedTTL, &out.UnauthorizedTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthCacheSpec.
+func (in *AuthCacheSpec) DeepCopy() *AuthCacheSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthCacheSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterInfoSpec) DeepCopyInto(out *ClusterInfoSpec) {
+	*out = *in
+	if in.BootstrapTokens != nil {
+		in, out := &in.BootstrapTokens, &out.BootstrapTokens
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterInfoSpec.
+func (in *ClusterInfoSpec) DeepCopy() *ClusterInfoSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterInfoSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 	*out = *in
@@ -42,6 +124,44 @@ func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.ImageID != nil {
+		in, out := &in.ImageID, &out.ImageID
+		*out = new(string)
+		**out = **in
+	}
+	if in.KubeConfigURL != nil {
+		in, out := &in.KubeConfigURL, &out.KubeConfigURL
+		*out = new(string)
+		**out = **in
+	}
+	if in.KubeConfigURLExpiry != nil {
+		in, out := &in.KubeConfigURLExpiry, &out.KubeConfigURLExpiry
+		*out = (*in).DeepCopy()
+	}
+	if in.SecretsEncryptionKey != nil {
+		in, out := &in.SecretsEncryptionKey, &out.SecretsEncryptionKey
+		*out = new(string)
+		**out = **in
+	}
+	if in.ServiceAccountKey != nil {
+		in, out := &in.ServiceAccountKey, &out.ServiceAccountKey
+		*out = new(string)
+		**out = **in
+	}
+	if in.ConfigLocations != nil {
+		in, out := &in.ConfigLocations, &out.ConfigLocations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.WarmPool != nil {
+		in, out := &in.WarmPool, &out.WarmPool
+		*out = new(WarmPoolStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CertificateExpiry != nil {
+		in, out := &in.CertificateExpiry, &out.CertificateExpiry
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStatus.
@@ -54,6 +174,161 @@ func (in *ClusterStatus) DeepCopy() *ClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentArgsSpec) DeepCopyInto(out *ComponentArgsSpec) {
+	*out = *in
+	if in.APIServer != nil {
+		in, out := &in.APIServer, &out.APIServer
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ControllerManager != nil {
+		in, out := &in.ControllerManager, &out.ControllerManager
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Scheduler != nil {
+		in, out := &in.Scheduler, &out.Scheduler
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Etcd != nil {
+		in, out := &in.Etcd, &out.Etcd
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Kubelet != nil {
+		in, out := &in.Kubelet, &out.Kubelet
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentArgsSpec.
+func (in *ComponentArgsSpec) DeepCopy() *ComponentArgsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentArgsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DHCPOptionsSpec) DeepCopyInto(out *DHCPOptionsSpec) {
+	*out = *in
+	if in.DomainNameServers != nil {
+		in, out := &in.DomainNameServers, &out.DomainNameServers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NTPServers != nil {
+		in, out := &in.NTPServers, &out.NTPServers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DHCPOptionsSpec.
+func (in *DHCPOptionsSpec) DeepCopy() *DHCPOptionsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DHCPOptionsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressRuleSpec) DeepCopyInto(out *EgressRuleSpec) {
+	*out = *in
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressRuleSpec.
+func (in *EgressRuleSpec) DeepCopy() *EgressRuleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressRuleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EtcdBackupSpec) DeepCopyInto(out *EtcdBackupSpec) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdBackupSpec.
+func (in *EtcdBackupSpec) DeepCopy() *EtcdBackupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EtcdBackupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlowLogsSpec) DeepCopyInto(out *FlowLogsSpec) {
+	*out = *in
+	if in.Destination != nil {
+		in, out := &in.Destination, &out.Destination
+		*out = new(string)
+		**out = **in
+	}
+	if in.DeliverLogsPermissionARN != nil {
+		in, out := &in.DeliverLogsPermissionARN, &out.DeliverLogsPermissionARN
+		*out = new(string)
+		**out = **in
+	}
+	if in.RetentionInDays != nil {
+		in, out := &in.RetentionInDays, &out.RetentionInDays
+		*out = new(int64)
+		**out = **in
+	}
+	if in.TrafficType != nil {
+		in, out := &in.TrafficType, &out.TrafficType
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlowLogsSpec.
+func (in *FlowLogsSpec) DeepCopy() *FlowLogsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FlowLogsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InfrastructureStatus) DeepCopyInto(out *InfrastructureStatus) {
 	*out = *in
@@ -87,6 +362,21 @@ func (in *InfrastructureStatus) DeepCopyInto(out *InfrastructureStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.FlowLogID != nil {
+		in, out := &in.FlowLogID, &out.FlowLogID
+		*out = new(string)
+		**out = **in
+	}
+	if in.DHCPOptionsID != nil {
+		in, out := &in.DHCPOptionsID, &out.DHCPOptionsID
+		*out = new(string)
+		**out = **in
+	}
+	if in.NATGatewayIDs != nil {
+		in, out := &in.NATGatewayIDs, &out.NATGatewayIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfrastructureStatus.
@@ -99,6 +389,36 @@ func (in *InfrastructureStatus) DeepCopy() *InfrastructureStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretsEncryptionSpec) DeepCopyInto(out *SecretsEncryptionSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretsEncryptionSpec.
+func (in *SecretsEncryptionSpec) DeepCopy() *SecretsEncryptionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretsEncryptionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountKeySpec) DeepCopyInto(out *ServiceAccountKeySpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountKeySpec.
+func (in *ServiceAccountKeySpec) DeepCopy() *ServiceAccountKeySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountKeySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SubnetSpec) DeepCopyInto(out *SubnetSpec) {
 	*out = *in
@@ -165,6 +485,249 @@ func (in *SubstrateSpec) DeepCopyInto(out *SubstrateSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.DetailedMonitoring != nil {
+		in, out := &in.DetailedMonitoring, &out.DetailedMonitoring
+		*out = new(bool)
+		**out = **in
+	}
+	if in.WarmPool != nil {
+		in, out := &in.WarmPool, &out.WarmPool
+		*out = new(WarmPoolSpec)
+		**out = **in
+	}
+	if in.Bottlerocket != nil {
+		in, out := &in.Bottlerocket, &out.Bottlerocket
+		*out = new(BottlerocketSpec)
+		**out = **in
+	}
+	if in.NodeLabels != nil {
+		in, out := &in.NodeLabels, &out.NodeLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.NodeTaints != nil {
+		in, out := &in.NodeTaints, &out.NodeTaints
+		*out = make([]v1.Taint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BucketKMSKeyARN != nil {
+		in, out := &in.BucketKMSKeyARN, &out.BucketKMSKeyARN
+		*out = new(string)
+		**out = **in
+	}
+	if in.BucketTransferAcceleration != nil {
+		in, out := &in.BucketTransferAcceleration, &out.BucketTransferAcceleration
+		*out = new(bool)
+		**out = **in
+	}
+	if in.FlowLogs != nil {
+		in, out := &in.FlowLogs, &out.FlowLogs
+		*out = new(FlowLogsSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EventTTL != nil {
+		in, out := &in.EventTTL, &out.EventTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.KubeConfigEndpoint != nil {
+		in, out := &in.KubeConfigEndpoint, &out.KubeConfigEndpoint
+		*out = new(string)
+		**out = **in
+	}
+	if in.APIServerPort != nil {
+		in, out := &in.APIServerPort, &out.APIServerPort
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AdditionalCertSANs != nil {
+		in, out := &in.AdditionalCertSANs, &out.AdditionalCertSANs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CertificateRenewBefore != nil {
+		in, out := &in.CertificateRenewBefore, &out.CertificateRenewBefore
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ForceCertificateRenewal != nil {
+		in, out := &in.ForceCertificateRenewal, &out.ForceCertificateRenewal
+		*out = (*in).DeepCopy()
+	}
+	if in.ElasticIPAllocationID != nil {
+		in, out := &in.ElasticIPAllocationID, &out.ElasticIPAllocationID
+		*out = new(string)
+		**out = **in
+	}
+	if in.Region != nil {
+		in, out := &in.Region, &out.Region
+		*out = new(string)
+		**out = **in
+	}
+	if in.ReplicaBucket != nil {
+		in, out := &in.ReplicaBucket, &out.ReplicaBucket
+		*out = new(ReplicaBucketSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UploadTimeout != nil {
+		in, out := &in.UploadTimeout, &out.UploadTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.KubeConfigURLTTL != nil {
+		in, out := &in.KubeConfigURLTTL, &out.KubeConfigURLTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.AuditLog != nil {
+		in, out := &in.AuditLog, &out.AuditLog
+		*out = new(AuditLogSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ComponentSidecars != nil {
+		in, out := &in.ComponentSidecars, &out.ComponentSidecars
+		*out = make(map[string][]v1.Container, len(*in))
+		for key, val := range *in {
+			var outVal []v1.Container
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]v1.Container, len(*in))
+				for i := range *in {
+					(*in)[i].DeepCopyInto(&(*out)[i])
+				}
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.ComponentArgs != nil {
+		in, out := &in.ComponentArgs, &out.ComponentArgs
+		*out = new(ComponentArgsSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Schedulers != nil {
+		in, out := &in.Schedulers, &out.Schedulers
+		*out = make([]SchedulerSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.AnonymousAuth != nil {
+		in, out := &in.AnonymousAuth, &out.AnonymousAuth
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ClientCertAuth != nil {
+		in, out := &in.ClientCertAuth, &out.ClientCertAuth
+		*out = new(bool)
+		**out = **in
+	}
+	if in.EnableBootstrapTokenAuth != nil {
+		in, out := &in.EnableBootstrapTokenAuth, &out.EnableBootstrapTokenAuth
+		*out = new(bool)
+		**out = **in
+	}
+	if in.EnableIAMAuthenticator != nil {
+		in, out := &in.EnableIAMAuthenticator, &out.EnableIAMAuthenticator
+		*out = new(bool)
+		**out = **in
+	}
+	if in.RuntimeConfig != nil {
+		in, out := &in.RuntimeConfig, &out.RuntimeConfig
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.AuthCache != nil {
+		in, out := &in.AuthCache, &out.AuthCache
+		*out = new(AuthCacheSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretsEncryption != nil {
+		in, out := &in.SecretsEncryption, &out.SecretsEncryption
+		*out = new(SecretsEncryptionSpec)
+		**out = **in
+	}
+	if in.DHCPOptions != nil {
+		in, out := &in.DHCPOptions, &out.DHCPOptions
+		*out = new(DHCPOptionsSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccountExtendTokenExpiration != nil {
+		in, out := &in.ServiceAccountExtendTokenExpiration, &out.ServiceAccountExtendTokenExpiration
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ServiceAccountKey != nil {
+		in, out := &in.ServiceAccountKey, &out.ServiceAccountKey
+		*out = new(ServiceAccountKeySpec)
+		**out = **in
+	}
+	if in.Hostname != nil {
+		in, out := &in.Hostname, &out.Hostname
+		*out = new(HostnameSpec)
+		**out = **in
+	}
+	if in.RequestHeader != nil {
+		in, out := &in.RequestHeader, &out.RequestHeader
+		*out = new(RequestHeaderSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OIDC != nil {
+		in, out := &in.OIDC, &out.OIDC
+		*out = new(OIDCSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WatchCacheEnabled != nil {
+		in, out := &in.WatchCacheEnabled, &out.WatchCacheEnabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.WatchCacheSizes != nil {
+		in, out := &in.WatchCacheSizes, &out.WatchCacheSizes
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.HTTP2MaxStreamsPerConnection != nil {
+		in, out := &in.HTTP2MaxStreamsPerConnection, &out.HTTP2MaxStreamsPerConnection
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FeatureGates != nil {
+		in, out := &in.FeatureGates, &out.FeatureGates
+		*out = make(map[string]bool, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ClusterInfo != nil {
+		in, out := &in.ClusterInfo, &out.ClusterInfo
+		*out = new(ClusterInfoSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Egress != nil {
+		in, out := &in.Egress, &out.Egress
+		*out = make([]EgressRuleSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EtcdBackup != nil {
+		in, out := &in.EtcdBackup, &out.EtcdBackup
+		*out = new(EtcdBackupSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EgressSelector != nil {
+		in, out := &in.EgressSelector, &out.EgressSelector
+		*out = new(EgressSelectorSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubstrateSpec.
@@ -215,3 +778,183 @@ func (in *VPCSpec) DeepCopy() *VPCSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequestHeaderSpec) DeepCopyInto(out *RequestHeaderSpec) {
+	*out = *in
+	if in.AllowedNames != nil {
+		in, out := &in.AllowedNames, &out.AllowedNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.UsernameHeaders != nil {
+		in, out := &in.UsernameHeaders, &out.UsernameHeaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.GroupHeaders != nil {
+		in, out := &in.GroupHeaders, &out.GroupHeaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExtraHeadersPrefix != nil {
+		in, out := &in.ExtraHeadersPrefix, &out.ExtraHeadersPrefix
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequestHeaderSpec.
+func (in *RequestHeaderSpec) DeepCopy() *RequestHeaderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RequestHeaderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OIDCSpec) DeepCopyInto(out *OIDCSpec) {
+	*out = *in
+	if in.SigningAlgs != nil {
+		in, out := &in.SigningAlgs, &out.SigningAlgs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OIDCSpec.
+func (in *OIDCSpec) DeepCopy() *OIDCSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OIDCSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicaBucketSpec) DeepCopyInto(out *ReplicaBucketSpec) {
+	*out = *in
+	if in.Region != nil {
+		in, out := &in.Region, &out.Region
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicaBucketSpec.
+func (in *ReplicaBucketSpec) DeepCopy() *ReplicaBucketSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicaBucketSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchedulerSpec) DeepCopyInto(out *SchedulerSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchedulerSpec.
+func (in *SchedulerSpec) DeepCopy() *SchedulerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SchedulerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WarmPoolSpec) DeepCopyInto(out *WarmPoolSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WarmPoolSpec.
+func (in *WarmPoolSpec) DeepCopy() *WarmPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WarmPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WarmPoolStatus) DeepCopyInto(out *WarmPoolStatus) {
+	*out = *in
+	if in.ClaimedInstanceID != nil {
+		in, out := &in.ClaimedInstanceID, &out.ClaimedInstanceID
+		*out = new(string)
+		**out = **in
+	}
+	if in.IdleInstanceIDs != nil {
+		in, out := &in.IdleInstanceIDs, &out.IdleInstanceIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WarmPoolStatus.
+func (in *WarmPoolStatus) DeepCopy() *WarmPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WarmPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BottlerocketSpec) DeepCopyInto(out *BottlerocketSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BottlerocketSpec.
+func (in *BottlerocketSpec) DeepCopy() *BottlerocketSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BottlerocketSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressSelectorSpec) DeepCopyInto(out *EgressSelectorSpec) {
+	*out = *in
+	if in.Selections != nil {
+		in, out := &in.Selections, &out.Selections
+		*out = make([]EgressSelectionSpec, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressSelectorSpec.
+func (in *EgressSelectorSpec) DeepCopy() *EgressSelectorSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressSelectorSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressSelectionSpec) DeepCopyInto(out *EgressSelectionSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressSelectionSpec.
+func (in *EgressSelectionSpec) DeepCopy() *EgressSelectionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressSelectionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
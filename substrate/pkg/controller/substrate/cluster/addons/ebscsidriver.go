@@ -0,0 +1,297 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/apiclient"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	ebsCSIDriverName            = "ebs.csi.aws.com"
+	ebsCSIControllerName        = "ebs-csi-controller"
+	ebsCSINodeName              = "ebs-csi-node"
+	ebsCSIServiceAccountName    = "ebs-csi-controller-sa"
+	ebsCSIDriverImage           = "public.ecr.aws/ebs-csi-driver/aws-ebs-csi-driver:v1.5.0"
+	csiProvisionerImage         = "k8s.gcr.io/sig-storage/csi-provisioner:v3.0.0"
+	csiAttacherImage            = "k8s.gcr.io/sig-storage/csi-attacher:v3.3.0"
+	csiNodeDriverRegistrarImage = "k8s.gcr.io/sig-storage/csi-node-driver-registrar:v2.4.0"
+	defaultStorageClassName     = "gp3"
+	kubeletDir                  = "/var/lib/kubelet"
+)
+
+// EBSCSIDriver installs the EBS CSI driver and a default gp3 StorageClass.
+// The driver authenticates with the substrate node's instance profile.
+type EBSCSIDriver struct {
+}
+
+func (e *EBSCSIDriver) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	if !substrate.Spec.EBSCSIDriver {
+		return reconcile.Result{}, nil
+	}
+	if !substrate.IsReady() {
+		return reconcile.Result{Requeue: true}, nil
+	}
+	client, err := kubeconfig.ClientSetFromFile(*substrate.Status.Cluster.KubeConfig)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("creating client, %w", err)
+	}
+	if err := ensureEBSCSIDriver(ctx, client); err != nil {
+		return reconcile.Result{Requeue: true}, fmt.Errorf("ensuring ebs csi driver addon, %w", err)
+	}
+	logging.FromContext(ctx).Infof("Ensured EBS CSI driver and %s storage class", defaultStorageClassName)
+	return reconcile.Result{}, nil
+}
+
+func (e *EBSCSIDriver) Delete(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	if !substrate.Spec.EBSCSIDriver || substrate.Status.Cluster.KubeConfig == nil {
+		return reconcile.Result{}, nil
+	}
+	client, err := kubeconfig.ClientSetFromFile(*substrate.Status.Cluster.KubeConfig)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("creating client, %w", err)
+	}
+	if err := removeEBSCSIDriver(ctx, client); err != nil {
+		return reconcile.Result{}, fmt.Errorf("removing ebs csi driver addon, %w", err)
+	}
+	logging.FromContext(ctx).Infof("Deleted EBS CSI driver and %s storage class", defaultStorageClassName)
+	return reconcile.Result{}, nil
+}
+
+func ensureEBSCSIDriver(ctx context.Context, client clientset.Interface) error {
+	if err := createOrRetainCSIDriver(ctx, client); err != nil {
+		return fmt.Errorf("ensuring csi driver, %w", err)
+	}
+	if err := apiclient.CreateOrUpdateServiceAccount(client, &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: ebsCSIServiceAccountName, Namespace: metav1.NamespaceSystem},
+	}); err != nil {
+		return fmt.Errorf("ensuring service account, %w", err)
+	}
+	if err := apiclient.CreateOrUpdateClusterRole(client, ebsCSIControllerClusterRole()); err != nil {
+		return fmt.Errorf("ensuring cluster role, %w", err)
+	}
+	if err := apiclient.CreateOrUpdateClusterRoleBinding(client, &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: ebsCSIControllerName},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: ebsCSIControllerName},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: ebsCSIServiceAccountName, Namespace: metav1.NamespaceSystem}},
+	}); err != nil {
+		return fmt.Errorf("ensuring cluster role binding, %w", err)
+	}
+	if err := apiclient.CreateOrUpdateDeployment(client, ebsCSIControllerDeployment()); err != nil {
+		return fmt.Errorf("ensuring controller deployment, %w", err)
+	}
+	if err := apiclient.CreateOrUpdateDaemonSet(client, ebsCSINodeDaemonSet()); err != nil {
+		return fmt.Errorf("ensuring node daemonset, %w", err)
+	}
+	if err := createOrRetainStorageClass(ctx, client); err != nil {
+		return fmt.Errorf("ensuring storage class, %w", err)
+	}
+	return nil
+}
+
+func removeEBSCSIDriver(ctx context.Context, client clientset.Interface) error {
+	for _, remove := range []func() error{
+		func() error {
+			return client.StorageV1().StorageClasses().Delete(ctx, defaultStorageClassName, metav1.DeleteOptions{})
+		},
+		func() error {
+			return apiclient.DeleteDaemonSetForeground(client, metav1.NamespaceSystem, ebsCSINodeName)
+		},
+		func() error {
+			return apiclient.DeleteDeploymentForeground(client, metav1.NamespaceSystem, ebsCSIControllerName)
+		},
+		func() error {
+			return client.RbacV1().ClusterRoleBindings().Delete(ctx, ebsCSIControllerName, metav1.DeleteOptions{})
+		},
+		func() error {
+			return client.RbacV1().ClusterRoles().Delete(ctx, ebsCSIControllerName, metav1.DeleteOptions{})
+		},
+		func() error {
+			return client.CoreV1().ServiceAccounts(metav1.NamespaceSystem).Delete(ctx, ebsCSIServiceAccountName, metav1.DeleteOptions{})
+		},
+		func() error {
+			return client.StorageV1().CSIDrivers().Delete(ctx, ebsCSIDriverName, metav1.DeleteOptions{})
+		},
+	} {
+		if err := remove(); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// CSIDriver and StorageClass specs are immutable, so existing objects are retained as is
+func createOrRetainCSIDriver(ctx context.Context, client clientset.Interface) error {
+	driver := &storagev1.CSIDriver{
+		ObjectMeta: metav1.ObjectMeta{Name: ebsCSIDriverName},
+		Spec: storagev1.CSIDriverSpec{
+			AttachRequired: aws.Bool(true),
+			PodInfoOnMount: aws.Bool(false),
+		},
+	}
+	if _, err := client.StorageV1().CSIDrivers().Create(ctx, driver, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func createOrRetainStorageClass(ctx context.Context, client clientset.Interface) error {
+	bindingMode := storagev1.VolumeBindingWaitForFirstConsumer
+	storageClass := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        defaultStorageClassName,
+			Annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "true"},
+		},
+		Provisioner:       ebsCSIDriverName,
+		Parameters:        map[string]string{"type": "gp3", "encrypted": "true"},
+		VolumeBindingMode: &bindingMode,
+	}
+	if _, err := client.StorageV1().StorageClasses().Create(ctx, storageClass, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func ebsCSIControllerClusterRole() *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: ebsCSIControllerName},
+		Rules: []rbacv1.PolicyRule{
+			// external-provisioner
+			{APIGroups: []string{""}, Resources: []string{"persistentvolumes"}, Verbs: []string{"get", "list", "watch", "create", "delete"}},
+			{APIGroups: []string{""}, Resources: []string{"persistentvolumeclaims"}, Verbs: []string{"get", "list", "watch", "update"}},
+			{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"list", "watch", "create", "update", "patch"}},
+			{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{"storage.k8s.io"}, Resources: []string{"storageclasses", "csinodes"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{"coordination.k8s.io"}, Resources: []string{"leases"}, Verbs: []string{"get", "watch", "list", "delete", "update", "create"}},
+			// external-attacher
+			{APIGroups: []string{""}, Resources: []string{"persistentvolumes"}, Verbs: []string{"patch", "update"}},
+			{APIGroups: []string{"storage.k8s.io"}, Resources: []string{"volumeattachments"}, Verbs: []string{"get", "list", "watch", "update", "patch"}},
+			{APIGroups: []string{"storage.k8s.io"}, Resources: []string{"volumeattachments/status"}, Verbs: []string{"patch"}},
+		},
+	}
+}
+
+func ebsCSIControllerDeployment() *appsv1.Deployment {
+	labels := map[string]string{"app": ebsCSIControllerName}
+	socketDir := v1.VolumeMount{Name: "socket-dir", MountPath: "/var/lib/csi/sockets/pluginproxy/"}
+	csiAddress := "--csi-address=$(ADDRESS)"
+	address := v1.EnvVar{Name: "ADDRESS", Value: "/var/lib/csi/sockets/pluginproxy/csi.sock"}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: ebsCSIControllerName, Namespace: metav1.NamespaceSystem},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: aws.Int32(1),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					ServiceAccountName: ebsCSIServiceAccountName,
+					PriorityClassName:  "system-cluster-critical",
+					Tolerations:        []v1.Toleration{{Operator: v1.TolerationOpExists}},
+					Containers: []v1.Container{{
+						Name:  "ebs-plugin",
+						Image: ebsCSIDriverImage,
+						Args:  []string{"controller", "--endpoint=$(CSI_ENDPOINT)", "--logtostderr", "--v=2"},
+						Env: []v1.EnvVar{
+							{Name: "CSI_ENDPOINT", Value: "unix:///var/lib/csi/sockets/pluginproxy/csi.sock"},
+							{Name: "CSI_NODE_NAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}},
+						},
+						VolumeMounts: []v1.VolumeMount{socketDir},
+					}, {
+						Name:         "csi-provisioner",
+						Image:        csiProvisionerImage,
+						Args:         []string{csiAddress, "--v=2", "--feature-gates=Topology=true", "--extra-create-metadata", "--leader-election=true", "--default-fstype=ext4"},
+						Env:          []v1.EnvVar{address},
+						VolumeMounts: []v1.VolumeMount{socketDir},
+					}, {
+						Name:         "csi-attacher",
+						Image:        csiAttacherImage,
+						Args:         []string{csiAddress, "--v=2", "--leader-election=true"},
+						Env:          []v1.EnvVar{address},
+						VolumeMounts: []v1.VolumeMount{socketDir},
+					}},
+					Volumes: []v1.Volume{{Name: "socket-dir", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}},
+				},
+			},
+		},
+	}
+}
+
+func ebsCSINodeDaemonSet() *appsv1.DaemonSet {
+	labels := map[string]string{"app": ebsCSINodeName}
+	bidirectional := v1.MountPropagationBidirectional
+	directory := v1.HostPathDirectory
+	directoryOrCreate := v1.HostPathDirectoryOrCreate
+	pluginDir := kubeletDir + "/plugins/" + ebsCSIDriverName + "/"
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: ebsCSINodeName, Namespace: metav1.NamespaceSystem},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					PriorityClassName: "system-node-critical",
+					Tolerations:       []v1.Toleration{{Operator: v1.TolerationOpExists}},
+					Containers: []v1.Container{{
+						Name:            "ebs-plugin",
+						Image:           ebsCSIDriverImage,
+						Args:            []string{"node", "--endpoint=$(CSI_ENDPOINT)", "--logtostderr", "--v=2"},
+						SecurityContext: &v1.SecurityContext{Privileged: aws.Bool(true)},
+						Env: []v1.EnvVar{
+							{Name: "CSI_ENDPOINT", Value: "unix:/csi/csi.sock"},
+							{Name: "CSI_NODE_NAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}},
+						},
+						VolumeMounts: []v1.VolumeMount{
+							{Name: "kubelet-dir", MountPath: kubeletDir, MountPropagation: &bidirectional},
+							{Name: "plugin-dir", MountPath: "/csi"},
+							{Name: "device-dir", MountPath: "/dev"},
+						},
+					}, {
+						Name:  "node-driver-registrar",
+						Image: csiNodeDriverRegistrarImage,
+						Args:  []string{"--csi-address=$(ADDRESS)", "--kubelet-registration-path=$(DRIVER_REG_SOCK_PATH)", "--v=2"},
+						Env: []v1.EnvVar{
+							{Name: "ADDRESS", Value: "/csi/csi.sock"},
+							{Name: "DRIVER_REG_SOCK_PATH", Value: pluginDir + "csi.sock"},
+						},
+						VolumeMounts: []v1.VolumeMount{
+							{Name: "plugin-dir", MountPath: "/csi"},
+							{Name: "registration-dir", MountPath: "/registration"},
+						},
+					}},
+					Volumes: []v1.Volume{
+						{Name: "kubelet-dir", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: kubeletDir, Type: &directory}}},
+						{Name: "plugin-dir", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: pluginDir, Type: &directoryOrCreate}}},
+						{Name: "registration-dir", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: kubeletDir + "/plugins_registry/", Type: &directory}}},
+						{Name: "device-dir", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/dev", Type: &directory}}},
+					},
+				},
+			},
+		},
+	}
+}
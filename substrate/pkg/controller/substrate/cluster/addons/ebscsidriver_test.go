@@ -0,0 +1,64 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEBSCSIDriver(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	if err := ensureEBSCSIDriver(ctx, client); err != nil {
+		t.Fatalf("ensuring ebs csi driver, %v", err)
+	}
+	// Ensuring is idempotent
+	if err := ensureEBSCSIDriver(ctx, client); err != nil {
+		t.Fatalf("ensuring ebs csi driver again, %v", err)
+	}
+	if _, err := client.StorageV1().CSIDrivers().Get(ctx, ebsCSIDriverName, metav1.GetOptions{}); err != nil {
+		t.Errorf("getting csi driver, %v", err)
+	}
+	if _, err := client.AppsV1().Deployments(metav1.NamespaceSystem).Get(ctx, ebsCSIControllerName, metav1.GetOptions{}); err != nil {
+		t.Errorf("getting controller deployment, %v", err)
+	}
+	if _, err := client.AppsV1().DaemonSets(metav1.NamespaceSystem).Get(ctx, ebsCSINodeName, metav1.GetOptions{}); err != nil {
+		t.Errorf("getting node daemonset, %v", err)
+	}
+	storageClass, err := client.StorageV1().StorageClasses().Get(ctx, defaultStorageClassName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting storage class, %v", err)
+	}
+	if storageClass.Provisioner != ebsCSIDriverName {
+		t.Errorf("expected provisioner %s, got %s", ebsCSIDriverName, storageClass.Provisioner)
+	}
+	if storageClass.Parameters["type"] != "gp3" {
+		t.Errorf("expected volume type gp3, got %s", storageClass.Parameters["type"])
+	}
+	if err := removeEBSCSIDriver(ctx, client); err != nil {
+		t.Fatalf("removing ebs csi driver, %v", err)
+	}
+	if _, err := client.StorageV1().StorageClasses().Get(ctx, defaultStorageClassName, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected storage class to be removed, got %v", err)
+	}
+	if _, err := client.StorageV1().CSIDrivers().Get(ctx, ebsCSIDriverName, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected csi driver to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/controller/substrate/cluster"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/cmd/kubeadm/app/images"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	etcdBackupName  = "etcd-backup"
+	awsCLIImage     = "public.ecr.aws/aws-cli/aws-cli:2.4.6"
+	etcdSnapshotDir = "/snapshots"
+	etcdPKIDir      = "/etc/kubernetes/pki/etcd"
+	// etcdSnapshotScript uploads the snapshot and deletes all but the most
+	// recent snapshots, snapshot keys are timestamps so they sort by age
+	etcdSnapshotScript = `set -euo pipefail
+aws s3 cp "${SNAPSHOT_DIR}/snapshot.db" "s3://${BUCKET}/${PREFIX}$(date -u +%Y%m%dT%H%M%SZ).db"
+aws s3 ls "s3://${BUCKET}/${PREFIX}" | awk '{print $4}' | sort | head -n -"${RETENTION}" | while read -r snapshot; do
+  aws s3 rm "s3://${BUCKET}/${PREFIX}${snapshot}"
+done`
+)
+
+// EtcdBackup runs a CronJob on the substrate node that snapshots etcd and
+// uploads the snapshot to the cluster configuration bucket. Failed backups
+// are reported by the Job's events and logged when the substrate is applied.
+type EtcdBackup struct {
+}
+
+func (e *EtcdBackup) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	if !substrate.IsReady() {
+		return reconcile.Result{Requeue: true}, nil
+	}
+	client, err := kubeconfig.ClientSetFromFile(*substrate.Status.Cluster.KubeConfig)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("creating client, %w", err)
+	}
+	if substrate.Spec.EtcdBackup == nil {
+		if err := client.BatchV1().CronJobs(metav1.NamespaceSystem).Delete(ctx, etcdBackupName, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return reconcile.Result{}, fmt.Errorf("deleting etcd backup cronjob, %w", err)
+		}
+		return reconcile.Result{}, nil
+	}
+	if err := ensureEtcdBackup(ctx, client, substrate); err != nil {
+		return reconcile.Result{}, fmt.Errorf("ensuring etcd backup, %w", err)
+	}
+	logging.FromContext(ctx).Infof("Ensured etcd backups every %s to s3://%s/%s",
+		substrate.Spec.EtcdBackup.Interval.Duration, aws.StringValue(discovery.BucketName(substrate)), cluster.EtcdSnapshotPrefix(substrate))
+	failed, err := lastEtcdBackupFailed(ctx, client)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if failed != "" {
+		logging.FromContext(ctx).Warnf("Latest etcd backup failed, see kubectl describe job -n %s %s", metav1.NamespaceSystem, failed)
+	}
+	return reconcile.Result{}, nil
+}
+
+func (e *EtcdBackup) Delete(_ context.Context, _ *v1alpha1.Substrate) (reconcile.Result, error) {
+	return reconcile.Result{}, nil
+}
+
+func ensureEtcdBackup(ctx context.Context, client clientset.Interface, substrate *v1alpha1.Substrate) error {
+	cronJob := etcdBackupCronJob(substrate)
+	existing, err := client.BatchV1().CronJobs(metav1.NamespaceSystem).Get(ctx, cronJob.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.BatchV1().CronJobs(metav1.NamespaceSystem).Create(ctx, cronJob, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	existing.Spec = cronJob.Spec
+	_, err = client.BatchV1().CronJobs(metav1.NamespaceSystem).Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+// lastEtcdBackupFailed returns the name of the most recent backup job if it failed
+func lastEtcdBackupFailed(ctx context.Context, client clientset.Interface) (string, error) {
+	jobs, err := client.BatchV1().Jobs(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{LabelSelector: "app=" + etcdBackupName})
+	if err != nil {
+		return "", fmt.Errorf("listing etcd backup jobs, %w", err)
+	}
+	var last *batchv1.Job
+	for i := range jobs.Items {
+		if last == nil || last.CreationTimestamp.Before(&jobs.Items[i].CreationTimestamp) {
+			last = &jobs.Items[i]
+		}
+	}
+	if last == nil || last.Status.Failed == 0 {
+		return "", nil
+	}
+	return last.Name, nil
+}
+
+func etcdBackupCronJob(substrate *v1alpha1.Substrate) *batchv1.CronJob {
+	labels := map[string]string{"app": etcdBackupName}
+	env := []v1.EnvVar{
+		{Name: "SNAPSHOT_DIR", Value: etcdSnapshotDir},
+		{Name: "BUCKET", Value: aws.StringValue(discovery.BucketName(substrate))},
+		{Name: "PREFIX", Value: cluster.EtcdSnapshotPrefix(substrate)},
+		{Name: "RETENTION", Value: fmt.Sprint(aws.Int32Value(substrate.Spec.EtcdBackup.Retention))},
+	}
+	if substrate.Spec.Region != nil {
+		env = append(env, v1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: aws.StringValue(substrate.Spec.Region)})
+	}
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: etcdBackupName, Namespace: metav1.NamespaceSystem, Labels: labels},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   fmt.Sprintf("@every %s", substrate.Spec.EtcdBackup.Interval.Duration),
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: aws.Int32(1),
+			FailedJobsHistoryLimit:     aws.Int32(3),
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: aws.Int32(1),
+					Template: v1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec: v1.PodSpec{
+							// etcd only listens on the substrate node's loopback address
+							HostNetwork:       true,
+							NodeSelector:      map[string]string{v1alpha1.SubstrateNodeLabelKey: "control-plane"},
+							Tolerations:       []v1.Toleration{{Operator: v1.TolerationOpExists}},
+							PriorityClassName: "system-cluster-critical",
+							RestartPolicy:     v1.RestartPolicyNever,
+							InitContainers: []v1.Container{{
+								Name:    "snapshot",
+								Image:   images.GetEtcdImage(&cluster.DefaultClusterConfig(substrate).ClusterConfiguration),
+								Command: []string{"etcdctl"},
+								Args: []string{
+									"snapshot", "save", etcdSnapshotDir + "/snapshot.db",
+									"--endpoints=https://127.0.0.1:2379",
+									"--cacert=" + etcdPKIDir + "/ca.crt",
+									"--cert=" + etcdPKIDir + "/healthcheck-client.crt",
+									"--key=" + etcdPKIDir + "/healthcheck-client.key",
+								},
+								Env: []v1.EnvVar{{Name: "ETCDCTL_API", Value: "3"}},
+								VolumeMounts: []v1.VolumeMount{
+									{Name: "etcd-certs", MountPath: etcdPKIDir, ReadOnly: true},
+									{Name: "snapshots", MountPath: etcdSnapshotDir},
+								},
+							}},
+							Containers: []v1.Container{{
+								Name:         "upload",
+								Image:        awsCLIImage,
+								Command:      []string{"/bin/bash", "-c", etcdSnapshotScript},
+								Env:          env,
+								VolumeMounts: []v1.VolumeMount{{Name: "snapshots", MountPath: etcdSnapshotDir, ReadOnly: true}},
+							}},
+							Volumes: []v1.Volume{{
+								Name:         "etcd-certs",
+								VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: etcdPKIDir}},
+							}, {
+								Name:         "snapshots",
+								VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEtcdBackup(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{EtcdBackup: &v1alpha1.EtcdBackupSpec{}},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if err := ensureEtcdBackup(ctx, client, substrate); err != nil {
+		t.Fatalf("ensuring etcd backup, %v", err)
+	}
+	// The interval is updated on an existing cronjob
+	substrate.Spec.EtcdBackup.Interval = &metav1.Duration{Duration: 30 * time.Minute}
+	if err := ensureEtcdBackup(ctx, client, substrate); err != nil {
+		t.Fatalf("ensuring etcd backup again, %v", err)
+	}
+	cronJob, err := client.BatchV1().CronJobs(metav1.NamespaceSystem).Get(ctx, etcdBackupName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting cronjob, %v", err)
+	}
+	if cronJob.Spec.Schedule != "@every 30m0s" {
+		t.Errorf("expected schedule @every 30m0s, got %s", cronJob.Spec.Schedule)
+	}
+	env := map[string]string{}
+	for _, e := range cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	for name, expected := range map[string]string{
+		"BUCKET":    "kit-test-substrate",
+		"PREFIX":    "tmp/kit-test-substrate/etcd-snapshots/",
+		"RETENTION": "24",
+	} {
+		if env[name] != expected {
+			t.Errorf("expected %s=%s, got %s", name, expected, env[name])
+		}
+	}
+
+	// Only the most recent job is reported
+	for _, job := range []*batchv1.Job{
+		{ObjectMeta: metav1.ObjectMeta{Name: "etcd-backup-1", CreationTimestamp: metav1.NewTime(time.Unix(1, 0))}, Status: batchv1.JobStatus{Failed: 1}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "etcd-backup-2", CreationTimestamp: metav1.NewTime(time.Unix(2, 0))}, Status: batchv1.JobStatus{Succeeded: 1}},
+	} {
+		job.Namespace = metav1.NamespaceSystem
+		job.Labels = map[string]string{"app": etcdBackupName}
+		if _, err := client.BatchV1().Jobs(metav1.NamespaceSystem).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("creating job, %v", err)
+		}
+	}
+	if failed, err := lastEtcdBackupFailed(ctx, client); err != nil || failed != "" {
+		t.Errorf("expected the latest backup to have succeeded, got %q, %v", failed, err)
+	}
+	if _, err := client.BatchV1().Jobs(metav1.NamespaceSystem).Create(ctx, &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd-backup-3", Namespace: metav1.NamespaceSystem, Labels: map[string]string{"app": etcdBackupName},
+			CreationTimestamp: metav1.NewTime(time.Unix(3, 0))},
+		Status: batchv1.JobStatus{Failed: 1},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("creating job, %v", err)
+	}
+	if failed, err := lastEtcdBackupFailed(ctx, client); err != nil || failed != "etcd-backup-3" {
+		t.Errorf("expected the latest backup etcd-backup-3 to have failed, got %q, %v", failed, err)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// NodeRoles labels the substrate node with the node-role labels of the spec,
+// the kubelet refuses to register them itself
+type NodeRoles struct {
+}
+
+func (n *NodeRoles) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	if !substrate.IsReady() {
+		return reconcile.Result{Requeue: true}, nil
+	}
+	labels := substrate.NodeRoleLabels()
+	if len(labels) == 0 {
+		return reconcile.Result{}, nil
+	}
+	client, err := kubeconfig.ClientSetFromFile(*substrate.Status.Cluster.KubeConfig)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("creating client, %w", err)
+	}
+	labeled, err := labelSubstrateNodes(ctx, client, labels)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	// The node may not have registered yet
+	return reconcile.Result{Requeue: labeled == 0}, nil
+}
+
+func (n *NodeRoles) Delete(_ context.Context, _ *v1alpha1.Substrate) (reconcile.Result, error) {
+	return reconcile.Result{}, nil
+}
+
+// labelSubstrateNodes patches the labels onto the nodes registered with the
+// substrate's label and returns how many there are
+func labelSubstrateNodes(ctx context.Context, client clientset.Interface, labels map[string]string) (int, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: v1alpha1.SubstrateNodeLabelKey + "=control-plane"})
+	if err != nil {
+		return 0, fmt.Errorf("listing nodes, %w", err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"labels": labels}})
+	if err != nil {
+		return 0, fmt.Errorf("marshalling node labels, %w", err)
+	}
+	for _, node := range nodes.Items {
+		if _, err := client.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return 0, fmt.Errorf("labeling node %s, %w", node.Name, err)
+		}
+	}
+	return len(nodes.Items), nil
+}
@@ -0,0 +1,50 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"testing"
+
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLabelSubstrateNodes(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "test-substrate",
+		Labels: map[string]string{v1alpha1.SubstrateNodeLabelKey: "control-plane"},
+	}}, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "tenant-node"}})
+	labeled, err := labelSubstrateNodes(ctx, client, map[string]string{"node-role.kubernetes.io/control-plane": ""})
+	if err != nil {
+		t.Fatalf("labeling nodes, %v", err)
+	}
+	if labeled != 1 {
+		t.Errorf("expected 1 substrate node to be labeled, got %d", labeled)
+	}
+	node, err := client.CoreV1().Nodes().Get(ctx, "test-substrate", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting node, %v", err)
+	}
+	if _, ok := node.Labels["node-role.kubernetes.io/control-plane"]; !ok || node.Labels[v1alpha1.SubstrateNodeLabelKey] != "control-plane" {
+		t.Errorf("expected the node-role label to be added, got %v", node.Labels)
+	}
+	if node, _ := client.CoreV1().Nodes().Get(ctx, "tenant-node", metav1.GetOptions{}); len(node.Labels) != 0 {
+		t.Errorf("expected other nodes to be left alone, got %v", node.Labels)
+	}
+}
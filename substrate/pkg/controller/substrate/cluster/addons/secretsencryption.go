@@ -0,0 +1,147 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/controller/substrate/cluster"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// SecretsEncryption rewrites all secrets with the active encryption key after
+// a key rotation, or unencrypted when encryption is disabled, once the API
+// server has loaded the new encryption config
+type SecretsEncryption struct {
+}
+
+func (s *SecretsEncryption) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	if !substrate.IsReady() {
+		return reconcile.Result{Requeue: true}, nil
+	}
+	keys, err := cluster.EncryptionKeyNames(substrate)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	// Secrets only need to be rewritten while retired keys are present
+	if len(keys) <= 1 || ptr.StringValue(substrate.Status.Cluster.SecretsEncryptionKey) == keys[0] {
+		return reconcile.Result{}, nil
+	}
+	client, err := kubeconfig.ClientSetFromFile(*substrate.Status.Cluster.KubeConfig)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("creating client, %w", err)
+	}
+	loaded, err := encryptionConfigLoaded(ctx, client, substrate)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !loaded {
+		logging.FromContext(ctx).Infof("Waiting for the API server to load encryption key %s", keys[0])
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	count, err := rewriteSecrets(ctx, client)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("rewriting secrets, %w", err)
+	}
+	logging.FromContext(ctx).Infof("Rewrote %d secrets with encryption key %s", count, keys[0])
+	substrate.Status.Cluster.SecretsEncryptionKey = ptr.String(keys[0])
+	return reconcile.Result{}, nil
+}
+
+func (s *SecretsEncryption) Delete(_ context.Context, _ *v1alpha1.Substrate) (reconcile.Result, error) {
+	return reconcile.Result{}, nil
+}
+
+// encryptionConfigLoaded compares the encryption config hash of the running
+// API server, read from its mirror pod, with the latest encryption config
+func encryptionConfigLoaded(ctx context.Context, client clientset.Interface, substrate *v1alpha1.Substrate) (bool, error) {
+	expected, err := cluster.EncryptionConfigHash(substrate)
+	if err != nil {
+		return false, err
+	}
+	pod, err := client.CoreV1().Pods(metav1.NamespaceSystem).Get(ctx, fmt.Sprintf("kube-apiserver-%s", substrate.Name), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("getting api server pod, %w", err)
+	}
+	return pod.Annotations[cluster.EncryptionConfigHashAnnotation] == expected, nil
+}
+
+// rewriteSecrets updates every secret unchanged, which is the equivalent of
+// `kubectl get secrets -A -o yaml | kubectl replace -f -`. The API server
+// encrypts the secrets with the active key when they're written. Only the
+// secrets that were updated are counted.
+func rewriteSecrets(ctx context.Context, client clientset.Interface) (int, error) {
+	count := 0
+	options := metav1.ListOptions{Limit: 500}
+	for {
+		secrets, err := client.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, options)
+		if err != nil {
+			return count, fmt.Errorf("listing secrets, %w", err)
+		}
+		for i := range secrets.Items {
+			updated, err := rewriteSecret(ctx, client, &secrets.Items[i])
+			if err != nil {
+				return count, fmt.Errorf("updating secret %s/%s, %w", secrets.Items[i].Namespace, secrets.Items[i].Name, err)
+			}
+			if updated {
+				count++
+			}
+		}
+		if secrets.Continue == "" {
+			return count, nil
+		}
+		options.Continue = secrets.Continue
+	}
+}
+
+// rewriteSecret updates the secret, reading it again when it was modified
+// since being listed, as a write racing the key change may have used the
+// previous key. Deleted secrets are skipped.
+func rewriteSecret(ctx context.Context, client clientset.Interface, secret *v1.Secret) (bool, error) {
+	updated := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		_, err := client.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		if errors.IsConflict(err) {
+			latest, getErr := client.CoreV1().Secrets(secret.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+			secret = latest
+			return err
+		}
+		if err == nil {
+			updated = true
+		}
+		return err
+	})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return updated, err
+}
@@ -0,0 +1,71 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRewriteSecrets(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "modified", Namespace: metav1.NamespaceDefault}},
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: metav1.NamespaceDefault}},
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "unchanged", Namespace: metav1.NamespaceDefault}},
+	)
+	conflicted := false
+	client.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		switch action.(k8stesting.UpdateAction).GetObject().(*v1.Secret).Name {
+		case "modified":
+			// The first write conflicts with a write since the secret was listed
+			if !conflicted {
+				conflicted = true
+				return true, nil, errors.NewConflict(schema.GroupResource{Resource: "secrets"}, "modified", nil)
+			}
+		case "deleted":
+			return true, nil, errors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "deleted")
+		}
+		return false, nil, nil
+	})
+	count, err := rewriteSecrets(ctx, client)
+	if err != nil {
+		t.Fatalf("rewriting secrets, %v", err)
+	}
+	if !conflicted {
+		t.Fatalf("expected the update to conflict")
+	}
+	if count != 2 {
+		t.Errorf("expected the modified and unchanged secrets to be rewritten, got %d", count)
+	}
+	updates := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			updates++
+		}
+	}
+	// The conflicted secret is written again, the deleted secret isn't
+	if updates != 4 {
+		t.Errorf("expected 4 updates, got %d", updates)
+	}
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
 	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
 	"knative.dev/pkg/logging"
@@ -27,10 +28,13 @@ import (
 )
 
 type Address struct {
-	EC2 *ec2.EC2
+	EC2 ec2iface.EC2API
 }
 
 func (a *Address) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	if substrate.Spec.ElasticIPAllocationID != nil {
+		return reconcile.Result{}, a.ensureExistingAddress(ctx, substrate)
+	}
 	addressesOutput, err := a.EC2.DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{Filters: discovery.Filters(substrate, discovery.Name(substrate))})
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("describing addresses, %w", err)
@@ -49,8 +53,61 @@ func (a *Address) Create(ctx context.Context, substrate *v1alpha1.Substrate) (re
 	return reconcile.Result{}, nil
 }
 
+// ensureExistingAddress uses the pre-allocated elastic IP as the substrate's
+// address, the substrate node associates it on boot so it must be free or
+// already associated with the substrate node
+func (a *Address) ensureExistingAddress(ctx context.Context, substrate *v1alpha1.Substrate) error {
+	allocationID := substrate.Spec.ElasticIPAllocationID
+	addressesOutput, err := a.EC2.DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{AllocationIds: []*string{allocationID}})
+	if err != nil {
+		return fmt.Errorf("describing address %s, %w", aws.StringValue(allocationID), err)
+	}
+	if len(addressesOutput.Addresses) == 0 {
+		return fmt.Errorf("elastic IP %s not found", aws.StringValue(allocationID))
+	}
+	address := addressesOutput.Addresses[0]
+	if address.AssociationId != nil {
+		owned, err := a.associatedWithSubstrate(ctx, substrate, address)
+		if err != nil {
+			return err
+		}
+		if !owned {
+			return fmt.Errorf("elastic IP %s is already associated, %s", aws.StringValue(allocationID), aws.StringValue(address.AssociationId))
+		}
+	}
+	logging.FromContext(ctx).Infof("Found address %s", aws.StringValue(address.PublicIp))
+	substrate.Status.Cluster.Address = address.PublicIp
+	return nil
+}
+
+func (a *Address) associatedWithSubstrate(ctx context.Context, substrate *v1alpha1.Substrate, address *ec2.Address) (bool, error) {
+	if address.InstanceId == nil {
+		return false, nil
+	}
+	instancesOutput, err := a.EC2.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []*string{address.InstanceId},
+		Filters:     discovery.Filters(substrate),
+	})
+	if err != nil {
+		return false, fmt.Errorf("describing instances, %w", err)
+	}
+	for _, reservation := range instancesOutput.Reservations {
+		if len(reservation.Instances) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Delete releases the substrate node's address, NAT gateway addresses are
+// released once their NAT gateway is deleted. A pre-allocated elastic IP is
+// retained and disassociated when the substrate node terminates.
 func (a *Address) Delete(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
-	addressesOutput, err := a.EC2.DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{Filters: discovery.Filters(substrate)})
+	if substrate.Spec.ElasticIPAllocationID != nil {
+		logging.FromContext(ctx).Infof("Retaining address %s", aws.StringValue(substrate.Spec.ElasticIPAllocationID))
+		return reconcile.Result{}, nil
+	}
+	addressesOutput, err := a.EC2.DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{Filters: discovery.Filters(substrate, discovery.Name(substrate))})
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("describing addresses, %w", err)
 	}
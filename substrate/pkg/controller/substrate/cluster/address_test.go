@@ -0,0 +1,100 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeEC2 holds the elastic IPs, instances and launch template versions in
+// the account, calls not needed by the Address, Instance or LaunchTemplate
+// panic
+type fakeEC2 struct {
+	ec2iface.EC2API
+	addresses       []*ec2.Address
+	released        []string
+	instances       []*ec2.Instance
+	fleets          []*ec2.CreateFleetInput
+	terminated      []string
+	launchTemplates []*ec2.RequestLaunchTemplateData
+}
+
+func (f *fakeEC2) DescribeAddressesWithContext(_ aws.Context, input *ec2.DescribeAddressesInput, _ ...request.Option) (*ec2.DescribeAddressesOutput, error) {
+	output := &ec2.DescribeAddressesOutput{}
+	for _, address := range f.addresses {
+		for _, id := range input.AllocationIds {
+			if aws.StringValue(id) == aws.StringValue(address.AllocationId) {
+				output.Addresses = append(output.Addresses, address)
+			}
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeEC2) DescribeInstancesWithContext(_ aws.Context, _ *ec2.DescribeInstancesInput, _ ...request.Option) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: f.instances}}}, nil
+}
+
+func (f *fakeEC2) ReleaseAddressWithContext(_ aws.Context, input *ec2.ReleaseAddressInput, _ ...request.Option) (*ec2.ReleaseAddressOutput, error) {
+	f.released = append(f.released, aws.StringValue(input.AllocationId))
+	return &ec2.ReleaseAddressOutput{}, nil
+}
+
+func TestExistingElasticIP(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeEC2{addresses: []*ec2.Address{
+		{AllocationId: aws.String("eipalloc-free"), PublicIp: aws.String("203.0.113.10")},
+		{AllocationId: aws.String("eipalloc-used"), PublicIp: aws.String("203.0.113.11"),
+			AssociationId: aws.String("eipassoc-other"), InstanceId: aws.String("i-other")},
+	}}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{ElasticIPAllocationID: aws.String("eipalloc-free")},
+	}
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	address := &Address{EC2: fake}
+	if _, err := address.Create(ctx, substrate); err != nil {
+		t.Fatalf("creating address, %v", err)
+	}
+	if actual := aws.StringValue(substrate.Status.Cluster.Address); actual != "203.0.113.10" {
+		t.Errorf("expected the existing elastic IP, got %s", actual)
+	}
+	if _, err := address.Delete(ctx, substrate); err != nil {
+		t.Fatalf("deleting address, %v", err)
+	}
+	if len(fake.released) > 0 {
+		t.Errorf("expected the existing elastic IP to be retained, released %v", fake.released)
+	}
+	for _, id := range []string{"eipalloc-used", "eipalloc-missing"} {
+		substrate.Spec.ElasticIPAllocationID = aws.String(id)
+		if _, err := address.Create(ctx, substrate); err == nil {
+			t.Errorf("expected elastic IP %s to be rejected", id)
+		}
+	}
+	substrate.Spec.ElasticIPAllocationID = aws.String("203.0.113.10")
+	if err := substrate.Validate(ctx); err == nil {
+		t.Errorf("expected an invalid allocation ID to fail validation")
+	}
+}
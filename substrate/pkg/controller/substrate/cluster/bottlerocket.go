@@ -0,0 +1,119 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+)
+
+const (
+	// bottlerocketRootfs is where superpowered host containers mount the host's filesystem
+	bottlerocketRootfs = "/.bottlerocket/rootfs"
+	// bottlerocketSyncContainer is the host container syncing the configuration
+	bottlerocketSyncContainer = "kit-sync"
+	// bottlerocketStaticPodPath and bottlerocketKubeconfig are the paths of
+	// Bottlerocket's kubelet configuration, the manifests and kubelet.conf are
+	// synced there instead of the paths used by kubelet.service
+	bottlerocketStaticPodPath = "/etc/kubernetes/static-pods"
+	bottlerocketKubeconfig    = "/etc/kubernetes/kubelet/kubeconfig"
+)
+
+// bottlerocketUserData is the TOML settings of a Bottlerocket substrate node.
+// The settings render the kubelet's configuration, the host container then
+// replaces the kubeconfig with the substrate's kubelet.conf so the kubelet
+// authenticates with its client certificate.
+func bottlerocketUserData(substrate *v1alpha1.Substrate) string {
+	labels := []string{fmt.Sprintf("%q = %q", v1alpha1.SubstrateNodeLabelKey, "control-plane")}
+	for key, value := range substrate.KubeletNodeLabels() {
+		labels = append(labels, fmt.Sprintf("%q = %q", key, value))
+	}
+	sort.Strings(labels[1:])
+	taints := []string{}
+	for _, taint := range substrate.Spec.NodeTaints {
+		taints = append(taints, fmt.Sprintf("%q = %q", taint.Key, taint.Value+":"+string(taint.Effect)))
+	}
+	return fmt.Sprintf(`[settings.kubernetes]
+cluster-name = %[1]q
+api-server = %[2]q
+hostname-override = %[1]q
+cluster-dns-ip = %[3]q
+pod-infra-container-image = %[4]q
+
+[settings.kubernetes.node-labels]
+%[5]s
+
+[settings.kubernetes.node-taints]
+%[6]s
+
+[settings.host-containers.%[7]s]
+source = %[8]q
+enabled = true
+superpowered = true
+user-data = %[9]q
+`, substrate.Name, "https://"+net.JoinHostPort(aws.StringValue(substrate.Status.Cluster.Address), strconv.Itoa(int(substrate.APIServerPort()))),
+		serviceIP(substrate, 10), pauseImage, strings.Join(labels, "\n"), strings.Join(taints, "\n"), bottlerocketSyncContainer,
+		substrate.Spec.Bottlerocket.SyncImage, base64.StdEncoding.EncodeToString([]byte(bottlerocketSyncScript(substrate))))
+}
+
+// bottlerocketSyncScript is the host container's user data, it associates the
+// elastic IP and syncs the configuration from the bucket to the host like the
+// Amazon Linux 2 user data
+func bottlerocketSyncScript(substrate *v1alpha1.Substrate) string {
+	return fmt.Sprintf(`#!/usr/bin/env bash
+REGION=$(echo $(curl -s http://169.254.169.254/latest/meta-data/placement/availability-zone) | sed 's/[a-z]$//')
+InstanceID=$(curl -s http://169.254.169.254/latest/meta-data/instance-id)
+
+ELASTICIP_ALLOCATION_ID="%[3]s"
+for i in {0..30}; do
+	if [ -z "$ELASTICIP_ALLOCATION_ID" ]
+	then
+		ELASTICIP_ALLOCATION_ID=$(AWS_DEFAULT_REGION=$REGION aws ec2 describe-addresses --filters "Name=tag:Name,Values=%[1]s" --query "Addresses[*].AllocationId" --output text)
+		sleep 2
+	fi
+done
+[[ -z "$ELASTICIP_ALLOCATION_ID" ]] && { echo "ELASTICIP_ALLOCATION_ID not found, exiting"; exit 1; }
+AWS_DEFAULT_REGION=$REGION aws ec2 associate-address --instance-id $InstanceID --allocation-id $ELASTICIP_ALLOCATION_ID
+
+while [ true ]; do
+ existing_checksum=$(ls -alR %[4]s/etc/kubernetes %[4]s/etc/aws-iam-authenticator | md5sum)
+ for dir in "/etc/kubernetes" "/etc/aws-iam-authenticator"; do
+    mkdir -p %[4]s$dir
+    aws s3 sync --exact-timestamps s3://%[2]s/tmp/%[1]s$dir %[4]s$dir
+ done
+ # Manifests removed from the bucket stop their static pods
+ aws s3 sync --delete --exact-timestamps s3://%[2]s/tmp/%[1]s%[5]s %[4]s%[6]s
+ # Copied only when it changed so its timestamp doesn't change the checksum
+ if [ "$(md5sum < %[4]s/etc/kubernetes/kubelet.conf)" != "$(md5sum 2>/dev/null < %[4]s%[7]s)" ]; then
+    cp -p %[4]s/etc/kubernetes/kubelet.conf %[4]s%[7]s
+ fi
+ new_checksum=$(ls -alR %[4]s/etc/kubernetes %[4]s/etc/aws-iam-authenticator | md5sum)
+ if [ "$new_checksum" != "$existing_checksum" ]; then
+    echo "$(date) Synced from S3, restarting kubelet"
+    chroot %[4]s systemctl restart kubelet
+ fi
+ sleep 5
+done
+`, aws.StringValue(discovery.Name(substrate)), aws.StringValue(discovery.BucketName(substrate)), aws.StringValue(substrate.Spec.ElasticIPAllocationID),
+		bottlerocketRootfs, clusterManifestPath, bottlerocketStaticPodPath, bottlerocketKubeconfig)
+}
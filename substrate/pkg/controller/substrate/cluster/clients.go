@@ -0,0 +1,82 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+)
+
+// Clients are the AWS clients used to store a substrate's configuration in a region
+type Clients struct {
+	Region     *string
+	S3         s3iface.S3API
+	STS        *sts.STS
+	S3Uploader s3manageriface.UploadWithIterator
+	// S3AccelerateUploader uploads through the accelerate endpoint, to buckets
+	// with transfer acceleration enabled
+	S3AccelerateUploader s3manageriface.UploadWithIterator
+	// SSM stores the secrets encryption keys
+	SSM ssmiface.SSMAPI
+}
+
+// ClientFactory constructs regional clients from a session and caches them per region
+type ClientFactory struct {
+	mu      sync.Mutex
+	session *session.Session
+	clients map[string]*Clients
+}
+
+func NewClientFactory(session *session.Session) *ClientFactory {
+	return &ClientFactory{session: session, clients: map[string]*Clients{}}
+}
+
+// For returns the clients for the substrate's region, falling back to the session's region
+func (f *ClientFactory) For(substrate *v1alpha1.Substrate) *Clients {
+	return f.ForRegion(substrate.Spec.Region)
+}
+
+// ForRegion returns the clients for the region, falling back to the session's region
+func (f *ClientFactory) ForRegion(region *string) *Clients {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if region == nil {
+		region = f.session.Config.Region
+	}
+	if clients, ok := f.clients[aws.StringValue(region)]; ok {
+		return clients
+	}
+	session := f.session.Copy(&aws.Config{Region: region})
+	clients := &Clients{
+		Region:               region,
+		S3:                   s3.New(session),
+		STS:                  sts.New(session),
+		S3Uploader:           s3manager.NewUploader(session),
+		S3AccelerateUploader: s3manager.NewUploaderWithClient(s3.New(session, &aws.Config{S3UseAccelerate: aws.Bool(true)})),
+		SSM:                  ssm.New(session),
+	}
+	f.clients[aws.StringValue(region)] = clients
+	return clients
+}
@@ -0,0 +1,87 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	bootstrapjws "k8s.io/cluster-bootstrap/token/jws"
+	bootstraputil "k8s.io/cluster-bootstrap/token/util"
+	"k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"sigs.k8s.io/yaml"
+)
+
+const clusterInfoPath = "/etc/kubernetes/cluster-info.yaml"
+
+// generateClusterInfo writes the kube-public/cluster-info ConfigMap kubeadm
+// join uses for token discovery, it holds a kubeconfig with the cluster CA and
+// API server endpoint and a JWS signature of it for each bootstrap token
+func (c *Config) generateClusterInfo(cfg *kubeadm.InitConfiguration, substrate *v1alpha1.Substrate) error {
+	if substrate.Spec.ClusterInfo == nil {
+		return nil
+	}
+	caCert, err := ioutil.ReadFile(path.Join(cfg.CertificatesDir, kubeadmconstants.CACertName))
+	if err != nil {
+		return fmt.Errorf("reading CA certificate, %w", err)
+	}
+	kubeConfig, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{"": {
+			Server:                   fmt.Sprintf("https://%s", cfg.ControlPlaneEndpoint),
+			CertificateAuthorityData: caCert,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("serializing cluster-info kubeconfig, %w", err)
+	}
+	configMap := &v1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: bootstrapapi.ConfigMapClusterInfo, Namespace: metav1.NamespacePublic},
+		Data:       map[string]string{bootstrapapi.KubeConfigKey: string(kubeConfig)},
+	}
+	for _, token := range substrate.Spec.ClusterInfo.BootstrapTokens {
+		// Tokens are validated with the substrate, the submatches are the token id and secret
+		parts := bootstraputil.BootstrapTokenRegexp.FindStringSubmatch(token)
+		if len(parts) != 3 {
+			return fmt.Errorf("invalid bootstrap token")
+		}
+		id := parts[1]
+		signature, err := bootstrapjws.ComputeDetachedSignature(string(kubeConfig), id, parts[2])
+		if err != nil {
+			return fmt.Errorf("signing cluster-info, %w", err)
+		}
+		configMap.Data[bootstrapapi.JWSSignatureKeyPrefix+id] = signature
+	}
+	contents, err := yaml.Marshal(configMap)
+	if err != nil {
+		return fmt.Errorf("marshaling cluster-info, %w", err)
+	}
+	localPath := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), clusterInfoPath)
+	if err := os.MkdirAll(path.Dir(localPath), 0700); err != nil {
+		return fmt.Errorf("failed to create directory, %w", err)
+	}
+	return ioutil.WriteFile(localPath, contents, 0644)
+}
@@ -16,24 +16,41 @@ package cluster
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/awslabs/kit/operator/pkg/components/iamauthenticator"
 	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
 	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	"go.uber.org/multierr"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/util/runtime"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
 	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
 	"k8s.io/kubernetes/cmd/kubeadm/app/phases/certs"
@@ -42,6 +59,8 @@ import (
 	"k8s.io/kubernetes/cmd/kubeadm/app/phases/kubeconfig"
 	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
 	"k8s.io/kubernetes/cmd/kubeadm/app/util/config"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/pkiutil"
+	staticpodutil "k8s.io/kubernetes/cmd/kubeadm/app/util/staticpod"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -55,75 +74,303 @@ const (
 	kubeletSystemdPath         = "/etc/systemd/system"
 	kubeletConfigPath          = "/var/lib/kubelet/"
 	authenticatorConfigDir     = "/etc/aws-iam-authenticator"
+	authenticatorKubeconfig    = "/var/aws-iam-authenticator/kubeconfig/kubeconfig.yaml"
+	auditPolicyPath            = "/etc/kubernetes/audit/policy.yaml"
+	auditLogDir                = "/var/log/kubernetes/audit"
 	kubernetesVersionTag       = "v1.21.2-eks-1-21-4"
 	imageRepository            = "public.ecr.aws/eks-distro/kubernetes"
 	etcdVersionTag             = "v3.4.16-eks-1-21-7"
 	etcdImageRepository        = "public.ecr.aws/eks-distro/etcd-io"
 	tenantControlPlaneNodeRole = "tenant-controlplane-node-role"
+	auditPolicyHashAnnotation  = "kit.sh/audit-policy-hash"
+	containerdSocket           = "unix:///run/containerd/containerd.sock"
+	// pauseImage is pinned by the kubelet and is containerd's sandbox image
+	pauseImage = "public.ecr.aws/eks-distro/kubernetes/pause:v1.18.9-eks-1-18-1"
+	// uploadWorkers bounds the concurrent uploads of the cluster configuration
+	uploadWorkers = 8
 )
 
 type Config struct {
-	S3         *s3.S3
-	STS        *sts.STS
-	S3Uploader *s3manager.Uploader
+	Clients *ClientFactory
+	// Recorder reports the configuration's milestones and failures as events
+	// on the substrate, events are skipped when unset
+	Recorder EventRecorder
+	// DryRun logs the bucket, objects and local paths that would be deleted
+	// without deleting them
+	DryRun bool
+}
+
+// EventRecorder is the method of client-go's record.EventRecorder the Config
+// records with
+type EventRecorder interface {
+	Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{})
+}
+
+// LoggingRecorder logs the events, the substrate only lives in memory while
+// the CLI runs, so there's no API server to record them on. The Config logs
+// its milestones already, so normal events are only logged at debug level.
+type LoggingRecorder struct {
+	ctx context.Context
+}
+
+func NewLoggingRecorder(ctx context.Context) *LoggingRecorder {
+	return &LoggingRecorder{ctx: ctx}
+}
+
+func (l *LoggingRecorder) Eventf(_ runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if eventType == v1.EventTypeWarning {
+		logging.FromContext(l.ctx).Warnf("%s: %s", reason, fmt.Sprintf(messageFmt, args...))
+		return
+	}
+	logging.FromContext(l.ctx).Debugf("%s: %s", reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// event records an event on the substrate when the Config has a recorder
+func (c *Config) event(substrate *v1alpha1.Substrate, eventType, reason, messageFmt string, args ...interface{}) {
+	if c.Recorder == nil {
+		return
+	}
+	c.Recorder.Eventf(substrate, eventType, reason, messageFmt, args...)
 }
 
 func (c *Config) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
 	if substrate.Status.Cluster.Address == nil {
+		substrate.StatusConditions().MarkUnknown(v1alpha1.ConditionClusterConfigUploaded, "WaitingForAddress", "waiting for the substrate's address")
 		return reconcile.Result{Requeue: true}, nil
 	}
+	clients := c.Clients.For(substrate)
 	// ensure S3 bucket
-	if err := c.ensureBucket(ctx, substrate); err != nil {
+	if err := c.ensureBucket(ctx, clients, substrate); err != nil {
+		c.event(substrate, v1.EventTypeWarning, "BucketCreationFailed", "Creating S3 bucket %s failed, %s", aws.StringValue(discovery.BucketName(substrate)), err)
 		return reconcile.Result{}, fmt.Errorf("ensuring S3 bucket, %w", err)
 	}
+	if err := c.ensurePublicAccessBlock(ctx, clients, substrate); err != nil {
+		return reconcile.Result{}, fmt.Errorf("ensuring S3 bucket public access block, %w", err)
+	}
+	if err := c.ensureBucketEncryption(ctx, clients, substrate); err != nil {
+		return reconcile.Result{}, fmt.Errorf("ensuring S3 bucket encryption, %w", err)
+	}
+	// The encryption config decides whether the API server is rendered with it
+	if err := c.secretsEncryption(ctx, clients, substrate); err != nil {
+		return reconcile.Result{}, fmt.Errorf("generating encryption config, %w", err)
+	}
 	// create all configs file
 	cfg := DefaultClusterConfig(substrate)
 	if err := c.generateCerts(cfg, substrate); err != nil {
 		return reconcile.Result{}, fmt.Errorf("generating certs, %w", err)
 	}
+	// Reporting the expiry is best effort, it doesn't block the configuration
+	expiry, err := certificateExpiry(cfg.CertificatesDir)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Reading certificate expiry, %v", err)
+	}
+	substrate.Status.Cluster.CertificateExpiry = expiry
 	if err := c.kubeConfigs(cfg, substrate); err != nil {
 		return reconcile.Result{}, fmt.Errorf("generating kube config, %w", err)
 	}
+	if err := c.generateClusterInfo(cfg, substrate); err != nil {
+		return reconcile.Result{}, fmt.Errorf("generating cluster-info, %w", err)
+	}
 	if err := c.generateStaticPodManifests(cfg, substrate); err != nil {
 		return reconcile.Result{}, fmt.Errorf("generating manifests, %w", err)
 	}
-	if err := c.kubeletSystemService(cfg, substrate); err != nil {
-		return reconcile.Result{}, fmt.Errorf("generating kubelet service config, %w", err)
+	// Bottlerocket's kubelet is configured through the launch template's settings
+	if substrate.Spec.OperatingSystem != v1alpha1.OperatingSystemBottlerocket {
+		if err := c.kubeletSystemService(cfg, substrate); err != nil {
+			return reconcile.Result{}, fmt.Errorf("generating kubelet service config, %w", err)
+		}
 	}
+	if err := c.auditPolicy(substrate); err != nil {
+		return reconcile.Result{}, fmt.Errorf("generating audit policy, %w", err)
+	}
+	if err := c.egressSelector(substrate); err != nil {
+		return reconcile.Result{}, fmt.Errorf("generating egress selector config, %w", err)
+	}
+	if err := c.oidcCA(substrate); err != nil {
+		return reconcile.Result{}, fmt.Errorf("generating OIDC CA, %w", err)
+	}
+	// A stuck request to AWS fails the reconcile instead of hanging it
+	uploadCtx, cancel := context.WithTimeout(ctx, uploadTimeoutFor(substrate))
+	defer cancel()
 	// deploy aws IAM authenticator
-	if err := c.ensureAuthenticatorConfig(ctx, substrate); err != nil {
-		return reconcile.Result{}, fmt.Errorf("generating authenticator config, %w", err)
+	if substrate.IAMAuthenticatorEnabled() {
+		if err := c.ensureAuthenticatorConfig(uploadCtx, clients, substrate); err != nil {
+			return reconcile.Result{}, uploadTimedOut(uploadCtx, substrate, fmt.Errorf("generating authenticator config, %w", err))
+		}
+		if err := c.staticPodSpecForAuthenticator(uploadCtx, substrate); err != nil {
+			return reconcile.Result{}, fmt.Errorf("generating authenticator config, %w", err)
+		}
 	}
-	if err := c.staticPodSpecForAuthenticator(ctx, substrate); err != nil {
-		return reconcile.Result{}, fmt.Errorf("generating authenticator config, %w", err)
+	if err := c.pruneStaticPodManifests(uploadCtx, clients, substrate); err != nil {
+		return reconcile.Result{}, uploadTimedOut(uploadCtx, substrate, fmt.Errorf("pruning manifests, %w", err))
 	}
-	// upload to s3 bucket
-	if err := c.S3Uploader.UploadWithIterator(ctx, NewDirectoryIterator(
-		aws.StringValue(discovery.Name(substrate)), path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))); err != nil {
-		return reconcile.Result{}, fmt.Errorf("uploading to S3 %w", err)
+	if err := c.upload(uploadCtx, clients, substrate); err != nil {
+		err = uploadTimedOut(uploadCtx, substrate, err)
+		c.event(substrate, v1.EventTypeWarning, "UploadFailed", "Uploading cluster configuration to s3://%s failed, %s", aws.StringValue(discovery.BucketName(substrate)), err)
+		return reconcile.Result{}, err
 	}
-	logging.FromContext(ctx).Infof("Uploaded cluster configuration to s3://%s", aws.StringValue(discovery.Name(substrate)))
+	substrate.StatusConditions().MarkTrue(v1alpha1.ConditionClusterConfigUploaded)
 	substrate.Status.Cluster.KubeConfig = ptr.String(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), kubeconfigFile))
+	if err := presignKubeConfig(clients, substrate); err != nil {
+		return reconcile.Result{}, fmt.Errorf("presigning kube config, %w", err)
+	}
+	// Wait for secrets to be rewritten with the active key to remove the
+	// retired keys, or rewritten unencrypted to disable encryption
+	if encryption := substrate.Spec.SecretsEncryption; encryption == nil || encryption.RemoveRetiredKeys {
+		keys, err := EncryptionKeyNames(substrate)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if len(keys) > 1 {
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+	}
 	return reconcile.Result{}, nil
 }
 
 func (c *Config) Delete(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	clients := c.Clients.For(substrate)
+	if c.DryRun {
+		plan, err := c.DeletePlan(ctx, substrate)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		for _, deletion := range plan {
+			logging.FromContext(ctx).Infof("Would delete %s", deletion)
+		}
+		return reconcile.Result{}, nil
+	}
 	// delete the s3 bucket
-	if err := s3manager.NewBatchDeleteWithClient(c.S3).Delete(ctx, s3manager.NewDeleteListIterator(
-		c.S3, &s3.ListObjectsInput{Bucket: discovery.Name(substrate)}),
-	); err != nil && !strings.Contains(err.(awserr.Error).Error(), "NoSuchBucket") {
-		return reconcile.Result{}, fmt.Errorf("deleting objects from bucket %v", err)
+	if err := s3manager.NewBatchDeleteWithClient(clients.S3).Delete(ctx, s3manager.NewDeleteListIterator(
+		clients.S3, &s3.ListObjectsInput{Bucket: discovery.BucketName(substrate)}),
+	); err != nil && !errBatchNoSuchBucket(err) {
+		return reconcile.Result{}, fmt.Errorf("deleting objects from bucket, %w", err)
 	}
-	if _, err := c.S3.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{Bucket: discovery.Name(substrate)}); err != nil {
-		if err.(awserr.Error).Code() != s3.ErrCodeNoSuchBucket {
+	if _, err := clients.S3.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{Bucket: discovery.BucketName(substrate)}); err != nil {
+		if !ErrNoSuchBucket(err) {
 			return reconcile.Result{}, fmt.Errorf("deleting S3, %w", err)
 		}
 	} else {
-		logging.FromContext(ctx).Infof("Deleted S3 bucket %s", aws.StringValue(discovery.Name(substrate)))
+		logging.FromContext(ctx).Infof("Deleted S3 bucket %s", aws.StringValue(discovery.BucketName(substrate)))
+	}
+	if err := deleteEncryptionKeys(ctx, clients, substrate); err != nil {
+		return reconcile.Result{}, err
 	}
 	return reconcile.Result{}, os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
 }
 
+// DeletePlan lists what Delete removes, the objects in the substrate's bucket
+// followed by the bucket and the local configuration directory. Missing
+// buckets and directories are left out.
+func (c *Config) DeletePlan(ctx context.Context, substrate *v1alpha1.Substrate) ([]string, error) {
+	bucket := aws.StringValue(discovery.BucketName(substrate))
+	plan := []string{}
+	if err := c.Clients.For(substrate).S3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			plan = append(plan, fmt.Sprintf("s3://%s/%s", bucket, strings.TrimPrefix(aws.StringValue(object.Key), "/")))
+		}
+		return true
+	}); err != nil {
+		if !ErrNoSuchBucket(err) {
+			return nil, fmt.Errorf("listing objects in bucket %s, %w", bucket, err)
+		}
+	} else {
+		plan = append(plan, "s3://"+bucket)
+	}
+	dir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)))
+	if _, err := os.Stat(dir); err == nil {
+		plan = append(plan, dir)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("checking %s, %w", dir, err)
+	}
+	return plan, nil
+}
+
+// upload the configuration to the substrate's bucket, then copy it to the
+// replica bucket. The replica is best effort, failing to copy the
+// configuration is logged and the replica is left out of the status.
+func (c *Config) upload(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate) error {
+	dir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)))
+	bucket := aws.StringValue(discovery.BucketName(substrate))
+	uploader := clients.S3Uploader
+	if aws.BoolValue(substrate.Spec.BucketTransferAcceleration) {
+		uploader = clients.S3AccelerateUploader
+	}
+	if err := uploadDirectory(ctx, uploader, bucket, dir); err != nil {
+		return fmt.Errorf("uploading to S3 %w", err)
+	}
+	logging.FromContext(ctx).Infof("Uploaded cluster configuration to s3://%s", bucket)
+	c.event(substrate, v1.EventTypeNormal, "ConfigUploaded", "Uploaded cluster configuration to s3://%s", bucket)
+	substrate.Status.Cluster.ConfigLocations = []string{"s3://" + bucket}
+	replica := substrate.Spec.ReplicaBucket
+	if replica == nil {
+		return nil
+	}
+	region := replica.Region
+	if region == nil {
+		region = clients.Region
+	}
+	if err := uploadDirectory(ctx, c.Clients.ForRegion(region).S3Uploader, replica.Name, dir); err != nil {
+		logging.FromContext(ctx).Warnf("Failed to copy cluster configuration to s3://%s, %s", replica.Name, err)
+		return nil
+	}
+	logging.FromContext(ctx).Infof("Copied cluster configuration to s3://%s", replica.Name)
+	substrate.Status.Cluster.ConfigLocations = append(substrate.Status.Cluster.ConfigLocations, "s3://"+replica.Name)
+	return nil
+}
+
+// presignKubeConfig sets the status to a URL downloading the uploaded admin
+// kubeconfig, the URL is cleared when the TTL is unset
+func presignKubeConfig(clients *Clients, substrate *v1alpha1.Substrate) error {
+	ttl := substrate.Spec.KubeConfigURLTTL
+	if ttl == nil {
+		substrate.Status.Cluster.KubeConfigURL = nil
+		substrate.Status.Cluster.KubeConfigURLExpiry = nil
+		return nil
+	}
+	// The configuration is uploaded keyed by its local path
+	req, _ := clients.S3.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: discovery.BucketName(substrate),
+		Key:    substrate.Status.Cluster.KubeConfig,
+	})
+	expiry := metav1.NewTime(time.Now().Add(ttl.Duration))
+	url, err := req.Presign(ttl.Duration)
+	if err != nil {
+		return err
+	}
+	substrate.Status.Cluster.KubeConfigURL = ptr.String(url)
+	substrate.Status.Cluster.KubeConfigURLExpiry = &expiry
+	return nil
+}
+
+// ErrUploadTimeout is wrapped by the errors of an upload that didn't complete
+// within the substrate's upload timeout
+var ErrUploadTimeout = errors.New("uploading the cluster configuration timed out")
+
+func uploadTimeoutFor(substrate *v1alpha1.Substrate) time.Duration {
+	if substrate.Spec.UploadTimeout == nil {
+		return v1alpha1.DefaultUploadTimeout
+	}
+	return substrate.Spec.UploadTimeout.Duration
+}
+
+// uploadTimedOut wraps err with ErrUploadTimeout when the upload's deadline
+// expired. The AWS SDK's errors don't wrap the context's error, so the
+// context is checked instead. Files are closed by the uploader as each upload
+// fails, files that weren't started aren't opened.
+func uploadTimedOut(ctx context.Context, substrate *v1alpha1.Substrate, err error) error {
+	if ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	return fmt.Errorf("%w after %s, the upload is retried on the next apply, %s", ErrUploadTimeout, uploadTimeoutFor(substrate), err)
+}
+
+// EtcdSnapshotPrefix is the key prefix of the etcd snapshots in the cluster
+// configuration bucket, next to the configuration synced to the node
+func EtcdSnapshotPrefix(substrate *v1alpha1.Substrate) string {
+	return path.Join(strings.TrimPrefix(ClusterCertsBasePath, "/"), aws.StringValue(discovery.Name(substrate)), "etcd-snapshots") + "/"
+}
+
 func ErrNoSuchBucket(err error) bool {
 	if err != nil {
 		if aerr := awserr.Error(nil); errors.As(err, &aerr) {
@@ -133,17 +380,148 @@ func ErrNoSuchBucket(err error) bool {
 	return false
 }
 
+// errBatchNoSuchBucket is true when a batch delete failed as the bucket is
+// missing, the batch error's code is generic and the listing's code is only
+// in its message
+func errBatchNoSuchBucket(err error) bool {
+	if aerr := awserr.Error(nil); errors.As(err, &aerr) {
+		return strings.Contains(aerr.Error(), s3.ErrCodeNoSuchBucket)
+	}
+	return false
+}
+
 func (c *Config) generateCerts(cfg *kubeadm.InitConfiguration, substrate *v1alpha1.Substrate) error {
 	cfg.CertificatesDir = path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), certPKIPath)
 	certTree, err := certs.GetDefaultCertList().AsMap().CertTree()
 	if err != nil {
 		return err
 	}
-	if err := certTree.CreateTree(cfg); err != nil {
-		return fmt.Errorf("error creating cert tree, %w", err)
+	if err := removeCertMissingSANs(cfg.CertificatesDir, kubeadmconstants.APIServerCertAndKeyBaseName, cfg.APIServer.CertSANs); err != nil {
+		return err
+	}
+	complete, err := removeCertsToRenew(cfg.CertificatesDir, certTree, substrate)
+	if err != nil {
+		return err
+	}
+	// The tree is only created when certificates are missing, as loading and
+	// verifying the existing tree is slow
+	if !complete {
+		if err := certTree.CreateTree(cfg); err != nil {
+			return fmt.Errorf("error creating cert tree, %w", err)
+		}
+		c.event(substrate, v1.EventTypeNormal, "CertificatesGenerated", "Generated certificates in %s", cfg.CertificatesDir)
 	}
 	// create private and public keys for service accounts
-	return certs.CreateServiceAccountKeyAndPublicKeyFiles(cfg.CertificatesDir, cfg.ClusterConfiguration.PublicKeyAlgorithm())
+	return serviceAccountKeys(cfg, substrate)
+}
+
+// removeCertMissingSANs removes a certificate and its key when it's missing
+// one of the SANs, kubeadm keeps existing certificates and fails validating
+// them against the SANs otherwise. The API server reloads its serving
+// certificate from disk once the reissued certificate is synced to the node.
+func removeCertMissingSANs(pkiDir, baseName string, sans []string) error {
+	if !pkiutil.CertOrKeyExist(pkiDir, baseName) {
+		return nil
+	}
+	cert, err := pkiutil.TryLoadCertFromDisk(pkiDir, baseName)
+	if err != nil {
+		return fmt.Errorf("loading %s certificate, %w", baseName, err)
+	}
+	for _, san := range sans {
+		if cert.VerifyHostname(san) != nil {
+			certPath, keyPath := pkiutil.PathsForCertAndKey(pkiDir, baseName)
+			for _, file := range []string{certPath, keyPath} {
+				if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("removing %s, %w", file, err)
+				}
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// removeCertsToRenew removes the certificates signed by the CAs that expire
+// within the substrate's renewal threshold, are signed by another CA or are
+// forced to renew, so the cert tree reissues them with the existing CAs. It
+// reports whether all of the tree's certificates exist.
+func removeCertsToRenew(pkiDir string, certTree certs.CertificateTree, substrate *v1alpha1.Substrate) (bool, error) {
+	renewBefore := v1alpha1.DefaultCertificateRenewBefore
+	if substrate.Spec.CertificateRenewBefore != nil {
+		renewBefore = substrate.Spec.CertificateRenewBefore.Duration
+	}
+	complete := true
+	for ca, leaves := range certTree {
+		if !certAndKeyExist(pkiDir, ca.BaseName) {
+			complete = false
+			continue
+		}
+		caCert, err := pkiutil.TryLoadCertFromDisk(pkiDir, ca.BaseName)
+		if err != nil {
+			return false, fmt.Errorf("loading %s certificate, %w", ca.BaseName, err)
+		}
+		for _, leaf := range leaves {
+			if !certAndKeyExist(pkiDir, leaf.BaseName) {
+				complete = false
+				continue
+			}
+			cert, err := pkiutil.TryLoadCertFromDisk(pkiDir, leaf.BaseName)
+			if err != nil {
+				return false, fmt.Errorf("loading %s certificate, %w", leaf.BaseName, err)
+			}
+			if !forcesRenewal(substrate, cert) && time.Until(cert.NotAfter) > renewBefore && cert.CheckSignatureFrom(caCert) == nil {
+				continue
+			}
+			certPath, keyPath := pkiutil.PathsForCertAndKey(pkiDir, leaf.BaseName)
+			for _, file := range []string{certPath, keyPath} {
+				if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+					return false, fmt.Errorf("removing %s, %w", file, err)
+				}
+			}
+			complete = false
+		}
+	}
+	return complete, nil
+}
+
+// forcesRenewal of a certificate issued before the substrate's forced renewal
+// time. kubeadm backdates the certificates it signs to their CA's NotBefore,
+// so when they were issued is derived from their expiry instead, which is
+// only precise to the second like the serialized time.
+func forcesRenewal(substrate *v1alpha1.Substrate, cert *x509.Certificate) bool {
+	force := substrate.Spec.ForceCertificateRenewal
+	return force != nil && cert.NotAfter.Add(-kubeadmconstants.CertificateValidity).Before(force.Time.Truncate(time.Second))
+}
+
+// certificateExpiry is the earliest expiry of the cert tree's certificates
+func certificateExpiry(pkiDir string) (*metav1.Time, error) {
+	certTree, err := certs.GetDefaultCertList().AsMap().CertTree()
+	if err != nil {
+		return nil, err
+	}
+	var expiry *metav1.Time
+	for ca, leaves := range certTree {
+		for _, kubeadmCert := range append(certs.Certificates{ca}, leaves...) {
+			cert, err := pkiutil.TryLoadCertFromDisk(pkiDir, kubeadmCert.BaseName)
+			if err != nil {
+				return nil, fmt.Errorf("loading %s certificate, %w", kubeadmCert.BaseName, err)
+			}
+			if expiry == nil || cert.NotAfter.Before(expiry.Time) {
+				expiry = &metav1.Time{Time: cert.NotAfter}
+			}
+		}
+	}
+	return expiry, nil
+}
+
+func certAndKeyExist(pkiDir, baseName string) bool {
+	certPath, keyPath := pkiutil.PathsForCertAndKey(pkiDir, baseName)
+	for _, file := range []string{certPath, keyPath} {
+		if _, err := os.Stat(file); err != nil {
+			return false
+		}
+	}
+	return true
 }
 
 func (c *Config) kubeConfigs(cfg *kubeadm.InitConfiguration, substrate *v1alpha1.Substrate) error {
@@ -154,7 +532,13 @@ func (c *Config) kubeConfigs(cfg *kubeadm.InitConfiguration, substrate *v1alpha1
 		kubeadmconstants.KubeletKubeConfigFileName,
 		kubeadmconstants.ControllerManagerKubeConfigFileName,
 		kubeadmconstants.SchedulerKubeConfigFileName} {
-		if err := kubeconfig.CreateKubeConfigFile(kubeConfigFileName, kubeConfigDir, cfg); err != nil {
+		config := cfg
+		// Admin kubeconfig is used outside the substrate node and can point to an externally reachable endpoint
+		if kubeConfigFileName == kubeadmconstants.AdminKubeConfigFileName && substrate.Spec.KubeConfigEndpoint != nil {
+			config = cfg.DeepCopy()
+			config.ControlPlaneEndpoint = aws.StringValue(substrate.Spec.KubeConfigEndpoint)
+		}
+		if err := kubeconfig.CreateKubeConfigFile(kubeConfigFileName, kubeConfigDir, config); err != nil {
 			return fmt.Errorf("creating %v, %w", kubeConfigFileName, err)
 		}
 	}
@@ -179,23 +563,249 @@ func (c *Config) generateStaticPodManifests(cfg *kubeadm.InitConfiguration, subs
 			return fmt.Errorf("creating static pod file for %v, %w", componentName, err)
 		}
 	}
+	if substrate.Spec.AnonymousAuth != nil && !*substrate.Spec.AnonymousAuth {
+		if err := patchStaticPod(manifestDir, kubeadmconstants.KubeAPIServer, tcpSocketProbes); err != nil {
+			return err
+		}
+	}
+	if substrate.Spec.AuditLog != nil {
+		if err := patchStaticPod(manifestDir, kubeadmconstants.KubeAPIServer, annotateAuditPolicyHash(substrate)); err != nil {
+			return err
+		}
+	}
+	if substrate.Spec.EgressSelector != nil {
+		if err := patchStaticPod(manifestDir, kubeadmconstants.KubeAPIServer, annotateEgressSelectorHash(substrate)); err != nil {
+			return err
+		}
+	}
+	if substrate.Spec.ServiceAccountKey != nil {
+		for _, componentName := range []string{kubeadmconstants.KubeAPIServer, kubeadmconstants.KubeControllerManager} {
+			if err := patchStaticPod(manifestDir, componentName, annotateServiceAccountKeyHash(substrate)); err != nil {
+				return err
+			}
+		}
+	}
+	if secretsEncrypted(substrate) {
+		hash, err := EncryptionConfigHash(substrate)
+		if err != nil {
+			return err
+		}
+		if err := patchStaticPod(manifestDir, kubeadmconstants.KubeAPIServer, annotateEncryptionConfigHash(hash)); err != nil {
+			return err
+		}
+	}
+	if err := c.additionalSchedulers(manifestDir, substrate); err != nil {
+		return err
+	}
+	for componentName, sidecars := range substrate.Spec.ComponentSidecars {
+		if err := patchStaticPod(manifestDir, componentName, injectSidecars(sidecars)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchStaticPod modifies a static pod manifest generated by kubeadm
+func patchStaticPod(manifestDir, componentName string, patch func(*v1.Pod) error) error {
+	pod, err := staticpodutil.ReadStaticPodFromDisk(kubeadmconstants.GetStaticPodFilepath(componentName, manifestDir))
+	if err != nil {
+		return fmt.Errorf("reading static pod for %v, %w", componentName, err)
+	}
+	if err := patch(pod); err != nil {
+		return fmt.Errorf("patching static pod for %v, %w", componentName, err)
+	}
+	if err := staticpodutil.WriteStaticPodToDisk(componentName, manifestDir, *pod); err != nil {
+		return fmt.Errorf("writing static pod for %v, %w", componentName, err)
+	}
+	return nil
+}
+
+// injectSidecars appends the sidecars to the pod, sidecars can only mount volumes defined in the pod
+func injectSidecars(sidecars []v1.Container) func(*v1.Pod) error {
+	return func(pod *v1.Pod) error {
+		volumes := sets.NewString()
+		for _, volume := range pod.Spec.Volumes {
+			volumes.Insert(volume.Name)
+		}
+		for _, sidecar := range sidecars {
+			for _, volumeMount := range sidecar.VolumeMounts {
+				if !volumes.Has(volumeMount.Name) {
+					return fmt.Errorf("sidecar %s mounts volume %s not found", sidecar.Name, volumeMount.Name)
+				}
+			}
+		}
+		pod.Spec.Containers = append(pod.Spec.Containers, sidecars...)
+		return nil
+	}
+}
+
+// tcpSocketProbes replaces kubeadm's HTTPS probes, which are sent without
+// credentials and rejected when anonymous auth is disabled
+func tcpSocketProbes(pod *v1.Pod) error {
+	for i := range pod.Spec.Containers {
+		for _, probe := range []*v1.Probe{pod.Spec.Containers[i].LivenessProbe, pod.Spec.Containers[i].ReadinessProbe, pod.Spec.Containers[i].StartupProbe} {
+			if probe == nil || probe.HTTPGet == nil {
+				continue
+			}
+			probe.TCPSocket = &v1.TCPSocketAction{Host: probe.HTTPGet.Host, Port: probe.HTTPGet.Port}
+			probe.HTTPGet = nil
+		}
+	}
 	return nil
 }
 
-func (c *Config) ensureBucket(ctx context.Context, substrate *v1alpha1.Substrate) error {
-	if _, err := c.S3.CreateBucket(&s3.CreateBucketInput{Bucket: discovery.Name(substrate),
-		CreateBucketConfiguration: &s3.CreateBucketConfiguration{LocationConstraint: c.S3.Config.Region},
+func (c *Config) ensureBucket(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate) error {
+	input := &s3.CreateBucketInput{Bucket: discovery.BucketName(substrate)}
+	// us-east-1 is the default location and is rejected as a location constraint
+	if aws.StringValue(clients.Region) != endpoints.UsEast1RegionID {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: clients.Region}
+	}
+	attempt := 0
+	if err := retry.OnError(createBucketBackoff, func(err error) bool {
+		if !createBucketRetryable(err) {
+			return false
+		}
+		attempt++
+		logging.FromContext(ctx).Infof("Creating s3 bucket %s failed (attempt %d of %d), %s", aws.StringValue(input.Bucket), attempt, createBucketBackoff.Steps, err)
+		return true
+	}, func() error {
+		_, err := clients.S3.CreateBucket(input)
+		return err
 	}); err != nil {
-		if err.(awserr.Error).Code() != s3.ErrCodeBucketAlreadyOwnedByYou {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != s3.ErrCodeBucketAlreadyOwnedByYou {
 			return fmt.Errorf("creating S3 bucket, %w", err)
 		}
-		logging.FromContext(ctx).Infof("Found s3 bucket %s", aws.StringValue(discovery.Name(substrate)))
+		logging.FromContext(ctx).Infof("Found s3 bucket %s", aws.StringValue(discovery.BucketName(substrate)))
 	} else {
-		logging.FromContext(ctx).Infof("Created s3 bucket %s", aws.StringValue(discovery.Name(substrate)))
+		logging.FromContext(ctx).Infof("Created s3 bucket %s", aws.StringValue(discovery.BucketName(substrate)))
+		c.event(substrate, v1.EventTypeNormal, "BucketCreated", "Created S3 bucket %s", aws.StringValue(discovery.BucketName(substrate)))
+	}
+	// Tagged like the substrate's other resources so it's found when reaping
+	if _, err := clients.S3.PutBucketTagging(&s3.PutBucketTaggingInput{
+		Bucket: discovery.BucketName(substrate),
+		Tagging: &s3.Tagging{TagSet: []*s3.Tag{
+			{Key: aws.String(discovery.OwnerTagKey), Value: aws.String(substrate.Name)},
+			{Key: aws.String("Name"), Value: discovery.Name(substrate)},
+		}},
+	}); err != nil {
+		return fmt.Errorf("tagging S3 bucket, %w", err)
+	}
+	if acceleration := substrate.Spec.BucketTransferAcceleration; acceleration != nil {
+		status := s3.BucketAccelerateStatusSuspended
+		if *acceleration {
+			status = s3.BucketAccelerateStatusEnabled
+		}
+		if _, err := clients.S3.PutBucketAccelerateConfigurationWithContext(ctx, &s3.PutBucketAccelerateConfigurationInput{
+			Bucket:                  discovery.BucketName(substrate),
+			AccelerateConfiguration: &s3.AccelerateConfiguration{Status: aws.String(status)},
+		}); err != nil {
+			return fmt.Errorf("configuring S3 bucket transfer acceleration, %w", err)
+		}
+	}
+	return nil
+}
+
+// createBucketBackoff retries creating the bucket while a concurrent create or
+// delete of the bucket is in progress, or the request is throttled
+var createBucketBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Steps: 5, Cap: 30 * time.Second}
+
+func createBucketRetryable(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		// S3 throttles with SlowDown, which the SDK doesn't consider a throttling error
+		case "OperationAborted", "SlowDown":
+			return true
+		}
+	}
+	return request.IsErrorThrottle(err)
+}
+
+// ensurePublicAccessBlock blocks all public access to the bucket, and blocks
+// it again if any of the settings have been turned off since
+func (c *Config) ensurePublicAccessBlock(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate) error {
+	output, err := clients.S3.GetPublicAccessBlock(&s3.GetPublicAccessBlockInput{Bucket: discovery.BucketName(substrate)})
+	if err != nil {
+		if aerr := awserr.Error(nil); !errors.As(err, &aerr) || aerr.Code() != "NoSuchPublicAccessBlockConfiguration" {
+			return fmt.Errorf("getting public access block, %w", err)
+		}
+	} else if publicAccessBlocked(output.PublicAccessBlockConfiguration) {
+		return nil
+	}
+	if _, err := clients.S3.PutPublicAccessBlock(&s3.PutPublicAccessBlockInput{
+		Bucket: discovery.BucketName(substrate),
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	}); err != nil {
+		return fmt.Errorf("putting public access block, %w", err)
+	}
+	logging.FromContext(ctx).Infof("Blocked public access to s3 bucket %s", aws.StringValue(discovery.BucketName(substrate)))
+	return nil
+}
+
+func publicAccessBlocked(configuration *s3.PublicAccessBlockConfiguration) bool {
+	return configuration != nil &&
+		aws.BoolValue(configuration.BlockPublicAcls) &&
+		aws.BoolValue(configuration.BlockPublicPolicy) &&
+		aws.BoolValue(configuration.IgnorePublicAcls) &&
+		aws.BoolValue(configuration.RestrictPublicBuckets)
+}
+
+// ensureBucketEncryption sets the bucket's default encryption, as it stores
+// the control plane's private keys. Putting the configuration replaces any
+// existing configuration, so it's applied on every reconcile.
+func (c *Config) ensureBucketEncryption(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate) error {
+	rule := &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256)}
+	if substrate.Spec.BucketKMSKeyARN != nil {
+		rule = &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(s3.ServerSideEncryptionAwsKms), KMSMasterKeyID: substrate.Spec.BucketKMSKeyARN}
+	}
+	if _, err := clients.S3.PutBucketEncryption(&s3.PutBucketEncryptionInput{
+		Bucket: discovery.BucketName(substrate),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: rule}},
+		},
+	}); err != nil {
+		return fmt.Errorf("putting bucket encryption, %w", err)
 	}
+	logging.FromContext(ctx).Infof("Encrypted s3 bucket %s with %s", aws.StringValue(discovery.BucketName(substrate)), aws.StringValue(rule.SSEAlgorithm))
 	return nil
 }
 
+// auditPolicy writes the substrate's policy, or logs metadata for all requests
+// by default, the policy is synced to the node with the rest of /etc/kubernetes
+func (c *Config) auditPolicy(substrate *v1alpha1.Substrate) error {
+	if substrate.Spec.AuditLog == nil {
+		return nil
+	}
+	localPath := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), auditPolicyPath)
+	if err := os.MkdirAll(path.Dir(localPath), 0700); err != nil {
+		return fmt.Errorf("failed to create directory, %w", err)
+	}
+	return ioutil.WriteFile(localPath, []byte(auditPolicyFor(substrate)), 0644)
+}
+
+func auditPolicyFor(substrate *v1alpha1.Substrate) string {
+	if policy := substrate.Spec.AuditLog.Policy; policy != "" {
+		return policy
+	}
+	return auditPolicy
+}
+
+// annotateAuditPolicyHash restarts the API server when the audit policy
+// changes, as it's only read on start up
+func annotateAuditPolicyHash(substrate *v1alpha1.Substrate) func(*v1.Pod) error {
+	return func(pod *v1.Pod) error {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[auditPolicyHashAnnotation] = fmt.Sprintf("%x", sha256.Sum256([]byte(auditPolicyFor(substrate))))
+		return nil
+	}
+}
+
 func (c *Config) kubeletSystemService(cfg *kubeadm.InitConfiguration, substrate *v1alpha1.Substrate) error {
 	localDir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), kubeletSystemdPath)
 	if _, err := os.Stat(localDir); err != nil {
@@ -207,20 +817,108 @@ func (c *Config) kubeletSystemService(cfg *kubeadm.InitConfiguration, substrate
 		}
 	}
 	if err := ioutil.WriteFile(path.Join(localDir, "kubelet.service"), []byte(fmt.Sprintf(`[Unit]
-After=docker.service iptables-restore.service
-Requires=docker.service
+After=%[1]s.service iptables-restore.service
+Requires=%[1]s.service
 
 [Service]
-ExecStart=/usr/bin/kubelet --hostname-override=%s --address=127.0.0.1 --pod-manifest-path=/etc/kubernetes/manifests --kubeconfig=/etc/kubernetes/kubelet.conf  --cgroup-driver=systemd  --container-runtime=docker --network-plugin=cni --pod-infra-container-image=public.ecr.aws/eks-distro/kubernetes/pause:v1.18.9-eks-1-18-1 --node-labels=kit.aws/substrate=control-plane
-Restart=always`, substrate.Name)), 0644); err != nil {
+%[2]sExecStart=/usr/bin/kubelet --hostname-override=%[3]s --address=127.0.0.1 --pod-manifest-path=/etc/kubernetes/manifests --kubeconfig=%[11]s  --cgroup-driver=%[8]s  %[4]s --pod-infra-container-image=%[5]s --node-labels=%[9]s%[10]s%[6]s%[7]s
+Restart=always`, containerRuntimeService(substrate), kubeletEnvironmentFile(substrate), kubeletHostnameOverride(substrate), kubeletContainerRuntimeFlags(substrate),
+		pauseImage, kubeletFeatureGates(substrate), kubeletComponentArgs(substrate), cgroupDriverFor(substrate),
+		kubeletNodeLabels(substrate), kubeletNodeTaints(substrate), kubeletKubeConfig(substrate))), 0644); err != nil {
 		return fmt.Errorf("writing kubelet configuration, %w", err)
 	}
 	return nil
 }
 
+// kubeletEnvironmentFile sets the hostname resolved by the node, the kubelet's
+// client certificate for it is issued before the kubelet starts
+func kubeletEnvironmentFile(substrate *v1alpha1.Substrate) string {
+	if !nodeHostnameResolved(substrate) {
+		return ""
+	}
+	return fmt.Sprintf("EnvironmentFile=%s\nExecStartPre=%s\n", kubeletHostnameEnvFile, kubeletKubeConfigScript)
+}
+
+// kubeletContainerRuntimeArgs are the kubelet's flags for the substrate's
+// container runtime, --network-plugin is only used by dockershim
+func kubeletContainerRuntimeArgs(substrate *v1alpha1.Substrate) map[string]string {
+	if substrate.Spec.ContainerRuntime == v1alpha1.ContainerRuntimeContainerd {
+		return map[string]string{"container-runtime": "remote", "container-runtime-endpoint": containerdSocket}
+	}
+	return map[string]string{"container-runtime": "docker", "network-plugin": "cni"}
+}
+
+// cgroupDriverFor is the driver shared by the kubelet and the container
+// runtime, the kubelet fails to start when they differ
+func cgroupDriverFor(substrate *v1alpha1.Substrate) string {
+	if substrate.Spec.CgroupDriver == "" {
+		return v1alpha1.CgroupDriverSystemd
+	}
+	return substrate.Spec.CgroupDriver
+}
+
+// containerRuntimeService is the systemd unit the kubelet depends on
+func containerRuntimeService(substrate *v1alpha1.Substrate) string {
+	if substrate.Spec.ContainerRuntime == v1alpha1.ContainerRuntimeContainerd {
+		return "containerd"
+	}
+	return "docker"
+}
+
+func kubeletContainerRuntimeFlags(substrate *v1alpha1.Substrate) string {
+	flags := []string{}
+	for flag, value := range kubeletContainerRuntimeArgs(substrate) {
+		flags = append(flags, fmt.Sprintf("--%s=%s", flag, value))
+	}
+	sort.Strings(flags)
+	return strings.Join(flags, " ")
+}
+
+// kubeletNodeLabels are sorted after the substrate's label so the service is
+// stable across reconciles
+func kubeletNodeLabels(substrate *v1alpha1.Substrate) string {
+	labels := []string{}
+	for key, value := range substrate.KubeletNodeLabels() {
+		labels = append(labels, key+"="+value)
+	}
+	sort.Strings(labels)
+	return strings.Join(append([]string{v1alpha1.SubstrateNodeLabelKey + "=control-plane"}, labels...), ",")
+}
+
+func kubeletNodeTaints(substrate *v1alpha1.Substrate) string {
+	if len(substrate.Spec.NodeTaints) == 0 {
+		return ""
+	}
+	taints := []string{}
+	for _, taint := range substrate.Spec.NodeTaints {
+		taints = append(taints, taint.ToString())
+	}
+	return " --register-with-taints=" + strings.Join(taints, ",")
+}
+
+func kubeletFeatureGates(substrate *v1alpha1.Substrate) string {
+	if len(substrate.Spec.FeatureGates) == 0 {
+		return ""
+	}
+	return " --feature-gates=" + featureGatesFor(substrate)
+}
+
+// serviceIP is the address at offset in the substrate's service range, the
+// kubernetes service is the first and the cluster DNS the tenth. The range is
+// validated, an invalid range returns an empty address.
+func serviceIP(substrate *v1alpha1.Substrate, offset uint32) string {
+	_, ipNet, err := net.ParseCIDR(substrate.ServiceCIDR())
+	if err != nil || ipNet.IP.To4() == nil {
+		return ""
+	}
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(ipNet.IP.To4())+offset)
+	return ip.String()
+}
+
 func DefaultClusterConfig(substrate *v1alpha1.Substrate) *kubeadm.InitConfiguration {
 	defaultStaticConfig, err := config.DefaultedStaticInitConfiguration()
-	runtime.Must(err)
+	utilruntime.Must(err)
 	// etcd specific config
 	defaultStaticConfig.ClusterConfiguration.KubernetesVersion = kubernetesVersionTag
 	defaultStaticConfig.ClusterConfiguration.ImageRepository = imageRepository
@@ -242,39 +940,229 @@ func DefaultClusterConfig(substrate *v1alpha1.Substrate) *kubeadm.InitConfigurat
 	// master specific config
 	masterElasticIP := aws.StringValue(substrate.Status.Cluster.Address)
 	defaultStaticConfig.LocalAPIEndpoint.AdvertiseAddress = masterElasticIP
-	defaultStaticConfig.LocalAPIEndpoint.BindPort = 443
-	defaultStaticConfig.ControlPlaneEndpoint = masterElasticIP + ":443"
+	port := strconv.Itoa(int(substrate.APIServerPort()))
+	defaultStaticConfig.LocalAPIEndpoint.BindPort = substrate.APIServerPort()
+	defaultStaticConfig.ControlPlaneEndpoint = net.JoinHostPort(masterElasticIP, port)
+	defaultStaticConfig.Networking.ServiceSubnet = substrate.ServiceCIDR()
 	defaultStaticConfig.APIServer.CertSANs = []string{masterElasticIP, substrate.Name,
-		"kubernetes", "kubernetes.default", "kubernetes.default.svc", "kubernetes.default.svc.cluster.local", "10.96.0.1"}
+		"kubernetes", "kubernetes.default", "kubernetes.default.svc", "kubernetes.default.svc.cluster.local", serviceIP(substrate, 1)}
+	defaultStaticConfig.APIServer.CertSANs = append(defaultStaticConfig.APIServer.CertSANs, substrate.Spec.AdditionalCertSANs...)
+	// The admin kubeconfig's server is verified against the certificate too
+	if substrate.Spec.KubeConfigEndpoint != nil {
+		if host, _, err := net.SplitHostPort(*substrate.Spec.KubeConfigEndpoint); err == nil {
+			defaultStaticConfig.APIServer.CertSANs = append(defaultStaticConfig.APIServer.CertSANs, host)
+		}
+	}
 	defaultStaticConfig.APIServer.ExtraArgs = map[string]string{
 		"advertise-address": masterElasticIP,
-		"secure-port":       "443",
-		"authentication-token-webhook-config-file": "/var/aws-iam-authenticator/kubeconfig/kubeconfig.yaml",
-	}
-	defaultStaticConfig.APIServer.ExtraVolumes = []kubeadm.HostPathMount{{
-		Name:      "authenticator-config",
-		HostPath:  "/var/aws-iam-authenticator/kubeconfig/kubeconfig.yaml",
-		MountPath: "/var/aws-iam-authenticator/kubeconfig/kubeconfig.yaml",
-		ReadOnly:  true,
-		PathType:  v1.HostPathFileOrCreate,
-	}}
+		"secure-port":       port,
+	}
+	if substrate.IAMAuthenticatorEnabled() {
+		defaultStaticConfig.APIServer.ExtraArgs["authentication-token-webhook-config-file"] = authenticatorKubeconfig
+	}
+	if substrate.Spec.AnonymousAuth != nil {
+		defaultStaticConfig.APIServer.ExtraArgs["anonymous-auth"] = strconv.FormatBool(*substrate.Spec.AnonymousAuth)
+	}
+	if substrate.Spec.EnableBootstrapTokenAuth != nil {
+		defaultStaticConfig.APIServer.ExtraArgs["enable-bootstrap-token-auth"] = strconv.FormatBool(*substrate.Spec.EnableBootstrapTokenAuth)
+	}
+	if substrate.Spec.ServiceAccountExtendTokenExpiration != nil {
+		defaultStaticConfig.APIServer.ExtraArgs["service-account-extend-token-expiration"] = strconv.FormatBool(*substrate.Spec.ServiceAccountExtendTokenExpiration)
+	}
+	if substrate.Spec.WatchCacheEnabled != nil {
+		defaultStaticConfig.APIServer.ExtraArgs["watch-cache"] = strconv.FormatBool(*substrate.Spec.WatchCacheEnabled)
+	}
+	if len(substrate.Spec.WatchCacheSizes) > 0 {
+		defaultStaticConfig.APIServer.ExtraArgs["watch-cache-sizes"] = watchCacheSizesFor(substrate)
+	}
+	if substrate.Spec.StorageBackend != "" {
+		defaultStaticConfig.APIServer.ExtraArgs["storage-backend"] = substrate.Spec.StorageBackend
+	}
+	if substrate.Spec.StorageMediaType != "" {
+		defaultStaticConfig.APIServer.ExtraArgs["storage-media-type"] = substrate.Spec.StorageMediaType
+	}
+	if substrate.Spec.HTTP2MaxStreamsPerConnection != nil {
+		defaultStaticConfig.APIServer.ExtraArgs["http2-max-streams-per-connection"] = fmt.Sprint(*substrate.Spec.HTTP2MaxStreamsPerConnection)
+	}
+	if substrate.Spec.EventTTL != nil {
+		defaultStaticConfig.APIServer.ExtraArgs["event-ttl"] = substrate.Spec.EventTTL.Duration.String()
+	}
+	if len(substrate.Spec.RuntimeConfig) > 0 {
+		defaultStaticConfig.APIServer.ExtraArgs["runtime-config"] = runtimeConfigFor(substrate)
+	}
+	if authCache := substrate.Spec.AuthCache; authCache != nil {
+		for flag, ttl := range map[string]*metav1.Duration{
+			"authentication-token-webhook-cache-ttl":       authCache.TokenWebhookTTL,
+			"authorization-webhook-cache-authorized-ttl":   authCache.AuthorizedTTL,
+			"authorization-webhook-cache-unauthorized-ttl": authCache.UnauthorizedTTL,
+		} {
+			if ttl != nil {
+				defaultStaticConfig.APIServer.ExtraArgs[flag] = ttl.Duration.String()
+			}
+		}
+	}
+	// kubeadm configures the front-proxy CA and client certificate, only the trusted names and headers are overridden
+	if requestHeader := substrate.Spec.RequestHeader; requestHeader != nil {
+		for flag, values := range map[string][]string{
+			"requestheader-allowed-names":        requestHeader.AllowedNames,
+			"requestheader-username-headers":     requestHeader.UsernameHeaders,
+			"requestheader-group-headers":        requestHeader.GroupHeaders,
+			"requestheader-extra-headers-prefix": requestHeader.ExtraHeadersPrefix,
+		} {
+			if len(values) > 0 {
+				defaultStaticConfig.APIServer.ExtraArgs[flag] = strings.Join(values, ",")
+			}
+		}
+	}
+	if substrate.Spec.OIDC != nil {
+		for flag, value := range oidcArgsFor(substrate.Spec.OIDC) {
+			defaultStaticConfig.APIServer.ExtraArgs[flag] = value
+		}
+	}
+	if substrate.IAMAuthenticatorEnabled() {
+		defaultStaticConfig.APIServer.ExtraVolumes = append(defaultStaticConfig.APIServer.ExtraVolumes, kubeadm.HostPathMount{
+			Name:      "authenticator-config",
+			HostPath:  authenticatorKubeconfig,
+			MountPath: authenticatorKubeconfig,
+			ReadOnly:  true,
+			PathType:  v1.HostPathFileOrCreate,
+		})
+	}
+	if auditLog := substrate.Spec.AuditLog; auditLog != nil {
+		defaultStaticConfig.APIServer.ExtraArgs["audit-policy-file"] = auditPolicyPath
+		defaultStaticConfig.APIServer.ExtraArgs["audit-log-path"] = path.Join(auditLogDir, "audit.log")
+		defaultStaticConfig.APIServer.ExtraArgs["audit-log-maxage"] = fmt.Sprint(aws.Int32Value(auditLog.MaxAge))
+		defaultStaticConfig.APIServer.ExtraArgs["audit-log-maxbackup"] = fmt.Sprint(aws.Int32Value(auditLog.MaxBackup))
+		defaultStaticConfig.APIServer.ExtraArgs["audit-log-maxsize"] = fmt.Sprint(aws.Int32Value(auditLog.MaxSize))
+		defaultStaticConfig.APIServer.ExtraVolumes = append(defaultStaticConfig.APIServer.ExtraVolumes, kubeadm.HostPathMount{
+			Name:      "audit-policy",
+			HostPath:  auditPolicyPath,
+			MountPath: auditPolicyPath,
+			ReadOnly:  true,
+			PathType:  v1.HostPathFile,
+		}, kubeadm.HostPathMount{
+			Name:      "audit-log",
+			HostPath:  auditLogDir,
+			MountPath: auditLogDir,
+			PathType:  v1.HostPathDirectoryOrCreate,
+		})
+	}
+	if secretsEncrypted(substrate) {
+		defaultStaticConfig.APIServer.ExtraArgs["encryption-provider-config"] = encryptionConfigPath
+		defaultStaticConfig.APIServer.ExtraVolumes = append(defaultStaticConfig.APIServer.ExtraVolumes, kubeadm.HostPathMount{
+			Name:      "encryption-config",
+			HostPath:  encryptionConfigPath,
+			MountPath: encryptionConfigPath,
+			ReadOnly:  true,
+			PathType:  v1.HostPathFile,
+		})
+	}
+	if substrate.Spec.EgressSelector != nil {
+		defaultStaticConfig.APIServer.ExtraArgs["egress-selector-config-file"] = egressSelectorConfigPath
+		defaultStaticConfig.APIServer.ExtraVolumes = append(defaultStaticConfig.APIServer.ExtraVolumes, kubeadm.HostPathMount{
+			Name:      "egress-selector-config",
+			HostPath:  egressSelectorConfigPath,
+			MountPath: egressSelectorConfigPath,
+			ReadOnly:  true,
+			PathType:  v1.HostPathFile,
+		})
+		for i, dir := range egressSocketDirs(substrate) {
+			defaultStaticConfig.APIServer.ExtraVolumes = append(defaultStaticConfig.APIServer.ExtraVolumes, kubeadm.HostPathMount{
+				Name:      fmt.Sprintf("egress-proxy-%d", i),
+				HostPath:  dir,
+				MountPath: dir,
+				PathType:  v1.HostPathDirectoryOrCreate,
+			})
+		}
+	}
 	if defaultStaticConfig.Scheduler.ExtraArgs == nil {
 		defaultStaticConfig.Scheduler.ExtraArgs = map[string]string{}
 	}
 	if defaultStaticConfig.ControllerManager.ExtraArgs == nil {
 		defaultStaticConfig.ControllerManager.ExtraArgs = map[string]string{}
 	}
+	if len(substrate.Spec.FeatureGates) > 0 {
+		for _, extraArgs := range []map[string]string{defaultStaticConfig.APIServer.ExtraArgs,
+			defaultStaticConfig.ControllerManager.ExtraArgs, defaultStaticConfig.Scheduler.ExtraArgs} {
+			extraArgs["feature-gates"] = featureGatesFor(substrate)
+		}
+	}
 	defaultStaticConfig.NodeRegistration = kubeadm.NodeRegistrationOptions{
 		Name: substrate.Name,
-		KubeletExtraArgs: map[string]string{"cgroup-driver": "systemd", "network-plugin": "cni",
+		KubeletExtraArgs: map[string]string{"cgroup-driver": cgroupDriverFor(substrate),
 			"pod-infra-container-image": imageRepository + "/pause:" + kubernetesVersionTag,
 		},
 	}
+	for flag, value := range kubeletContainerRuntimeArgs(substrate) {
+		defaultStaticConfig.NodeRegistration.KubeletExtraArgs[flag] = value
+	}
+	if substrate.Spec.ContainerRuntime == v1alpha1.ContainerRuntimeContainerd {
+		defaultStaticConfig.NodeRegistration.CRISocket = containerdSocket
+	}
+	// User flags are merged last to take precedence over the defaults above
+	if args := substrate.Spec.ComponentArgs; args != nil {
+		for _, merge := range []struct{ defaults, user map[string]string }{
+			{defaultStaticConfig.APIServer.ExtraArgs, args.APIServer},
+			{defaultStaticConfig.ControllerManager.ExtraArgs, args.ControllerManager},
+			{defaultStaticConfig.Scheduler.ExtraArgs, args.Scheduler},
+			{defaultStaticConfig.Etcd.Local.ExtraArgs, args.Etcd},
+			{defaultStaticConfig.NodeRegistration.KubeletExtraArgs, args.Kubelet},
+		} {
+			for flag, value := range merge.user {
+				merge.defaults[flag] = value
+			}
+		}
+	}
 	return defaultStaticConfig
 }
 
-func (c *Config) ensureAuthenticatorConfig(ctx context.Context, substrate *v1alpha1.Substrate) error {
-	identity, err := c.STS.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+// kubeletComponentArgs are appended to the kubelet's command line, where the
+// last occurrence of a flag wins
+func kubeletComponentArgs(substrate *v1alpha1.Substrate) string {
+	if substrate.Spec.ComponentArgs == nil {
+		return ""
+	}
+	args := []string{}
+	for flag, value := range substrate.Spec.ComponentArgs.Kubelet {
+		args = append(args, fmt.Sprintf(" --%s=%s", flag, value))
+	}
+	// Sorted so the service is stable across reconciles
+	sort.Strings(args)
+	return strings.Join(args, "")
+}
+
+// watchCacheSizesFor sorts the entries so the flag and static pod are stable across reconciles
+func watchCacheSizesFor(substrate *v1alpha1.Substrate) string {
+	entries := []string{}
+	for resource, size := range substrate.Spec.WatchCacheSizes {
+		entries = append(entries, fmt.Sprintf("%s#%d", resource, size))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// featureGatesFor sorts the gates so the flag and static pods are stable across reconciles
+func featureGatesFor(substrate *v1alpha1.Substrate) string {
+	entries := []string{}
+	for gate, enabled := range substrate.Spec.FeatureGates {
+		entries = append(entries, gate+"="+strconv.FormatBool(enabled))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// runtimeConfigFor sorts the entries so the flag and static pod are stable across reconciles
+func runtimeConfigFor(substrate *v1alpha1.Substrate) string {
+	entries := []string{}
+	for groupVersion, enabled := range substrate.Spec.RuntimeConfig {
+		entries = append(entries, groupVersion+"="+enabled)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+func (c *Config) ensureAuthenticatorConfig(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate) error {
+	identity, err := clients.STS.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
 		return fmt.Errorf("getting caller identity, %w", err)
 	}
@@ -301,14 +1189,14 @@ func (c *Config) staticPodSpecForAuthenticator(ctx context.Context, substrate *v
 			VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: authenticatorConfigDir}},
 		})
 		return template
-	})
+	}, iamauthenticator.WithAPIServerPort(substrate.APIServerPort()))
 	serialized, err := kubeadmutil.MarshalToYaml(
 		&v1.Pod{ObjectMeta: podTemplateSpec.ObjectMeta, Spec: podTemplateSpec.Spec}, v1.SchemeGroupVersion)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config map manifest, %w", err)
 	}
 	if err := ioutil.WriteFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)),
-		clusterManifestPath, "aws-iam-authenticator.yaml"), serialized, 0644); err != nil {
+		clusterManifestPath, authenticatorComponentName+".yaml"), serialized, 0644); err != nil {
 		return fmt.Errorf("writing authenticator pod yaml, %w", err)
 	}
 	return nil
@@ -327,8 +1215,17 @@ type DirectoryIterator struct {
 
 // NewDirectoryIterator builds a new DirectoryIterator
 func NewDirectoryIterator(bucket, dir string) s3manager.BatchUploadIterator {
+	paths, err := directoryFiles(dir)
+	return &DirectoryIterator{
+		filePaths: paths,
+		bucket:    bucket,
+		err:       err,
+	}
+}
+
+func directoryFiles(dir string) ([]string, error) {
 	var paths []string
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -336,16 +1233,36 @@ func NewDirectoryIterator(bucket, dir string) s3manager.BatchUploadIterator {
 			paths = append(paths, path)
 		}
 		return nil
-	})
-	return &DirectoryIterator{
-		filePaths: paths,
-		bucket:    bucket,
+	}); err != nil {
+		return nil, fmt.Errorf("walking %s, %w", dir, err)
 	}
+	return paths, nil
+}
+
+// uploadDirectory uploads the files in dir with up to uploadWorkers concurrent
+// uploads, using the same keys as NewDirectoryIterator. The first failed
+// upload cancels the files that haven't started uploading.
+func uploadDirectory(ctx context.Context, uploader s3manageriface.UploadWithIterator, bucket, dir string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// The s3manager.Uploader doesn't check the iterator's Err, so walking
+	// the directory fails before uploading
+	paths, err := directoryFiles(dir)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, len(paths))
+	workqueue.ParallelizeUntil(ctx, uploadWorkers, len(paths), func(i int) {
+		if errs[i] = uploader.UploadWithIterator(ctx, &DirectoryIterator{filePaths: paths[i : i+1], bucket: bucket}); errs[i] != nil {
+			cancel()
+		}
+	})
+	return multierr.Combine(errs...)
 }
 
 // Next returns whether next file exists or not
 func (d *DirectoryIterator) Next() bool {
-	if len(d.filePaths) == 0 {
+	if d.err != nil || len(d.filePaths) == 0 {
 		d.next.f = nil
 		return false
 	}
@@ -367,3 +1284,15 @@ func (d *DirectoryIterator) UploadObject() s3manager.BatchUploadObject {
 		After:  d.next.f.Close,
 	}
 }
+
+var auditPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+omitStages:
+- RequestReceived
+rules:
+- level: None
+  resources:
+  - group: ""
+    resources: ["events"]
+- level: Metadata
+`
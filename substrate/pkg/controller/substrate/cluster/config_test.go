@@ -0,0 +1,2518 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/keyutil"
+	bootstrapjws "k8s.io/cluster-bootstrap/token/jws"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/pkiutil"
+	staticpodutil "k8s.io/kubernetes/cmd/kubeadm/app/util/staticpod"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeS3 records the buckets used by the calls the Config makes
+type fakeS3 struct {
+	s3iface.S3API
+	created []string
+	listed  []string
+	deleted []string
+	regions []string
+	inputs  []*s3.CreateBucketInput
+	// encryption is the default encryption put on the bucket
+	encryption *s3.ServerSideEncryptionByDefault
+	// publicAccessBlock is the bucket's current public access block, nil if unset
+	publicAccessBlock  *s3.PublicAccessBlockConfiguration
+	publicAccessBlocks []*s3.PutPublicAccessBlockInput
+	// getPublicAccessBlockErr is returned by GetPublicAccessBlock when set
+	getPublicAccessBlockErr error
+	// tags are the tags put on the bucket
+	tags []*s3.Tag
+	// objects are the keys in the bucket
+	objects []string
+	// createBucketErrors are returned by the next calls to CreateBucket
+	createBucketErrors []error
+	// listErr and deleteBucketErr fail listing the objects and deleting the bucket
+	listErr         error
+	deleteBucketErr error
+	// accelerateStatus is the bucket's transfer acceleration, empty if unset
+	accelerateStatus string
+}
+
+func (f *fakeS3) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	if len(f.createBucketErrors) > 0 {
+		err := f.createBucketErrors[0]
+		f.createBucketErrors = f.createBucketErrors[1:]
+		return nil, err
+	}
+	f.created = append(f.created, aws.StringValue(input.Bucket))
+	// Buckets created without a location constraint are in us-east-1
+	region := "us-east-1"
+	if input.CreateBucketConfiguration != nil {
+		region = aws.StringValue(input.CreateBucketConfiguration.LocationConstraint)
+	}
+	f.regions = append(f.regions, region)
+	f.inputs = append(f.inputs, input)
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (f *fakeS3) PutBucketTagging(input *s3.PutBucketTaggingInput) (*s3.PutBucketTaggingOutput, error) {
+	f.tags = input.Tagging.TagSet
+	return &s3.PutBucketTaggingOutput{}, nil
+}
+
+func (f *fakeS3) PutBucketEncryption(input *s3.PutBucketEncryptionInput) (*s3.PutBucketEncryptionOutput, error) {
+	f.encryption = input.ServerSideEncryptionConfiguration.Rules[0].ApplyServerSideEncryptionByDefault
+	return &s3.PutBucketEncryptionOutput{}, nil
+}
+
+func (f *fakeS3) PutBucketAccelerateConfigurationWithContext(_ aws.Context, input *s3.PutBucketAccelerateConfigurationInput, _ ...request.Option) (*s3.PutBucketAccelerateConfigurationOutput, error) {
+	f.accelerateStatus = aws.StringValue(input.AccelerateConfiguration.Status)
+	return &s3.PutBucketAccelerateConfigurationOutput{}, nil
+}
+
+func (f *fakeS3) GetPublicAccessBlock(_ *s3.GetPublicAccessBlockInput) (*s3.GetPublicAccessBlockOutput, error) {
+	if f.getPublicAccessBlockErr != nil {
+		return nil, f.getPublicAccessBlockErr
+	}
+	if f.publicAccessBlock == nil {
+		return nil, awserr.New("NoSuchPublicAccessBlockConfiguration", "The public access block configuration was not found", nil)
+	}
+	return &s3.GetPublicAccessBlockOutput{PublicAccessBlockConfiguration: f.publicAccessBlock}, nil
+}
+
+func (f *fakeS3) PutPublicAccessBlock(input *s3.PutPublicAccessBlockInput) (*s3.PutPublicAccessBlockOutput, error) {
+	f.publicAccessBlocks = append(f.publicAccessBlocks, input)
+	f.publicAccessBlock = input.PublicAccessBlockConfiguration
+	return &s3.PutPublicAccessBlockOutput{}, nil
+}
+
+func (f *fakeS3) ListObjectsRequest(input *s3.ListObjectsInput) (*request.Request, *s3.ListObjectsOutput) {
+	f.listed = append(f.listed, aws.StringValue(input.Bucket))
+	output := &s3.ListObjectsOutput{}
+	handlers := request.Handlers{}
+	handlers.Send.PushBack(func(r *request.Request) { r.Error = f.listErr })
+	return request.New(aws.Config{}, metadata.ClientInfo{}, handlers, nil, &request.Operation{Name: "ListObjects"}, input, output), output
+}
+
+// GetObjectRequest returns a request of a real client to presign, signing
+// happens locally with static credentials
+func (f *fakeS3) GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	return s3.New(session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))).GetObjectRequest(input)
+}
+
+func (f *fakeS3) ListObjectsV2PagesWithContext(_ aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range f.objects {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			output.Contents = append(output.Contents, &s3.Object{Key: aws.String(key)})
+		}
+	}
+	fn(output, true)
+	return nil
+}
+
+func (f *fakeS3) DeleteObjectsWithContext(_ aws.Context, input *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	deleted := sets.NewString()
+	for _, object := range input.Delete.Objects {
+		deleted.Insert(aws.StringValue(object.Key))
+	}
+	objects := []string{}
+	for _, key := range f.objects {
+		if !deleted.Has(key) {
+			objects = append(objects, key)
+		}
+	}
+	f.objects = objects
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (f *fakeS3) DeleteBucketWithContext(_ aws.Context, input *s3.DeleteBucketInput, _ ...request.Option) (*s3.DeleteBucketOutput, error) {
+	if f.deleteBucketErr != nil {
+		return nil, f.deleteBucketErr
+	}
+	f.deleted = append(f.deleted, aws.StringValue(input.Bucket))
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+// fakeClientFactory returns a factory whose clients are already cached for the region
+func fakeClientFactory(fake *fakeS3, region string) *ClientFactory {
+	return &ClientFactory{
+		session: session.Must(session.NewSession(&aws.Config{Region: aws.String(region)})),
+		clients: map[string]*Clients{region: {Region: aws.String(region), S3: fake, SSM: &fakeSSM{}}},
+	}
+}
+
+func TestBucketNameWithPrefixAndSuffix(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeS3{}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{BucketNamePrefix: "acme-dev", BucketNameSuffix: "config"},
+	}
+	config := &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket, %v", err)
+	}
+	if _, err := config.Delete(ctx, substrate); err != nil {
+		t.Fatalf("deleting config, %v", err)
+	}
+	if len(fake.tags) == 0 || aws.StringValue(fake.tags[0].Value) != "test-substrate" {
+		t.Errorf("expected bucket to be tagged with the substrate, got %v", fake.tags)
+	}
+	expected := "acme-dev-kit-test-substrate-config"
+	for _, buckets := range [][]string{fake.created, fake.listed, fake.deleted} {
+		if len(buckets) != 1 || buckets[0] != expected {
+			t.Errorf("expected bucket %s, got %v", expected, buckets)
+		}
+	}
+}
+
+func TestBucketTransferAcceleration(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	fake := &fakeS3{}
+	config := &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+	if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket, %v", err)
+	}
+	if fake.accelerateStatus != "" {
+		t.Errorf("expected the accelerate configuration to be unchanged, got %s", fake.accelerateStatus)
+	}
+	substrate.Spec.BucketTransferAcceleration = aws.Bool(true)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket, %v", err)
+	}
+	if fake.accelerateStatus != s3.BucketAccelerateStatusEnabled {
+		t.Errorf("expected transfer acceleration to be enabled, got %s", fake.accelerateStatus)
+	}
+	substrate.Spec.BucketTransferAcceleration = aws.Bool(false)
+	if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket, %v", err)
+	}
+	if fake.accelerateStatus != s3.BucketAccelerateStatusSuspended {
+		t.Errorf("expected transfer acceleration to be suspended, got %s", fake.accelerateStatus)
+	}
+
+	// The accelerate uploader's client resolves the accelerate endpoint
+	clients := NewClientFactory(session.Must(session.NewSession(&aws.Config{Region: aws.String("us-west-2")}))).For(substrate)
+	for uploader, expected := range map[s3manageriface.UploadWithIterator]string{
+		clients.S3Uploader:           "kit-test-substrate.s3.us-west-2.amazonaws.com",
+		clients.S3AccelerateUploader: "kit-test-substrate.s3-accelerate.amazonaws.com",
+	} {
+		req, _ := uploader.(*s3manager.Uploader).S3.(*s3.S3).PutObjectRequest(&s3.PutObjectInput{Bucket: discovery.BucketName(substrate), Key: aws.String("config.yaml")})
+		if err := req.Build(); err != nil {
+			t.Fatalf("building request, %v", err)
+		}
+		if req.HTTPRequest.URL.Host != expected {
+			t.Errorf("expected the upload to use %s, got %s", expected, req.HTTPRequest.URL.Host)
+		}
+	}
+
+	substrate.Spec.BucketTransferAcceleration = aws.Bool(true)
+	substrate.Spec.BucketNameSuffix = "example.com"
+	if err := substrate.Validate(ctx); err == nil {
+		t.Errorf("expected a bucket name with dots to fail validation with transfer acceleration")
+	}
+}
+
+func TestEnsureBucketRetries(t *testing.T) {
+	defer func(backoff wait.Backoff) { createBucketBackoff = backoff }(createBucketBackoff)
+	createBucketBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx := logging.WithLogger(context.Background(), zap.New(core).Sugar())
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	aborted := awserr.New("OperationAborted", "A conflicting conditional operation is currently in progress", nil)
+	throttled := awserr.New("SlowDown", "Please reduce your request rate", nil)
+
+	fake := &fakeS3{createBucketErrors: []error{aborted, throttled}}
+	config := &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+	if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket, %v", err)
+	}
+	if len(fake.created) != 1 {
+		t.Errorf("expected the bucket to be created after retrying, got %v", fake.created)
+	}
+	if retries := logs.FilterMessageSnippet("Creating s3 bucket").Len(); retries != 2 {
+		t.Errorf("expected 2 retries to be logged, got %d", retries)
+	}
+
+	// Already owned isn't retried
+	fake = &fakeS3{createBucketErrors: []error{awserr.New(s3.ErrCodeBucketAlreadyOwnedByYou, "", nil), aborted}}
+	config = &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+	if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket, %v", err)
+	}
+	if len(fake.createBucketErrors) != 1 {
+		t.Errorf("expected an owned bucket not to be retried")
+	}
+
+	// The error is returned once the retries are exhausted
+	fake = &fakeS3{createBucketErrors: []error{aborted, aborted, aborted, aborted}}
+	config = &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+	if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); !errors.Is(err, aborted) {
+		t.Errorf("expected %v after exhausting retries, got %v", aborted, err)
+	}
+	if len(fake.createBucketErrors) != 1 {
+		t.Errorf("expected %d attempts, got %d", createBucketBackoff.Steps, 4-len(fake.createBucketErrors))
+	}
+}
+
+func TestBucketNameTooLong(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{BucketNamePrefix: "a-very-long-organization-prefix-for-all-team-buckets"},
+	}
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected bucket name longer than 63 characters to fail validation")
+	}
+}
+
+func TestEventTTL(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{EventTTL: &metav1.Duration{Duration: 6 * time.Hour}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if ttl := DefaultClusterConfig(substrate).APIServer.ExtraArgs["event-ttl"]; ttl != "6h0m0s" {
+		t.Errorf("expected event-ttl 6h0m0s, got %s", ttl)
+	}
+	substrate.Spec.EventTTL.Duration = 48 * time.Hour
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected event-ttl above the cap to fail validation")
+	}
+}
+
+func TestKubeConfigEndpoint(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-kubeconfig-endpoint"},
+		Spec:       v1alpha1.SubstrateSpec{KubeConfigEndpoint: aws.String("localhost:8443")},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	cfg := DefaultClusterConfig(substrate)
+	if err := config.generateCerts(cfg, substrate); err != nil {
+		t.Fatalf("generating certs, %v", err)
+	}
+	if err := config.kubeConfigs(cfg, substrate); err != nil {
+		t.Fatalf("generating kubeconfigs, %v", err)
+	}
+	kubeConfigDir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), kubeconfigPath)
+	for file, expected := range map[string]string{
+		kubeadmconstants.AdminKubeConfigFileName:   "https://localhost:8443",
+		kubeadmconstants.KubeletKubeConfigFileName: "https://10.0.0.1:443",
+	} {
+		kubeConfig, err := clientcmd.LoadFromFile(path.Join(kubeConfigDir, file))
+		if err != nil {
+			t.Fatalf("loading %s, %v", file, err)
+		}
+		for _, cluster := range kubeConfig.Clusters {
+			if cluster.Server != expected {
+				t.Errorf("expected %s server %s, got %s", file, expected, cluster.Server)
+			}
+		}
+	}
+	cert, err := pkiutil.TryLoadCertFromDisk(cfg.CertificatesDir, kubeadmconstants.APIServerCertAndKeyBaseName)
+	if err != nil {
+		t.Fatalf("loading API server certificate, %v", err)
+	}
+	if err := cert.VerifyHostname("localhost"); err != nil {
+		t.Errorf("expected the API server certificate to be valid for the kubeconfig endpoint, %v", err)
+	}
+}
+
+func TestAPIServerPort(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{APIServerPort: aws.Int32(6443)},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	cfg := DefaultClusterConfig(substrate)
+	if cfg.LocalAPIEndpoint.BindPort != 6443 || cfg.ControlPlaneEndpoint != "10.0.0.1:6443" || cfg.APIServer.ExtraArgs["secure-port"] != "6443" {
+		t.Errorf("expected the API server on 6443, got bind port %d, endpoint %s and secure port %s",
+			cfg.LocalAPIEndpoint.BindPort, cfg.ControlPlaneEndpoint, cfg.APIServer.ExtraArgs["secure-port"])
+	}
+	if endpoint := DefaultClusterConfig(&v1alpha1.Substrate{}).ControlPlaneEndpoint; endpoint != ":443" {
+		t.Errorf("expected the API server on 443 by default, got %s", endpoint)
+	}
+	// The authenticator reaches the API server on the node
+	manifestDir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), clusterManifestPath)
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	if err := os.MkdirAll(manifestDir, 0700); err != nil {
+		t.Fatalf("creating directory, %v", err)
+	}
+	if err := (&Config{}).staticPodSpecForAuthenticator(context.Background(), substrate); err != nil {
+		t.Fatalf("generating authenticator manifest, %v", err)
+	}
+	authenticator, err := staticpodutil.ReadStaticPodFromDisk(path.Join(manifestDir, authenticatorComponentName+".yaml"))
+	if err != nil {
+		t.Fatalf("reading authenticator manifest, %v", err)
+	}
+	if args := strings.Join(authenticator.Spec.Containers[0].Args, " "); !strings.Contains(args, "--master=https://localhost:6443/") {
+		t.Errorf("expected the authenticator to reach the API server on 6443, got %s", args)
+	}
+	substrate.Spec.APIServerPort = aws.Int32(70000)
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected an invalid port to fail validation")
+	}
+}
+
+func TestServiceCIDR(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-service-cidr"},
+		Spec:       v1alpha1.SubstrateSpec{ServiceCIDR: "172.20.0.0/16"},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	cfg := DefaultClusterConfig(substrate)
+	if cfg.Networking.ServiceSubnet != "172.20.0.0/16" {
+		t.Errorf("expected service subnet 172.20.0.0/16, got %s", cfg.Networking.ServiceSubnet)
+	}
+	if err := config.generateCerts(cfg, substrate); err != nil {
+		t.Fatalf("generating certs, %v", err)
+	}
+	cert, err := pkiutil.TryLoadCertFromDisk(cfg.CertificatesDir, kubeadmconstants.APIServerCertAndKeyBaseName)
+	if err != nil {
+		t.Fatalf("loading API server certificate, %v", err)
+	}
+	if err := cert.VerifyHostname("172.20.0.1"); err != nil {
+		t.Errorf("expected the API server certificate to be valid for the kubernetes service, %v", err)
+	}
+	if err := cert.VerifyHostname("10.96.0.1"); err == nil {
+		t.Errorf("expected the API server certificate not to be valid for the default kubernetes service")
+	}
+	if ip := serviceIP(&v1alpha1.Substrate{}, 1); ip != "10.96.0.1" {
+		t.Errorf("expected the default kubernetes service 10.96.0.1, got %s", ip)
+	}
+	for _, cidr := range []string{"172.20.0.0", "fd00::/108", "10.0.0.0/8", "10.96.0.0/29"} {
+		substrate.Spec.ServiceCIDR = cidr
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected service CIDR %s to fail validation", cidr)
+		}
+	}
+}
+
+func TestAdditionalCertSANs(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cert-sans"},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	cfg := DefaultClusterConfig(substrate)
+	if err := config.generateCerts(cfg, substrate); err != nil {
+		t.Fatalf("generating certs, %v", err)
+	}
+	// Adding SANs to an existing substrate reissues the API server's certificate
+	substrate.Spec.AdditionalCertSANs = []string{"kit.example.com", "192.0.2.10"}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	cfg = DefaultClusterConfig(substrate)
+	if err := config.generateCerts(cfg, substrate); err != nil {
+		t.Fatalf("generating certs, %v", err)
+	}
+	cert, err := pkiutil.TryLoadCertFromDisk(cfg.CertificatesDir, kubeadmconstants.APIServerCertAndKeyBaseName)
+	if err != nil {
+		t.Fatalf("loading API server certificate, %v", err)
+	}
+	for _, san := range []string{"10.0.0.1", "kit.example.com", "192.0.2.10"} {
+		if err := cert.VerifyHostname(san); err != nil {
+			t.Errorf("expected the API server certificate to be valid for %s, %v", san, err)
+		}
+	}
+	for _, san := range []string{"*.example.com", "kit_example"} {
+		substrate.Spec.AdditionalCertSANs = []string{san}
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected SAN %s to fail validation", san)
+		}
+	}
+}
+
+func TestCertificateRenewal(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cert-renewal"},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	substrate.SetDefaults(context.Background())
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	cfg := DefaultClusterConfig(substrate)
+	serials := func() map[string]string {
+		if err := config.generateCerts(cfg, substrate); err != nil {
+			t.Fatalf("generating certs, %v", err)
+		}
+		serials := map[string]string{}
+		for _, baseName := range []string{kubeadmconstants.CACertAndKeyBaseName, kubeadmconstants.APIServerCertAndKeyBaseName, kubeadmconstants.EtcdServerCertAndKeyBaseName} {
+			cert, err := pkiutil.TryLoadCertFromDisk(cfg.CertificatesDir, baseName)
+			if err != nil {
+				t.Fatalf("loading %s certificate, %v", baseName, err)
+			}
+			serials[baseName] = cert.SerialNumber.String()
+		}
+		return serials
+	}
+	generated := serials()
+	// Valid certificates are kept
+	if reused := serials(); fmt.Sprint(reused) != fmt.Sprint(generated) {
+		t.Errorf("expected the certificates to be reused, got %v and %v", generated, reused)
+	}
+	// Certificates are signed for a year, so they all expire within the threshold
+	substrate.Spec.CertificateRenewBefore = &metav1.Duration{Duration: 366 * 24 * time.Hour}
+	renewed := serials()
+	for baseName, serial := range renewed {
+		if rotated := serial != generated[baseName]; rotated != (baseName != kubeadmconstants.CACertAndKeyBaseName) {
+			t.Errorf("expected only the certificates signed by the CA to be renewed, %s renewed %t", baseName, rotated)
+		}
+	}
+	substrate.Spec.CertificateRenewBefore = &metav1.Duration{Duration: v1alpha1.DefaultCertificateRenewBefore}
+	// Certificates record when they were issued to the second
+	time.Sleep(time.Second)
+	substrate.Spec.ForceCertificateRenewal = &metav1.Time{Time: time.Now()}
+	forced := serials()
+	if forced[kubeadmconstants.APIServerCertAndKeyBaseName] == renewed[kubeadmconstants.APIServerCertAndKeyBaseName] ||
+		forced[kubeadmconstants.CACertAndKeyBaseName] != generated[kubeadmconstants.CACertAndKeyBaseName] {
+		t.Errorf("expected forcing renewal to reissue the certificates with the same CA")
+	}
+	// Forcing renewal is one-shot, the reissued certificates are kept
+	if reused := serials(); fmt.Sprint(reused) != fmt.Sprint(forced) {
+		t.Errorf("expected the renewed certificates to be reused, got %v and %v", forced, reused)
+	}
+	substrate.Spec.ForceCertificateRenewal = &metav1.Time{Time: time.Now().Add(time.Hour)}
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected a forced renewal in the future to fail validation")
+	}
+	substrate.Spec.ForceCertificateRenewal = nil
+	substrate.Spec.CertificateRenewBefore = &metav1.Duration{Duration: 365 * 24 * time.Hour}
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected a renewal threshold of a year to fail validation")
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cert-expiry"},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	cfg := DefaultClusterConfig(substrate)
+	if err := config.generateCerts(cfg, substrate); err != nil {
+		t.Fatalf("generating certs, %v", err)
+	}
+	expiry, err := certificateExpiry(cfg.CertificatesDir)
+	if err != nil {
+		t.Fatalf("reading certificate expiry, %v", err)
+	}
+	// Leaves are signed for a year, before their CAs expire
+	cert, err := pkiutil.TryLoadCertFromDisk(cfg.CertificatesDir, kubeadmconstants.APIServerCertAndKeyBaseName)
+	if err != nil {
+		t.Fatalf("loading API server certificate, %v", err)
+	}
+	if expiry == nil || expiry.Time.After(cert.NotAfter) {
+		t.Errorf("expected the expiry to be at most the API server certificate's %v, got %v", cert.NotAfter, expiry)
+	}
+	if until := time.Until(expiry.Time); until < 364*24*time.Hour || until > 366*24*time.Hour {
+		t.Errorf("expected the certificates to expire in a year, got %v", until)
+	}
+	certPath, _ := pkiutil.PathsForCertAndKey(cfg.CertificatesDir, kubeadmconstants.APIServerCertAndKeyBaseName)
+	if err := os.Remove(certPath); err != nil {
+		t.Fatalf("removing API server certificate, %v", err)
+	}
+	if expiry, err := certificateExpiry(cfg.CertificatesDir); err == nil || expiry != nil {
+		t.Errorf("expected a missing certificate to fail reading the expiry, got %v", expiry)
+	}
+}
+
+func TestServiceAccountKeyRotation(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-sa-key-rotation"},
+		Spec:       v1alpha1.SubstrateSpec{ServiceAccountKey: &v1alpha1.ServiceAccountKeySpec{}},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	substrate.SetDefaults(context.Background())
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	cfg := DefaultClusterConfig(substrate)
+	keys := func() ([]interface{}, string) {
+		// Each apply starts from a new substrate without a status
+		substrate.Status.Cluster.ServiceAccountKey = nil
+		if err := config.generateCerts(cfg, substrate); err != nil {
+			t.Fatalf("generating certs, %v", err)
+		}
+		publicKeys, err := keyutil.PublicKeysFromFile(path.Join(cfg.CertificatesDir, kubeadmconstants.ServiceAccountPublicKeyName))
+		if err != nil {
+			t.Fatalf("reading service account public keys, %v", err)
+		}
+		pod := &v1.Pod{}
+		if err := annotateServiceAccountKeyHash(substrate)(pod); err != nil {
+			t.Fatalf("annotating service account key hash, %v", err)
+		}
+		return publicKeys, pod.Annotations[serviceAccountKeyHashAnnotation]
+	}
+	// The existing key is adopted as the named key
+	initial, initialHash := keys()
+	if len(initial) != 1 || aws.StringValue(substrate.Status.Cluster.ServiceAccountKey) != "key1" {
+		t.Fatalf("expected a single key named key1, got %d keys named %v", len(initial), aws.StringValue(substrate.Status.Cluster.ServiceAccountKey))
+	}
+	if unchanged, hash := keys(); !reflect.DeepEqual(unchanged, initial) || hash != initialHash {
+		t.Errorf("expected the key to be kept while its name is unchanged")
+	}
+	substrate.Spec.ServiceAccountKey = &v1alpha1.ServiceAccountKeySpec{KeyName: "key2", KeepPreviousKey: true}
+	rotated, rotatedHash := keys()
+	if len(rotated) != 2 || reflect.DeepEqual(rotated[0], initial[0]) || !reflect.DeepEqual(rotated[1], initial[0]) {
+		t.Errorf("expected a new key followed by the previous key, got %d keys", len(rotated))
+	}
+	if rotatedHash == initialHash || aws.StringValue(substrate.Status.Cluster.ServiceAccountKey) != "key2" {
+		t.Errorf("expected the rotation to restart the components and record key2")
+	}
+	// Only the key active before the rotation is kept
+	substrate.Spec.ServiceAccountKey = &v1alpha1.ServiceAccountKeySpec{KeyName: "key3", KeepPreviousKey: true}
+	if rotatedAgain, _ := keys(); len(rotatedAgain) != 2 || !reflect.DeepEqual(rotatedAgain[1], rotated[0]) {
+		t.Errorf("expected the new key followed by key2, got %d keys", len(rotatedAgain))
+	}
+	substrate.Spec.ServiceAccountKey = &v1alpha1.ServiceAccountKeySpec{KeyName: "key4"}
+	if replaced, _ := keys(); len(replaced) != 1 {
+		t.Errorf("expected the previous key to be dropped, got %d keys", len(replaced))
+	}
+	substrate.Spec.ServiceAccountKey.KeyName = "Key_5"
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected an invalid key name to fail validation")
+	}
+}
+
+func TestClusterInfo(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster-info"},
+		Spec: v1alpha1.SubstrateSpec{ClusterInfo: &v1alpha1.ClusterInfoSpec{
+			BootstrapTokens: []string{"abcdef.0123456789abcdef"},
+		}},
+		Status: v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	cfg := DefaultClusterConfig(substrate)
+	if err := config.generateCerts(cfg, substrate); err != nil {
+		t.Fatalf("generating certs, %v", err)
+	}
+	if err := config.generateClusterInfo(cfg, substrate); err != nil {
+		t.Fatalf("generating cluster-info, %v", err)
+	}
+	contents, err := ioutil.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), clusterInfoPath))
+	if err != nil {
+		t.Fatalf("reading cluster-info, %v", err)
+	}
+	configMap := &v1.ConfigMap{}
+	if err := yaml.Unmarshal(contents, configMap); err != nil {
+		t.Fatalf("decoding cluster-info, %v", err)
+	}
+	if configMap.Namespace != metav1.NamespacePublic || configMap.Name != "cluster-info" {
+		t.Errorf("expected kube-public/cluster-info, got %s/%s", configMap.Namespace, configMap.Name)
+	}
+	kubeConfig, err := clientcmd.Load([]byte(configMap.Data["kubeconfig"]))
+	if err != nil {
+		t.Fatalf("loading cluster-info kubeconfig, %v", err)
+	}
+	caCert, err := ioutil.ReadFile(path.Join(cfg.CertificatesDir, kubeadmconstants.CACertName))
+	if err != nil {
+		t.Fatalf("reading CA certificate, %v", err)
+	}
+	for _, cluster := range kubeConfig.Clusters {
+		if cluster.Server != "https://10.0.0.1:443" {
+			t.Errorf("expected server https://10.0.0.1:443, got %s", cluster.Server)
+		}
+		if string(cluster.CertificateAuthorityData) != string(caCert) {
+			t.Errorf("expected cluster-info CA to match %s", kubeadmconstants.CACertName)
+		}
+	}
+	// kubeadm join verifies the signature the same way with the token secret
+	if signature, ok := configMap.Data["jws-kubeconfig-abcdef"]; !ok {
+		t.Errorf("expected cluster-info to be signed with token abcdef")
+	} else if !bootstrapjws.DetachedTokenIsValid(signature, configMap.Data["kubeconfig"], "abcdef", "0123456789abcdef") {
+		t.Errorf("expected a valid signature for token abcdef, got %s", signature)
+	}
+}
+
+func TestBucketCreatedInSubstrateRegion(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeS3{}
+	config := &Config{Clients: fakeClientFactory(fake, "eu-west-1")}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{Region: aws.String("eu-west-1")},
+	}
+	if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket, %v", err)
+	}
+	if len(fake.regions) != 1 || fake.regions[0] != "eu-west-1" {
+		t.Errorf("expected bucket in eu-west-1, got %v", fake.regions)
+	}
+	if clients := config.Clients.For(&v1alpha1.Substrate{Spec: v1alpha1.SubstrateSpec{Region: aws.String("ap-south-1")}}); aws.StringValue(clients.Region) != "ap-south-1" {
+		t.Errorf("expected clients for ap-south-1, got %s", aws.StringValue(clients.Region))
+	}
+	if config.Clients.For(substrate) != config.Clients.For(substrate.DeepCopy()) {
+		t.Errorf("expected clients to be cached per region")
+	}
+}
+
+// fakeUploader records the objects uploaded to each bucket, or fails with err.
+// Like the s3manager.Uploader, it's safe for concurrent use, cancels uploads
+// with the context and closes the objects it fails to upload.
+type fakeUploader struct {
+	mu      sync.Mutex
+	objects map[string][]string
+	err     error
+	latency time.Duration
+	opened  int
+	closed  int
+}
+
+func (f *fakeUploader) UploadWithIterator(ctx aws.Context, iterator s3manager.BatchUploadIterator, _ ...func(*s3manager.Uploader)) error {
+	for iterator.Next() {
+		object := iterator.UploadObject()
+		f.mu.Lock()
+		f.opened++
+		err := f.err
+		f.mu.Unlock()
+		select {
+		case <-time.After(f.latency):
+		case <-ctx.Done():
+			err = awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+		}
+		f.mu.Lock()
+		if err == nil {
+			f.objects[aws.StringValue(object.Object.Bucket)] = append(f.objects[aws.StringValue(object.Object.Bucket)], aws.StringValue(object.Object.Key))
+		}
+		f.mu.Unlock()
+		if closeErr := object.After(); closeErr != nil {
+			return closeErr
+		}
+		f.mu.Lock()
+		f.closed++
+		f.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return iterator.Err()
+}
+
+// uploadFixture writes count small files to a temporary directory
+func uploadFixture(tb testing.TB, count int) string {
+	dir := tb.TempDir()
+	for i := 0; i < count; i++ {
+		if err := ioutil.WriteFile(path.Join(dir, fmt.Sprintf("file-%d.yaml", i)), []byte("test"), 0600); err != nil {
+			tb.Fatalf("writing file, %v", err)
+		}
+	}
+	return dir
+}
+
+func TestUploadDirectory(t *testing.T) {
+	ctx := context.Background()
+	dir := uploadFixture(t, 50)
+	uploader := &fakeUploader{objects: map[string][]string{}}
+	if err := uploadDirectory(ctx, uploader, "kit-test", dir); err != nil {
+		t.Fatalf("uploading directory, %v", err)
+	}
+	sequential := &fakeUploader{objects: map[string][]string{}}
+	if err := sequential.UploadWithIterator(ctx, NewDirectoryIterator("kit-test", dir)); err != nil {
+		t.Fatalf("uploading directory, %v", err)
+	}
+	if actual, expected := sets.NewString(uploader.objects["kit-test"]...), sets.NewString(sequential.objects["kit-test"]...); len(uploader.objects["kit-test"]) != 50 || !actual.Equal(expected) {
+		t.Errorf("expected the keys %v, got %v", expected.List(), actual.List())
+	}
+	// A missing directory fails instead of uploading nothing
+	missing := path.Join(dir, "missing")
+	if err := uploader.UploadWithIterator(ctx, NewDirectoryIterator("kit-test", missing)); err == nil {
+		t.Errorf("expected the iterator to fail for %s", missing)
+	}
+	if err := uploadDirectory(ctx, uploader, "kit-test", missing); err == nil {
+		t.Errorf("expected the upload to fail for %s", missing)
+	}
+	if len(uploader.objects["kit-test"]) != 50 {
+		t.Errorf("expected no objects to be uploaded, got %v", uploader.objects["kit-test"])
+	}
+	// A failed upload cancels the files that haven't started
+	uploader = &fakeUploader{objects: map[string][]string{}, err: fmt.Errorf("access denied")}
+	if err := uploadDirectory(ctx, uploader, "kit-test", dir); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("expected the upload to fail, got %v", err)
+	}
+}
+
+func TestUploadTimeout(t *testing.T) {
+	uploader := &fakeUploader{objects: map[string][]string{}, latency: time.Minute}
+	config := &Config{Clients: &ClientFactory{
+		session: session.Must(session.NewSession(&aws.Config{Region: aws.String("us-west-2")})),
+		clients: map[string]*Clients{"us-west-2": {Region: aws.String("us-west-2"), S3Uploader: uploader}},
+	}}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-upload-timeout"},
+		Spec:       v1alpha1.SubstrateSpec{UploadTimeout: &metav1.Duration{Duration: 10 * time.Millisecond}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	dir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)))
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("creating directory, %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := ioutil.WriteFile(path.Join(dir, fmt.Sprintf("file-%d.yaml", i)), []byte("test"), 0600); err != nil {
+			t.Fatalf("writing file, %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeoutFor(substrate))
+	defer cancel()
+	err := uploadTimedOut(ctx, substrate, config.upload(ctx, config.Clients.For(substrate), substrate))
+	if !errors.Is(err, ErrUploadTimeout) || !strings.Contains(err.Error(), "10ms") {
+		t.Fatalf("expected the upload to time out, got %v", err)
+	}
+	// Only the files being uploaded were opened, and they were closed
+	if uploader.opened == 0 || uploader.opened > uploadWorkers || uploader.opened != uploader.closed {
+		t.Errorf("expected the opened files to be closed, opened %d and closed %d", uploader.opened, uploader.closed)
+	}
+	// Other errors aren't timeouts
+	if err := uploadTimedOut(context.Background(), substrate, fmt.Errorf("access denied")); errors.Is(err, ErrUploadTimeout) {
+		t.Errorf("expected an error that isn't a timeout, got %v", err)
+	}
+	substrate.Spec.UploadTimeout.Duration = 0
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected a zero upload timeout to fail validation")
+	}
+}
+
+func BenchmarkUploadDirectory(b *testing.B) {
+	ctx := context.Background()
+	dir := uploadFixture(b, 50)
+	uploader := &fakeUploader{objects: map[string][]string{}, latency: time.Millisecond}
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := uploader.UploadWithIterator(ctx, NewDirectoryIterator("kit-test", dir)); err != nil {
+				b.Fatalf("uploading directory, %v", err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := uploadDirectory(ctx, uploader, "kit-test", dir); err != nil {
+				b.Fatalf("uploading directory, %v", err)
+			}
+		}
+	})
+}
+
+func TestReplicaBucket(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	ctx := logging.WithLogger(context.Background(), zap.New(core).Sugar())
+	primary := &fakeUploader{objects: map[string][]string{}}
+	replica := &fakeUploader{objects: map[string][]string{}}
+	config := &Config{Clients: &ClientFactory{
+		session: session.Must(session.NewSession(&aws.Config{Region: aws.String("us-west-2")})),
+		clients: map[string]*Clients{
+			"us-west-2": {Region: aws.String("us-west-2"), S3Uploader: primary},
+			"us-east-2": {Region: aws.String("us-east-2"), S3Uploader: replica},
+		},
+	}}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-replica-bucket"},
+		Spec:       v1alpha1.SubstrateSpec{ReplicaBucket: &v1alpha1.ReplicaBucketSpec{Name: "kit-dr", Region: aws.String("us-east-2")}},
+	}
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	dir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)))
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("creating directory, %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "config.yaml"), []byte("test"), 0600); err != nil {
+		t.Fatalf("writing config, %v", err)
+	}
+	if err := config.upload(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("uploading config, %v", err)
+	}
+	bucket := aws.StringValue(discovery.BucketName(substrate))
+	if len(primary.objects[bucket]) != 1 || len(replica.objects["kit-dr"]) != 1 || primary.objects[bucket][0] != replica.objects["kit-dr"][0] {
+		t.Errorf("expected the config in both buckets, got %v and %v", primary.objects, replica.objects)
+	}
+	if expected := []string{"s3://" + bucket, "s3://kit-dr"}; strings.Join(substrate.Status.Cluster.ConfigLocations, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected config locations %v, got %v", expected, substrate.Status.Cluster.ConfigLocations)
+	}
+	// Failing to copy the config to the replica is only a warning
+	replica.err = fmt.Errorf("access denied")
+	if err := config.upload(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("uploading config, %v", err)
+	}
+	if locations := substrate.Status.Cluster.ConfigLocations; len(locations) != 1 || locations[0] != "s3://"+bucket {
+		t.Errorf("expected only the substrate's bucket in the config locations, got %v", locations)
+	}
+	if warnings := logs.FilterMessageSnippet("s3://kit-dr").Len(); warnings != 1 {
+		t.Errorf("expected a warning for the replica bucket, got %d", warnings)
+	}
+	substrate.Spec.ReplicaBucket.Name = "Kit_DR"
+	if err := substrate.Validate(ctx); err == nil {
+		t.Errorf("expected an invalid bucket name to fail validation")
+	}
+}
+
+func TestBucketLocationConstraint(t *testing.T) {
+	ctx := context.Background()
+	for region, constrained := range map[string]bool{"us-east-1": false, "us-west-2": true} {
+		fake := &fakeS3{}
+		config := &Config{Clients: fakeClientFactory(fake, region)}
+		substrate := &v1alpha1.Substrate{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+			Spec:       v1alpha1.SubstrateSpec{Region: aws.String(region)},
+		}
+		if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); err != nil {
+			t.Fatalf("ensuring bucket, %v", err)
+		}
+		if configured := fake.inputs[0].CreateBucketConfiguration != nil; configured != constrained {
+			t.Errorf("expected bucket configuration in %s to be %t, got %t", region, constrained, configured)
+		}
+		if fake.regions[0] != region {
+			t.Errorf("expected bucket in %s, got %s", region, fake.regions[0])
+		}
+	}
+}
+
+func TestBucketEncryption(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeS3{}
+	config := &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	if err := config.ensureBucketEncryption(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket encryption, %v", err)
+	}
+	if algorithm := aws.StringValue(fake.encryption.SSEAlgorithm); algorithm != s3.ServerSideEncryptionAes256 {
+		t.Errorf("expected bucket encrypted with %s, got %s", s3.ServerSideEncryptionAes256, algorithm)
+	}
+	if strings.Contains(aws.StringValue(desiredRolesFor(substrate)[0].policy), "kms:Decrypt") {
+		t.Errorf("expected no kms permissions without a bucket key")
+	}
+	key := "arn:aws:kms:us-west-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	substrate.Spec.BucketKMSKeyARN = aws.String(key)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if err := config.ensureBucketEncryption(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket encryption, %v", err)
+	}
+	if algorithm, id := aws.StringValue(fake.encryption.SSEAlgorithm), aws.StringValue(fake.encryption.KMSMasterKeyID); algorithm != s3.ServerSideEncryptionAwsKms || id != key {
+		t.Errorf("expected bucket encrypted with %s key %s, got %s key %s", s3.ServerSideEncryptionAwsKms, key, algorithm, id)
+	}
+	// The substrate node decrypts the configuration it syncs from the bucket
+	policy := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(aws.StringValue(desiredRolesFor(substrate)[0].policy)), &policy); err != nil {
+		t.Fatalf("parsing substrate node policy, %v", err)
+	}
+	if !strings.Contains(aws.StringValue(desiredRolesFor(substrate)[0].policy), fmt.Sprintf(`"Resource": [%q]`, key)) {
+		t.Errorf("expected the substrate node to be allowed to decrypt with %s", key)
+	}
+	substrate.Spec.BucketKMSKeyARN = aws.String("alias/kit")
+	if err := substrate.Validate(ctx); err == nil {
+		t.Errorf("expected a key alias to fail validation")
+	}
+}
+
+func TestBucketPublicAccessBlock(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeS3{}
+	config := &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	// Reconciling again doesn't put the block while it's in place
+	for i := 0; i < 2; i++ {
+		if err := config.ensurePublicAccessBlock(ctx, config.Clients.For(substrate), substrate); err != nil {
+			t.Fatalf("ensuring public access block, %v", err)
+		}
+	}
+	if len(fake.publicAccessBlocks) != 1 {
+		t.Fatalf("expected the public access block to be put once, got %d", len(fake.publicAccessBlocks))
+	}
+	block := fake.publicAccessBlocks[0].PublicAccessBlockConfiguration
+	for setting, enabled := range map[string]*bool{
+		"BlockPublicAcls":       block.BlockPublicAcls,
+		"BlockPublicPolicy":     block.BlockPublicPolicy,
+		"IgnorePublicAcls":      block.IgnorePublicAcls,
+		"RestrictPublicBuckets": block.RestrictPublicBuckets,
+	} {
+		if !aws.BoolValue(enabled) {
+			t.Errorf("expected %s to be enabled", setting)
+		}
+	}
+	// A setting turned off is blocked again
+	fake.publicAccessBlock = &s3.PublicAccessBlockConfiguration{
+		BlockPublicAcls:       aws.Bool(true),
+		BlockPublicPolicy:     aws.Bool(false),
+		IgnorePublicAcls:      aws.Bool(true),
+		RestrictPublicBuckets: aws.Bool(true),
+	}
+	if err := config.ensurePublicAccessBlock(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring public access block, %v", err)
+	}
+	if len(fake.publicAccessBlocks) != 2 || !publicAccessBlocked(fake.publicAccessBlock) {
+		t.Errorf("expected public access to be blocked again, got %v", fake.publicAccessBlock)
+	}
+	// Errors other than AWS errors are returned
+	fake.getPublicAccessBlockErr = fmt.Errorf("getting public access block, %w", context.Canceled)
+	if err := config.ensurePublicAccessBlock(ctx, config.Clients.For(substrate), substrate); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error to be returned, got %v", err)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{AuditLog: &v1alpha1.AuditLogSpec{MaxSize: aws.Int32(500)}},
+	}
+	substrate.SetDefaults(context.Background())
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	args := DefaultClusterConfig(substrate).APIServer.ExtraArgs
+	for flag, expected := range map[string]string{
+		"audit-policy-file":   auditPolicyPath,
+		"audit-log-maxage":    "7",
+		"audit-log-maxbackup": "10",
+		"audit-log-maxsize":   "500",
+	} {
+		if args[flag] != expected {
+			t.Errorf("expected %s=%s, got %q", flag, expected, args[flag])
+		}
+	}
+	substrate.Spec.AuditLog.MaxBackup = aws.Int32(0)
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected non positive audit-log-maxbackup to fail validation")
+	}
+	if _, ok := DefaultClusterConfig(&v1alpha1.Substrate{}).APIServer.ExtraArgs["audit-log-maxage"]; ok {
+		t.Errorf("expected no audit flags when audit logging is disabled")
+	}
+}
+
+func TestAuditPolicy(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-audit-policy"},
+		Spec:       v1alpha1.SubstrateSpec{AuditLog: &v1alpha1.AuditLogSpec{}},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	substrate.SetDefaults(context.Background())
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	policyPath := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), auditPolicyPath)
+	manifestDir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), clusterManifestPath)
+	hashes := []string{}
+	for _, policy := range []string{"", "apiVersion: audit.k8s.io/v1\nkind: Policy\nrules:\n- level: RequestResponse\n"} {
+		substrate.Spec.AuditLog.Policy = policy
+		if err := substrate.Validate(context.Background()); err != nil {
+			t.Fatalf("validating substrate, %v", err)
+		}
+		if err := config.auditPolicy(substrate); err != nil {
+			t.Fatalf("generating audit policy, %v", err)
+		}
+		contents, err := ioutil.ReadFile(policyPath)
+		if err != nil {
+			t.Fatalf("reading audit policy, %v", err)
+		}
+		expected := policy
+		if policy == "" {
+			expected = auditPolicy
+		}
+		if string(contents) != expected {
+			t.Errorf("expected audit policy %q, got %q", expected, contents)
+		}
+		if err := config.generateStaticPodManifests(DefaultClusterConfig(substrate), substrate); err != nil {
+			t.Fatalf("generating static pod manifests, %v", err)
+		}
+		pod, err := staticpodutil.ReadStaticPodFromDisk(kubeadmconstants.GetStaticPodFilepath(kubeadmconstants.KubeAPIServer, manifestDir))
+		if err != nil {
+			t.Fatalf("reading static pod, %v", err)
+		}
+		hashes = append(hashes, pod.Annotations[auditPolicyHashAnnotation])
+	}
+	// A new policy restarts the API server to load it
+	if hashes[0] == "" || hashes[0] == hashes[1] {
+		t.Errorf("expected the audit policy hash annotation to change with the policy, got %v", hashes)
+	}
+	substrate.Spec.AuditLog.Policy = "kind: ConfigMap"
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected a policy of the wrong kind to fail validation")
+	}
+}
+
+func TestComponentSidecars(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-component-sidecars"},
+		Spec: v1alpha1.SubstrateSpec{ComponentSidecars: map[string][]v1.Container{
+			kubeadmconstants.KubeAPIServer: {{
+				Name:         "log-shipper",
+				Image:        "public.ecr.aws/aws-observability/aws-for-fluent-bit:latest",
+				VolumeMounts: []v1.VolumeMount{{Name: "k8s-certs", MountPath: "/etc/kubernetes/pki", ReadOnly: true}},
+			}},
+		}},
+		Status: v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	if err := (&Config{}).generateStaticPodManifests(DefaultClusterConfig(substrate), substrate); err != nil {
+		t.Fatalf("generating static pod manifests, %v", err)
+	}
+	manifestDir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), clusterManifestPath)
+	for component, expected := range map[string]int{kubeadmconstants.KubeAPIServer: 2, kubeadmconstants.Etcd: 1} {
+		pod, err := staticpodutil.ReadStaticPodFromDisk(kubeadmconstants.GetStaticPodFilepath(component, manifestDir))
+		if err != nil {
+			t.Fatalf("reading static pod for %s, %v", component, err)
+		}
+		if len(pod.Spec.Containers) != expected {
+			t.Errorf("expected %d containers for %s, got %d", expected, component, len(pod.Spec.Containers))
+		}
+	}
+
+	substrate.Spec.ComponentSidecars[kubeadmconstants.KubeAPIServer][0].VolumeMounts[0].Name = "missing"
+	if err := (&Config{}).generateStaticPodManifests(DefaultClusterConfig(substrate), substrate); err == nil {
+		t.Errorf("expected sidecar mounting a missing volume to fail")
+	}
+	substrate.Spec.ComponentSidecars[kubeadmconstants.KubeAPIServer][0].Name = kubeadmconstants.KubeAPIServer
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected sidecar name colliding with the component to fail validation")
+	}
+}
+
+func TestAdditionalSchedulers(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-schedulers"},
+		Spec: v1alpha1.SubstrateSpec{Schedulers: []v1alpha1.SchedulerSpec{
+			{Name: "bin-packing"},
+			{Name: "custom", Image: "public.ecr.aws/kit/custom-scheduler:latest", Config: "apiVersion: kubescheduler.config.k8s.io/v1beta1\nkind: KubeSchedulerConfiguration\n"},
+		}},
+		Status: v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	dir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)))
+	defer os.RemoveAll(dir)
+	if err := (&Config{}).generateStaticPodManifests(DefaultClusterConfig(substrate), substrate); err != nil {
+		t.Fatalf("generating static pod manifests, %v", err)
+	}
+	manifestDir := path.Join(dir, clusterManifestPath)
+	for i, scheduler := range substrate.Spec.Schedulers {
+		component := "kube-scheduler-" + scheduler.Name
+		pod, err := staticpodutil.ReadStaticPodFromDisk(kubeadmconstants.GetStaticPodFilepath(component, manifestDir))
+		if err != nil {
+			t.Fatalf("reading static pod for %s, %v", component, err)
+		}
+		if pod.Name != component {
+			t.Errorf("expected static pod %s, got %s", component, pod.Name)
+		}
+		command := strings.Join(pod.Spec.Containers[0].Command, " ")
+		configPath := "/etc/kubernetes/schedulers/" + scheduler.Name + ".yaml"
+		for _, expected := range []string{"--config=" + configPath, fmt.Sprintf("--secure-port=%d", 10260+i)} {
+			if !strings.Contains(command, expected) {
+				t.Errorf("expected %s in %s", expected, command)
+			}
+		}
+		if strings.Contains(command, "--leader-elect=") {
+			t.Errorf("expected leader election to be configured by the config file, got %s", command)
+		}
+		contents, err := ioutil.ReadFile(path.Join(dir, configPath))
+		if err != nil {
+			t.Fatalf("reading scheduler config, %v", err)
+		}
+		// Each scheduler needs its own lease, or it competes with the default scheduler
+		if !strings.Contains(string(contents), "resourceName: "+component+"\n") {
+			t.Errorf("expected the config for %s to use the %s lease, got %s", scheduler.Name, component, contents)
+		}
+	}
+	config, err := schedulerConfigFor(substrate.Spec.Schedulers[0])
+	if err != nil {
+		t.Fatalf("rendering scheduler config, %v", err)
+	}
+	if !strings.Contains(config, "- schedulerName: bin-packing") {
+		t.Errorf("expected the default config to be named after the scheduler")
+	}
+	// A config that names its own lease is used as is
+	named := v1alpha1.SchedulerSpec{Name: "named", Config: "leaderElection:\n  resourceName: my-scheduler\n"}
+	if config, err := schedulerConfigFor(named); err != nil || config != named.Config {
+		t.Errorf("expected the config to be unchanged, got %s, %v", config, err)
+	}
+	defaultScheduler, err := staticpodutil.ReadStaticPodFromDisk(kubeadmconstants.GetStaticPodFilepath(kubeadmconstants.KubeScheduler, manifestDir))
+	if err != nil {
+		t.Fatalf("reading static pod for %s, %v", kubeadmconstants.KubeScheduler, err)
+	}
+	if defaultScheduler.Spec.Containers[0].Image == "public.ecr.aws/kit/custom-scheduler:latest" {
+		t.Errorf("expected the default scheduler to be unchanged")
+	}
+	for _, names := range [][]string{{"default-scheduler"}, {"custom", "custom"}, {"Custom"}} {
+		substrate.Spec.Schedulers = nil
+		for _, name := range names {
+			substrate.Spec.Schedulers = append(substrate.Spec.Schedulers, v1alpha1.SchedulerSpec{Name: name})
+		}
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected schedulers %v to fail validation", names)
+		}
+	}
+	substrate.Spec.Schedulers = []v1alpha1.SchedulerSpec{{Name: "custom", Config: "leaderElection:\n  resourceName: kube-scheduler\n"}}
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected a config using the default scheduler's lease to fail validation")
+	}
+}
+
+func TestAnonymousAuthDisabled(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-anonymous-auth"},
+		Spec:       v1alpha1.SubstrateSpec{AnonymousAuth: aws.Bool(false)},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	cfg := DefaultClusterConfig(substrate)
+	if flag := cfg.APIServer.ExtraArgs["anonymous-auth"]; flag != "false" {
+		t.Errorf("expected anonymous-auth=false, got %q", flag)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	if err := (&Config{}).generateStaticPodManifests(cfg, substrate); err != nil {
+		t.Fatalf("generating static pod manifests, %v", err)
+	}
+	manifestDir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), clusterManifestPath)
+	pod, err := staticpodutil.ReadStaticPodFromDisk(kubeadmconstants.GetStaticPodFilepath(kubeadmconstants.KubeAPIServer, manifestDir))
+	if err != nil {
+		t.Fatalf("reading static pod, %v", err)
+	}
+	for name, probe := range map[string]*v1.Probe{
+		"liveness":  pod.Spec.Containers[0].LivenessProbe,
+		"readiness": pod.Spec.Containers[0].ReadinessProbe,
+		"startup":   pod.Spec.Containers[0].StartupProbe,
+	} {
+		if probe == nil || probe.HTTPGet != nil || probe.TCPSocket == nil || probe.TCPSocket.Port.IntValue() != 443 {
+			t.Errorf("expected %s probe to use a TCP socket on 443, got %+v", name, probe)
+		}
+	}
+}
+
+func TestClientCertAuthDisabled(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-client-cert-auth"},
+		Spec:       v1alpha1.SubstrateSpec{ClientCertAuth: aws.Bool(false)},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	cfg := DefaultClusterConfig(substrate)
+	if err := config.generateCerts(cfg, substrate); err != nil {
+		t.Fatalf("generating certs, %v", err)
+	}
+	if err := config.kubeConfigs(cfg, substrate); err != nil {
+		t.Fatalf("generating kubeconfigs, %v", err)
+	}
+	if err := config.generateStaticPodManifests(cfg, substrate); err != nil {
+		t.Fatalf("generating static pod manifests, %v", err)
+	}
+	manifestDir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), clusterManifestPath)
+	pod, err := staticpodutil.ReadStaticPodFromDisk(kubeadmconstants.GetStaticPodFilepath(kubeadmconstants.KubeAPIServer, manifestDir))
+	if err != nil {
+		t.Fatalf("reading static pod, %v", err)
+	}
+	clientCAFile := ""
+	for _, arg := range pod.Spec.Containers[0].Command {
+		if strings.HasPrefix(arg, "--client-ca-file=") {
+			clientCAFile = strings.TrimPrefix(arg, "--client-ca-file=")
+		}
+	}
+	if clientCAFile == "" {
+		t.Fatalf("expected the API server to keep --client-ca-file")
+	}
+	// The components authenticate with client certificates the API server's client CA verifies
+	clientCA, err := ioutil.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), clientCAFile))
+	if err != nil {
+		t.Fatalf("reading client CA, %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(clientCA) {
+		t.Fatalf("parsing client CA %s", clientCAFile)
+	}
+	kubeConfigDir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), kubeconfigPath)
+	for _, file := range []string{
+		kubeadmconstants.KubeletKubeConfigFileName,
+		kubeadmconstants.ControllerManagerKubeConfigFileName,
+		kubeadmconstants.SchedulerKubeConfigFileName,
+		kubeadmconstants.AdminKubeConfigFileName,
+	} {
+		kubeConfig, err := clientcmd.LoadFromFile(path.Join(kubeConfigDir, file))
+		if err != nil {
+			t.Fatalf("loading %s, %v", file, err)
+		}
+		for _, authInfo := range kubeConfig.AuthInfos {
+			block, _ := pem.Decode(authInfo.ClientCertificateData)
+			if block == nil {
+				t.Errorf("expected %s to authenticate with a client certificate", file)
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatalf("parsing %s client certificate, %v", file, err)
+			}
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+				t.Errorf("expected the %s client certificate to authenticate, %v", file, err)
+			}
+		}
+	}
+
+	// Users need a token authenticator
+	substrate.Spec.EnableIAMAuthenticator = aws.Bool(false)
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected disabling client certificate auth without a token authenticator to fail validation")
+	}
+}
+
+func TestComponentArgs(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-component-args"},
+		Spec: v1alpha1.SubstrateSpec{
+			AnonymousAuth: aws.Bool(true),
+			ComponentArgs: &v1alpha1.ComponentArgsSpec{
+				APIServer: map[string]string{"max-requests-inflight": "800", "anonymous-auth": "false"},
+				Kubelet:   map[string]string{"max-pods": "50"},
+			},
+		},
+		Status: v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	cfg := DefaultClusterConfig(substrate)
+	if err := config.generateStaticPodManifests(cfg, substrate); err != nil {
+		t.Fatalf("generating static pod manifests, %v", err)
+	}
+	manifestDir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), clusterManifestPath)
+	pod, err := staticpodutil.ReadStaticPodFromDisk(kubeadmconstants.GetStaticPodFilepath(kubeadmconstants.KubeAPIServer, manifestDir))
+	if err != nil {
+		t.Fatalf("reading static pod, %v", err)
+	}
+	args := sets.NewString(pod.Spec.Containers[0].Command...)
+	// The user's value wins over the substrate's anonymous-auth
+	for _, expected := range []string{"--max-requests-inflight=800", "--anonymous-auth=false"} {
+		if !args.Has(expected) {
+			t.Errorf("expected %s in the API server command, got %v", expected, pod.Spec.Containers[0].Command)
+		}
+	}
+	if err := config.kubeletSystemService(cfg, substrate); err != nil {
+		t.Fatalf("generating kubelet service, %v", err)
+	}
+	service, err := ioutil.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), kubeletSystemdPath, "kubelet.service"))
+	if err != nil {
+		t.Fatalf("reading kubelet service, %v", err)
+	}
+	if !strings.Contains(string(service), " --max-pods=50") {
+		t.Errorf("expected kubelet --max-pods=50, got %s", service)
+	}
+	substrate.Spec.ComponentArgs.Scheduler = map[string]string{"--v": "4"}
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected a flag with leading dashes to fail validation")
+	}
+}
+
+func TestRuntimeConfig(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-runtime-config"},
+		Spec: v1alpha1.SubstrateSpec{RuntimeConfig: map[string]string{
+			"storage.k8s.io/v1alpha1": "true",
+			"batch/v2alpha1":          "true",
+			"autoscaling/v2beta1":     "false",
+			"api/alpha":               "false",
+		}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	expected := "api/alpha=false,autoscaling/v2beta1=false,batch/v2alpha1=true,storage.k8s.io/v1alpha1=true"
+	for i := 0; i < 5; i++ {
+		if flag := DefaultClusterConfig(substrate).APIServer.ExtraArgs["runtime-config"]; flag != expected {
+			t.Fatalf("expected runtime-config=%s, got %q", expected, flag)
+		}
+	}
+	for key, value := range map[string]string{"batch": "true", "batch/v1/jobs": "true", "Batch/v1": "true", "batch/1": "true", "batch/v1": "yes"} {
+		substrate.Spec.RuntimeConfig = map[string]string{key: value}
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected %s=%s to fail validation", key, value)
+		}
+	}
+	if _, ok := DefaultClusterConfig(&v1alpha1.Substrate{}).APIServer.ExtraArgs["runtime-config"]; ok {
+		t.Errorf("expected no runtime-config flag by default")
+	}
+}
+
+func TestAuthCache(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-auth-cache"},
+		Spec: v1alpha1.SubstrateSpec{AuthCache: &v1alpha1.AuthCacheSpec{
+			TokenWebhookTTL: &metav1.Duration{Duration: 30 * time.Second},
+			AuthorizedTTL:   &metav1.Duration{Duration: 0},
+			UnauthorizedTTL: &metav1.Duration{Duration: 10 * time.Second},
+		}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	args := DefaultClusterConfig(substrate).APIServer.ExtraArgs
+	for flag, expected := range map[string]string{
+		"authentication-token-webhook-cache-ttl":       "30s",
+		"authorization-webhook-cache-authorized-ttl":   "0s",
+		"authorization-webhook-cache-unauthorized-ttl": "10s",
+	} {
+		if args[flag] != expected {
+			t.Errorf("expected %s=%s, got %q", flag, expected, args[flag])
+		}
+	}
+	substrate.Spec.AuthCache.TokenWebhookTTL.Duration = -time.Second
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected negative token webhook cache ttl to fail validation")
+	}
+}
+
+func TestSecretsEncryptionKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secrets-encryption"},
+		Spec:       v1alpha1.SubstrateSpec{SecretsEncryption: &v1alpha1.SecretsEncryptionSpec{RemoveRetiredKeys: true}},
+	}
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	clients := &Clients{SSM: &fakeSSM{}}
+	if err := config.secretsEncryption(ctx, clients, substrate); err != nil {
+		t.Fatalf("generating encryption config, %v", err)
+	}
+	original, err := readEncryptionKeys(substrate)
+	if err != nil {
+		t.Fatalf("reading encryption keys, %v", err)
+	}
+	if len(original) != 1 || original[0].Name != "key1" || original[0].Secret == "" {
+		t.Fatalf("expected a single key1, got %v", original)
+	}
+	// Rotate to a new key, the old key is retained until secrets are rewritten
+	substrate.Spec.SecretsEncryption.KeyName = "key2"
+	for i := 0; i < 2; i++ {
+		if err := config.secretsEncryption(ctx, clients, substrate); err != nil {
+			t.Fatalf("rotating encryption key, %v", err)
+		}
+	}
+	rotated, err := readEncryptionKeys(substrate)
+	if err != nil {
+		t.Fatalf("reading encryption keys, %v", err)
+	}
+	if len(rotated) != 2 || rotated[0].Name != "key2" || rotated[1] != original[0] {
+		t.Fatalf("expected key2 to be prepended to key1, got %v", rotated)
+	}
+	if rotated[0].Secret == original[0].Secret {
+		t.Errorf("expected a new secret for key2")
+	}
+	// Once secrets are rewritten with key2, key1 is removed
+	substrate.Status.Cluster.SecretsEncryptionKey = aws.String("key2")
+	if err := config.secretsEncryption(ctx, clients, substrate); err != nil {
+		t.Fatalf("removing retired keys, %v", err)
+	}
+	if keys, err := EncryptionKeyNames(substrate); err != nil || len(keys) != 1 || keys[0] != "key2" {
+		t.Errorf("expected only key2 to remain, got %v, %v", keys, err)
+	}
+	if flag := DefaultClusterConfig(substrate).APIServer.ExtraArgs["encryption-provider-config"]; flag != encryptionConfigPath {
+		t.Errorf("expected encryption-provider-config=%s, got %q", encryptionConfigPath, flag)
+	}
+	if stored := clients.SSM.(*fakeSSM).parameters; len(stored) != 1 || stored[encryptionKeysPath(substrate)+"key2"] != rotated[0].Secret {
+		t.Errorf("expected only key2 to be stored, got %v", stored)
+	}
+}
+
+func TestSecretsEncryptionRestoredKeys(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secrets-encryption-restored"},
+		Spec:       v1alpha1.SubstrateSpec{SecretsEncryption: &v1alpha1.SecretsEncryptionSpec{}},
+	}
+	substrate.SetDefaults(ctx)
+	dir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)))
+	defer os.RemoveAll(dir)
+	clients := &Clients{SSM: &fakeSSM{}}
+	if err := (&Config{}).secretsEncryption(ctx, clients, substrate); err != nil {
+		t.Fatalf("generating encryption config, %v", err)
+	}
+	original, err := readEncryptionKeys(substrate)
+	if err != nil {
+		t.Fatalf("reading encryption keys, %v", err)
+	}
+	// Losing the local config restores the stored key instead of generating one
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("removing local config, %v", err)
+	}
+	if err := (&Config{}).secretsEncryption(ctx, clients, substrate); err != nil {
+		t.Fatalf("generating encryption config, %v", err)
+	}
+	restored, err := readEncryptionKeys(substrate)
+	if err != nil {
+		t.Fatalf("reading encryption keys, %v", err)
+	}
+	if len(restored) != 1 || restored[0] != original[0] {
+		t.Errorf("expected %v to be restored, got %v", original, restored)
+	}
+}
+
+func TestSecretsEncryptionDisabled(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secrets-encryption-disabled"},
+		Spec:       v1alpha1.SubstrateSpec{SecretsEncryption: &v1alpha1.SecretsEncryptionSpec{}},
+	}
+	substrate.SetDefaults(ctx)
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	clients := &Clients{SSM: &fakeSSM{}}
+	if err := (&Config{}).secretsEncryption(ctx, clients, substrate); err != nil {
+		t.Fatalf("generating encryption config, %v", err)
+	}
+	// identity writes secrets unencrypted, the key still reads the encrypted ones
+	substrate.Spec.SecretsEncryption = nil
+	if err := (&Config{}).secretsEncryption(ctx, clients, substrate); err != nil {
+		t.Fatalf("disabling encryption, %v", err)
+	}
+	if keys, err := EncryptionKeyNames(substrate); err != nil || len(keys) != 2 || keys[0] != IdentityKeyName || keys[1] != "key1" {
+		t.Fatalf("expected identity ahead of key1, got %v, %v", keys, err)
+	}
+	if flag := DefaultClusterConfig(substrate).APIServer.ExtraArgs["encryption-provider-config"]; flag != encryptionConfigPath {
+		t.Errorf("expected encryption-provider-config=%s until secrets are rewritten, got %q", encryptionConfigPath, flag)
+	}
+	// Once secrets are rewritten unencrypted, the config and key are removed
+	substrate.Status.Cluster.SecretsEncryptionKey = aws.String(IdentityKeyName)
+	if err := (&Config{}).secretsEncryption(ctx, clients, substrate); err != nil {
+		t.Fatalf("disabling encryption, %v", err)
+	}
+	if keys, err := EncryptionKeyNames(substrate); err != nil || len(keys) != 0 {
+		t.Errorf("expected the encryption config to be removed, got %v, %v", keys, err)
+	}
+	if _, ok := DefaultClusterConfig(substrate).APIServer.ExtraArgs["encryption-provider-config"]; ok {
+		t.Errorf("expected encryption-provider-config to be removed")
+	}
+	if stored := clients.SSM.(*fakeSSM).parameters; len(stored) != 0 {
+		t.Errorf("expected the stored key to be removed, got %v", stored)
+	}
+}
+
+func TestServiceAccountExtendTokenExpiration(t *testing.T) {
+	if _, ok := DefaultClusterConfig(&v1alpha1.Substrate{}).APIServer.ExtraArgs["service-account-extend-token-expiration"]; ok {
+		t.Errorf("expected the API server default when unset")
+	}
+	for _, extend := range []bool{true, false} {
+		substrate := &v1alpha1.Substrate{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-extend-token-expiration"},
+			Spec:       v1alpha1.SubstrateSpec{ServiceAccountExtendTokenExpiration: aws.Bool(extend)},
+		}
+		if err := substrate.Validate(context.Background()); err != nil {
+			t.Fatalf("validating substrate, %v", err)
+		}
+		expected := strconv.FormatBool(extend)
+		if flag := DefaultClusterConfig(substrate).APIServer.ExtraArgs["service-account-extend-token-expiration"]; flag != expected {
+			t.Errorf("expected service-account-extend-token-expiration=%s, got %q", expected, flag)
+		}
+	}
+}
+
+func TestKubeletHostname(t *testing.T) {
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-kubelet-hostname"}}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	kubeletService := func() string {
+		if err := config.kubeletSystemService(DefaultClusterConfig(substrate), substrate); err != nil {
+			t.Fatalf("generating kubelet service, %v", err)
+		}
+		service, err := os.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), kubeletSystemdPath, "kubelet.service"))
+		if err != nil {
+			t.Fatalf("reading kubelet service, %v", err)
+		}
+		return string(service)
+	}
+	// Single node substrates keep the substrate's name
+	if service := kubeletService(); !strings.Contains(service, "--hostname-override=test-kubelet-hostname ") || strings.Contains(service, "EnvironmentFile") ||
+		!strings.Contains(service, "--kubeconfig=/etc/kubernetes/kubelet.conf ") {
+		t.Errorf("expected the substrate's name as hostname, got %s", service)
+	}
+	if script, err := kubeletHostnameScript(substrate); err != nil || script != "" {
+		t.Errorf("expected no hostname script, got %q, %v", script, err)
+	}
+
+	substrate.Spec.Hostname = &v1alpha1.HostnameSpec{Strategy: v1alpha1.HostnameStrategyTemplate, Template: "{{.Name}}-{{.Ordinal}}"}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if service := kubeletService(); !strings.Contains(service, "EnvironmentFile="+kubeletHostnameEnvFile) || !strings.Contains(service, "--hostname-override=${KUBELET_HOSTNAME} ") {
+		t.Errorf("expected the hostname from the node's environment, got %s", service)
+	}
+	// The kubelet authenticates as the node it registers
+	if service := kubeletService(); !strings.Contains(service, "ExecStartPre="+kubeletKubeConfigScript) || !strings.Contains(service, "--kubeconfig=/etc/kit/kubelet/kubelet.conf ") {
+		t.Errorf("expected the kubelet's kubeconfig to be issued on the node, got %s", service)
+	}
+	script, err := kubeletHostnameScript(substrate)
+	if err != nil {
+		t.Fatalf("generating hostname script, %v", err)
+	}
+	if !strings.Contains(script, "/latest/meta-data/ami-launch-index") {
+		t.Errorf("expected the node ordinal from the launch index, got %s", script)
+	}
+	if !strings.Contains(script, `-subj "/O=system:nodes/CN=system:node:$KUBELET_HOSTNAME"`) || !strings.Contains(script, "-CAkey /etc/kubernetes/pki/ca.key") {
+		t.Errorf("expected a client certificate for system:node:$KUBELET_HOSTNAME signed by the cluster CA, got %s", script)
+	}
+	hostname, err := nodeHostname(substrate)
+	if err != nil {
+		t.Fatalf("rendering hostname, %v", err)
+	}
+	// Expand the hostname as each node would with its launch index
+	hostnames := map[string]bool{}
+	for _, ordinal := range []string{"0", "1", "2"} {
+		hostnames[os.Expand(hostname, func(variable string) string {
+			if variable == nodeOrdinalVariable {
+				return ordinal
+			}
+			return ""
+		})] = true
+	}
+	for _, expected := range []string{"test-kubelet-hostname-0", "test-kubelet-hostname-1", "test-kubelet-hostname-2"} {
+		if !hostnames[expected] {
+			t.Errorf("expected hostname %s, got %v", expected, hostnames)
+		}
+	}
+
+	for strategy, metadata := range map[string]string{
+		v1alpha1.HostnameStrategyPrivateDNSName: "/latest/meta-data/local-hostname",
+		v1alpha1.HostnameStrategyIMDSHostname:   "/latest/meta-data/hostname",
+	} {
+		substrate.Spec.Hostname = &v1alpha1.HostnameSpec{Strategy: strategy}
+		if hostname, err := nodeHostname(substrate); err != nil || !strings.Contains(hostname, metadata) {
+			t.Errorf("expected %s hostname from %s, got %q, %v", strategy, metadata, hostname, err)
+		}
+	}
+}
+
+func TestRequestHeader(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-request-header"},
+		Spec: v1alpha1.SubstrateSpec{RequestHeader: &v1alpha1.RequestHeaderSpec{
+			AllowedNames:       []string{"front-proxy-client", "aggregator"},
+			GroupHeaders:       []string{"X-Remote-Group", "X-Forwarded-Group"},
+			ExtraHeadersPrefix: []string{"X-Remote-Extra-"},
+		}},
+		Status: v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	cfg := DefaultClusterConfig(substrate)
+	for flag, expected := range map[string]string{
+		"requestheader-allowed-names":        "front-proxy-client,aggregator",
+		"requestheader-group-headers":        "X-Remote-Group,X-Forwarded-Group",
+		"requestheader-extra-headers-prefix": "X-Remote-Extra-",
+	} {
+		if value := cfg.APIServer.ExtraArgs[flag]; value != expected {
+			t.Errorf("expected %s=%s, got %q", flag, expected, value)
+		}
+	}
+	if _, ok := cfg.APIServer.ExtraArgs["requestheader-username-headers"]; ok {
+		t.Errorf("expected kubeadm's default for requestheader-username-headers")
+	}
+	if err := (&Config{}).generateCerts(cfg, substrate); err != nil {
+		t.Fatalf("generating certs, %v", err)
+	}
+	for _, cert := range []string{kubeadmconstants.FrontProxyCACertName, kubeadmconstants.FrontProxyClientCertName, kubeadmconstants.FrontProxyClientKeyName} {
+		if _, err := os.Stat(path.Join(cfg.CertificatesDir, cert)); err != nil {
+			t.Errorf("expected %s to be generated, %v", cert, err)
+		}
+	}
+
+	substrate.Spec.RequestHeader.GroupHeaders = []string{"X Remote Group"}
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected invalid group header to fail validation")
+	}
+}
+
+func TestFeatureGates(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-feature-gates"},
+		Spec: v1alpha1.SubstrateSpec{
+			WatchCacheEnabled: aws.Bool(false),
+			FeatureGates:      map[string]bool{"APIListChunking": true, "EphemeralContainers": false},
+		},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	expected := "APIListChunking=true,EphemeralContainers=false"
+	cfg := DefaultClusterConfig(substrate)
+	for component, extraArgs := range map[string]map[string]string{
+		kubeadmconstants.KubeAPIServer:         cfg.APIServer.ExtraArgs,
+		kubeadmconstants.KubeControllerManager: cfg.ControllerManager.ExtraArgs,
+		kubeadmconstants.KubeScheduler:         cfg.Scheduler.ExtraArgs,
+	} {
+		if flag := extraArgs["feature-gates"]; flag != expected {
+			t.Errorf("expected %s feature-gates=%s, got %q", component, expected, flag)
+		}
+	}
+	// The gates are merged with the other extra args
+	if flag := cfg.APIServer.ExtraArgs["watch-cache"]; flag != "false" {
+		t.Errorf("expected watch-cache=false, got %q", flag)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	if err := (&Config{}).kubeletSystemService(cfg, substrate); err != nil {
+		t.Fatalf("generating kubelet service, %v", err)
+	}
+	service, err := ioutil.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), kubeletSystemdPath, "kubelet.service"))
+	if err != nil {
+		t.Fatalf("reading kubelet service, %v", err)
+	}
+	if !strings.Contains(string(service), "--feature-gates="+expected+"\n") {
+		t.Errorf("expected kubelet --feature-gates=%s, got %s", expected, service)
+	}
+	substrate.Spec.FeatureGates = map[string]bool{"API-List=Chunking": true}
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected an invalid feature gate name to fail validation")
+	}
+}
+
+func TestWatchCache(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-watch-cache"},
+		Spec:       v1alpha1.SubstrateSpec{WatchCacheEnabled: aws.Bool(false)},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if flag := DefaultClusterConfig(substrate).APIServer.ExtraArgs["watch-cache"]; flag != "false" {
+		t.Errorf("expected watch-cache=false, got %q", flag)
+	}
+	// Resizing caches conflicts with disabling the watch cache
+	substrate.Spec.WatchCacheSizes = map[string]int32{"pods": 100}
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected watch cache sizes with the watch cache disabled to fail validation")
+	}
+	substrate.Spec.WatchCacheEnabled = nil
+	substrate.Spec.WatchCacheSizes = map[string]int32{"pods": 100, "deployments.apps": 0}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	cfg := DefaultClusterConfig(substrate)
+	if _, ok := cfg.APIServer.ExtraArgs["watch-cache"]; ok {
+		t.Errorf("expected the API server default for watch-cache")
+	}
+	if flag := cfg.APIServer.ExtraArgs["watch-cache-sizes"]; flag != "deployments.apps#0,pods#100" {
+		t.Errorf("expected watch-cache-sizes=deployments.apps#0,pods#100, got %q", flag)
+	}
+	for _, sizes := range []map[string]int32{{"Pods": 100}, {"pods": -1}} {
+		substrate.Spec.WatchCacheSizes = sizes
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected watch cache sizes %v to fail validation", sizes)
+		}
+	}
+}
+
+func TestStorage(t *testing.T) {
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-storage"}}
+	cfg := DefaultClusterConfig(substrate)
+	for _, flag := range []string{"storage-backend", "storage-media-type"} {
+		if _, ok := cfg.APIServer.ExtraArgs[flag]; ok {
+			t.Errorf("expected the API server default for %s", flag)
+		}
+	}
+	for _, mediaType := range []string{v1alpha1.StorageMediaTypeJSON, v1alpha1.StorageMediaTypeProtobuf} {
+		substrate.Spec.StorageBackend = v1alpha1.StorageBackendEtcd3
+		substrate.Spec.StorageMediaType = mediaType
+		if err := substrate.Validate(context.Background()); err != nil {
+			t.Fatalf("validating substrate, %v", err)
+		}
+		cfg := DefaultClusterConfig(substrate)
+		if flag := cfg.APIServer.ExtraArgs["storage-backend"]; flag != "etcd3" {
+			t.Errorf("expected storage-backend=etcd3, got %q", flag)
+		}
+		if flag := cfg.APIServer.ExtraArgs["storage-media-type"]; flag != mediaType {
+			t.Errorf("expected storage-media-type=%s, got %q", mediaType, flag)
+		}
+	}
+	for _, spec := range []v1alpha1.SubstrateSpec{{StorageBackend: "etcd2"}, {StorageMediaType: "application/yaml"}} {
+		substrate.Spec = spec
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected %+v to fail validation", spec)
+		}
+	}
+}
+
+func TestHTTP2MaxStreamsPerConnection(t *testing.T) {
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-http2-streams"}}
+	substrate.SetDefaults(context.Background())
+	if flag := DefaultClusterConfig(substrate).APIServer.ExtraArgs["http2-max-streams-per-connection"]; flag != "1000" {
+		t.Errorf("expected http2-max-streams-per-connection=1000 by default, got %q", flag)
+	}
+	substrate.Spec.HTTP2MaxStreamsPerConnection = aws.Int32(2000)
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if flag := DefaultClusterConfig(substrate).APIServer.ExtraArgs["http2-max-streams-per-connection"]; flag != "2000" {
+		t.Errorf("expected http2-max-streams-per-connection=2000, got %q", flag)
+	}
+	for _, streams := range []int32{0, 10001} {
+		substrate.Spec.HTTP2MaxStreamsPerConnection = aws.Int32(streams)
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected %d streams to fail validation", streams)
+		}
+	}
+}
+
+func TestMaxNameLength(t *testing.T) {
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", v1alpha1.MaxNameLength)}}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	for _, role := range desiredRolesFor(substrate) {
+		if name := aws.StringValue(role.name); len(name) > 63 {
+			t.Errorf("expected role %s to be no more than 63 characters", name)
+		}
+	}
+	substrate.Name += "a"
+	err := substrate.Validate(context.Background())
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("must be no more than %d characters", v1alpha1.MaxNameLength)) {
+		t.Errorf("expected the maximum name length in the error, got %v", err)
+	}
+}
+
+func TestIAMAuthenticator(t *testing.T) {
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-iam-authenticator"}}
+	substrate.SetDefaults(context.Background())
+	cfg := DefaultClusterConfig(substrate)
+	if flag := cfg.APIServer.ExtraArgs["authentication-token-webhook-config-file"]; flag != authenticatorKubeconfig {
+		t.Errorf("expected the authenticator webhook by default, got %q", flag)
+	}
+	if len(cfg.APIServer.ExtraVolumes) != 1 || cfg.APIServer.ExtraVolumes[0].Name != "authenticator-config" {
+		t.Errorf("expected the authenticator config to be mounted by default, got %v", cfg.APIServer.ExtraVolumes)
+	}
+	substrate.Spec.EnableIAMAuthenticator = aws.Bool(false)
+	cfg = DefaultClusterConfig(substrate)
+	if _, ok := cfg.APIServer.ExtraArgs["authentication-token-webhook-config-file"]; ok {
+		t.Errorf("expected no authenticator webhook")
+	}
+	if len(cfg.APIServer.ExtraVolumes) != 0 {
+		t.Errorf("expected no volumes, got %v", cfg.APIServer.ExtraVolumes)
+	}
+}
+
+func TestOIDC(t *testing.T) {
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-oidc"},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	config := &Config{}
+	cfg := DefaultClusterConfig(substrate)
+	for flag := range cfg.APIServer.ExtraArgs {
+		if strings.HasPrefix(flag, "oidc-") {
+			t.Errorf("expected no OIDC flags by default, got %s", flag)
+		}
+	}
+	// Any CA will do to verify the provider
+	if err := config.generateCerts(cfg, substrate); err != nil {
+		t.Fatalf("generating certs, %v", err)
+	}
+	ca, err := ioutil.ReadFile(path.Join(cfg.CertificatesDir, kubeadmconstants.CACertName))
+	if err != nil {
+		t.Fatalf("reading CA certificate, %v", err)
+	}
+	substrate.Spec.OIDC = &v1alpha1.OIDCSpec{
+		IssuerURL:     "https://oidc.example.com",
+		ClientID:      "kit",
+		UsernameClaim: "email",
+		GroupsClaim:   "groups",
+		GroupsPrefix:  "oidc:",
+		CA:            string(ca),
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if err := config.oidcCA(substrate); err != nil {
+		t.Fatalf("generating OIDC CA, %v", err)
+	}
+	contents, err := ioutil.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), oidcCAPath))
+	if err != nil {
+		t.Fatalf("reading OIDC CA, %v", err)
+	}
+	if string(contents) != string(ca) {
+		t.Errorf("expected the OIDC CA to be written to %s", oidcCAPath)
+	}
+	args := DefaultClusterConfig(substrate).APIServer.ExtraArgs
+	for flag, expected := range map[string]string{
+		"oidc-issuer-url":     "https://oidc.example.com",
+		"oidc-client-id":      "kit",
+		"oidc-username-claim": "email",
+		"oidc-groups-claim":   "groups",
+		"oidc-groups-prefix":  "oidc:",
+		"oidc-ca-file":        "/etc/kubernetes/pki/oidc-ca.crt",
+	} {
+		if actual := args[flag]; actual != expected {
+			t.Errorf("expected %s=%s, got %q", flag, expected, actual)
+		}
+	}
+	if _, ok := args["oidc-username-prefix"]; ok {
+		t.Errorf("expected the API server default for oidc-username-prefix")
+	}
+	if _, ok := args["oidc-signing-algs"]; ok {
+		t.Errorf("expected the API server default for oidc-signing-algs")
+	}
+	substrate.Spec.OIDC.SigningAlgs = []string{"RS256", "ES256"}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if actual := DefaultClusterConfig(substrate).APIServer.ExtraArgs["oidc-signing-algs"]; actual != "RS256,ES256" {
+		t.Errorf("expected oidc-signing-algs=RS256,ES256, got %q", actual)
+	}
+	for _, oidc := range []*v1alpha1.OIDCSpec{
+		{IssuerURL: "http://oidc.example.com", ClientID: "kit"},
+		{IssuerURL: "https://oidc.example.com"},
+		{IssuerURL: "https://oidc.example.com", ClientID: "kit", CA: "not a certificate"},
+		{IssuerURL: "https://oidc.example.com", ClientID: "kit", SigningAlgs: []string{"HS256"}},
+		// Multiple issuers aren't supported by the --oidc flags
+		{IssuerURL: "https://oidc.example.com,https://dex.example.com", ClientID: "kit"},
+		{IssuerURL: "https://oidc.example.com https://dex.example.com", ClientID: "kit"},
+		{IssuerURL: "https://oidc.example.com", ClientID: "kit,dex"},
+	} {
+		substrate.Spec.OIDC = oidc
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected %+v to fail validation", oidc)
+		}
+	}
+}
+
+func TestEtcdBackupPolicy(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	if strings.Contains(aws.StringValue(desiredRolesFor(substrate)[0].policy), "s3:PutObject") {
+		t.Errorf("expected no write permissions without etcd backups")
+	}
+	substrate.Spec.EtcdBackup = &v1alpha1.EtcdBackupSpec{}
+	substrate.Spec.BucketKMSKeyARN = aws.String("arn:aws:kms:us-west-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab")
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	policy := aws.StringValue(desiredRolesFor(substrate)[0].policy)
+	if err := json.Unmarshal([]byte(policy), &map[string]interface{}{}); err != nil {
+		t.Fatalf("parsing substrate node policy, %v", err)
+	}
+	// Writes are limited to the snapshots
+	if !strings.Contains(policy, `"Resource": ["arn:aws:s3:::kit-test-substrate/tmp/kit-test-substrate/etcd-snapshots/*"]`) {
+		t.Errorf("expected the substrate node to be allowed to write snapshots, got %s", policy)
+	}
+	if !strings.Contains(policy, "kms:GenerateDataKey") {
+		t.Errorf("expected the substrate node to be allowed to encrypt snapshots")
+	}
+	for _, backup := range []*v1alpha1.EtcdBackupSpec{
+		{Interval: &metav1.Duration{Duration: time.Second}},
+		{Retention: aws.Int32(0)},
+	} {
+		substrate.Spec.EtcdBackup = backup
+		if err := substrate.Validate(ctx); err == nil {
+			t.Errorf("expected etcd backup %v to fail validation", backup)
+		}
+	}
+}
+
+func TestBootstrapTokenAuth(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec: v1alpha1.SubstrateSpec{ClusterInfo: &v1alpha1.ClusterInfoSpec{
+			BootstrapTokens: []string{"abcdef.0123456789abcdef"},
+		}},
+	}
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if flag := DefaultClusterConfig(substrate).APIServer.ExtraArgs["enable-bootstrap-token-auth"]; flag != "true" {
+		t.Errorf("expected bootstrap token auth with bootstrap tokens, got %q", flag)
+	}
+	substrate.Spec.EnableBootstrapTokenAuth = aws.Bool(false)
+	if err := substrate.Validate(ctx); err == nil {
+		t.Errorf("expected bootstrap tokens without bootstrap token auth to fail validation")
+	}
+	// Defaults to off without bootstrap tokens
+	substrate = &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	substrate.SetDefaults(ctx)
+	if flag := DefaultClusterConfig(substrate).APIServer.ExtraArgs["enable-bootstrap-token-auth"]; flag != "false" {
+		t.Errorf("expected no bootstrap token auth without bootstrap tokens, got %q", flag)
+	}
+}
+
+func TestContainerRuntime(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-container-runtime"}}
+	substrate.SetDefaults(ctx)
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	kubeletService := func() string {
+		if err := (&Config{}).kubeletSystemService(DefaultClusterConfig(substrate), substrate); err != nil {
+			t.Fatalf("generating kubelet service, %v", err)
+		}
+		service, err := os.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), kubeletSystemdPath, "kubelet.service"))
+		if err != nil {
+			t.Fatalf("reading kubelet service, %v", err)
+		}
+		return string(service)
+	}
+	// Docker is the default
+	service := kubeletService()
+	for _, expected := range []string{"Requires=docker.service", " --container-runtime=docker --network-plugin=cni ", "--pod-infra-container-image=" + pauseImage} {
+		if !strings.Contains(service, expected) {
+			t.Errorf("expected kubelet service to contain %q, got %s", expected, service)
+		}
+	}
+
+	substrate.Spec.ContainerRuntime = v1alpha1.ContainerRuntimeContainerd
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	service = kubeletService()
+	for _, expected := range []string{"Requires=containerd.service", " --container-runtime=remote ", " --container-runtime-endpoint=" + containerdSocket + " ", "--pod-infra-container-image=" + pauseImage} {
+		if !strings.Contains(service, expected) {
+			t.Errorf("expected kubelet service to contain %q, got %s", expected, service)
+		}
+	}
+	if strings.Contains(service, "docker") || strings.Contains(service, "--network-plugin") {
+		t.Errorf("expected no docker flags, got %s", service)
+	}
+	cfg := DefaultClusterConfig(substrate)
+	if args := cfg.NodeRegistration.KubeletExtraArgs; args["container-runtime"] != "remote" || args["container-runtime-endpoint"] != containerdSocket || args["network-plugin"] != "" {
+		t.Errorf("expected containerd kubelet args, got %v", args)
+	}
+	if cfg.NodeRegistration.CRISocket != containerdSocket {
+		t.Errorf("expected cri socket %s, got %s", containerdSocket, cfg.NodeRegistration.CRISocket)
+	}
+	if script := containerRuntimeScript(substrate); !strings.Contains(script, `sandbox_image = "`+pauseImage+`"`) {
+		t.Errorf("expected containerd's sandbox image to be %s, got %s", pauseImage, script)
+	}
+
+	substrate.Spec.ContainerRuntime = "cri-o"
+	if err := substrate.Validate(ctx); err == nil {
+		t.Errorf("expected an unsupported container runtime to fail validation")
+	}
+}
+
+func TestCgroupDriver(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cgroup-driver"},
+		Spec:       v1alpha1.SubstrateSpec{CgroupDriver: v1alpha1.CgroupDriverCgroupfs},
+	}
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	cfg := DefaultClusterConfig(substrate)
+	if flag := cfg.NodeRegistration.KubeletExtraArgs["cgroup-driver"]; flag != v1alpha1.CgroupDriverCgroupfs {
+		t.Errorf("expected kubelet extra arg cgroup-driver=cgroupfs, got %q", flag)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	if err := (&Config{}).kubeletSystemService(cfg, substrate); err != nil {
+		t.Fatalf("generating kubelet service, %v", err)
+	}
+	service, err := os.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), kubeletSystemdPath, "kubelet.service"))
+	if err != nil {
+		t.Fatalf("reading kubelet service, %v", err)
+	}
+	if !strings.Contains(string(service), " --cgroup-driver=cgroupfs ") {
+		t.Errorf("expected kubelet --cgroup-driver=cgroupfs, got %s", service)
+	}
+	// The container runtime is configured with the same driver
+	if script := containerRuntimeScript(substrate); !strings.Contains(script, `"native.cgroupdriver=cgroupfs"`) {
+		t.Errorf("expected docker to use cgroupfs, got %s", script)
+	}
+	substrate.Spec.ContainerRuntime = v1alpha1.ContainerRuntimeContainerd
+	if script := containerRuntimeScript(substrate); !strings.Contains(script, "SystemdCgroup = false") {
+		t.Errorf("expected containerd to use cgroupfs, got %s", script)
+	}
+
+	substrate.Spec.CgroupDriver = "cgroupv2"
+	if err := substrate.Validate(ctx); err == nil {
+		t.Errorf("expected an unsupported cgroup driver to fail validation")
+	}
+}
+
+func TestPruneStaticPodManifests(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-prune-manifests"},
+		Spec:       v1alpha1.SubstrateSpec{Schedulers: []v1alpha1.SchedulerSpec{{Name: "bin-packing"}}},
+		Status:     v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	dir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)))
+	defer os.RemoveAll(dir)
+	fake := &fakeS3{}
+	config := &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+	if err := config.generateStaticPodManifests(DefaultClusterConfig(substrate), substrate); err != nil {
+		t.Fatalf("generating static pod manifests, %v", err)
+	}
+	// The manifests as uploaded to the bucket
+	manifestDir := path.Join(dir, clusterManifestPath)
+	files, err := os.ReadDir(manifestDir)
+	if err != nil {
+		t.Fatalf("reading manifests, %v", err)
+	}
+	for _, file := range files {
+		fake.objects = append(fake.objects, strings.TrimPrefix(path.Join(manifestDir, file.Name()), "/"))
+	}
+	fake.objects = append(fake.objects, strings.TrimPrefix(path.Join(dir, kubeletSystemdPath, "kubelet.service"), "/"))
+	if err := config.pruneStaticPodManifests(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("pruning manifests, %v", err)
+	}
+	if len(fake.objects) != len(files)+1 {
+		t.Fatalf("expected no manifests to be pruned, got %v", fake.objects)
+	}
+
+	substrate.Spec.Schedulers = nil
+	if err := config.pruneStaticPodManifests(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("pruning manifests, %v", err)
+	}
+	stale := kubeadmconstants.GetStaticPodFilepath("kube-scheduler-bin-packing", manifestDir)
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", stale, err)
+	}
+	remaining := sets.NewString(fake.objects...)
+	if remaining.Has(strings.TrimPrefix(stale, "/")) {
+		t.Errorf("expected the removed scheduler's manifest to be pruned from the bucket, got %v", fake.objects)
+	}
+	for _, component := range []string{kubeadmconstants.KubeScheduler, kubeadmconstants.KubeAPIServer} {
+		if !remaining.Has(strings.TrimPrefix(kubeadmconstants.GetStaticPodFilepath(component, manifestDir), "/")) {
+			t.Errorf("expected the %s manifest to be kept, got %v", component, fake.objects)
+		}
+	}
+	if !remaining.Has(strings.TrimPrefix(path.Join(dir, kubeletSystemdPath, "kubelet.service"), "/")) {
+		t.Errorf("expected objects outside the manifests to be kept, got %v", fake.objects)
+	}
+}
+
+func TestNodeLabelsAndTaints(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node-labels"},
+		Spec: v1alpha1.SubstrateSpec{
+			NodeLabels: map[string]string{"kit.sh/experiment": "churn", "tier": "iteration", "node-role.kubernetes.io/control-plane": ""},
+			NodeTaints: []v1.Taint{
+				{Key: "kit.sh/dedicated", Value: "control-plane", Effect: v1.TaintEffectNoSchedule},
+				{Key: "experimental", Effect: v1.TaintEffectPreferNoSchedule},
+			},
+		},
+	}
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	defer os.RemoveAll(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate))))
+	if err := (&Config{}).kubeletSystemService(DefaultClusterConfig(substrate), substrate); err != nil {
+		t.Fatalf("generating kubelet service, %v", err)
+	}
+	service, err := os.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), kubeletSystemdPath, "kubelet.service"))
+	if err != nil {
+		t.Fatalf("reading kubelet service, %v", err)
+	}
+	for _, expected := range []string{
+		" --node-labels=kit.aws/substrate=control-plane,kit.sh/experiment=churn,tier=iteration ",
+		" --register-with-taints=kit.sh/dedicated=control-plane:NoSchedule,experimental:PreferNoSchedule",
+	} {
+		if !strings.Contains(string(service), expected) {
+			t.Errorf("expected kubelet service to contain %q, got %s", expected, service)
+		}
+	}
+	// The kubelet refuses to register node-role labels, they're applied through the API
+	if strings.Contains(string(service), "node-role") {
+		t.Errorf("expected the node-role label to be left out of the kubelet service, got %s", service)
+	}
+}
+
+func TestBottlerocket(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-bottlerocket"},
+		Spec: v1alpha1.SubstrateSpec{
+			OperatingSystem: v1alpha1.OperatingSystemBottlerocket,
+			Bottlerocket:    &v1alpha1.BottlerocketSpec{SyncImage: "public.ecr.aws/kit/sync:latest"},
+			NodeLabels:      map[string]string{"team": "kit"},
+			NodeTaints:      []v1.Taint{{Key: "dedicated", Value: "control-plane", Effect: v1.TaintEffectNoSchedule}},
+		},
+		Status: v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	userData := bottlerocketUserData(substrate)
+	for _, expected := range []string{
+		"[settings.kubernetes]\n",
+		`cluster-name = "test-bottlerocket"`,
+		`api-server = "https://10.0.0.1:443"`,
+		`hostname-override = "test-bottlerocket"`,
+		`cluster-dns-ip = "10.96.0.10"`,
+		fmt.Sprintf("pod-infra-container-image = %q", pauseImage),
+		"[settings.kubernetes.node-labels]\n\"kit.aws/substrate\" = \"control-plane\"\n\"team\" = \"kit\"\n",
+		"[settings.kubernetes.node-taints]\n\"dedicated\" = \"control-plane:NoSchedule\"\n",
+		"[settings.host-containers.kit-sync]\n",
+		`source = "public.ecr.aws/kit/sync:latest"`,
+		"superpowered = true",
+	} {
+		if !strings.Contains(userData, expected) {
+			t.Errorf("expected user data to contain %q, got %s", expected, userData)
+		}
+	}
+	// The host container syncs the configuration to Bottlerocket's kubelet paths
+	script := bottlerocketSyncScript(substrate)
+	for _, expected := range []string{
+		"s3://kit-test-bottlerocket/tmp/kit-test-bottlerocket/etc/kubernetes/manifests /.bottlerocket/rootfs/etc/kubernetes/static-pods",
+		"cp -p /.bottlerocket/rootfs/etc/kubernetes/kubelet.conf /.bottlerocket/rootfs/etc/kubernetes/kubelet/kubeconfig",
+		"chroot /.bottlerocket/rootfs systemctl restart kubelet",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected sync script to contain %q, got %s", expected, script)
+		}
+	}
+	if !strings.Contains(userData, base64.StdEncoding.EncodeToString([]byte(script))) {
+		t.Errorf("expected the sync script to be the host container's user data")
+	}
+}
+
+func TestEgressSelector(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-egress-selector"},
+		Spec: v1alpha1.SubstrateSpec{EgressSelector: &v1alpha1.EgressSelectorSpec{Selections: []v1alpha1.EgressSelectionSpec{
+			{Name: v1alpha1.EgressSelectionCluster, ProxyProtocol: v1alpha1.ProxyProtocolGRPC, UDSName: "/etc/kubernetes/konnectivity-server/konnectivity-server.socket"},
+			{Name: v1alpha1.EgressSelectionEtcd},
+		}}},
+		Status: v1alpha1.SubstrateStatus{Cluster: v1alpha1.ClusterStatus{Address: aws.String("10.0.0.1")}},
+	}
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	data, err := egressSelectorConfigFor(substrate)
+	if err != nil {
+		t.Fatalf("generating egress selector config, %v", err)
+	}
+	config := egressSelectorConfiguration{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		t.Fatalf("unmarshalling egress selector config, %v", err)
+	}
+	if config.APIVersion != "apiserver.k8s.io/v1beta1" || config.Kind != "EgressSelectorConfiguration" {
+		t.Errorf("expected an EgressSelectorConfiguration, got %s", data)
+	}
+	// Every destination is rendered, the ones missing from the spec are direct
+	expected := map[string]egressConnection{
+		v1alpha1.EgressSelectionCluster: {ProxyProtocol: v1alpha1.ProxyProtocolGRPC, Transport: &egressTransport{UDS: &udsTransport{
+			UDSName: "/etc/kubernetes/konnectivity-server/konnectivity-server.socket"}}},
+		v1alpha1.EgressSelectionControlPlane: {ProxyProtocol: v1alpha1.ProxyProtocolDirect},
+		v1alpha1.EgressSelectionEtcd:         {ProxyProtocol: v1alpha1.ProxyProtocolDirect},
+	}
+	if len(config.EgressSelections) != len(expected) {
+		t.Fatalf("expected %d egress selections, got %s", len(expected), data)
+	}
+	for _, selection := range config.EgressSelections {
+		actual, _ := json.Marshal(selection.Connection)
+		if connection, _ := json.Marshal(expected[selection.Name]); string(actual) != string(connection) {
+			t.Errorf("expected %s to connect with %s, got %s", selection.Name, connection, actual)
+		}
+	}
+	cfg := DefaultClusterConfig(substrate)
+	if cfg.APIServer.ExtraArgs["egress-selector-config-file"] != egressSelectorConfigPath {
+		t.Errorf("expected --egress-selector-config-file=%s, got %v", egressSelectorConfigPath, cfg.APIServer.ExtraArgs)
+	}
+	mounts := sets.NewString()
+	for _, volume := range cfg.APIServer.ExtraVolumes {
+		mounts.Insert(volume.MountPath)
+	}
+	if !mounts.HasAll(egressSelectorConfigPath, "/etc/kubernetes/konnectivity-server") {
+		t.Errorf("expected the config and proxy socket to be mounted, got %v", mounts.List())
+	}
+	for _, selection := range []v1alpha1.EgressSelectionSpec{
+		{Name: "master"},
+		{Name: v1alpha1.EgressSelectionCluster, ProxyProtocol: "SOCKS5", UDSName: "/run/proxy.socket"},
+		{Name: v1alpha1.EgressSelectionCluster, ProxyProtocol: v1alpha1.ProxyProtocolHTTPConnect},
+		{Name: v1alpha1.EgressSelectionCluster, ProxyProtocol: v1alpha1.ProxyProtocolHTTPConnect, UDSName: "proxy.socket"},
+		{Name: v1alpha1.EgressSelectionCluster, ProxyProtocol: v1alpha1.ProxyProtocolDirect, UDSName: "/run/proxy.socket"},
+		{Name: v1alpha1.EgressSelectionEtcd, ProxyProtocol: v1alpha1.ProxyProtocolGRPC, UDSName: "/run/proxy.socket"},
+	} {
+		substrate.Spec.EgressSelector.Selections = []v1alpha1.EgressSelectionSpec{selection}
+		if err := substrate.Validate(ctx); err == nil {
+			t.Errorf("expected %+v to fail validation", selection)
+		}
+	}
+	substrate.Spec.EgressSelector.Selections = []v1alpha1.EgressSelectionSpec{{Name: v1alpha1.EgressSelectionEtcd}, {Name: v1alpha1.EgressSelectionEtcd}}
+	if err := substrate.Validate(ctx); err == nil {
+		t.Errorf("expected duplicate destinations to fail validation")
+	}
+}
+
+func TestKubeConfigURL(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{KubeConfigURLTTL: &metav1.Duration{Duration: 15 * time.Minute}},
+	}
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	substrate.Status.Cluster.KubeConfig = aws.String(path.Join(ClusterCertsBasePath, "test-substrate", kubeconfigFile))
+	clients := fakeClientFactory(&fakeS3{}, "us-west-2").For(substrate)
+	if err := presignKubeConfig(clients, substrate); err != nil {
+		t.Fatalf("presigning kube config, %v", err)
+	}
+	url := aws.StringValue(substrate.Status.Cluster.KubeConfigURL)
+	for _, expected := range []string{aws.StringValue(discovery.BucketName(substrate)), "tmp/test-substrate/etc/kubernetes/admin.conf", "X-Amz-Expires=900"} {
+		if !strings.Contains(url, expected) {
+			t.Errorf("expected kube config URL %s to contain %s", url, expected)
+		}
+	}
+	if expiry := substrate.Status.Cluster.KubeConfigURLExpiry; expiry == nil || time.Until(expiry.Time) > 15*time.Minute || time.Until(expiry.Time) < 14*time.Minute {
+		t.Errorf("expected kube config URL to expire in 15m, got %v", expiry)
+	}
+	substrate.Spec.KubeConfigURLTTL = nil
+	if err := presignKubeConfig(clients, substrate); err != nil {
+		t.Fatalf("presigning kube config, %v", err)
+	}
+	if substrate.Status.Cluster.KubeConfigURL != nil || substrate.Status.Cluster.KubeConfigURLExpiry != nil {
+		t.Errorf("expected kube config URL to be cleared when the TTL is unset")
+	}
+	for _, ttl := range []time.Duration{30 * time.Second, 13 * time.Hour} {
+		substrate.Spec.KubeConfigURLTTL = &metav1.Duration{Duration: ttl}
+		if err := substrate.Validate(ctx); err == nil {
+			t.Errorf("expected kube config URL TTL %s to fail validation", ttl)
+		}
+	}
+}
+
+// fakeRecorder records the events' type, reason and message
+type fakeRecorder struct {
+	events []string
+}
+
+func (f *fakeRecorder) Eventf(_ runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	f.events = append(f.events, eventType+" "+reason+" "+fmt.Sprintf(messageFmt, args...))
+}
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-events"}}
+	substrate.Status.Cluster.Address = aws.String("1.2.3.4")
+	bucket := aws.StringValue(discovery.BucketName(substrate))
+
+	recorder := &fakeRecorder{}
+	fake := &fakeS3{createBucketErrors: []error{awserr.New("AccessDenied", "Access Denied", nil)}}
+	config := &Config{Clients: fakeClientFactory(fake, "us-west-2"), Recorder: recorder}
+	if _, err := config.Create(ctx, substrate); err == nil {
+		t.Fatalf("expected creating the bucket to fail")
+	}
+	if expected := "Warning BucketCreationFailed Creating S3 bucket " + bucket + " failed"; len(recorder.events) != 1 ||
+		!strings.HasPrefix(recorder.events[0], expected) || !strings.Contains(recorder.events[0], "AccessDenied") {
+		t.Errorf("expected an event starting with %q and including the error, got %v", expected, recorder.events)
+	}
+
+	recorder.events = nil
+	if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket, %v", err)
+	}
+	uploader := &fakeUploader{objects: map[string][]string{}}
+	config.Clients.For(substrate).S3Uploader = uploader
+	dir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)))
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("creating directory, %v", err)
+	}
+	if err := config.upload(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("uploading, %v", err)
+	}
+	expected := []string{
+		"Normal BucketCreated Created S3 bucket " + bucket,
+		"Normal ConfigUploaded Uploaded cluster configuration to s3://" + bucket,
+	}
+	if !reflect.DeepEqual(recorder.events, expected) {
+		t.Errorf("expected events %v, got %v", expected, recorder.events)
+	}
+
+	// Certificates are only reported when they're generated
+	recorder.events = nil
+	cfg := DefaultClusterConfig(substrate)
+	for i := 0; i < 2; i++ {
+		if err := config.generateCerts(cfg, substrate); err != nil {
+			t.Fatalf("generating certs, %v", err)
+		}
+	}
+	if expected := []string{"Normal CertificatesGenerated Generated certificates in " + cfg.CertificatesDir}; !reflect.DeepEqual(recorder.events, expected) {
+		t.Errorf("expected events %v, got %v", expected, recorder.events)
+	}
+
+	// A Config without a recorder skips the events
+	config.Recorder = nil
+	if err := config.ensureBucket(ctx, config.Clients.For(substrate), substrate); err != nil {
+		t.Fatalf("ensuring bucket, %v", err)
+	}
+}
+
+func TestDeleteDryRun(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-delete-dry-run"}}
+	bucket := aws.StringValue(discovery.BucketName(substrate))
+	dir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)))
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("creating directory, %v", err)
+	}
+	fake := &fakeS3{objects: []string{path.Join(dir, kubeconfigFile)}}
+	config := &Config{Clients: fakeClientFactory(fake, "us-west-2"), DryRun: true}
+	if _, err := config.Delete(ctx, substrate); err != nil {
+		t.Fatalf("deleting config, %v", err)
+	}
+	if len(fake.listed) != 0 || len(fake.deleted) != 0 || len(fake.objects) != 1 {
+		t.Errorf("expected nothing to be deleted, listed %v for deletion and deleted %v", fake.listed, fake.deleted)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("expected %s to be kept, %v", dir, err)
+	}
+	plan, err := config.DeletePlan(ctx, substrate)
+	if err != nil {
+		t.Fatalf("planning delete, %v", err)
+	}
+	expected := []string{
+		fmt.Sprintf("s3://%s%s", bucket, path.Join(dir, kubeconfigFile)),
+		"s3://" + bucket,
+		dir,
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("expected plan %v, got %v", expected, plan)
+	}
+
+	// Deleting for real is unchanged
+	config.DryRun = false
+	if _, err := config.Delete(ctx, substrate); err != nil {
+		t.Fatalf("deleting config, %v", err)
+	}
+	if len(fake.deleted) != 1 || fake.deleted[0] != bucket {
+		t.Errorf("expected bucket %s to be deleted, got %v", bucket, fake.deleted)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, %v", dir, err)
+	}
+}
+
+func TestDeleteErrors(t *testing.T) {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-delete-errors"}}
+	for _, err := range []error{errors.New("connection reset"), context.DeadlineExceeded, fmt.Errorf("wrapped, %w", context.DeadlineExceeded)} {
+		// Listing the objects fails
+		fake := &fakeS3{listErr: err}
+		config := &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+		if _, deleteErr := config.Delete(ctx, substrate); deleteErr == nil || !strings.Contains(deleteErr.Error(), "deleting objects from bucket") {
+			t.Errorf("expected listing to fail with %v, got %v", err, deleteErr)
+		}
+		// Deleting the bucket fails
+		fake = &fakeS3{deleteBucketErr: err}
+		config = &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+		if _, deleteErr := config.Delete(ctx, substrate); !errors.Is(deleteErr, err) {
+			t.Errorf("expected deleting the bucket to fail with %v, got %v", err, deleteErr)
+		}
+	}
+	// Missing buckets are already deleted
+	fake := &fakeS3{
+		listErr:         awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil),
+		deleteBucketErr: fmt.Errorf("wrapped, %w", awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil)),
+	}
+	config := &Config{Clients: fakeClientFactory(fake, "us-west-2")}
+	if _, err := config.Delete(ctx, substrate); err != nil {
+		t.Errorf("expected a missing bucket to be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	egressSelectorConfigPath = "/etc/kubernetes/egress-selector/config.yaml"
+	// egressSelectorHashAnnotation restarts the API server when the egress
+	// selector config changes, as it's only read on start up
+	egressSelectorHashAnnotation = "kit.sh/egress-selector-hash"
+)
+
+// egressSelectorConfiguration is apiserver.k8s.io/v1beta1
+// EgressSelectorConfiguration without the TCP transport
+type egressSelectorConfiguration struct {
+	APIVersion       string            `json:"apiVersion"`
+	Kind             string            `json:"kind"`
+	EgressSelections []egressSelection `json:"egressSelections"`
+}
+
+type egressSelection struct {
+	Name       string           `json:"name"`
+	Connection egressConnection `json:"connection"`
+}
+
+type egressConnection struct {
+	ProxyProtocol string           `json:"proxyProtocol"`
+	Transport     *egressTransport `json:"transport,omitempty"`
+}
+
+type egressTransport struct {
+	UDS *udsTransport `json:"uds,omitempty"`
+}
+
+type udsTransport struct {
+	UDSName string `json:"udsName"`
+}
+
+// egressSelectorConfigFor renders a connection for every destination, the
+// destinations missing from the spec are connected to directly
+func egressSelectorConfigFor(substrate *v1alpha1.Substrate) ([]byte, error) {
+	selections := map[string]v1alpha1.EgressSelectionSpec{}
+	for _, selection := range substrate.Spec.EgressSelector.Selections {
+		selections[selection.Name] = selection
+	}
+	config := egressSelectorConfiguration{APIVersion: "apiserver.k8s.io/v1beta1", Kind: "EgressSelectorConfiguration"}
+	for _, name := range []string{v1alpha1.EgressSelectionCluster, v1alpha1.EgressSelectionControlPlane, v1alpha1.EgressSelectionEtcd} {
+		connection := egressConnection{ProxyProtocol: v1alpha1.ProxyProtocolDirect}
+		if selection, ok := selections[name]; ok && selection.ProxyProtocol != "" && selection.ProxyProtocol != v1alpha1.ProxyProtocolDirect {
+			connection = egressConnection{ProxyProtocol: selection.ProxyProtocol, Transport: &egressTransport{UDS: &udsTransport{UDSName: selection.UDSName}}}
+		}
+		config.EgressSelections = append(config.EgressSelections, egressSelection{Name: name, Connection: connection})
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling egress selector config, %w", err)
+	}
+	return data, nil
+}
+
+func (c *Config) egressSelector(substrate *v1alpha1.Substrate) error {
+	if substrate.Spec.EgressSelector == nil {
+		return nil
+	}
+	config, err := egressSelectorConfigFor(substrate)
+	if err != nil {
+		return err
+	}
+	localPath := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), egressSelectorConfigPath)
+	if err := os.MkdirAll(path.Dir(localPath), 0700); err != nil {
+		return fmt.Errorf("failed to create directory, %w", err)
+	}
+	return ioutil.WriteFile(localPath, config, 0644)
+}
+
+// egressSocketDirs are the directories of the proxies' sockets, mounted into
+// the API server
+func egressSocketDirs(substrate *v1alpha1.Substrate) []string {
+	dirs := sets.NewString()
+	for _, selection := range substrate.Spec.EgressSelector.Selections {
+		if selection.UDSName != "" {
+			dirs.Insert(path.Dir(selection.UDSName))
+		}
+	}
+	return dirs.List()
+}
+
+func annotateEgressSelectorHash(substrate *v1alpha1.Substrate) func(*v1.Pod) error {
+	return func(pod *v1.Pod) error {
+		config, err := egressSelectorConfigFor(substrate)
+		if err != nil {
+			return err
+		}
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[egressSelectorHashAnnotation] = fmt.Sprintf("%x", sha256.Sum256(config))
+		return nil
+	}
+}
@@ -0,0 +1,316 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	encryptionConfigPath = "/etc/kubernetes/encryption/config.yaml"
+	// EncryptionConfigHashAnnotation is set on the API server static pod, so the
+	// pod is restarted when the encryption config changes and the loaded
+	// config can be read from its mirror pod
+	EncryptionConfigHashAnnotation = "kit.sh/encryption-config-hash"
+	// IdentityKeyName is reported as the active key while encryption is being
+	// disabled, secrets are rewritten unencrypted before the keys are removed
+	IdentityKeyName = "identity"
+)
+
+// encryptionConfiguration is the subset of apiserver.config.k8s.io/v1
+// EncryptionConfiguration used to encrypt secrets with aescbc
+type encryptionConfiguration struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Resources  []encryptionResources `json:"resources"`
+}
+
+type encryptionResources struct {
+	Resources []string             `json:"resources"`
+	Providers []encryptionProvider `json:"providers"`
+}
+
+type encryptionProvider struct {
+	AESCBC   *aesProvider `json:"aescbc,omitempty"`
+	Identity *struct{}    `json:"identity,omitempty"`
+}
+
+type aesProvider struct {
+	Keys []encryptionKey `json:"keys"`
+}
+
+type encryptionKey struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+// secretsEncryption writes the encryption config with the active key first,
+// the first key encrypts writes and all keys are used to decrypt. Retired keys
+// are kept until all secrets have been rewritten with the active key. The keys
+// are stored in SSM, so they're restored when the local config is missing.
+// Disabling encryption makes identity the active provider, the keys are kept
+// to read the encrypted secrets until they're all rewritten unencrypted.
+func (c *Config) secretsEncryption(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate) error {
+	stored, err := storedEncryptionKeys(ctx, clients, substrate)
+	if err != nil {
+		return err
+	}
+	keys, err := readEncryptionKeys(substrate)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		keys = stored
+	}
+	localPath := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), encryptionConfigPath)
+	// identity reads secrets written before encryption was enabled
+	providers := []encryptionProvider{{AESCBC: &aesProvider{Keys: keys}}, {Identity: &struct{}{}}}
+	if substrate.Spec.SecretsEncryption == nil {
+		if len(keys) == 0 || aws.StringValue(substrate.Status.Cluster.SecretsEncryptionKey) == IdentityKeyName {
+			if err := syncEncryptionKeys(ctx, clients, substrate, stored, nil); err != nil {
+				return err
+			}
+			if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("removing encryption config, %w", err)
+			}
+			return nil
+		}
+		providers = []encryptionProvider{{Identity: &struct{}{}}, {AESCBC: &aesProvider{Keys: keys}}}
+	} else {
+		if keys, err = rotateEncryptionKeys(keys, substrate); err != nil {
+			return err
+		}
+		providers[0].AESCBC.Keys = keys
+		// Re-enabling encryption, secrets written since are encrypted
+		if aws.StringValue(substrate.Status.Cluster.SecretsEncryptionKey) == IdentityKeyName {
+			substrate.Status.Cluster.SecretsEncryptionKey = aws.String(keys[0].Name)
+		}
+	}
+	if err := syncEncryptionKeys(ctx, clients, substrate, stored, keys); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(localPath), 0700); err != nil {
+		return fmt.Errorf("failed to create directory, %w", err)
+	}
+	config, err := yaml.Marshal(encryptionConfiguration{
+		APIVersion: "apiserver.config.k8s.io/v1",
+		Kind:       "EncryptionConfiguration",
+		Resources:  []encryptionResources{{Resources: []string{"secrets"}, Providers: providers}},
+	})
+	if err != nil {
+		return fmt.Errorf("marshalling encryption config, %w", err)
+	}
+	return ioutil.WriteFile(localPath, config, 0600)
+}
+
+// secretsEncrypted returns whether the API server runs with an encryption
+// config, which outlives the spec until encryption is disabled
+func secretsEncrypted(substrate *v1alpha1.Substrate) bool {
+	if substrate.Spec.SecretsEncryption != nil {
+		return true
+	}
+	_, err := os.Stat(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), encryptionConfigPath))
+	return err == nil
+}
+
+// encryptionKeysPath is the SSM path of the substrate's encryption keys, each
+// key is a SecureString parameter named after the key
+func encryptionKeysPath(substrate *v1alpha1.Substrate) string {
+	return fmt.Sprintf("/%s/secrets-encryption/", aws.StringValue(discovery.Name(substrate)))
+}
+
+func storedEncryptionKeys(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate) ([]encryptionKey, error) {
+	keys := []encryptionKey{}
+	if err := clients.SSM.GetParametersByPathPagesWithContext(ctx, &ssm.GetParametersByPathInput{
+		Path:           aws.String(encryptionKeysPath(substrate)),
+		WithDecryption: aws.Bool(true),
+	}, func(page *ssm.GetParametersByPathOutput, _ bool) bool {
+		for _, parameter := range page.Parameters {
+			keys = append(keys, encryptionKey{Name: path.Base(aws.StringValue(parameter.Name)), Secret: aws.StringValue(parameter.Value)})
+		}
+		return true
+	}); err != nil {
+		return nil, fmt.Errorf("getting encryption keys, %w", err)
+	}
+	return keys, nil
+}
+
+// syncEncryptionKeys stores the keys that changed and deletes the stored keys
+// that were removed
+func syncEncryptionKeys(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate, stored []encryptionKey, keys []encryptionKey) error {
+	secrets := map[string]string{}
+	for _, key := range stored {
+		secrets[key.Name] = key.Secret
+	}
+	for _, key := range keys {
+		if secret, ok := secrets[key.Name]; ok && secret == key.Secret {
+			delete(secrets, key.Name)
+			continue
+		}
+		if _, err := clients.SSM.PutParameterWithContext(ctx, &ssm.PutParameterInput{
+			Name:      aws.String(encryptionKeysPath(substrate) + key.Name),
+			Type:      aws.String(ssm.ParameterTypeSecureString),
+			Value:     aws.String(key.Secret),
+			Overwrite: aws.Bool(true),
+		}); err != nil {
+			return fmt.Errorf("storing encryption key %s, %w", key.Name, err)
+		}
+		delete(secrets, key.Name)
+	}
+	for name := range secrets {
+		if err := deleteEncryptionKey(ctx, clients, substrate, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteEncryptionKey(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate, name string) error {
+	if _, err := clients.SSM.DeleteParameterWithContext(ctx, &ssm.DeleteParameterInput{Name: aws.String(encryptionKeysPath(substrate) + name)}); err != nil {
+		if aerr := awserr.Error(nil); !errors.As(err, &aerr) || aerr.Code() != ssm.ErrCodeParameterNotFound {
+			return fmt.Errorf("deleting encryption key %s, %w", name, err)
+		}
+	}
+	return nil
+}
+
+// deleteEncryptionKeys deletes the substrate's stored encryption keys
+func deleteEncryptionKeys(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate) error {
+	stored, err := storedEncryptionKeys(ctx, clients, substrate)
+	if err != nil {
+		return err
+	}
+	return syncEncryptionKeys(ctx, clients, substrate, stored, nil)
+}
+
+// rotateEncryptionKeys prepends a new key when the active key changes and
+// removes the retired keys once secrets are rewritten, if configured to
+func rotateEncryptionKeys(keys []encryptionKey, substrate *v1alpha1.Substrate) ([]encryptionKey, error) {
+	spec := substrate.Spec.SecretsEncryption
+	if len(keys) > 0 && keys[0].Name == spec.KeyName {
+		if spec.RemoveRetiredKeys && aws.StringValue(substrate.Status.Cluster.SecretsEncryptionKey) == spec.KeyName {
+			return keys[:1], nil
+		}
+		return keys, nil
+	}
+	active := encryptionKey{Name: spec.KeyName}
+	retired := []encryptionKey{}
+	for _, key := range keys {
+		// Reactivating a retired key moves it to the front
+		if key.Name == spec.KeyName {
+			active = key
+			continue
+		}
+		retired = append(retired, key)
+	}
+	if active.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("generating encryption key, %w", err)
+		}
+		active.Secret = base64.StdEncoding.EncodeToString(secret)
+	}
+	return append([]encryptionKey{active}, retired...), nil
+}
+
+func readEncryptionKeys(substrate *v1alpha1.Substrate) ([]encryptionKey, error) {
+	providers, err := readEncryptionProviders(substrate)
+	if err != nil {
+		return nil, err
+	}
+	for _, provider := range providers {
+		if provider.AESCBC != nil {
+			return provider.AESCBC.Keys, nil
+		}
+	}
+	return nil, nil
+}
+
+func readEncryptionProviders(substrate *v1alpha1.Substrate) ([]encryptionProvider, error) {
+	data, err := ioutil.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), encryptionConfigPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading encryption config, %w", err)
+	}
+	config := encryptionConfiguration{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unmarshalling encryption config, %w", err)
+	}
+	for _, resources := range config.Resources {
+		return resources.Providers, nil
+	}
+	return nil, nil
+}
+
+// EncryptionKeyNames returns the names of the keys in the encryption config,
+// starting with the active key, IdentityKeyName while encryption is disabled
+func EncryptionKeyNames(substrate *v1alpha1.Substrate) ([]string, error) {
+	providers, err := readEncryptionProviders(substrate)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, provider := range providers {
+		if provider.Identity != nil && len(names) == 0 {
+			names = append(names, IdentityKeyName)
+		}
+		if provider.AESCBC != nil {
+			for _, key := range provider.AESCBC.Keys {
+				names = append(names, key.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// EncryptionConfigHash is the hash of the encryption config the API server is
+// expected to run with
+func EncryptionConfigHash(substrate *v1alpha1.Substrate) (string, error) {
+	data, err := ioutil.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), encryptionConfigPath))
+	if err != nil {
+		return "", fmt.Errorf("reading encryption config, %w", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// annotateEncryptionConfigHash restarts the API server when the encryption
+// config changes, as it's only read on start up
+func annotateEncryptionConfigHash(hash string) func(*v1.Pod) error {
+	return func(pod *v1.Pod) error {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[EncryptionConfigHashAnnotation] = hash
+		return nil
+	}
+}
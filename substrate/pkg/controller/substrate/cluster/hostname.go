@@ -0,0 +1,128 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+)
+
+const (
+	// kubeletHostnameEnvFile is written by the node on boot, outside of the
+	// directories synced from S3, as the hostname differs per node
+	kubeletHostnameEnvFile = "/etc/kit/kubelet-hostname.env"
+	// nodeOrdinalVariable is set by the node to its launch index
+	nodeOrdinalVariable = "KIT_NODE_ORDINAL"
+	instanceMetadataURL = "http://169.254.169.254/latest/meta-data"
+	// kubeletCertDir holds the kubelet's client certificate and kubeconfig
+	// issued on the node for its hostname, the kubelet.conf synced from the
+	// bucket is for the substrate's name
+	kubeletCertDir = "/etc/kit/kubelet"
+	// kubeletKubeConfigScript issues the kubelet's client certificate before it starts
+	kubeletKubeConfigScript = "/etc/kit/kubelet-kubeconfig.sh"
+)
+
+// nodeHostnameResolved is true when the hostname is resolved by each node
+// rather than set to the substrate's name
+func nodeHostnameResolved(substrate *v1alpha1.Substrate) bool {
+	return substrate.Spec.Hostname != nil && substrate.Spec.Hostname.Strategy != v1alpha1.HostnameStrategySubstrateName
+}
+
+// kubeletHostnameOverride is the kubelet's --hostname-override, expanded by
+// systemd from the node's environment file when resolved by the node
+func kubeletHostnameOverride(substrate *v1alpha1.Substrate) string {
+	if !nodeHostnameResolved(substrate) {
+		return substrate.Name
+	}
+	return "${KUBELET_HOSTNAME}"
+}
+
+// kubeletKubeConfig is the kubeconfig the kubelet authenticates with. The Node
+// authorizer only lets system:node:<name> update the Node <name>, so a node
+// registering with its own hostname needs a certificate for that hostname.
+func kubeletKubeConfig(substrate *v1alpha1.Substrate) string {
+	if !nodeHostnameResolved(substrate) {
+		return "/etc/kubernetes/kubelet.conf"
+	}
+	return kubeletCertDir + "/kubelet.conf"
+}
+
+// nodeHostname is the shell expression evaluated by the node on boot for its hostname
+func nodeHostname(substrate *v1alpha1.Substrate) (string, error) {
+	switch substrate.Spec.Hostname.Strategy {
+	case v1alpha1.HostnameStrategyPrivateDNSName:
+		return fmt.Sprintf("$(curl -s %s/local-hostname)", instanceMetadataURL), nil
+	case v1alpha1.HostnameStrategyIMDSHostname:
+		return fmt.Sprintf("$(curl -s %s/hostname)", instanceMetadataURL), nil
+	case v1alpha1.HostnameStrategyTemplate:
+		return v1alpha1.RenderHostname(substrate.Spec.Hostname.Template, substrate.Name, "${"+nodeOrdinalVariable+"}")
+	default:
+		return "", fmt.Errorf("unsupported hostname strategy %s", substrate.Spec.Hostname.Strategy)
+	}
+}
+
+// kubeletHostnameScript writes the kubelet's environment file in the node's
+// user data, nodes launched together get distinct launch indexes
+func kubeletHostnameScript(substrate *v1alpha1.Substrate) (string, error) {
+	if !nodeHostnameResolved(substrate) {
+		return "", nil
+	}
+	hostname, err := nodeHostname(substrate)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`%[1]s=$(curl -s %[2]s/ami-launch-index)
+echo "KUBELET_HOSTNAME=%[3]s" | sudo tee %[4]s
+cat <<'EOF' | sudo tee %[5]s
+#!/bin/env bash
+# Signs a client certificate for system:node:$KUBELET_HOSTNAME with the
+# cluster CA synced to the node, it's reissued when the hostname or CA change
+# and a month before it expires
+set -e
+mkdir -p %[6]s
+if [ "$(cat %[6]s/hostname 2>/dev/null)" != "$KUBELET_HOSTNAME" ] ||
+	! openssl verify -CAfile %[7]s/ca.crt %[6]s/kubelet.crt >/dev/null 2>&1 ||
+	! openssl x509 -checkend 2592000 -noout -in %[6]s/kubelet.crt; then
+	openssl req -new -newkey rsa:2048 -nodes -keyout %[6]s/kubelet.key -out %[6]s/kubelet.csr \
+		-subj "/O=system:nodes/CN=system:node:$KUBELET_HOSTNAME"
+	openssl x509 -req -days 365 -in %[6]s/kubelet.csr -CA %[7]s/ca.crt -CAkey %[7]s/ca.key -CAcreateserial \
+		-out %[6]s/kubelet.crt
+	echo "$KUBELET_HOSTNAME" > %[6]s/hostname
+fi
+cat <<KUBECONFIG > %[6]s/kubelet.conf
+apiVersion: v1
+kind: Config
+clusters:
+- name: kubernetes
+  cluster:
+    certificate-authority: %[7]s/ca.crt
+    server: $(awk '/server:/ {print $2}' /etc/kubernetes/kubelet.conf)
+users:
+- name: system:node:$KUBELET_HOSTNAME
+  user:
+    client-certificate: %[6]s/kubelet.crt
+    client-key: %[6]s/kubelet.key
+contexts:
+- name: default
+  context:
+    cluster: kubernetes
+    user: system:node:$KUBELET_HOSTNAME
+current-context: default
+KUBECONFIG
+EOF
+sudo chmod a+x %[5]s
+`, nodeOrdinalVariable, instanceMetadataURL, hostname, kubeletHostnameEnvFile, kubeletKubeConfigScript, kubeletCertDir, certPKIPath), nil
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
 	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
 	"knative.dev/pkg/logging"
@@ -28,7 +29,7 @@ import (
 )
 
 type Instance struct {
-	EC2 *ec2.EC2
+	EC2 ec2iface.EC2API
 }
 
 func (i *Instance) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
@@ -39,22 +40,110 @@ func (i *Instance) Create(ctx context.Context, substrate *v1alpha1.Substrate) (r
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("describing instances, %w", err)
 	}
+	var node *string
+	idle := []*ec2.Instance{}
 	for _, reservation := range instancesOutput.Reservations {
 		for _, instance := range reservation.Instances {
 			if aws.StringValue(instance.State.Name) == ec2.InstanceStateNameRunning || aws.StringValue(instance.State.Name) == ec2.InstanceStateNamePending {
-				for _, tag := range instance.Tags {
-					if aws.StringValue(tag.Key) == "aws:ec2launchtemplate:version" && aws.StringValue(tag.Value) == aws.StringValue(substrate.Status.Cluster.LaunchTemplateVersion) {
-						logging.FromContext(ctx).Infof("Found instance %s", aws.StringValue(instance.InstanceId))
-						return reconcile.Result{}, nil
-					}
+				if isIdle(instance) {
+					idle = append(idle, instance)
+					continue
 				}
+				// Under the AnyVersion policy, a claimed instance is kept when the launch template changes
+				if node == nil && (isCurrentVersion(instance, substrate) || (tagValue(instance, warmPoolTagKey) == warmPoolClaimed && claimable(instance, substrate))) {
+					logging.FromContext(ctx).Infof("Found instance %s", aws.StringValue(instance.InstanceId))
+					node = instance.InstanceId
+				}
+			}
+		}
+	}
+	if node == nil {
+		for index, instance := range idle {
+			if !claimable(instance, substrate) {
+				continue
+			}
+			// The claimed instance runs the user data of the current version
+			if _, err := i.EC2.CreateTagsWithContext(ctx, &ec2.CreateTagsInput{
+				Resources: []*string{instance.InstanceId},
+				Tags: []*ec2.Tag{
+					{Key: aws.String(warmPoolVersionTagKey), Value: substrate.Status.Cluster.LaunchTemplateVersion},
+					{Key: aws.String(warmPoolTagKey), Value: aws.String(warmPoolClaimed)},
+				},
+			}); err != nil {
+				return reconcile.Result{}, fmt.Errorf("claiming instance, %w", err)
 			}
+			logging.FromContext(ctx).Infof("Claimed instance %s from the warm pool", aws.StringValue(instance.InstanceId))
+			node = instance.InstanceId
+			idle = append(idle[:index], idle[index+1:]...)
+			break
 		}
 	}
+	if node == nil {
+		instances, result, err := i.launch(ctx, substrate, 1, false)
+		if err != nil || result.Requeue {
+			return result, err
+		}
+		logging.FromContext(ctx).Infof("Created instance %s", aws.StringValue(instances[0]))
+		node = instances[0]
+	}
+
+	if err := i.delete(ctx, substrate, func(instance *ec2.Instance) bool {
+		if aws.StringValue(instance.InstanceId) == aws.StringValue(node) || isIdle(instance) {
+			return false
+		}
+		return aws.StringValue(instance.State.Name) == ec2.InstanceStateNameRunning ||
+			aws.StringValue(instance.State.Name) == ec2.InstanceStateNamePending
+	}); err != nil {
+		return reconcile.Result{}, err
+	}
+	return i.reconcileWarmPool(ctx, substrate, node, idle)
+}
+
+// reconcileWarmPool replaces idle instances that can't be claimed and launches
+// instances until the pool is full, the pool's state is recorded in the status
+func (i *Instance) reconcileWarmPool(ctx context.Context, substrate *v1alpha1.Substrate, node *string, idle []*ec2.Instance) (reconcile.Result, error) {
+	retained := []*string{}
+	stale := map[string]bool{}
+	for _, instance := range idle {
+		if claimable(instance, substrate) && len(retained) < warmPoolSize(substrate) {
+			retained = append(retained, instance.InstanceId)
+		} else {
+			stale[aws.StringValue(instance.InstanceId)] = true
+		}
+	}
+	if len(stale) > 0 {
+		if err := i.delete(ctx, substrate, func(instance *ec2.Instance) bool {
+			return stale[aws.StringValue(instance.InstanceId)]
+		}); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if missing := warmPoolSize(substrate) - len(retained); missing > 0 {
+		instances, result, err := i.launch(ctx, substrate, missing, true)
+		if err != nil || result.Requeue {
+			return result, err
+		}
+		logging.FromContext(ctx).Infof("Created warm pool instances %v", aws.StringValueSlice(instances))
+		retained = append(retained, instances...)
+	}
+	substrate.Status.Cluster.WarmPool = nil
+	if substrate.Spec.WarmPool != nil {
+		substrate.Status.Cluster.WarmPool = &v1alpha1.WarmPoolStatus{ClaimedInstanceID: node, IdleInstanceIDs: aws.StringValueSlice(retained)}
+	}
+	return reconcile.Result{}, nil
+}
+
+// launch creates count instances from the current launch template version,
+// pooled instances wait to be claimed before configuring themselves
+func (i *Instance) launch(ctx context.Context, substrate *v1alpha1.Substrate, count int, pooled bool) ([]*string, reconcile.Result, error) {
 	overrides := []*ec2.FleetLaunchTemplateOverridesRequest{}
 	for _, subnet := range substrate.Status.Infrastructure.PublicSubnetIDs {
 		overrides = append(overrides, &ec2.FleetLaunchTemplateOverridesRequest{SubnetId: aws.String(subnet)})
 	}
+	tags := discovery.Tags(substrate, ec2.ResourceTypeInstance, discovery.Name(substrate))
+	if pooled {
+		tags[0].Tags = append(tags[0].Tags, &ec2.Tag{Key: aws.String(warmPoolTagKey), Value: aws.String(warmPoolIdle)})
+	}
 	createFleetOutput, err := i.EC2.CreateFleetWithContext(ctx, &ec2.CreateFleetInput{
 		Type: aws.String(ec2.FleetTypeInstant),
 		LaunchTemplateConfigs: []*ec2.FleetLaunchTemplateConfigRequest{{
@@ -66,36 +155,34 @@ func (i *Instance) Create(ctx context.Context, substrate *v1alpha1.Substrate) (r
 		},
 		TargetCapacitySpecification: &ec2.TargetCapacitySpecificationRequest{
 			DefaultTargetCapacityType: aws.String(ec2.DefaultTargetCapacityTypeOnDemand),
-			TotalTargetCapacity:       aws.Int64(1),
+			TotalTargetCapacity:       aws.Int64(int64(count)),
 		},
-		TagSpecifications: discovery.Tags(substrate, ec2.ResourceTypeInstance, discovery.Name(substrate)),
+		TagSpecifications: tags,
 		OnDemandOptions:   &ec2.OnDemandOptionsRequest{AllocationStrategy: aws.String(ec2.FleetOnDemandAllocationStrategyLowestPrice)},
 	})
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("creating fleet, %w", err)
+		return nil, reconcile.Result{}, fmt.Errorf("creating fleet, %w", err)
 	}
 	for _, err := range createFleetOutput.Errors {
 		if strings.Contains(aws.StringValue(err.ErrorMessage), "Invalid IAM Instance Profile name") {
-			return reconcile.Result{Requeue: true}, nil
+			return nil, reconcile.Result{Requeue: true}, nil
 		}
-		return reconcile.Result{}, fmt.Errorf("creating fleet %v", aws.StringValue(err.ErrorMessage))
+		return nil, reconcile.Result{}, fmt.Errorf("creating fleet %v", aws.StringValue(err.ErrorMessage))
 	}
-	logging.FromContext(ctx).Infof("Created instance %s", aws.StringValue(createFleetOutput.Instances[0].InstanceIds[0]))
-
-	if err := i.delete(ctx, substrate, func(instance *ec2.Instance) bool {
-		if aws.StringValue(instance.InstanceId) == aws.StringValue(createFleetOutput.Instances[0].InstanceIds[0]) {
-			return false
-		}
-		return aws.StringValue(instance.State.Name) == ec2.InstanceStateNameRunning ||
-			aws.StringValue(instance.State.Name) == ec2.InstanceStateNamePending
-	}); err != nil {
-		return reconcile.Result{}, err
+	instances := []*string{}
+	for _, instance := range createFleetOutput.Instances {
+		instances = append(instances, instance.InstanceIds...)
 	}
-	return reconcile.Result{}, nil
+	return instances, reconcile.Result{}, nil
 }
 
 func (i *Instance) Delete(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	// Pooled instances are in the substrate's VPC, so they're deleted with it
+	// unless the pool is kept for the next substrate
 	return reconcile.Result{}, i.delete(ctx, substrate, func(instance *ec2.Instance) bool {
+		if substrate.KeepsWarmPool() && isIdle(instance) {
+			return false
+		}
 		return aws.StringValue(instance.State.Name) != ec2.InstanceStateNameShuttingDown &&
 			aws.StringValue(instance.State.Name) != ec2.InstanceStateNameTerminated
 	})
@@ -0,0 +1,227 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testImageID is the AMI of the fake's launch template
+const testImageID = "ami-1"
+
+func (f *fakeEC2) CreateFleetWithContext(_ aws.Context, input *ec2.CreateFleetInput, _ ...request.Option) (*ec2.CreateFleetOutput, error) {
+	f.fleets = append(f.fleets, input)
+	output := &ec2.CreateFleetOutput{Instances: []*ec2.CreateFleetInstance{{}}}
+	for i := int64(0); i < aws.Int64Value(input.TargetCapacitySpecification.TotalTargetCapacity); i++ {
+		instance := &ec2.Instance{
+			InstanceId:   aws.String(fmt.Sprintf("i-launched-%d", len(f.instances))),
+			ImageId:      aws.String(testImageID),
+			InstanceType: aws.String("t4g.nano"),
+			State:        &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNamePending)},
+			Tags:         append(input.TagSpecifications[0].Tags, &ec2.Tag{Key: aws.String(launchTemplateVersionTagKey), Value: input.LaunchTemplateConfigs[0].LaunchTemplateSpecification.Version}),
+		}
+		f.instances = append(f.instances, instance)
+		output.Instances[0].InstanceIds = append(output.Instances[0].InstanceIds, instance.InstanceId)
+	}
+	return output, nil
+}
+
+func (f *fakeEC2) CreateTagsWithContext(_ aws.Context, input *ec2.CreateTagsInput, _ ...request.Option) (*ec2.CreateTagsOutput, error) {
+	for _, instance := range f.instances {
+		for _, id := range input.Resources {
+			if aws.StringValue(id) != aws.StringValue(instance.InstanceId) {
+				continue
+			}
+			for _, tag := range input.Tags {
+				if tagValue(instance, aws.StringValue(tag.Key)) == "" {
+					instance.Tags = append(instance.Tags, &ec2.Tag{Key: tag.Key, Value: tag.Value})
+				}
+				for _, existing := range instance.Tags {
+					if aws.StringValue(existing.Key) == aws.StringValue(tag.Key) {
+						existing.Value = tag.Value
+					}
+				}
+			}
+		}
+	}
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (f *fakeEC2) TerminateInstancesWithContext(_ aws.Context, input *ec2.TerminateInstancesInput, _ ...request.Option) (*ec2.TerminateInstancesOutput, error) {
+	for _, instance := range f.instances {
+		for _, id := range input.InstanceIds {
+			if aws.StringValue(id) == aws.StringValue(instance.InstanceId) {
+				instance.State.Name = aws.String(ec2.InstanceStateNameShuttingDown)
+				f.terminated = append(f.terminated, aws.StringValue(id))
+			}
+		}
+	}
+	return &ec2.TerminateInstancesOutput{}, nil
+}
+
+// idleInstance is a pooled instance launched from a launch template version
+func idleInstance(id string, version string, image string) *ec2.Instance {
+	return &ec2.Instance{
+		InstanceId:   aws.String(id),
+		ImageId:      aws.String(image),
+		InstanceType: aws.String("t4g.nano"),
+		State:        &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+		Tags: []*ec2.Tag{
+			{Key: aws.String(warmPoolTagKey), Value: aws.String(warmPoolIdle)},
+			{Key: aws.String(launchTemplateVersionTagKey), Value: aws.String(version)},
+		},
+	}
+}
+
+func warmPoolSubstrate(t *testing.T, version string) *v1alpha1.Substrate {
+	ctx := context.Background()
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{WarmPool: &v1alpha1.WarmPoolSpec{Size: 1}},
+		Status: v1alpha1.SubstrateStatus{
+			Cluster:        v1alpha1.ClusterStatus{LaunchTemplateVersion: aws.String(version), ImageID: aws.String(testImageID)},
+			Infrastructure: v1alpha1.InfrastructureStatus{PublicSubnetIDs: []string{"subnet-1"}},
+		},
+	}
+	substrate.SetDefaults(ctx)
+	if err := substrate.Validate(ctx); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	return substrate
+}
+
+func TestWarmPoolClaim(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeEC2{instances: []*ec2.Instance{idleInstance("i-idle", "1", testImageID)}}
+	substrate := warmPoolSubstrate(t, "1")
+	instance := &Instance{EC2: fake}
+	if _, err := instance.Create(ctx, substrate); err != nil {
+		t.Fatalf("creating instance, %v", err)
+	}
+	status := substrate.Status.Cluster.WarmPool
+	if status == nil || aws.StringValue(status.ClaimedInstanceID) != "i-idle" {
+		t.Fatalf("expected the pooled instance to be claimed, got %+v", status)
+	}
+	if tagValue(fake.instances[0], warmPoolTagKey) != warmPoolClaimed {
+		t.Errorf("expected the claimed instance to be tagged %s", warmPoolClaimed)
+	}
+	// The only fleet refills the pool, the substrate node isn't launched
+	if len(fake.fleets) != 1 {
+		t.Fatalf("expected one fleet refilling the pool, got %d", len(fake.fleets))
+	}
+	if tags := fake.fleets[0].TagSpecifications[0].Tags; aws.StringValue(tags[len(tags)-1].Value) != warmPoolIdle {
+		t.Errorf("expected the refilled instance to be idle, got tags %v", tags)
+	}
+	if len(status.IdleInstanceIDs) != 1 || status.IdleInstanceIDs[0] != "i-launched-1" {
+		t.Errorf("expected the refilled instance to be idle, got %v", status.IdleInstanceIDs)
+	}
+	if len(fake.terminated) != 0 {
+		t.Errorf("expected no instances to be terminated, got %v", fake.terminated)
+	}
+
+	// Reconciling again keeps the claimed instance and the full pool
+	if _, err := instance.Create(ctx, substrate); err != nil {
+		t.Fatalf("creating instance, %v", err)
+	}
+	if len(fake.fleets) != 1 || len(fake.terminated) != 0 {
+		t.Errorf("expected the pool to be unchanged, got %d fleets and terminated %v", len(fake.fleets), fake.terminated)
+	}
+}
+
+func TestWarmPoolClaimAfterTemplateChange(t *testing.T) {
+	ctx := context.Background()
+	// Both were launched from version 1, only the first booted the current AMI
+	fake := &fakeEC2{instances: []*ec2.Instance{
+		idleInstance("i-idle", "1", testImageID),
+		idleInstance("i-stale", "1", "ami-0"),
+	}}
+	substrate := warmPoolSubstrate(t, "2")
+	instance := &Instance{EC2: fake}
+	if _, err := instance.Create(ctx, substrate); err != nil {
+		t.Fatalf("creating instance, %v", err)
+	}
+	if claimed := substrate.Status.Cluster.WarmPool.ClaimedInstanceID; aws.StringValue(claimed) != "i-idle" {
+		t.Fatalf("expected the instance with the current AMI to be claimed, got %s", aws.StringValue(claimed))
+	}
+	// The claimed instance runs the user data of the current version
+	if version := tagValue(fake.instances[0], warmPoolVersionTagKey); version != "2" {
+		t.Errorf("expected the claimed instance to be tagged with version 2, got %q", version)
+	}
+	if !isCurrentVersion(fake.instances[0], substrate) {
+		t.Errorf("expected the claimed instance to be current")
+	}
+	if len(fake.terminated) != 1 || fake.terminated[0] != "i-stale" {
+		t.Errorf("expected the instance with the old AMI to be replaced, got %v", fake.terminated)
+	}
+
+	// Reconciling again keeps the claimed instance
+	if _, err := instance.Create(ctx, substrate); err != nil {
+		t.Fatalf("creating instance, %v", err)
+	}
+	if len(fake.terminated) != 1 {
+		t.Errorf("expected the claimed instance to be kept, got %v", fake.terminated)
+	}
+}
+
+func TestWarmPoolKeptOnDelete(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeEC2{instances: []*ec2.Instance{idleInstance("i-idle", "1", testImageID), {
+		InstanceId: aws.String("i-node"),
+		State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+		Tags:       []*ec2.Tag{{Key: aws.String(warmPoolTagKey), Value: aws.String(warmPoolClaimed)}},
+	}}}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate", DeletionTimestamp: &metav1.Time{Time: time.Now()}},
+		Spec:       v1alpha1.SubstrateSpec{WarmPool: &v1alpha1.WarmPoolSpec{}},
+	}
+	if _, err := (&Instance{EC2: fake}).Delete(ctx, substrate); err != nil {
+		t.Fatalf("deleting instance, %v", err)
+	}
+	if len(fake.terminated) != 1 || fake.terminated[0] != "i-node" {
+		t.Errorf("expected only the substrate node to be terminated, got %v", fake.terminated)
+	}
+
+	// Without the pool, every instance is terminated
+	substrate.Spec.WarmPool = nil
+	if _, err := (&Instance{EC2: fake}).Delete(ctx, substrate); err != nil {
+		t.Fatalf("deleting instance, %v", err)
+	}
+	if len(fake.terminated) != 2 || fake.terminated[1] != "i-idle" {
+		t.Errorf("expected the idle instance to be terminated, got %v", fake.terminated)
+	}
+}
+
+func TestWarmPoolScript(t *testing.T) {
+	script := warmPoolScript(warmPoolSubstrate(t, "1"))
+	for _, expected := range []string{
+		"delay=$(( delay < 30 ? delay * 2 : 30 ))",
+		"--launch-template-name kit-test-substrate",
+		"KIT_WARM_POOL_CLAIMED=true exec bash",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected the warm pool script to contain %q, got\n%s", expected, script)
+		}
+	}
+}
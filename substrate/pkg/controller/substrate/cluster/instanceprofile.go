@@ -31,10 +31,15 @@ type InstanceProfile struct {
 	IAM *iam.IAM
 }
 
+const ebsCSIDriverPolicy = "arn:aws:iam::aws:policy/service-role/AmazonEBSCSIDriverPolicy"
+
 type role struct {
 	name            *string
 	policy          *string
 	managedPolicies []string
+	// retiredPolicies are managed policies attached while a feature was
+	// enabled, they're detached so the role matches the spec and can be deleted
+	retiredPolicies []string
 }
 
 func (i *InstanceProfile) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
@@ -43,6 +48,9 @@ func (i *InstanceProfile) Create(ctx context.Context, substrate *v1alpha1.Substr
 		if err != nil {
 			return result, err
 		}
+		if err := i.detach(ctx, desired.name, desired.retiredPolicies); err != nil {
+			return reconcile.Result{}, err
+		}
 	}
 	return reconcile.Result{}, nil
 }
@@ -104,7 +112,9 @@ func (i *InstanceProfile) create(ctx context.Context, resourceName, policy *stri
 
 func (i *InstanceProfile) Delete(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
 	for _, desired := range desiredRolesFor(substrate) {
-		result, err := i.delete(ctx, desired.name, desired.policy, desired.managedPolicies)
+		// The role can't be deleted with any policy attached, whether or not the
+		// spec still enables it
+		result, err := i.delete(ctx, desired.name, desired.policy, append(desired.managedPolicies, desired.retiredPolicies...))
 		if err != nil {
 			return result, err
 		}
@@ -124,14 +134,8 @@ func (i *InstanceProfile) delete(ctx context.Context, resourceName, policy *stri
 		}
 	}
 	// Managed Policies
-	for _, policy := range managedPolicies {
-		if _, err := i.IAM.DetachRolePolicyWithContext(ctx, &iam.DetachRolePolicyInput{RoleName: resourceName, PolicyArn: aws.String(policy)}); err != nil {
-			if err.(awserr.Error).Code() != iam.ErrCodeNoSuchEntityException {
-				return reconcile.Result{}, fmt.Errorf("detatching policy from role, %w", err)
-			}
-		} else {
-			logging.FromContext(ctx).Infof("Deleted policy %s from role %s", aws.StringValue(resourceName), aws.StringValue(resourceName))
-		}
+	if err := i.detach(ctx, resourceName, managedPolicies); err != nil {
+		return reconcile.Result{}, err
 	}
 	// Binding
 	if _, err := i.IAM.RemoveRoleFromInstanceProfileWithContext(ctx, &iam.RemoveRoleFromInstanceProfileInput{RoleName: resourceName, InstanceProfileName: resourceName}); err != nil {
@@ -160,10 +164,36 @@ func (i *InstanceProfile) delete(ctx context.Context, resourceName, policy *stri
 	return reconcile.Result{}, nil
 }
 
+// detach the managed policies from the role, ignoring those not attached
+func (i *InstanceProfile) detach(ctx context.Context, resourceName *string, managedPolicies []string) error {
+	for _, policy := range managedPolicies {
+		if _, err := i.IAM.DetachRolePolicyWithContext(ctx, &iam.DetachRolePolicyInput{RoleName: resourceName, PolicyArn: aws.String(policy)}); err != nil {
+			if err.(awserr.Error).Code() != iam.ErrCodeNoSuchEntityException {
+				return fmt.Errorf("detatching policy from role, %w", err)
+			}
+		} else {
+			logging.FromContext(ctx).Infof("Deleted policy %s from role %s", policy, aws.StringValue(resourceName))
+		}
+	}
+	return nil
+}
+
 func desiredRolesFor(substrate *v1alpha1.Substrate) []role {
+	substrateManagedPolicies := []string{
+		"arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore",
+		"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly",
+		"arn:aws:iam::aws:policy/AmazonEKS_CNI_Policy",
+	}
+	retiredPolicies := []string{}
+	if substrate.Spec.EBSCSIDriver {
+		// The EBS CSI driver runs on the substrate node with its instance profile
+		substrateManagedPolicies = append(substrateManagedPolicies, ebsCSIDriverPolicy)
+	} else {
+		retiredPolicies = append(retiredPolicies, ebsCSIDriverPolicy)
+	}
 	return []role{{
 		// Roles and policies attached to the substrate node
-		name: discovery.Name(substrate), policy: aws.String(`{
+		name: discovery.Name(substrate), policy: aws.String(fmt.Sprintf(`{
 			"Version": "2012-10-17",
 			"Statement": [
 				{
@@ -180,7 +210,9 @@ func desiredRolesFor(substrate *v1alpha1.Substrate) []role {
 						"iam:PassRole",
 						"ec2:TerminateInstances",
 						"ec2:DescribeLaunchTemplates",
+						"ec2:DescribeLaunchTemplateVersions",
 						"ec2:DescribeInstances",
+						"ec2:DescribeTags",
 						"ec2:DescribeSecurityGroups",
 						"ec2:DescribeSubnets",
 						"ec2:DescribeInstanceTypes",
@@ -189,14 +221,11 @@ func desiredRolesFor(substrate *v1alpha1.Substrate) []role {
 						"ssm:GetParameter"
 					],
 					"Resource": ["*"]
-				}
+				}%s%s
 			]
-		}`),
-		managedPolicies: []string{
-			"arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore",
-			"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly",
-			"arn:aws:iam::aws:policy/AmazonEKS_CNI_Policy",
-		},
+		}`, etcdBackupStatement(substrate), bucketKMSKeyStatement(substrate))),
+		managedPolicies: substrateManagedPolicies,
+		retiredPolicies: retiredPolicies,
 	}, {
 		// Roles and policies attached to the nodes provisioned by Karpenter
 		name: discovery.Name(substrate, tenantControlPlaneNodeRole),
@@ -209,3 +238,36 @@ func desiredRolesFor(substrate *v1alpha1.Substrate) []role {
 		},
 	}}
 }
+
+// etcdBackupStatement allows the etcd backup job on the substrate node to
+// upload and prune the snapshots, but not to modify the cluster configuration
+func etcdBackupStatement(substrate *v1alpha1.Substrate) string {
+	if substrate.Spec.EtcdBackup == nil {
+		return ""
+	}
+	return fmt.Sprintf(`,
+				{
+					"Effect": "Allow",
+					"Action": ["s3:PutObject", "s3:DeleteObject"],
+					"Resource": ["arn:aws:s3:::%s/%s*"]
+				}`, aws.StringValue(discovery.BucketName(substrate)), EtcdSnapshotPrefix(substrate))
+}
+
+// bucketKMSKeyStatement allows the substrate node to decrypt the cluster
+// configuration it syncs from a bucket encrypted with a KMS key, and to
+// encrypt the etcd snapshots it uploads
+func bucketKMSKeyStatement(substrate *v1alpha1.Substrate) string {
+	if substrate.Spec.BucketKMSKeyARN == nil {
+		return ""
+	}
+	actions := `"kms:Decrypt"`
+	if substrate.Spec.EtcdBackup != nil {
+		actions += `, "kms:GenerateDataKey"`
+	}
+	return fmt.Sprintf(`,
+				{
+					"Effect": "Allow",
+					"Action": [%s],
+					"Resource": [%q]
+				}`, actions, aws.StringValue(substrate.Spec.BucketKMSKeyARN))
+}
@@ -0,0 +1,46 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEBSCSIDriverPolicyDetached(t *testing.T) {
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}, Spec: v1alpha1.SubstrateSpec{EBSCSIDriver: true}}
+	node := desiredRolesFor(substrate)[0]
+	if !contains(node.managedPolicies, ebsCSIDriverPolicy) || contains(node.retiredPolicies, ebsCSIDriverPolicy) {
+		t.Errorf("expected %s to be attached, got %v", ebsCSIDriverPolicy, node.managedPolicies)
+	}
+	// Turning the driver off, or deleting a substrate without its spec,
+	// detaches the policy
+	substrate.Spec.EBSCSIDriver = false
+	node = desiredRolesFor(substrate)[0]
+	if contains(node.managedPolicies, ebsCSIDriverPolicy) || !contains(node.retiredPolicies, ebsCSIDriverPolicy) {
+		t.Errorf("expected %s to be detached, got %v", ebsCSIDriverPolicy, node.retiredPolicies)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
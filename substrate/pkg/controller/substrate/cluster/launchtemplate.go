@@ -22,7 +22,9 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
 	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
 	"github.com/mitchellh/hashstructure/v2"
@@ -31,8 +33,8 @@ import (
 )
 
 type LaunchTemplate struct {
-	EC2    *ec2.EC2
-	SSM    *ssm.SSM
+	EC2    ec2iface.EC2API
+	SSM    ssmiface.SSMAPI
 	Region *string
 }
 
@@ -40,13 +42,30 @@ func (l *LaunchTemplate) Create(ctx context.Context, substrate *v1alpha1.Substra
 	if substrate.Status.Infrastructure.SecurityGroupID == nil {
 		return reconcile.Result{Requeue: true}, nil
 	}
-	parameterOutput, err := l.SSM.GetParameterWithContext(ctx, &ssm.GetParameterInput{Name: aws.String("/aws/service/eks/optimized-ami/1.21/amazon-linux-2-arm64/recommended/image_id")})
+	imageParameter, deviceName := "/aws/service/eks/optimized-ami/1.21/amazon-linux-2-arm64/recommended/image_id", "/dev/xvda"
+	var userData string
+	if substrate.Spec.OperatingSystem == v1alpha1.OperatingSystemBottlerocket {
+		// The user data points the kubelet at the API server's address
+		if substrate.Status.Cluster.Address == nil {
+			return reconcile.Result{Requeue: true}, nil
+		}
+		// Bottlerocket's root volume only holds the OS, images and pods use the data volume
+		imageParameter, deviceName = "/aws/service/bottlerocket/aws-k8s-1.21/arm64/latest/image_id", "/dev/xvdb"
+		userData = bottlerocketUserData(substrate)
+	} else {
+		hostnameScript, err := kubeletHostnameScript(substrate)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("generating hostname script, %w", err)
+		}
+		userData = amazonLinux2UserData(substrate, hostnameScript)
+	}
+	parameterOutput, err := l.SSM.GetParameterWithContext(ctx, &ssm.GetParameterInput{Name: aws.String(imageParameter)})
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("getting ssm parameter, %w", err)
 	}
 	launchTemplateData := &ec2.RequestLaunchTemplateData{
 		BlockDeviceMappings: []*ec2.LaunchTemplateBlockDeviceMappingRequest{{
-			DeviceName: aws.String("/dev/xvda"),
+			DeviceName: aws.String(deviceName),
 			Ebs: &ec2.LaunchTemplateEbsBlockDeviceRequest{
 				DeleteOnTermination: aws.Bool(true),
 				Iops:                aws.Int64(3000),
@@ -57,61 +76,9 @@ func (l *LaunchTemplate) Create(ctx context.Context, substrate *v1alpha1.Substra
 		InstanceType:       substrate.Spec.InstanceType,
 		ImageId:            parameterOutput.Parameter.Value,
 		IamInstanceProfile: &ec2.LaunchTemplateIamInstanceProfileSpecificationRequest{Name: discovery.Name(substrate)},
-		Monitoring:         &ec2.LaunchTemplatesMonitoringRequest{Enabled: aws.Bool(true)},
+		Monitoring:         &ec2.LaunchTemplatesMonitoringRequest{Enabled: aws.Bool(substrate.Spec.DetailedMonitoring == nil || *substrate.Spec.DetailedMonitoring)},
 		SecurityGroupIds:   []*string{substrate.Status.Infrastructure.SecurityGroupID},
-		// aws s3 sync sometimes fails to sync small changes in a file, so we use --exact-timestamps
-		// refer: https://github.com/aws/aws-cli/issues/3273
-		UserData: aws.String(base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`#!/bin/bash
-cat <<EOF | sudo tee /etc/docker/daemon.json
-{
-	"exec-opts": ["native.cgroupdriver=systemd"]
-}
-EOF
-sudo systemctl enable docker
-sudo systemctl daemon-reload
-sudo systemctl restart docker
-
-REGION=$(echo $(curl -s http://169.254.169.254/latest/meta-data/placement/availability-zone) | sed 's/[a-z]$//')
-echo "Region is $REGION"
-
-#Instance ID through Instance meta data
-InstanceID=$(curl -s http://169.254.169.254/latest/meta-data/instance-id)
-
-#Assigning Elastic IP to Instance
-ELASTICIP_ALLOCATION_ID=""
-for i in {0..30}; do
-	if [ -z "$ELASTICIP_ALLOCATION_ID" ]
-	then
-		ELASTICIP_ALLOCATION_ID=$(AWS_DEFAULT_REGION=$REGION aws ec2 describe-addresses --filters "Name=tag:Name,Values=%[1]s" --query "Addresses[*].AllocationId" --output text)
-		sleep 2
-	fi
-done
-[[ -z "$ELASTICIP_ALLOCATION_ID" ]] && { echo "ELASTICIP_ALLOCATION_ID not found, exiting"; exit 1; }
-AWS_DEFAULT_REGION=$REGION aws ec2 associate-address --instance-id $InstanceID --allocation-id $ELASTICIP_ALLOCATION_ID
-
-sudo mkdir -p /etc/kit/
-cat <<EOF | sudo tee /etc/kit/sync.sh
-#!/bin/env bash
-while [ true ]; do
- dirs=("/etc/systemd/system" "/etc/kubernetes" "/etc/aws-iam-authenticator")
- for dir in "\${dirs[@]}"; do
-    echo "\$(date) Syncing S3 files for \$dir"
-    mkdir -p \$dir
-    existing_checksum=\$(ls -alR \$dir | md5sum)
-    aws s3 sync --exact-timestamps s3://%[1]s/tmp/%[1]s\$dir "\$dir"
-    new_checksum=\$(ls -alR \$dir | md5sum)
-    if [ "\$new_checksum" != "\$existing_checksum" ]; then
-		echo "Successfully synced from S3 \$dir"
-		echo "Restarting Kubelet service"
-		systemctl daemon-reload
-		systemctl restart kubelet
-    fi
- done
-done
-EOF
-
-chmod a+x /etc/kit/sync.sh
-/etc/kit/sync.sh > /var/log/sync-kit-files.log&`, aws.StringValue(discovery.Name(substrate)))))),
+		UserData:           aws.String(base64.StdEncoding.EncodeToString([]byte(userData))),
 	}
 	if _, err := l.EC2.CreateLaunchTemplateWithContext(ctx, &ec2.CreateLaunchTemplateInput{
 		LaunchTemplateName: discovery.Name(substrate),
@@ -139,6 +106,7 @@ chmod a+x /etc/kit/sync.sh
 		return reconcile.Result{}, fmt.Errorf("creating launch template version, %w", err)
 	}
 	substrate.Status.Cluster.LaunchTemplateVersion = aws.String(fmt.Sprint(aws.Int64Value(launchTemplateVersionOutput.LaunchTemplateVersion.VersionNumber)))
+	substrate.Status.Cluster.ImageID = parameterOutput.Parameter.Value
 	logging.FromContext(ctx).Infof("Created launch template version %s for %s", aws.StringValue(substrate.Status.Cluster.LaunchTemplateVersion), aws.StringValue(discovery.Name(substrate)))
 	return reconcile.Result{}, nil
 }
@@ -159,3 +127,88 @@ func (l *LaunchTemplate) Delete(ctx context.Context, substrate *v1alpha1.Substra
 	}
 	return reconcile.Result{}, nil
 }
+
+// amazonLinux2UserData associates the elastic IP and syncs the configuration
+// from the bucket, restarting the kubelet when it changes.
+// aws s3 sync sometimes fails to sync small changes in a file, so we use --exact-timestamps
+// refer: https://github.com/aws/aws-cli/issues/3273
+func amazonLinux2UserData(substrate *v1alpha1.Substrate, hostnameScript string) string {
+	return fmt.Sprintf(`#!/bin/bash
+%[6]s
+REGION=$(echo $(curl -s http://169.254.169.254/latest/meta-data/placement/availability-zone) | sed 's/[a-z]$//')
+echo "Region is $REGION"
+
+#Instance ID through Instance meta data
+InstanceID=$(curl -s http://169.254.169.254/latest/meta-data/instance-id)
+
+%[5]s#Assigning Elastic IP to Instance
+ELASTICIP_ALLOCATION_ID="%[4]s"
+for i in {0..30}; do
+	if [ -z "$ELASTICIP_ALLOCATION_ID" ]
+	then
+		ELASTICIP_ALLOCATION_ID=$(AWS_DEFAULT_REGION=$REGION aws ec2 describe-addresses --filters "Name=tag:Name,Values=%[1]s" --query "Addresses[*].AllocationId" --output text)
+		sleep 2
+	fi
+done
+[[ -z "$ELASTICIP_ALLOCATION_ID" ]] && { echo "ELASTICIP_ALLOCATION_ID not found, exiting"; exit 1; }
+AWS_DEFAULT_REGION=$REGION aws ec2 associate-address --instance-id $InstanceID --allocation-id $ELASTICIP_ALLOCATION_ID
+
+sudo mkdir -p /etc/kit/
+%[3]s
+cat <<EOF | sudo tee /etc/kit/sync.sh
+#!/bin/env bash
+while [ true ]; do
+ dirs=("/etc/systemd/system" "/etc/kubernetes" "/etc/aws-iam-authenticator")
+ for dir in "\${dirs[@]}"; do
+    echo "\$(date) Syncing S3 files for \$dir"
+    mkdir -p \$dir
+    existing_checksum=\$(ls -alR \$dir | md5sum)
+    aws s3 sync --exact-timestamps s3://%[2]s/tmp/%[1]s\$dir "\$dir"
+    # Manifests removed from the bucket stop their static pods
+    [ "\$dir" == "/etc/kubernetes" ] && aws s3 sync --delete --exact-timestamps s3://%[2]s/tmp/%[1]s%[7]s %[7]s
+    new_checksum=\$(ls -alR \$dir | md5sum)
+    if [ "\$new_checksum" != "\$existing_checksum" ]; then
+		echo "Successfully synced from S3 \$dir"
+		echo "Restarting Kubelet service"
+		systemctl daemon-reload
+		systemctl restart kubelet
+    fi
+ done
+done
+EOF
+
+chmod a+x /etc/kit/sync.sh
+/etc/kit/sync.sh > /var/log/sync-kit-files.log&`, aws.StringValue(discovery.Name(substrate)), aws.StringValue(discovery.BucketName(substrate)), hostnameScript,
+		aws.StringValue(substrate.Spec.ElasticIPAllocationID), warmPoolScript(substrate),
+		containerRuntimeScript(substrate), clusterManifestPath)
+}
+
+// containerRuntimeScript configures the runtime the kubelet's unit depends on
+// with the kubelet's cgroup driver
+func containerRuntimeScript(substrate *v1alpha1.Substrate) string {
+	if substrate.Spec.ContainerRuntime == v1alpha1.ContainerRuntimeContainerd {
+		return fmt.Sprintf(`sudo mkdir -p /etc/containerd
+cat <<EOF | sudo tee /etc/containerd/config.toml
+version = 2
+[plugins."io.containerd.grpc.v1.cri"]
+  sandbox_image = "%s"
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+  runtime_type = "io.containerd.runc.v2"
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+  SystemdCgroup = %t
+EOF
+sudo systemctl enable containerd
+sudo systemctl daemon-reload
+sudo systemctl restart containerd
+`, pauseImage, cgroupDriverFor(substrate) == v1alpha1.CgroupDriverSystemd)
+	}
+	return fmt.Sprintf(`cat <<EOF | sudo tee /etc/docker/daemon.json
+{
+	"exec-opts": ["native.cgroupdriver=%s"]
+}
+EOF
+sudo systemctl enable docker
+sudo systemctl daemon-reload
+sudo systemctl restart docker
+`, cgroupDriverFor(substrate))
+}
@@ -0,0 +1,106 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/ptr"
+)
+
+// fakeSSM resolves every parameter to the same AMI, the parameters put are
+// listed by path
+type fakeSSM struct {
+	ssmiface.SSMAPI
+	parameters map[string]string
+}
+
+func (f *fakeSSM) GetParametersByPathPagesWithContext(_ aws.Context, input *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool, _ ...request.Option) error {
+	output := &ssm.GetParametersByPathOutput{}
+	for name, value := range f.parameters {
+		if strings.HasPrefix(name, aws.StringValue(input.Path)) {
+			output.Parameters = append(output.Parameters, &ssm.Parameter{Name: aws.String(name), Value: aws.String(value)})
+		}
+	}
+	fn(output, true)
+	return nil
+}
+
+func (f *fakeSSM) PutParameterWithContext(_ aws.Context, input *ssm.PutParameterInput, _ ...request.Option) (*ssm.PutParameterOutput, error) {
+	if f.parameters == nil {
+		f.parameters = map[string]string{}
+	}
+	f.parameters[aws.StringValue(input.Name)] = aws.StringValue(input.Value)
+	return &ssm.PutParameterOutput{}, nil
+}
+
+func (f *fakeSSM) DeleteParameterWithContext(_ aws.Context, input *ssm.DeleteParameterInput, _ ...request.Option) (*ssm.DeleteParameterOutput, error) {
+	if _, ok := f.parameters[aws.StringValue(input.Name)]; !ok {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "parameter not found", nil)
+	}
+	delete(f.parameters, aws.StringValue(input.Name))
+	return &ssm.DeleteParameterOutput{}, nil
+}
+
+func (f *fakeSSM) GetParameterWithContext(_ aws.Context, input *ssm.GetParameterInput, _ ...request.Option) (*ssm.GetParameterOutput, error) {
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Name: input.Name, Value: aws.String("ami-0123456789abcdef0")}}, nil
+}
+
+func (f *fakeEC2) CreateLaunchTemplateWithContext(_ aws.Context, input *ec2.CreateLaunchTemplateInput, _ ...request.Option) (*ec2.CreateLaunchTemplateOutput, error) {
+	f.launchTemplates = append(f.launchTemplates, input.LaunchTemplateData)
+	return &ec2.CreateLaunchTemplateOutput{}, nil
+}
+
+func (f *fakeEC2) CreateLaunchTemplateVersionWithContext(_ aws.Context, input *ec2.CreateLaunchTemplateVersionInput, _ ...request.Option) (*ec2.CreateLaunchTemplateVersionOutput, error) {
+	f.launchTemplates = append(f.launchTemplates, input.LaunchTemplateData)
+	return &ec2.CreateLaunchTemplateVersionOutput{LaunchTemplateVersion: &ec2.LaunchTemplateVersion{
+		VersionNumber: aws.Int64(int64(len(f.launchTemplates)))}}, nil
+}
+
+func TestDetailedMonitoring(t *testing.T) {
+	ctx := context.Background()
+	for _, detailedMonitoring := range []*bool{nil, ptr.Bool(true), ptr.Bool(false)} {
+		fake := &fakeEC2{}
+		substrate := &v1alpha1.Substrate{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+			Spec:       v1alpha1.SubstrateSpec{DetailedMonitoring: detailedMonitoring},
+			Status:     v1alpha1.SubstrateStatus{Infrastructure: v1alpha1.InfrastructureStatus{SecurityGroupID: aws.String("sg-1")}},
+		}
+		substrate.SetDefaults(ctx)
+		if _, err := (&LaunchTemplate{EC2: fake, SSM: &fakeSSM{}}).Create(ctx, substrate); err != nil {
+			t.Fatalf("creating launch template, %v", err)
+		}
+		// Instances are launched from the template, monitoring is enabled by default
+		expected := detailedMonitoring == nil || *detailedMonitoring
+		if len(fake.launchTemplates) != 2 {
+			t.Fatalf("expected a launch template and version, got %d", len(fake.launchTemplates))
+		}
+		for _, data := range fake.launchTemplates {
+			if data.Monitoring == nil || aws.BoolValue(data.Monitoring.Enabled) != expected {
+				t.Errorf("expected detailed monitoring %t, got %v", expected, data.Monitoring)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"knative.dev/pkg/logging"
+)
+
+const authenticatorComponentName = "aws-iam-authenticator"
+
+// desiredStaticPods are the components with a static pod manifest for the
+// substrate's spec, sidecars are part of their component's manifest
+func desiredStaticPods(substrate *v1alpha1.Substrate) sets.String {
+	desired := sets.NewString(kubeadmconstants.Etcd, kubeadmconstants.KubeAPIServer, kubeadmconstants.KubeControllerManager, kubeadmconstants.KubeScheduler)
+	for _, scheduler := range substrate.Spec.Schedulers {
+		desired.Insert(schedulerComponentName(scheduler))
+	}
+	if substrate.IAMAuthenticatorEnabled() {
+		desired.Insert(authenticatorComponentName)
+	}
+	return desired
+}
+
+// pruneStaticPodManifests removes the manifests left by previous specs, i.e.
+// for a removed scheduler, from the local configuration and the bucket. The
+// node syncs the manifests with --delete, so the kubelet stops the pods.
+func (c *Config) pruneStaticPodManifests(ctx context.Context, clients *Clients, substrate *v1alpha1.Substrate) error {
+	desired := desiredStaticPods(substrate)
+	manifestDir := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), clusterManifestPath)
+	files, err := os.ReadDir(manifestDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading manifests, %w", err)
+	}
+	for _, file := range files {
+		if file.IsDir() || desired.Has(strings.TrimSuffix(file.Name(), ".yaml")) {
+			continue
+		}
+		if err := os.Remove(path.Join(manifestDir, file.Name())); err != nil {
+			return fmt.Errorf("removing manifest %s, %w", file.Name(), err)
+		}
+	}
+	// Keys are the local paths without the leading slash, see NewDirectoryIterator
+	prefix := strings.TrimPrefix(manifestDir, "/") + "/"
+	stale := []*s3.ObjectIdentifier{}
+	if err := clients.S3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{Bucket: discovery.BucketName(substrate), Prefix: aws.String(prefix)},
+		func(page *s3.ListObjectsV2Output, _ bool) bool {
+			for _, object := range page.Contents {
+				name := strings.TrimPrefix(aws.StringValue(object.Key), prefix)
+				if !strings.Contains(name, "/") && !desired.Has(strings.TrimSuffix(name, ".yaml")) {
+					stale = append(stale, &s3.ObjectIdentifier{Key: object.Key})
+				}
+			}
+			return true
+		}); err != nil {
+		return fmt.Errorf("listing manifests, %w", err)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	if _, err := clients.S3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: discovery.BucketName(substrate),
+		Delete: &s3.Delete{Objects: stale, Quiet: aws.Bool(true)},
+	}); err != nil {
+		return fmt.Errorf("deleting manifests, %w", err)
+	}
+	keys := []string{}
+	for _, object := range stale {
+		keys = append(keys, path.Base(aws.StringValue(object.Key)))
+	}
+	logging.FromContext(ctx).Infof("Pruned static pod manifests %v", keys)
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+)
+
+// oidcCAPath is in the PKI directory kubeadm mounts into the API server
+const oidcCAPath = certPKIPath + "/oidc-ca.crt"
+
+// oidcCA writes the CA of the OIDC provider next to the cluster's certs, it's
+// synced to the node with the rest of /etc/kubernetes
+func (c *Config) oidcCA(substrate *v1alpha1.Substrate) error {
+	if substrate.Spec.OIDC == nil || substrate.Spec.OIDC.CA == "" {
+		return nil
+	}
+	localPath := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), oidcCAPath)
+	if err := os.MkdirAll(path.Dir(localPath), 0700); err != nil {
+		return fmt.Errorf("failed to create directory, %w", err)
+	}
+	return ioutil.WriteFile(localPath, []byte(substrate.Spec.OIDC.CA), 0644)
+}
+
+// oidcArgsFor the API server, flags for unset fields are left out to keep the
+// API server's defaults. The --oidc flags take a single issuer, there's no
+// --authentication-config to fall back from on the pinned EKS-D 1.21.
+func oidcArgsFor(oidc *v1alpha1.OIDCSpec) map[string]string {
+	args := map[string]string{
+		"oidc-issuer-url": oidc.IssuerURL,
+		"oidc-client-id":  oidc.ClientID,
+	}
+	for flag, value := range map[string]string{
+		"oidc-username-claim":  oidc.UsernameClaim,
+		"oidc-username-prefix": oidc.UsernamePrefix,
+		"oidc-groups-claim":    oidc.GroupsClaim,
+		"oidc-groups-prefix":   oidc.GroupsPrefix,
+	} {
+		if value != "" {
+			args[flag] = value
+		}
+	}
+	if oidc.CA != "" {
+		args["oidc-ca-file"] = oidcCAPath
+	}
+	if len(oidc.SigningAlgs) > 0 {
+		args["oidc-signing-algs"] = strings.Join(oidc.SigningAlgs, ",")
+	}
+	return args
+}
@@ -40,6 +40,7 @@ type Readiness struct{}
 
 func (r *Readiness) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
 	if substrate.Status.Cluster.KubeConfig == nil {
+		substrate.StatusConditions().MarkUnknown(v1alpha1.ConditionEndpointReady, "WaitingForKubeConfig", "waiting for the cluster configuration")
 		return reconcile.Result{Requeue: true}, nil
 	}
 	// create kubernetes interface to substrate cluster
@@ -58,6 +59,7 @@ func (r *Readiness) Create(ctx context.Context, substrate *v1alpha1.Substrate) (
 		if os.IsTimeout(response.Error()) ||
 			(errors.As(response.Error(), &netErr) && errors.As(netErr.Err, &syscallErr) && errors.Is(syscallErr.Err, syscall.ECONNREFUSED)) ||
 			(errors.As(response.Error(), &statusErr) && statusErr.Status().Code != http.StatusOK) {
+			substrate.StatusConditions().MarkUnknown(v1alpha1.ConditionEndpointReady, "APIServerNotReady", "waiting for the API server, %s", response.Error())
 			return reconcile.Result{Requeue: true}, nil
 		}
 		return reconcile.Result{Requeue: true}, fmt.Errorf("verifying control plane ready, %w, %#v", response.Error(), response.Error())
@@ -67,7 +69,7 @@ func (r *Readiness) Create(ctx context.Context, substrate *v1alpha1.Substrate) (
 		return reconcile.Result{}, fmt.Errorf("getting response result, %w", err)
 	}
 	if string(result) == "ok" {
-		substrate.Ready()
+		substrate.StatusConditions().MarkTrue(v1alpha1.ConditionEndpointReady)
 		return reconcile.Result{}, nil
 	}
 	return reconcile.Result{}, fmt.Errorf("api server not yet ready status is %v", string(result))
@@ -0,0 +1,137 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	staticpodutil "k8s.io/kubernetes/cmd/kubeadm/app/util/staticpod"
+	"sigs.k8s.io/yaml"
+)
+
+const schedulerConfigDir = "/etc/kubernetes/schedulers"
+
+// defaultSchedulerConfig runs a single profile, with its own leader election
+// lease so it doesn't compete with the default scheduler
+const defaultSchedulerConfig = `apiVersion: kubescheduler.config.k8s.io/v1beta1
+kind: KubeSchedulerConfiguration
+clientConnection:
+  kubeconfig: /etc/kubernetes/scheduler.conf
+leaderElection:
+  leaderElect: true
+  resourceName: %[2]s
+  resourceNamespace: kube-system
+profiles:
+- schedulerName: %[1]s
+`
+
+// additionalSchedulers writes a static pod for each of the substrate's
+// schedulers, copied from the default scheduler's static pod. The config
+// replaces the default scheduler's kubeconfig and leader election flags, and
+// each scheduler listens on the port after the previous one's.
+func (c *Config) additionalSchedulers(manifestDir string, substrate *v1alpha1.Substrate) error {
+	for i, scheduler := range substrate.Spec.Schedulers {
+		configPath := path.Join(schedulerConfigDir, scheduler.Name+".yaml")
+		localPath := path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), configPath)
+		if err := os.MkdirAll(path.Dir(localPath), 0700); err != nil {
+			return fmt.Errorf("failed to create directory, %w", err)
+		}
+		config, err := schedulerConfigFor(scheduler)
+		if err != nil {
+			return fmt.Errorf("rendering config for scheduler %s, %w", scheduler.Name, err)
+		}
+		if err := ioutil.WriteFile(localPath, []byte(config), 0644); err != nil {
+			return fmt.Errorf("writing config for scheduler %s, %w", scheduler.Name, err)
+		}
+		pod, err := staticpodutil.ReadStaticPodFromDisk(kubeadmconstants.GetStaticPodFilepath(kubeadmconstants.KubeScheduler, manifestDir))
+		if err != nil {
+			return fmt.Errorf("reading static pod for %v, %w", kubeadmconstants.KubeScheduler, err)
+		}
+		componentName := schedulerComponentName(scheduler)
+		additionalScheduler(pod, componentName, scheduler.Image, configPath, kubeadmconstants.KubeSchedulerPort+1+i)
+		if err := staticpodutil.WriteStaticPodToDisk(componentName, manifestDir, *pod); err != nil {
+			return fmt.Errorf("writing static pod for %v, %w", componentName, err)
+		}
+	}
+	return nil
+}
+
+func schedulerComponentName(scheduler v1alpha1.SchedulerSpec) string {
+	return kubeadmconstants.KubeScheduler + "-" + scheduler.Name
+}
+
+// schedulerConfigFor returns the scheduler's config. A user provided config
+// that doesn't name its leader election lease would default to the default
+// scheduler's, so it's given the scheduler's component name instead.
+func schedulerConfigFor(scheduler v1alpha1.SchedulerSpec) (string, error) {
+	if scheduler.Config == "" {
+		return fmt.Sprintf(defaultSchedulerConfig, scheduler.Name, schedulerComponentName(scheduler)), nil
+	}
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(scheduler.Config), &config); err != nil {
+		return "", fmt.Errorf("parsing config, %w", err)
+	}
+	leaderElection, ok := config["leaderElection"].(map[string]interface{})
+	if !ok {
+		leaderElection = map[string]interface{}{}
+	}
+	if name, _ := leaderElection["resourceName"].(string); name != "" {
+		return scheduler.Config, nil
+	}
+	leaderElection["resourceName"] = schedulerComponentName(scheduler)
+	config["leaderElection"] = leaderElection
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("encoding config, %w", err)
+	}
+	return string(out), nil
+}
+
+func additionalScheduler(pod *v1.Pod, componentName, image, configPath string, port int) {
+	pod.Name = componentName
+	pod.Labels["component"] = componentName
+	container := &pod.Spec.Containers[0]
+	if image != "" {
+		container.Image = image
+	}
+	command := []string{}
+	for _, arg := range container.Command {
+		if !strings.HasPrefix(arg, "--kubeconfig=") && !strings.HasPrefix(arg, "--leader-elect=") && !strings.HasPrefix(arg, "--secure-port=") {
+			command = append(command, arg)
+		}
+	}
+	container.Command = append(command, "--config="+configPath, fmt.Sprintf("--secure-port=%d", port))
+	for _, probe := range []*v1.Probe{container.LivenessProbe, container.ReadinessProbe, container.StartupProbe} {
+		if probe != nil && probe.HTTPGet != nil {
+			probe.HTTPGet.Port = intstr.FromInt(port)
+		}
+	}
+	hostPathFile := v1.HostPathFile
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+		Name:         "scheduler-config",
+		VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: configPath, Type: &hostPathFile}},
+	})
+	container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{Name: "scheduler-config", MountPath: configPath, ReadOnly: true})
+}
@@ -0,0 +1,117 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"k8s.io/kubernetes/cmd/kubeadm/app/phases/certs"
+	"knative.dev/pkg/ptr"
+)
+
+// serviceAccountKeyHashAnnotation restarts the API server and controller
+// manager when the signing key changes, as they only read it on start up
+const serviceAccountKeyHashAnnotation = "kit.sh/service-account-key-hash"
+
+// serviceAccountKeyNameFile records the name of the active key next to it,
+// the substrate's status isn't kept between runs
+const serviceAccountKeyNameFile = "sa.name"
+
+// serviceAccountKeys creates the key signing service account tokens and
+// generates a new key when the key name changes. The key existing when a name
+// is first set is adopted as that key. The previous public key is appended to
+// sa.pub when kept, the API server verifies tokens against all of its keys.
+func serviceAccountKeys(cfg *kubeadm.InitConfiguration, substrate *v1alpha1.Substrate) error {
+	spec := substrate.Spec.ServiceAccountKey
+	namePath := path.Join(cfg.CertificatesDir, serviceAccountKeyNameFile)
+	active, err := ioutil.ReadFile(namePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading service account key name, %w", err)
+	}
+	if spec == nil || len(active) == 0 || string(active) == spec.KeyName {
+		if err := certs.CreateServiceAccountKeyAndPublicKeyFiles(cfg.CertificatesDir, cfg.ClusterConfiguration.PublicKeyAlgorithm()); err != nil {
+			return err
+		}
+		if spec == nil {
+			return nil
+		}
+		return activateServiceAccountKey(namePath, substrate)
+	}
+	keyPath := path.Join(cfg.CertificatesDir, kubeadmconstants.ServiceAccountPrivateKeyName)
+	publicKeyPath := path.Join(cfg.CertificatesDir, kubeadmconstants.ServiceAccountPublicKeyName)
+	previous, err := ioutil.ReadFile(publicKeyPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading service account public key, %w", err)
+	}
+	for _, file := range []string{keyPath, publicKeyPath} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing %s, %w", file, err)
+		}
+	}
+	if err := certs.CreateServiceAccountKeyAndPublicKeyFiles(cfg.CertificatesDir, cfg.ClusterConfiguration.PublicKeyAlgorithm()); err != nil {
+		return err
+	}
+	// sa.pub starts with the active key, older keys kept by the last rotation are dropped
+	if block, _ := pem.Decode(previous); block != nil && spec.KeepPreviousKey {
+		publicKeys, err := ioutil.ReadFile(publicKeyPath)
+		if err != nil {
+			return fmt.Errorf("reading service account public key, %w", err)
+		}
+		if err := ioutil.WriteFile(publicKeyPath, append(publicKeys, pem.EncodeToMemory(block)...), 0600); err != nil {
+			return fmt.Errorf("writing service account public key, %w", err)
+		}
+	}
+	return activateServiceAccountKey(namePath, substrate)
+}
+
+// activateServiceAccountKey records the spec's key name as the active key
+func activateServiceAccountKey(namePath string, substrate *v1alpha1.Substrate) error {
+	if err := ioutil.WriteFile(namePath, []byte(substrate.Spec.ServiceAccountKey.KeyName), 0600); err != nil {
+		return fmt.Errorf("writing service account key name, %w", err)
+	}
+	substrate.Status.Cluster.ServiceAccountKey = ptr.String(substrate.Spec.ServiceAccountKey.KeyName)
+	return nil
+}
+
+// annotateServiceAccountKeyHash restarts the component when the service
+// account keys change
+func annotateServiceAccountKeyHash(substrate *v1alpha1.Substrate) func(*v1.Pod) error {
+	return func(pod *v1.Pod) error {
+		hash := sha256.New()
+		for _, file := range []string{kubeadmconstants.ServiceAccountPrivateKeyName, kubeadmconstants.ServiceAccountPublicKeyName} {
+			data, err := ioutil.ReadFile(path.Join(ClusterCertsBasePath, aws.StringValue(discovery.Name(substrate)), certPKIPath, file))
+			if err != nil {
+				return fmt.Errorf("reading %s, %w", file, err)
+			}
+			hash.Write(data)
+		}
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[serviceAccountKeyHashAnnotation] = fmt.Sprintf("%x", hash.Sum(nil))
+		return nil
+	}
+}
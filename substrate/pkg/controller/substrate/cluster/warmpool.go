@@ -0,0 +1,114 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+)
+
+const (
+	// warmPoolTagKey is set on instances launched into the warm pool, instances
+	// launched without a pool don't have it
+	warmPoolTagKey  = "kit.aws/warm-pool"
+	warmPoolIdle    = "idle"
+	warmPoolClaimed = "claimed"
+	// warmPoolVersionTagKey is the launch template version a pooled instance
+	// was claimed for, it runs that version's user data
+	warmPoolVersionTagKey = "kit.aws/warm-pool-version"
+	// launchTemplateVersionTagKey is set by EC2 on instances launched from a launch template
+	launchTemplateVersionTagKey = "aws:ec2launchtemplate:version"
+)
+
+// warmPoolScript blocks the user data of pooled instances until the instance
+// is claimed, so idle instances don't take the elastic IP or run the
+// substrate's configuration. The claimed instance then runs the user data of
+// the launch template version it was claimed for, which may be newer than the
+// version it booted from. Polling slows down to every 30s the longer an
+// instance is idle.
+func warmPoolScript(substrate *v1alpha1.Substrate) string {
+	if substrate.Spec.WarmPool == nil {
+		return ""
+	}
+	return fmt.Sprintf(`#Waiting to be claimed from the warm pool
+if [ -z "$KIT_WARM_POOL_CLAIMED" ]; then
+	delay=2
+	while [ "$(AWS_DEFAULT_REGION=$REGION aws ec2 describe-tags --filters "Name=resource-id,Values=$InstanceID" "Name=key,Values=%[1]s" --query "Tags[0].Value" --output text)" == "%[2]s" ]; do
+		sleep $delay
+		delay=$(( delay < 30 ? delay * 2 : 30 ))
+	done
+	VERSION=$(AWS_DEFAULT_REGION=$REGION aws ec2 describe-tags --filters "Name=resource-id,Values=$InstanceID" "Name=key,Values=%[3]s" --query "Tags[0].Value" --output text)
+	AWS_DEFAULT_REGION=$REGION aws ec2 describe-launch-template-versions --launch-template-name %[4]s --versions "$VERSION" \
+		--query "LaunchTemplateVersions[0].LaunchTemplateData.UserData" --output text | base64 -d > /var/lib/kit-claimed-user-data.sh
+	KIT_WARM_POOL_CLAIMED=true exec bash /var/lib/kit-claimed-user-data.sh
+fi
+
+`, warmPoolTagKey, warmPoolIdle, warmPoolVersionTagKey, aws.StringValue(discovery.Name(substrate)))
+}
+
+func tagValue(instance *ec2.Instance, key string) string {
+	for _, tag := range instance.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
+
+func isIdle(instance *ec2.Instance) bool {
+	return tagValue(instance, warmPoolTagKey) == warmPoolIdle
+}
+
+// isCurrentVersion reports if the instance runs the user data of the current
+// launch template version, a claimed instance runs the version it was claimed
+// for rather than the one it booted from
+func isCurrentVersion(instance *ec2.Instance, substrate *v1alpha1.Substrate) bool {
+	version := tagValue(instance, warmPoolVersionTagKey)
+	if version == "" {
+		version = tagValue(instance, launchTemplateVersionTagKey)
+	}
+	return version == aws.StringValue(substrate.Status.Cluster.LaunchTemplateVersion)
+}
+
+// isCurrentImage reports if the instance booted with the AMI and instance type
+// of the current launch template version, so it only differs in user data
+func isCurrentImage(instance *ec2.Instance, substrate *v1alpha1.Substrate) bool {
+	return aws.StringValue(instance.ImageId) == aws.StringValue(substrate.Status.Cluster.ImageID) &&
+		aws.StringValue(instance.InstanceType) == aws.StringValue(substrate.Spec.InstanceType)
+}
+
+// warmPoolSize is the number of idle instances the pool should hold, the
+// pool is drained when it's removed from the spec
+func warmPoolSize(substrate *v1alpha1.Substrate) int {
+	if substrate.Spec.WarmPool == nil {
+		return 0
+	}
+	return int(substrate.Spec.WarmPool.Size)
+}
+
+// claimable reports if an idle instance may become the substrate node under
+// the pool's reuse policy. Pooled instances are keyed by the AMI and instance
+// type of the launch template version they booted from rather than the version
+// number, so they stay claimable when only the user data changes.
+func claimable(instance *ec2.Instance, substrate *v1alpha1.Substrate) bool {
+	if substrate.Spec.WarmPool == nil {
+		return false
+	}
+	return substrate.Spec.WarmPool.ReusePolicy == v1alpha1.WarmPoolReusePolicyAnyVersion || isCurrentImage(instance, substrate)
+}
@@ -16,6 +16,7 @@ package substrate
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"sync"
@@ -25,12 +26,10 @@ import (
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/iam"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/ssm"
-	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
 	"github.com/awslabs/kit/substrate/pkg/controller/substrate/cluster"
 	"github.com/awslabs/kit/substrate/pkg/controller/substrate/cluster/addons"
@@ -42,26 +41,37 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// DefaultDeleteTimeout is how long deleting all of the resources may take
+const DefaultDeleteTimeout = 30 * time.Minute
+
 func NewController(ctx context.Context) *Controller {
 	session := session.Must(session.NewSession(&aws.Config{STSRegionalEndpoint: endpoints.RegionalSTSEndpoint}))
 	session.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler("kit.sh"))
 	EC2 := ec2.New(session)
 	IAM := iam.New(session)
 	return &Controller{
+		DeleteTimeout: DefaultDeleteTimeout,
 		Resources: []Resource{
 			&infrastructure.VPC{EC2: EC2},
+			&infrastructure.DHCPOptions{EC2: EC2},
+			&infrastructure.FlowLogs{EC2: EC2, CloudWatchLogs: cloudwatchlogs.New(session)},
 			&infrastructure.Subnets{EC2: EC2},
 			&infrastructure.RouteTable{EC2: EC2},
 			&infrastructure.InternetGateway{EC2: EC2},
+			&infrastructure.NATGateway{EC2: EC2},
 			&infrastructure.SecurityGroup{EC2: EC2},
 			&cluster.Address{EC2: EC2},
 			&cluster.LaunchTemplate{EC2: EC2, SSM: ssm.New(session), Region: session.Config.Region},
 			&cluster.InstanceProfile{IAM: IAM},
 			&cluster.Instance{EC2: EC2},
-			&cluster.Config{S3: s3.New(session), STS: sts.New(session), S3Uploader: s3manager.NewUploader(session)},
+			&cluster.Config{Clients: cluster.NewClientFactory(session), Recorder: cluster.NewLoggingRecorder(ctx)},
 			&cluster.Readiness{},
 			&addons.RBAC{},
+			&addons.NodeRoles{},
 			&addons.KubeProxy{},
+			&addons.EBSCSIDriver{},
+			&addons.SecretsEncryption{},
+			&addons.EtcdBackup{},
 		},
 	}
 }
@@ -69,6 +79,10 @@ func NewController(ctx context.Context) *Controller {
 type Controller struct {
 	sync.RWMutex
 	Resources []Resource
+	// DeleteTimeout bounds the whole delete, the resources that haven't been
+	// deleted when it expires are abandoned so a stalled delete is reported
+	// rather than blocking forever. Zero waits.
+	DeleteTimeout time.Duration
 }
 
 type Resource interface {
@@ -77,6 +91,20 @@ type Resource interface {
 }
 
 func (c *Controller) Reconcile(ctx context.Context, substrate *v1alpha1.Substrate) error {
+	if substrate.DeletionTimestamp == nil {
+		substrate.SetDefaults(ctx)
+		if err := substrate.Validate(ctx); err != nil {
+			return fmt.Errorf("validating substrate, %w", err)
+		}
+		substrate.InitializeConditions()
+	}
+	var expired <-chan struct{}
+	if substrate.DeletionTimestamp != nil && c.DeleteTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, c.DeleteTimeout)
+		defer cancelTimeout()
+		expired = ctx.Done()
+	}
 	ctx, cancel := context.WithCancel(ctx)
 	var errs = make([]error, len(c.Resources))
 	workqueue.ParallelizeUntil(ctx, len(c.Resources), len(c.Resources), func(i int) {
@@ -85,11 +113,20 @@ func (c *Controller) Reconcile(ctx context.Context, substrate *v1alpha1.Substrat
 			c.RLock()
 			mutable := substrate.DeepCopy()
 			c.RUnlock()
+			conditions := mutable.Status.Conditions.DeepCopy()
 			f := resource.Create
 			if substrate.DeletionTimestamp != nil {
+				if substrate.KeepsWarmPool() && runsWarmPool(resource) {
+					return
+				}
 				f = resource.Delete
 			}
-			result, err := f(ctx, mutable)
+			result, err := c.call(ctx, expired, f, mutable)
+			if errors.Is(err, errDeleteTimeout) {
+				errs[i] = fmt.Errorf("deleting %s didn't complete within %s", reflect.ValueOf(resource).Elem().Type(), c.DeleteTimeout)
+				cancel()
+				return
+			}
 			if err != nil {
 				errs[i] = fmt.Errorf("reconciling %s, %w", reflect.ValueOf(resource).Elem().Type(), err)
 				cancel()
@@ -97,12 +134,56 @@ func (c *Controller) Reconcile(ctx context.Context, substrate *v1alpha1.Substrat
 			}
 			c.Lock()
 			runtime.Must(mergo.Merge(substrate, mutable))
+			// mergo keeps the existing conditions, the resources run concurrently
+			// and each only reports its own
+			substrate.MergeConditions(conditions, mutable)
 			c.Unlock()
 			if !result.Requeue && result.RequeueAfter == 0 {
 				return
 			}
-			time.Sleep(result.RequeueAfter + time.Second*1)
+			select {
+			case <-expired:
+				errs[i] = fmt.Errorf("deleting %s didn't complete within %s", reflect.ValueOf(resource).Elem().Type(), c.DeleteTimeout)
+				cancel()
+				return
+			case <-time.After(result.RequeueAfter + time.Second*1):
+			}
 		}
 	})
 	return multierr.Combine(errs...)
 }
+
+// runsWarmPool reports if idle warm pool instances depend on the resource, so
+// it's kept when the substrate is deleted with its warm pool
+func runsWarmPool(resource Resource) bool {
+	switch resource.(type) {
+	case *infrastructure.VPC, *infrastructure.DHCPOptions, *infrastructure.FlowLogs, *infrastructure.Subnets,
+		*infrastructure.RouteTable, *infrastructure.InternetGateway, *infrastructure.NATGateway,
+		*infrastructure.SecurityGroup, *cluster.LaunchTemplate, *cluster.InstanceProfile:
+		return true
+	}
+	return false
+}
+
+var errDeleteTimeout = errors.New("delete timed out")
+
+// call returns the result of f, or errDeleteTimeout if the delete timeout
+// expires first. A resource blocked past the timeout is abandoned.
+func (c *Controller) call(ctx context.Context, expired <-chan struct{}, f func(context.Context, *v1alpha1.Substrate) (reconcile.Result, error), substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	type returned struct {
+		result reconcile.Result
+		err    error
+	}
+	// Buffered so an abandoned resource returning later doesn't block forever
+	done := make(chan returned, 1)
+	go func() {
+		result, err := f(ctx, substrate)
+		done <- returned{result: result, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.result, r.err
+	case <-expired:
+		return reconcile.Result{}, errDeleteTimeout
+	}
+}
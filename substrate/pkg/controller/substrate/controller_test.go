@@ -0,0 +1,157 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package substrate
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/controller/substrate/infrastructure"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// stalledResource blocks deleting until released, ignoring its context like a
+// call without a deadline
+type stalledResource struct {
+	release chan struct{}
+}
+
+func (s *stalledResource) Create(_ context.Context, _ *v1alpha1.Substrate) (reconcile.Result, error) {
+	return reconcile.Result{}, nil
+}
+
+func (s *stalledResource) Delete(_ context.Context, _ *v1alpha1.Substrate) (reconcile.Result, error) {
+	<-s.release
+	return reconcile.Result{}, nil
+}
+
+// requeuedResource is never deleted, it requeues every time it's called
+type requeuedResource struct{}
+
+func (r *requeuedResource) Create(_ context.Context, _ *v1alpha1.Substrate) (reconcile.Result, error) {
+	return reconcile.Result{}, nil
+}
+
+func (r *requeuedResource) Delete(_ context.Context, _ *v1alpha1.Substrate) (reconcile.Result, error) {
+	return reconcile.Result{Requeue: true}, nil
+}
+
+// conditionResource marks its condition true, after waiting once when pending
+type conditionResource struct {
+	condition apis.ConditionType
+	pending   bool
+}
+
+func (c *conditionResource) Create(_ context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	if c.pending {
+		c.pending = false
+		substrate.StatusConditions().MarkUnknown(c.condition, "Waiting", "waiting for %s", c.condition)
+		return reconcile.Result{Requeue: true}, nil
+	}
+	substrate.StatusConditions().MarkTrue(c.condition)
+	return reconcile.Result{}, nil
+}
+
+func (c *conditionResource) Delete(_ context.Context, _ *v1alpha1.Substrate) (reconcile.Result, error) {
+	return reconcile.Result{}, nil
+}
+
+func TestConditions(t *testing.T) {
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	// The pending resources report stale copies of the others' conditions
+	controller := &Controller{Resources: []Resource{
+		&conditionResource{condition: v1alpha1.ConditionVPCReady},
+		&conditionResource{condition: v1alpha1.ConditionSubnetsReady},
+		&conditionResource{condition: v1alpha1.ConditionClusterConfigUploaded, pending: true},
+		&conditionResource{condition: v1alpha1.ConditionEndpointReady, pending: true},
+	}}
+	if err := controller.Reconcile(context.Background(), substrate); err != nil {
+		t.Fatalf("reconciling substrate, %v", err)
+	}
+	for _, condition := range []apis.ConditionType{
+		v1alpha1.ConditionVPCReady,
+		v1alpha1.ConditionSubnetsReady,
+		v1alpha1.ConditionClusterConfigUploaded,
+		v1alpha1.ConditionEndpointReady,
+	} {
+		if !substrate.StatusConditions().GetCondition(condition).IsTrue() {
+			t.Errorf("expected %s to be true, got %v", condition, substrate.StatusConditions().GetCondition(condition))
+		}
+	}
+	if !substrate.IsReady() {
+		t.Errorf("expected the substrate to be ready")
+	}
+}
+
+func TestConditionsRollUp(t *testing.T) {
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	substrate.InitializeConditions()
+	substrate.StatusConditions().MarkTrue(v1alpha1.ConditionVPCReady)
+	substrate.StatusConditions().MarkTrue(v1alpha1.ConditionSubnetsReady)
+	substrate.StatusConditions().MarkTrue(v1alpha1.ConditionClusterConfigUploaded)
+	if substrate.IsReady() {
+		t.Errorf("expected the substrate not to be ready before the endpoint")
+	}
+	reported := substrate.DeepCopy()
+	before := reported.Status.Conditions.DeepCopy()
+	reported.StatusConditions().MarkTrue(v1alpha1.ConditionEndpointReady)
+	substrate.StatusConditions().MarkFalse(v1alpha1.ConditionVPCReady, "Deleted", "vpc was deleted")
+	// Merging the endpoint doesn't revert the VPC to the reported copy's
+	substrate.MergeConditions(before, reported)
+	if condition := substrate.StatusConditions().GetCondition(v1alpha1.ConditionVPCReady); !condition.IsFalse() {
+		t.Errorf("expected VPCReady to stay false, got %v", condition)
+	}
+	if !substrate.StatusConditions().GetCondition(v1alpha1.ConditionEndpointReady).IsTrue() || substrate.IsReady() {
+		t.Errorf("expected EndpointReady to be merged without making the substrate ready")
+	}
+}
+
+func TestDeleteTimeout(t *testing.T) {
+	stalled := &stalledResource{release: make(chan struct{})}
+	defer close(stalled.release)
+	controller := &Controller{Resources: []Resource{stalled, &requeuedResource{}}, DeleteTimeout: 100 * time.Millisecond}
+	start := time.Now()
+	err := controller.Reconcile(context.Background(), &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate", DeletionTimestamp: &metav1.Time{Time: time.Now()}},
+	})
+	if err == nil {
+		t.Fatalf("expected deleting to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected delete to return after the timeout, took %s", elapsed)
+	}
+	// Both the blocked and the requeued resources are reported as stalled
+	for _, resource := range []string{"substrate.stalledResource", "substrate.requeuedResource"} {
+		if !strings.Contains(err.Error(), resource+" didn't complete within 100ms") {
+			t.Errorf("expected %s to be reported as stalled, got %v", resource, err)
+		}
+	}
+}
+
+func TestDeleteKeepsWarmPool(t *testing.T) {
+	// The VPC has no client, deleting it would panic
+	controller := &Controller{Resources: []Resource{&infrastructure.VPC{}, &conditionResource{}}}
+	if err := controller.Reconcile(context.Background(), &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate", DeletionTimestamp: &metav1.Time{Time: time.Now()}},
+		Spec:       v1alpha1.SubstrateSpec{WarmPool: &v1alpha1.WarmPoolSpec{}},
+	}); err != nil {
+		t.Fatalf("deleting substrate, %v", err)
+	}
+}
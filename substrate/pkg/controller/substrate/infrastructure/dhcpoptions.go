@@ -0,0 +1,100 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type DHCPOptions struct {
+	EC2 ec2iface.EC2API
+}
+
+func (d *DHCPOptions) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	if substrate.Spec.DHCPOptions == nil {
+		return reconcile.Result{}, nil
+	}
+	if substrate.Status.Infrastructure.VPCID == nil {
+		return reconcile.Result{Requeue: true}, nil
+	}
+	describeDhcpOptionsOutput, err := d.EC2.DescribeDhcpOptionsWithContext(ctx, &ec2.DescribeDhcpOptionsInput{Filters: discovery.Filters(substrate, discovery.Name(substrate))})
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("describing dhcp options, %w", err)
+	}
+	if len(describeDhcpOptionsOutput.DhcpOptions) > 0 {
+		substrate.Status.Infrastructure.DHCPOptionsID = describeDhcpOptionsOutput.DhcpOptions[0].DhcpOptionsId
+		logging.FromContext(ctx).Infof("Found dhcp options %s", aws.StringValue(substrate.Status.Infrastructure.DHCPOptionsID))
+	} else {
+		createDhcpOptionsOutput, err := d.EC2.CreateDhcpOptionsWithContext(ctx, &ec2.CreateDhcpOptionsInput{
+			DhcpConfigurations: dhcpConfigurationsFor(substrate.Spec.DHCPOptions),
+			TagSpecifications:  discovery.Tags(substrate, ec2.ResourceTypeDhcpOptions, discovery.Name(substrate)),
+		})
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("creating dhcp options, %w", err)
+		}
+		substrate.Status.Infrastructure.DHCPOptionsID = createDhcpOptionsOutput.DhcpOptions.DhcpOptionsId
+		logging.FromContext(ctx).Infof("Created dhcp options %s", aws.StringValue(substrate.Status.Infrastructure.DHCPOptionsID))
+	}
+	// Associating is idempotent, the VPC is associated with the default options set when created
+	if _, err := d.EC2.AssociateDhcpOptionsWithContext(ctx, &ec2.AssociateDhcpOptionsInput{
+		DhcpOptionsId: substrate.Status.Infrastructure.DHCPOptionsID,
+		VpcId:         substrate.Status.Infrastructure.VPCID,
+	}); err != nil {
+		return reconcile.Result{}, fmt.Errorf("associating dhcp options, %w", err)
+	}
+	logging.FromContext(ctx).Infof("Associated dhcp options %s with vpc %s",
+		aws.StringValue(substrate.Status.Infrastructure.DHCPOptionsID), aws.StringValue(substrate.Status.Infrastructure.VPCID))
+	return reconcile.Result{}, nil
+}
+
+func (d *DHCPOptions) Delete(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	describeDhcpOptionsOutput, err := d.EC2.DescribeDhcpOptionsWithContext(ctx, &ec2.DescribeDhcpOptionsInput{Filters: discovery.Filters(substrate)})
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("describing dhcp options, %w", err)
+	}
+	for _, dhcpOptions := range describeDhcpOptionsOutput.DhcpOptions {
+		if _, err := d.EC2.DeleteDhcpOptionsWithContext(ctx, &ec2.DeleteDhcpOptionsInput{DhcpOptionsId: dhcpOptions.DhcpOptionsId}); err != nil {
+			// Options can't be deleted until the VPC they're associated with is deleted
+			if errCode(err) == "DependencyViolation" {
+				return reconcile.Result{Requeue: true}, nil
+			}
+			return reconcile.Result{}, fmt.Errorf("deleting dhcp options, %w", err)
+		}
+		logging.FromContext(ctx).Infof("Deleted dhcp options %s", aws.StringValue(dhcpOptions.DhcpOptionsId))
+	}
+	return reconcile.Result{}, nil
+}
+
+func dhcpConfigurationsFor(options *v1alpha1.DHCPOptionsSpec) (configurations []*ec2.NewDhcpConfiguration) {
+	if options.DomainName != "" {
+		configurations = append(configurations, &ec2.NewDhcpConfiguration{Key: aws.String("domain-name"), Values: aws.StringSlice([]string{options.DomainName})})
+	}
+	if len(options.DomainNameServers) > 0 {
+		configurations = append(configurations, &ec2.NewDhcpConfiguration{Key: aws.String("domain-name-servers"), Values: aws.StringSlice(options.DomainNameServers)})
+	}
+	if len(options.NTPServers) > 0 {
+		configurations = append(configurations, &ec2.NewDhcpConfiguration{Key: aws.String("ntp-servers"), Values: aws.StringSlice(options.NTPServers)})
+	}
+	return configurations
+}
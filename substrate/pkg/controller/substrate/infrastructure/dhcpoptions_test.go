@@ -0,0 +1,104 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (f *fakeEC2) DescribeDhcpOptionsWithContext(_ aws.Context, _ *ec2.DescribeDhcpOptionsInput, _ ...request.Option) (*ec2.DescribeDhcpOptionsOutput, error) {
+	return &ec2.DescribeDhcpOptionsOutput{DhcpOptions: f.dhcpOptions}, nil
+}
+
+func (f *fakeEC2) DeleteDhcpOptionsWithContext(_ aws.Context, _ *ec2.DeleteDhcpOptionsInput, _ ...request.Option) (*ec2.DeleteDhcpOptionsOutput, error) {
+	return &ec2.DeleteDhcpOptionsOutput{}, f.deleteDhcpOptionsErr
+}
+
+func (f *fakeEC2) CreateDhcpOptionsWithContext(_ aws.Context, input *ec2.CreateDhcpOptionsInput, _ ...request.Option) (*ec2.CreateDhcpOptionsOutput, error) {
+	f.createDhcpOptionsInput = input
+	return &ec2.CreateDhcpOptionsOutput{DhcpOptions: &ec2.DhcpOptions{DhcpOptionsId: aws.String("dopt-1234")}}, nil
+}
+
+func (f *fakeEC2) AssociateDhcpOptionsWithContext(_ aws.Context, input *ec2.AssociateDhcpOptionsInput, _ ...request.Option) (*ec2.AssociateDhcpOptionsOutput, error) {
+	f.associateDhcpOptionsInput = input
+	return &ec2.AssociateDhcpOptionsOutput{}, nil
+}
+
+func TestDHCPOptionsCreate(t *testing.T) {
+	fake := &fakeEC2{}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec: v1alpha1.SubstrateSpec{DHCPOptions: &v1alpha1.DHCPOptionsSpec{
+			DomainName:        "corp.example.com",
+			DomainNameServers: []string{"10.0.0.2", "AmazonProvidedDNS"},
+			NTPServers:        []string{"169.254.169.123"},
+		}},
+		Status: v1alpha1.SubstrateStatus{Infrastructure: v1alpha1.InfrastructureStatus{VPCID: aws.String("vpc-1234")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if _, err := (&DHCPOptions{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating dhcp options, %v", err)
+	}
+	if fake.createDhcpOptionsInput == nil {
+		t.Fatalf("expected dhcp options to be created")
+	}
+	configurations := map[string][]string{}
+	for _, configuration := range fake.createDhcpOptionsInput.DhcpConfigurations {
+		configurations[aws.StringValue(configuration.Key)] = aws.StringValueSlice(configuration.Values)
+	}
+	if len(configurations["domain-name"]) != 1 || configurations["domain-name"][0] != "corp.example.com" {
+		t.Errorf("expected domain-name corp.example.com, got %v", configurations["domain-name"])
+	}
+	if len(configurations["domain-name-servers"]) != 2 || len(configurations["ntp-servers"]) != 1 {
+		t.Errorf("expected domain-name-servers and ntp-servers, got %v", configurations)
+	}
+	if fake.associateDhcpOptionsInput == nil {
+		t.Fatalf("expected dhcp options to be associated")
+	}
+	if id := aws.StringValue(fake.associateDhcpOptionsInput.VpcId); id != "vpc-1234" {
+		t.Errorf("expected dhcp options associated with vpc-1234, got %s", id)
+	}
+	if id := aws.StringValue(substrate.Status.Infrastructure.DHCPOptionsID); id != "dopt-1234" {
+		t.Errorf("expected dhcp options id dopt-1234 in status, got %s", id)
+	}
+}
+
+func TestDHCPOptionsDeleteErrors(t *testing.T) {
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	fake := &fakeEC2{
+		dhcpOptions:          []*ec2.DhcpOptions{{DhcpOptionsId: aws.String("dopt-1234")}},
+		deleteDhcpOptionsErr: awserr.New("DependencyViolation", "in use", nil),
+	}
+	result, err := (&DHCPOptions{EC2: fake}).Delete(context.Background(), substrate)
+	if err != nil || !result.Requeue {
+		t.Errorf("expected options still associated with the VPC to be requeued, got %v, %v", result, err)
+	}
+	// Errors that didn't come from the AWS API, e.g. a cancelled context, are returned
+	fake.deleteDhcpOptionsErr = fmt.Errorf("context canceled")
+	if _, err := (&DHCPOptions{EC2: fake}).Delete(context.Background(), substrate); err == nil {
+		t.Errorf("expected deleting the dhcp options to fail")
+	}
+}
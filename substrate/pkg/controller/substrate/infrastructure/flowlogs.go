@@ -0,0 +1,130 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type FlowLogs struct {
+	EC2            ec2iface.EC2API
+	CloudWatchLogs cloudwatchlogsiface.CloudWatchLogsAPI
+}
+
+func (f *FlowLogs) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	if substrate.Spec.FlowLogs == nil {
+		return reconcile.Result{}, nil
+	}
+	if substrate.Status.Infrastructure.VPCID == nil {
+		return reconcile.Result{Requeue: true}, nil
+	}
+	describeFlowLogsOutput, err := f.EC2.DescribeFlowLogsWithContext(ctx, &ec2.DescribeFlowLogsInput{Filter: discovery.Filters(substrate, discovery.Name(substrate))})
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("describing flow logs, %w", err)
+	}
+	if len(describeFlowLogsOutput.FlowLogs) > 0 {
+		substrate.Status.Infrastructure.FlowLogID = describeFlowLogsOutput.FlowLogs[0].FlowLogId
+		logging.FromContext(ctx).Infof("Found flow log %s", aws.StringValue(substrate.Status.Infrastructure.FlowLogID))
+		return reconcile.Result{}, nil
+	}
+	input := &ec2.CreateFlowLogsInput{
+		ResourceIds:        []*string{substrate.Status.Infrastructure.VPCID},
+		ResourceType:       aws.String(ec2.FlowLogsResourceTypeVpc),
+		TrafficType:        substrate.Spec.FlowLogs.TrafficType,
+		LogDestinationType: aws.String(substrate.Spec.FlowLogs.DestinationType),
+		LogDestination:     substrate.Spec.FlowLogs.Destination,
+		TagSpecifications:  discovery.Tags(substrate, ec2.ResourceTypeVpcFlowLog, discovery.Name(substrate)),
+	}
+	if substrate.Spec.FlowLogs.DestinationType == ec2.LogDestinationTypeCloudWatchLogs {
+		if err := f.ensureLogGroup(ctx, substrate); err != nil {
+			return reconcile.Result{}, err
+		}
+		input.LogGroupName = logGroupName(substrate)
+		input.DeliverLogsPermissionArn = substrate.Spec.FlowLogs.DeliverLogsPermissionARN
+	}
+	createFlowLogsOutput, err := f.EC2.CreateFlowLogsWithContext(ctx, input)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("creating flow logs, %w", err)
+	}
+	for _, item := range createFlowLogsOutput.Unsuccessful {
+		return reconcile.Result{}, fmt.Errorf("creating flow logs, %s", aws.StringValue(item.Error.Message))
+	}
+	if len(createFlowLogsOutput.FlowLogIds) > 0 {
+		substrate.Status.Infrastructure.FlowLogID = createFlowLogsOutput.FlowLogIds[0]
+	}
+	logging.FromContext(ctx).Infof("Created flow log %s", aws.StringValue(substrate.Status.Infrastructure.FlowLogID))
+	return reconcile.Result{}, nil
+}
+
+func (f *FlowLogs) ensureLogGroup(ctx context.Context, substrate *v1alpha1.Substrate) error {
+	if _, err := f.CloudWatchLogs.CreateLogGroupWithContext(ctx, &cloudwatchlogs.CreateLogGroupInput{
+		LogGroupName: logGroupName(substrate),
+		Tags:         map[string]*string{discovery.OwnerTagKey: aws.String(substrate.Name)},
+	}); err != nil {
+		if errCode(err) != cloudwatchlogs.ErrCodeResourceAlreadyExistsException {
+			return fmt.Errorf("creating log group, %w", err)
+		}
+		logging.FromContext(ctx).Infof("Found log group %s", aws.StringValue(logGroupName(substrate)))
+	} else {
+		logging.FromContext(ctx).Infof("Created log group %s", aws.StringValue(logGroupName(substrate)))
+	}
+	if substrate.Spec.FlowLogs.RetentionInDays == nil {
+		return nil
+	}
+	if _, err := f.CloudWatchLogs.PutRetentionPolicyWithContext(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+		LogGroupName:    logGroupName(substrate),
+		RetentionInDays: substrate.Spec.FlowLogs.RetentionInDays,
+	}); err != nil {
+		return fmt.Errorf("setting log group retention, %w", err)
+	}
+	return nil
+}
+
+func (f *FlowLogs) Delete(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	describeFlowLogsOutput, err := f.EC2.DescribeFlowLogsWithContext(ctx, &ec2.DescribeFlowLogsInput{Filter: discovery.Filters(substrate)})
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("describing flow logs, %w", err)
+	}
+	for _, flowLog := range describeFlowLogsOutput.FlowLogs {
+		if _, err := f.EC2.DeleteFlowLogsWithContext(ctx, &ec2.DeleteFlowLogsInput{FlowLogIds: []*string{flowLog.FlowLogId}}); err != nil {
+			return reconcile.Result{}, fmt.Errorf("deleting flow log, %w", err)
+		}
+		logging.FromContext(ctx).Infof("Deleted flow log %s", aws.StringValue(flowLog.FlowLogId))
+	}
+	// The spec may not be available on delete, so always attempt to remove the log group
+	if _, err := f.CloudWatchLogs.DeleteLogGroupWithContext(ctx, &cloudwatchlogs.DeleteLogGroupInput{LogGroupName: logGroupName(substrate)}); err != nil {
+		if errCode(err) != cloudwatchlogs.ErrCodeResourceNotFoundException {
+			return reconcile.Result{}, fmt.Errorf("deleting log group, %w", err)
+		}
+	} else {
+		logging.FromContext(ctx).Infof("Deleted log group %s", aws.StringValue(logGroupName(substrate)))
+	}
+	return reconcile.Result{}, nil
+}
+
+func logGroupName(substrate *v1alpha1.Substrate) *string {
+	return discovery.Name(substrate, "flow-logs")
+}
@@ -0,0 +1,118 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeEC2 struct {
+	ec2iface.EC2API
+	createFlowLogsInput       *ec2.CreateFlowLogsInput
+	createDhcpOptionsInput    *ec2.CreateDhcpOptionsInput
+	associateDhcpOptionsInput *ec2.AssociateDhcpOptionsInput
+	dhcpOptions               []*ec2.DhcpOptions
+	deleteDhcpOptionsErr      error
+	subnets                   []*ec2.Subnet
+	routeTables               []*ec2.RouteTable
+	natGateways               []*ec2.NatGateway
+	// routes and associations map route tables to NAT gateways and subnets to route tables
+	routes       map[string]string
+	associations map[string]string
+	// securityGroupIngress and securityGroupEgress are the rules the security
+	// group is described with
+	securityGroupIngress []*ec2.IpPermission
+	securityGroupEgress  []*ec2.IpPermission
+	ingress              []*ec2.IpPermission
+	revokedIngress       []*ec2.IpPermission
+	egress               []*ec2.IpPermission
+	revokedEgress        []*ec2.IpPermission
+}
+
+func (f *fakeEC2) DescribeFlowLogsWithContext(_ aws.Context, _ *ec2.DescribeFlowLogsInput, _ ...request.Option) (*ec2.DescribeFlowLogsOutput, error) {
+	return &ec2.DescribeFlowLogsOutput{}, nil
+}
+
+func (f *fakeEC2) CreateFlowLogsWithContext(_ aws.Context, input *ec2.CreateFlowLogsInput, _ ...request.Option) (*ec2.CreateFlowLogsOutput, error) {
+	f.createFlowLogsInput = input
+	return &ec2.CreateFlowLogsOutput{FlowLogIds: []*string{aws.String("fl-1234")}}, nil
+}
+
+func TestFlowLogsCreate(t *testing.T) {
+	fake := &fakeEC2{}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec: v1alpha1.SubstrateSpec{FlowLogs: &v1alpha1.FlowLogsSpec{
+			DestinationType: ec2.LogDestinationTypeS3,
+			Destination:     aws.String("arn:aws:s3:::flow-logs"),
+			TrafficType:     aws.String(ec2.TrafficTypeReject),
+		}},
+		Status: v1alpha1.SubstrateStatus{Infrastructure: v1alpha1.InfrastructureStatus{VPCID: aws.String("vpc-1234")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if _, err := (&FlowLogs{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating flow logs, %v", err)
+	}
+	if fake.createFlowLogsInput == nil {
+		t.Fatalf("expected flow logs to be created")
+	}
+	if traffic := aws.StringValue(fake.createFlowLogsInput.TrafficType); traffic != ec2.TrafficTypeReject {
+		t.Errorf("expected traffic type %s, got %s", ec2.TrafficTypeReject, traffic)
+	}
+	if id := aws.StringValue(fake.createFlowLogsInput.ResourceIds[0]); id != "vpc-1234" {
+		t.Errorf("expected flow log on vpc-1234, got %s", id)
+	}
+	if id := aws.StringValue(substrate.Status.Infrastructure.FlowLogID); id != "fl-1234" {
+		t.Errorf("expected flow log id fl-1234 in status, got %s", id)
+	}
+}
+
+type fakeCloudWatchLogs struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	deleteLogGroupErr error
+}
+
+func (f *fakeCloudWatchLogs) DeleteLogGroupWithContext(_ aws.Context, _ *cloudwatchlogs.DeleteLogGroupInput, _ ...request.Option) (*cloudwatchlogs.DeleteLogGroupOutput, error) {
+	return &cloudwatchlogs.DeleteLogGroupOutput{}, f.deleteLogGroupErr
+}
+
+func TestFlowLogsDeleteErrors(t *testing.T) {
+	substrate := &v1alpha1.Substrate{ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"}}
+	flowLogs := &FlowLogs{EC2: &fakeEC2{}, CloudWatchLogs: &fakeCloudWatchLogs{
+		deleteLogGroupErr: awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException, "not found", nil),
+	}}
+	if _, err := flowLogs.Delete(context.Background(), substrate); err != nil {
+		t.Errorf("expected a missing log group to be deleted, got %v", err)
+	}
+	// Errors that didn't come from the AWS API, e.g. a cancelled context, are returned
+	flowLogs.CloudWatchLogs = &fakeCloudWatchLogs{deleteLogGroupErr: fmt.Errorf("context canceled")}
+	if _, err := flowLogs.Delete(context.Background(), substrate); err == nil {
+		t.Errorf("expected deleting the log group to fail")
+	}
+}
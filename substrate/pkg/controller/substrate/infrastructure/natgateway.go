@@ -0,0 +1,301 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// NATGateway provides outbound internet access to the private subnets, with
+// one NAT gateway for all subnets or one per zone routed by a route table per
+// zone
+type NATGateway struct {
+	EC2 ec2iface.EC2API
+}
+
+func (n *NATGateway) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	if substrate.Spec.NATGateway == v1alpha1.NATGatewayNone || !hasPrivateSubnets(substrate) {
+		return reconcile.Result{}, nil
+	}
+	if substrate.Status.Infrastructure.PrivateRouteTableID == nil ||
+		len(substrate.Status.Infrastructure.PublicSubnetIDs) == 0 || len(substrate.Status.Infrastructure.PrivateSubnetIDs) == 0 {
+		return reconcile.Result{Requeue: true}, nil
+	}
+	publicSubnets, privateSubnets, err := n.subnetsByZone(ctx, substrate)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	// Subnets may not be described yet after being created
+	if len(publicSubnets) == 0 || len(privateSubnets) == 0 {
+		return reconcile.Result{Requeue: true}, nil
+	}
+	for zone := range privateSubnets {
+		if publicSubnets[zone] == nil && substrate.Spec.NATGateway == v1alpha1.NATGatewayPerAZ {
+			return reconcile.Result{Requeue: true}, nil
+		}
+	}
+	routeTablesOutput, err := n.EC2.DescribeRouteTablesWithContext(ctx, &ec2.DescribeRouteTablesInput{Filters: discovery.Filters(substrate)})
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("describing route tables, %w", err)
+	}
+	substrate.Status.Infrastructure.NATGatewayIDs = nil
+	available := true
+	zones := sets.StringKeySet(privateSubnets).List()
+	if substrate.Spec.NATGateway == v1alpha1.NATGatewaySingle {
+		// A single NAT gateway is created in the first zone with a public subnet
+		zones = sets.StringKeySet(publicSubnets).List()[:1]
+	}
+	for _, zone := range zones {
+		natGateway, err := n.ensureNATGateway(ctx, substrate, zone, publicSubnets[zone])
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		substrate.Status.Infrastructure.NATGatewayIDs = append(substrate.Status.Infrastructure.NATGatewayIDs, aws.StringValue(natGateway.NatGatewayId))
+		if aws.StringValue(natGateway.State) != ec2.NatGatewayStateAvailable {
+			logging.FromContext(ctx).Infof("Waiting for NAT gateway %s to be available", aws.StringValue(natGateway.NatGatewayId))
+			available = false
+			continue
+		}
+		if substrate.Spec.NATGateway == v1alpha1.NATGatewaySingle {
+			if err := n.ensureRoute(ctx, substrate.Status.Infrastructure.PrivateRouteTableID, natGateway.NatGatewayId); err != nil {
+				return reconcile.Result{}, err
+			}
+			continue
+		}
+		routeTable, err := n.ensureRouteTable(ctx, substrate, routeTablesOutput.RouteTables, discovery.Name(substrate, zone, "private"))
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if err := n.ensureRoute(ctx, routeTable.RouteTableId, natGateway.NatGatewayId); err != nil {
+			return reconcile.Result{}, err
+		}
+		for _, subnetID := range privateSubnets[zone] {
+			if err := n.ensureAssociation(ctx, routeTablesOutput.RouteTables, routeTable.RouteTableId, subnetID); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+	}
+	if !available {
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	return reconcile.Result{}, nil
+}
+
+// hasPrivateSubnets is false when all of the spec's subnets are public, there
+// is nothing to route through a NAT gateway
+func hasPrivateSubnets(substrate *v1alpha1.Substrate) bool {
+	for _, subnet := range substrate.Spec.Subnets {
+		if !subnet.Public {
+			return true
+		}
+	}
+	return false
+}
+
+// subnetsByZone returns the public subnet and the private subnets of each zone
+func (n *NATGateway) subnetsByZone(ctx context.Context, substrate *v1alpha1.Substrate) (map[string]*string, map[string][]*string, error) {
+	subnetsOutput, err := n.EC2.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{Filters: discovery.Filters(substrate)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("describing subnets, %w", err)
+	}
+	public := sets.NewString(substrate.Status.Infrastructure.PublicSubnetIDs...)
+	publicSubnets := map[string]*string{}
+	privateSubnets := map[string][]*string{}
+	for _, subnet := range subnetsOutput.Subnets {
+		zone := aws.StringValue(subnet.AvailabilityZone)
+		if public.Has(aws.StringValue(subnet.SubnetId)) {
+			publicSubnets[zone] = subnet.SubnetId
+		} else {
+			privateSubnets[zone] = append(privateSubnets[zone], subnet.SubnetId)
+		}
+	}
+	return publicSubnets, privateSubnets, nil
+}
+
+func (n *NATGateway) ensureNATGateway(ctx context.Context, substrate *v1alpha1.Substrate, zone string, subnetID *string) (*ec2.NatGateway, error) {
+	name := discovery.Name(substrate, zone, "nat")
+	natGatewaysOutput, err := n.EC2.DescribeNatGatewaysWithContext(ctx, &ec2.DescribeNatGatewaysInput{Filter: append(discovery.Filters(substrate, name),
+		&ec2.Filter{Name: aws.String("state"), Values: aws.StringSlice([]string{ec2.NatGatewayStatePending, ec2.NatGatewayStateAvailable})})})
+	if err != nil {
+		return nil, fmt.Errorf("describing nat gateways, %w", err)
+	}
+	if len(natGatewaysOutput.NatGateways) > 0 {
+		logging.FromContext(ctx).Infof("Found NAT gateway %s", aws.StringValue(name))
+		return natGatewaysOutput.NatGateways[0], nil
+	}
+	allocationID, err := n.ensureAddress(ctx, substrate, name)
+	if err != nil {
+		return nil, err
+	}
+	createNatGatewayOutput, err := n.EC2.CreateNatGatewayWithContext(ctx, &ec2.CreateNatGatewayInput{
+		AllocationId:      allocationID,
+		SubnetId:          subnetID,
+		TagSpecifications: discovery.Tags(substrate, ec2.ResourceTypeNatgateway, name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating nat gateway, %w", err)
+	}
+	logging.FromContext(ctx).Infof("Created NAT gateway %s", aws.StringValue(name))
+	return createNatGatewayOutput.NatGateway, nil
+}
+
+// ensureAddress allocates the elastic IP of the NAT gateway, it's named after
+// the NAT gateway so it's not confused with the address of the substrate node
+func (n *NATGateway) ensureAddress(ctx context.Context, substrate *v1alpha1.Substrate, name *string) (*string, error) {
+	addressesOutput, err := n.EC2.DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{Filters: discovery.Filters(substrate, name)})
+	if err != nil {
+		return nil, fmt.Errorf("describing addresses, %w", err)
+	}
+	if len(addressesOutput.Addresses) > 0 {
+		return addressesOutput.Addresses[0].AllocationId, nil
+	}
+	addressOutput, err := n.EC2.AllocateAddressWithContext(ctx, &ec2.AllocateAddressInput{
+		Domain:            aws.String(ec2.DomainTypeVpc),
+		TagSpecifications: discovery.Tags(substrate, ec2.ResourceTypeElasticIp, name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("allocating address, %w", err)
+	}
+	logging.FromContext(ctx).Infof("Created address %s for NAT gateway %s", aws.StringValue(addressOutput.PublicIp), aws.StringValue(name))
+	return addressOutput.AllocationId, nil
+}
+
+func (n *NATGateway) ensureRouteTable(ctx context.Context, substrate *v1alpha1.Substrate, routeTables []*ec2.RouteTable, name *string) (*ec2.RouteTable, error) {
+	for _, routeTable := range routeTables {
+		for _, tag := range routeTable.Tags {
+			if aws.StringValue(tag.Key) == "Name" && aws.StringValue(tag.Value) == aws.StringValue(name) {
+				return routeTable, nil
+			}
+		}
+	}
+	createRouteTableOutput, err := n.EC2.CreateRouteTableWithContext(ctx, &ec2.CreateRouteTableInput{
+		VpcId:             substrate.Status.Infrastructure.VPCID,
+		TagSpecifications: discovery.Tags(substrate, ec2.ResourceTypeRouteTable, name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating route table, %w", err)
+	}
+	logging.FromContext(ctx).Infof("Created route table %s", aws.StringValue(name))
+	return createRouteTableOutput.RouteTable, nil
+}
+
+func (n *NATGateway) ensureRoute(ctx context.Context, routeTableID *string, natGatewayID *string) error {
+	if _, err := n.EC2.CreateRouteWithContext(ctx, &ec2.CreateRouteInput{
+		RouteTableId:         routeTableID,
+		DestinationCidrBlock: aws.String("0.0.0.0/0"),
+		NatGatewayId:         natGatewayID,
+	}); err != nil {
+		if errCode(err) != "RouteAlreadyExists" {
+			return fmt.Errorf("creating route for nat gateway, %w", err)
+		}
+		// The NAT gateway is replaced if it was deleted outside of the substrate
+		if _, err := n.EC2.ReplaceRouteWithContext(ctx, &ec2.ReplaceRouteInput{
+			RouteTableId:         routeTableID,
+			DestinationCidrBlock: aws.String("0.0.0.0/0"),
+			NatGatewayId:         natGatewayID,
+		}); err != nil {
+			return fmt.Errorf("replacing route for nat gateway, %w", err)
+		}
+	}
+	logging.FromContext(ctx).Infof("Ensured route for NAT gateway %s in route table %s", aws.StringValue(natGatewayID), aws.StringValue(routeTableID))
+	return nil
+}
+
+// ensureAssociation moves the private subnet from the shared private route
+// table to the route table of its zone
+func (n *NATGateway) ensureAssociation(ctx context.Context, routeTables []*ec2.RouteTable, routeTableID *string, subnetID *string) error {
+	for _, routeTable := range routeTables {
+		for _, association := range routeTable.Associations {
+			if aws.StringValue(association.SubnetId) != aws.StringValue(subnetID) {
+				continue
+			}
+			if aws.StringValue(routeTable.RouteTableId) == aws.StringValue(routeTableID) {
+				return nil
+			}
+			if _, err := n.EC2.ReplaceRouteTableAssociationWithContext(ctx, &ec2.ReplaceRouteTableAssociationInput{
+				AssociationId: association.RouteTableAssociationId,
+				RouteTableId:  routeTableID,
+			}); err != nil {
+				return fmt.Errorf("replacing route table association, %w", err)
+			}
+			logging.FromContext(ctx).Infof("Replaced association of subnet %s with route table %s", aws.StringValue(subnetID), aws.StringValue(routeTableID))
+			return nil
+		}
+	}
+	if _, err := n.EC2.AssociateRouteTableWithContext(ctx, &ec2.AssociateRouteTableInput{RouteTableId: routeTableID, SubnetId: subnetID}); err != nil {
+		if errCode(err) != "Resource.AlreadyAssociated" {
+			return fmt.Errorf("associating route table with subnet, %w", err)
+		}
+	}
+	logging.FromContext(ctx).Infof("Ensured association of route table %s to subnet %s", aws.StringValue(routeTableID), aws.StringValue(subnetID))
+	return nil
+}
+
+// Delete removes the NAT gateways and releases their addresses once deleted,
+// the route tables are deleted with the rest of the substrate's route tables
+func (n *NATGateway) Delete(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
+	natGatewaysOutput, err := n.EC2.DescribeNatGatewaysWithContext(ctx, &ec2.DescribeNatGatewaysInput{Filter: discovery.Filters(substrate)})
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("describing nat gateways, %w", err)
+	}
+	deleted := true
+	for _, natGateway := range natGatewaysOutput.NatGateways {
+		switch aws.StringValue(natGateway.State) {
+		case ec2.NatGatewayStateDeleted, ec2.NatGatewayStateFailed:
+			for _, address := range natGateway.NatGatewayAddresses {
+				if _, err := n.EC2.ReleaseAddressWithContext(ctx, &ec2.ReleaseAddressInput{AllocationId: address.AllocationId}); err != nil {
+					if errCode(err) != "InvalidAllocationID.NotFound" {
+						return reconcile.Result{}, fmt.Errorf("releasing elastic IP, %w", err)
+					}
+					continue
+				}
+				logging.FromContext(ctx).Infof("Released address %s of NAT gateway %s", aws.StringValue(address.PublicIp), aws.StringValue(natGateway.NatGatewayId))
+			}
+		case ec2.NatGatewayStateDeleting:
+			deleted = false
+		default:
+			if _, err := n.EC2.DeleteNatGatewayWithContext(ctx, &ec2.DeleteNatGatewayInput{NatGatewayId: natGateway.NatGatewayId}); err != nil {
+				return reconcile.Result{}, fmt.Errorf("deleting nat gateway, %w", err)
+			}
+			logging.FromContext(ctx).Infof("Deleted NAT gateway %s", aws.StringValue(natGateway.NatGatewayId))
+			deleted = false
+		}
+	}
+	if !deleted {
+		return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	return reconcile.Result{}, nil
+}
+
+// errCode returns the code of an AWS error, or an empty string for other errors
+func errCode(err error) string {
+	if aerr := awserr.Error(nil); errors.As(err, &aerr) {
+		return aerr.Code()
+	}
+	return ""
+}
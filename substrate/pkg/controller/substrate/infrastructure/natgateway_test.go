@@ -0,0 +1,254 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (f *fakeEC2) DescribeSubnetsWithContext(_ aws.Context, _ *ec2.DescribeSubnetsInput, _ ...request.Option) (*ec2.DescribeSubnetsOutput, error) {
+	return &ec2.DescribeSubnetsOutput{Subnets: f.subnets}, nil
+}
+
+func (f *fakeEC2) DescribeRouteTablesWithContext(_ aws.Context, _ *ec2.DescribeRouteTablesInput, _ ...request.Option) (*ec2.DescribeRouteTablesOutput, error) {
+	for _, routeTable := range f.routeTables {
+		routeTable.Associations = nil
+		for subnet, routeTableID := range f.associations {
+			if routeTableID == aws.StringValue(routeTable.RouteTableId) {
+				routeTable.Associations = append(routeTable.Associations, &ec2.RouteTableAssociation{
+					RouteTableAssociationId: aws.String("rtbassoc-" + subnet), SubnetId: aws.String(subnet)})
+			}
+		}
+	}
+	return &ec2.DescribeRouteTablesOutput{RouteTables: f.routeTables}, nil
+}
+
+func (f *fakeEC2) DescribeNatGatewaysWithContext(_ aws.Context, _ *ec2.DescribeNatGatewaysInput, _ ...request.Option) (*ec2.DescribeNatGatewaysOutput, error) {
+	return &ec2.DescribeNatGatewaysOutput{}, nil
+}
+
+func (f *fakeEC2) DescribeAddressesWithContext(_ aws.Context, _ *ec2.DescribeAddressesInput, _ ...request.Option) (*ec2.DescribeAddressesOutput, error) {
+	return &ec2.DescribeAddressesOutput{}, nil
+}
+
+func (f *fakeEC2) AllocateAddressWithContext(_ aws.Context, _ *ec2.AllocateAddressInput, _ ...request.Option) (*ec2.AllocateAddressOutput, error) {
+	return &ec2.AllocateAddressOutput{AllocationId: aws.String(fmt.Sprintf("eipalloc-%d", len(f.natGateways)))}, nil
+}
+
+func (f *fakeEC2) CreateNatGatewayWithContext(_ aws.Context, input *ec2.CreateNatGatewayInput, _ ...request.Option) (*ec2.CreateNatGatewayOutput, error) {
+	natGateway := &ec2.NatGateway{
+		NatGatewayId: aws.String("nat-" + aws.StringValue(input.SubnetId)),
+		SubnetId:     input.SubnetId,
+		State:        aws.String(ec2.NatGatewayStateAvailable),
+	}
+	f.natGateways = append(f.natGateways, natGateway)
+	return &ec2.CreateNatGatewayOutput{NatGateway: natGateway}, nil
+}
+
+func (f *fakeEC2) CreateRouteTableWithContext(_ aws.Context, input *ec2.CreateRouteTableInput, _ ...request.Option) (*ec2.CreateRouteTableOutput, error) {
+	routeTable := &ec2.RouteTable{RouteTableId: aws.String("rtb-" + aws.StringValue(input.TagSpecifications[0].Tags[1].Value)), Tags: input.TagSpecifications[0].Tags}
+	f.routeTables = append(f.routeTables, routeTable)
+	return &ec2.CreateRouteTableOutput{RouteTable: routeTable}, nil
+}
+
+func (f *fakeEC2) CreateRouteWithContext(_ aws.Context, input *ec2.CreateRouteInput, _ ...request.Option) (*ec2.CreateRouteOutput, error) {
+	f.routes[aws.StringValue(input.RouteTableId)] = aws.StringValue(input.NatGatewayId)
+	return &ec2.CreateRouteOutput{}, nil
+}
+
+func (f *fakeEC2) ReplaceRouteTableAssociationWithContext(_ aws.Context, input *ec2.ReplaceRouteTableAssociationInput, _ ...request.Option) (*ec2.ReplaceRouteTableAssociationOutput, error) {
+	f.associations[aws.StringValue(input.AssociationId)[len("rtbassoc-"):]] = aws.StringValue(input.RouteTableId)
+	return &ec2.ReplaceRouteTableAssociationOutput{}, nil
+}
+
+// natGatewayFixture has a public and private subnet in two zones, with the
+// private subnets associated to the shared private route table
+func natGatewayFixture(strategy string) (*fakeEC2, *v1alpha1.Substrate) {
+	fake := &fakeEC2{
+		subnets: []*ec2.Subnet{
+			{SubnetId: aws.String("subnet-public-a"), AvailabilityZone: aws.String("us-west-2a")},
+			{SubnetId: aws.String("subnet-public-b"), AvailabilityZone: aws.String("us-west-2b")},
+			{SubnetId: aws.String("subnet-private-a"), AvailabilityZone: aws.String("us-west-2a")},
+			{SubnetId: aws.String("subnet-private-b"), AvailabilityZone: aws.String("us-west-2b")},
+		},
+		routeTables: []*ec2.RouteTable{
+			{RouteTableId: aws.String("rtb-public"), Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("kit-test-substrate-public")}}},
+			{RouteTableId: aws.String("rtb-private"), Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("kit-test-substrate-private")}}},
+		},
+		routes: map[string]string{},
+		associations: map[string]string{
+			"subnet-public-a":  "rtb-public",
+			"subnet-public-b":  "rtb-public",
+			"subnet-private-a": "rtb-private",
+			"subnet-private-b": "rtb-private",
+		},
+	}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec: v1alpha1.SubstrateSpec{
+			NATGateway: strategy,
+			Subnets: []*v1alpha1.SubnetSpec{
+				{Zone: "us-west-2a", CIDR: "10.0.0.0/24", Public: true},
+				{Zone: "us-west-2b", CIDR: "10.0.1.0/24", Public: true},
+				{Zone: "us-west-2a", CIDR: "10.0.100.0/24"},
+				{Zone: "us-west-2b", CIDR: "10.0.101.0/24"},
+			},
+		},
+		Status: v1alpha1.SubstrateStatus{Infrastructure: v1alpha1.InfrastructureStatus{
+			VPCID:               aws.String("vpc-1234"),
+			PublicRouteTableID:  aws.String("rtb-public"),
+			PrivateRouteTableID: aws.String("rtb-private"),
+			PublicSubnetIDs:     []string{"subnet-public-a", "subnet-public-b"},
+			PrivateSubnetIDs:    []string{"subnet-private-a", "subnet-private-b"},
+		}},
+	}
+	return fake, substrate
+}
+
+func TestNATGatewaySingle(t *testing.T) {
+	fake, substrate := natGatewayFixture(v1alpha1.NATGatewaySingle)
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if _, err := (&NATGateway{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating nat gateway, %v", err)
+	}
+	if expected := []string{"nat-subnet-public-a"}; !reflect.DeepEqual(substrate.Status.Infrastructure.NATGatewayIDs, expected) {
+		t.Errorf("expected nat gateways %v, got %v", expected, substrate.Status.Infrastructure.NATGatewayIDs)
+	}
+	// The shared private route table routes through the NAT gateway, the public route table is untouched
+	if expected := map[string]string{"rtb-private": "nat-subnet-public-a"}; !reflect.DeepEqual(fake.routes, expected) {
+		t.Errorf("expected routes %v, got %v", expected, fake.routes)
+	}
+	for _, subnet := range []string{"subnet-private-a", "subnet-private-b"} {
+		if routeTable := fake.associations[subnet]; routeTable != "rtb-private" {
+			t.Errorf("expected %s to be associated with rtb-private, got %s", subnet, routeTable)
+		}
+	}
+}
+
+func TestNATGatewaySubnetsNotDescribed(t *testing.T) {
+	for _, strategy := range []string{v1alpha1.NATGatewaySingle, v1alpha1.NATGatewayPerAZ} {
+		fake, substrate := natGatewayFixture(strategy)
+		fake.subnets = nil
+		result, err := (&NATGateway{EC2: fake}).Create(context.Background(), substrate)
+		if err != nil {
+			t.Fatalf("creating nat gateway, %v", err)
+		}
+		if !result.Requeue {
+			t.Errorf("expected %s to requeue until the subnets are described", strategy)
+		}
+		if len(substrate.Status.Infrastructure.NATGatewayIDs) != 0 {
+			t.Errorf("expected no nat gateways, got %v", substrate.Status.Infrastructure.NATGatewayIDs)
+		}
+	}
+}
+
+func TestNATGatewayPerAZ(t *testing.T) {
+	fake, substrate := natGatewayFixture(v1alpha1.NATGatewayPerAZ)
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if _, err := (&NATGateway{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating nat gateways, %v", err)
+	}
+	if expected := []string{"nat-subnet-public-a", "nat-subnet-public-b"}; !reflect.DeepEqual(substrate.Status.Infrastructure.NATGatewayIDs, expected) {
+		t.Errorf("expected nat gateways %v, got %v", expected, substrate.Status.Infrastructure.NATGatewayIDs)
+	}
+	// Each zone's private subnet is moved to a route table through the NAT gateway in its zone
+	if expected := map[string]string{
+		"rtb-kit-test-substrate-us-west-2a-private": "nat-subnet-public-a",
+		"rtb-kit-test-substrate-us-west-2b-private": "nat-subnet-public-b",
+	}; !reflect.DeepEqual(fake.routes, expected) {
+		t.Errorf("expected routes %v, got %v", expected, fake.routes)
+	}
+	if expected := map[string]string{
+		"subnet-public-a":  "rtb-public",
+		"subnet-public-b":  "rtb-public",
+		"subnet-private-a": "rtb-kit-test-substrate-us-west-2a-private",
+		"subnet-private-b": "rtb-kit-test-substrate-us-west-2b-private",
+	}; !reflect.DeepEqual(fake.associations, expected) {
+		t.Errorf("expected associations %v, got %v", expected, fake.associations)
+	}
+}
+
+func TestNATGatewayNone(t *testing.T) {
+	fake, substrate := natGatewayFixture(v1alpha1.NATGatewayNone)
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected none with private subnets to fail validation")
+	}
+	// With only public subnets no NAT gateways or routes are created
+	substrate.Spec.Subnets = substrate.Spec.Subnets[:2]
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if _, err := (&NATGateway{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating nat gateways, %v", err)
+	}
+	if len(fake.natGateways) != 0 || len(fake.routes) != 0 || len(substrate.Status.Infrastructure.NATGatewayIDs) != 0 {
+		t.Errorf("expected no nat gateways or routes, got %v, %v", fake.natGateways, fake.routes)
+	}
+}
+
+func TestNATGatewayPublicSubnetsOnly(t *testing.T) {
+	for _, strategy := range []string{v1alpha1.NATGatewaySingle, v1alpha1.NATGatewayPerAZ} {
+		fake, substrate := natGatewayFixture(strategy)
+		substrate.Spec.Subnets = substrate.Spec.Subnets[:2]
+		substrate.Status.Infrastructure.PrivateSubnetIDs = nil
+		if err := substrate.Validate(context.Background()); err == nil {
+			t.Errorf("expected %s with only public subnets to fail validation", strategy)
+		}
+		// Nothing is waited for without private subnets
+		result, err := (&NATGateway{EC2: fake}).Create(context.Background(), substrate)
+		if err != nil {
+			t.Fatalf("creating nat gateways, %v", err)
+		}
+		if result.Requeue || result.RequeueAfter != 0 {
+			t.Errorf("expected %s with only public subnets not to requeue, got %v", strategy, result)
+		}
+		if len(fake.natGateways) != 0 {
+			t.Errorf("expected no nat gateways, got %v", fake.natGateways)
+		}
+	}
+}
+
+func TestNATGatewayDefaults(t *testing.T) {
+	_, substrate := natGatewayFixture("")
+	substrate.SetDefaults(context.Background())
+	if substrate.Spec.NATGateway != v1alpha1.NATGatewaySingle {
+		t.Errorf("expected private subnets to default to %s, got %s", v1alpha1.NATGatewaySingle, substrate.Spec.NATGateway)
+	}
+	_, substrate = natGatewayFixture("")
+	substrate.Spec.Subnets = substrate.Spec.Subnets[:2]
+	substrate.SetDefaults(context.Background())
+	if substrate.Spec.NATGateway != v1alpha1.NATGatewayNone {
+		t.Errorf("expected public subnets to default to %s, got %s", v1alpha1.NATGatewayNone, substrate.Spec.NATGateway)
+	}
+	// per-az needs a public subnet in every zone with a private subnet
+	_, substrate = natGatewayFixture(v1alpha1.NATGatewayPerAZ)
+	substrate.Spec.Subnets = substrate.Spec.Subnets[1:]
+	if err := substrate.Validate(context.Background()); err == nil {
+		t.Errorf("expected per-az without a public subnet in us-west-2a to fail validation")
+	}
+}
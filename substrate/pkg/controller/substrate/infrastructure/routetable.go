@@ -49,7 +49,7 @@ func (r *RouteTable) Create(ctx context.Context, substrate *v1alpha1.Substrate)
 }
 
 func (r *RouteTable) ensure(ctx context.Context, substrate *v1alpha1.Substrate, name *string) (*ec2.RouteTable, error) {
-	describeRouteTablesOutput, err := r.EC2.DescribeRouteTablesWithContext(ctx, &ec2.DescribeRouteTablesInput{Filters: discovery.Filters(substrate, discovery.Name(substrate))})
+	describeRouteTablesOutput, err := r.EC2.DescribeRouteTablesWithContext(ctx, &ec2.DescribeRouteTablesInput{Filters: discovery.Filters(substrate, name)})
 	if err != nil {
 		return nil, fmt.Errorf("describing route tables, %w", err)
 	}
@@ -59,7 +59,7 @@ func (r *RouteTable) ensure(ctx context.Context, substrate *v1alpha1.Substrate,
 	}
 	createRouteTableOutput, err := r.EC2.CreateRouteTableWithContext(ctx, &ec2.CreateRouteTableInput{
 		VpcId:             substrate.Status.Infrastructure.VPCID,
-		TagSpecifications: discovery.Tags(substrate, ec2.ResourceTypeRouteTable, discovery.Name(substrate)),
+		TagSpecifications: discovery.Tags(substrate, ec2.ResourceTypeRouteTable, name),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("creating route table, %w", err)
@@ -17,10 +17,12 @@ package infrastructure
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
 	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
 	"knative.dev/pkg/logging"
@@ -28,9 +30,12 @@ import (
 )
 
 type SecurityGroup struct {
-	EC2 *ec2.EC2
+	EC2 ec2iface.EC2API
 }
 
+// allowAll is the egress rule EC2 adds to new security groups
+var allowAll = &ec2.IpPermission{IpProtocol: aws.String("-1"), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}}
+
 func (s *SecurityGroup) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
 	if substrate.Status.Infrastructure.VPCID == nil {
 		return reconcile.Result{Requeue: true}, nil
@@ -40,23 +45,171 @@ func (s *SecurityGroup) Create(ctx context.Context, substrate *v1alpha1.Substrat
 		return reconcile.Result{}, err
 	}
 	substrate.Status.Infrastructure.SecurityGroupID = securityGroup.GroupId
-	if _, err := s.EC2.AuthorizeSecurityGroupIngressWithContext(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
-		GroupId: securityGroup.GroupId,
-		IpPermissions: []*ec2.IpPermission{{
-			IpProtocol: aws.String("tcp"),
-			FromPort:   aws.Int64(443),
-			ToPort:     aws.Int64(443),
-			IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
-		}},
+	if err := s.ensureIngress(ctx, substrate, securityGroup); err != nil {
+		return reconcile.Result{}, err
+	}
+	if err := s.ensureEgress(ctx, substrate, securityGroup); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
+
+// ensureIngress allows the API server port and revokes the other ingress
+// rules, i.e. the rule for the previous port when the port changes. The new
+// rule is authorized before the old one is revoked.
+func (s *SecurityGroup) ensureIngress(ctx context.Context, substrate *v1alpha1.Substrate, securityGroup *ec2.SecurityGroup) error {
+	apiServer := &ec2.IpPermission{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(int64(substrate.APIServerPort())),
+		ToPort:     aws.Int64(int64(substrate.APIServerPort())),
+		IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+	}
+	extra := map[string]*ec2.IpPermission{}
+	for _, permission := range flattenPermissions(securityGroup.IpPermissions) {
+		extra[permissionKey(permission)] = permission
+	}
+	if _, ok := extra[permissionKey(apiServer)]; ok {
+		delete(extra, permissionKey(apiServer))
+		logging.FromContext(ctx).Infof("Found ingress rules for security group %s", aws.StringValue(discovery.Name(substrate)))
+	} else if _, err := s.EC2.AuthorizeSecurityGroupIngressWithContext(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       securityGroup.GroupId,
+		IpPermissions: []*ec2.IpPermission{apiServer},
 	}); err != nil {
-		if err.(awserr.Error).Code() != "InvalidPermission.Duplicate" {
-			return reconcile.Result{}, fmt.Errorf("authorizing security group ingress, %w", err)
+		if errCode(err) != "InvalidPermission.Duplicate" {
+			return fmt.Errorf("authorizing security group ingress, %w", err)
 		}
 		logging.FromContext(ctx).Infof("Found ingress rules for security group %s", aws.StringValue(discovery.Name(substrate)))
 	} else {
 		logging.FromContext(ctx).Infof("Created ingress rules for security group %s", aws.StringValue(discovery.Name(substrate)))
 	}
-	return reconcile.Result{}, nil
+	keys := []string{}
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := s.EC2.RevokeSecurityGroupIngressWithContext(ctx, &ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       securityGroup.GroupId,
+			IpPermissions: []*ec2.IpPermission{extra[key]},
+		}); err != nil {
+			if errCode(err) != "InvalidPermission.NotFound" {
+				return fmt.Errorf("revoking security group ingress, %w", err)
+			}
+			continue
+		}
+		logging.FromContext(ctx).Infof("Revoked ingress rule %s for security group %s", extra[key].String(), aws.StringValue(discovery.Name(substrate)))
+	}
+	return nil
+}
+
+// ensureEgress converges the group's egress on the substrate's egress rules,
+// or on the default allow-all when there are none. Missing rules are
+// authorized before the extras are revoked so the node doesn't lose access in
+// between
+func (s *SecurityGroup) ensureEgress(ctx context.Context, substrate *v1alpha1.Substrate, securityGroup *ec2.SecurityGroup) error {
+	desired := egressPermissions(substrate.Spec.Egress)
+	if len(desired) == 0 {
+		desired = []*ec2.IpPermission{allowAll}
+	}
+	extra := map[string]*ec2.IpPermission{}
+	for _, permission := range flattenPermissions(securityGroup.IpPermissionsEgress) {
+		extra[permissionKey(permission)] = permission
+	}
+	// Rules are authorized one at a time, a duplicate fails the whole request
+	for _, permission := range desired {
+		if _, ok := extra[permissionKey(permission)]; ok {
+			delete(extra, permissionKey(permission))
+			continue
+		}
+		if _, err := s.EC2.AuthorizeSecurityGroupEgressWithContext(ctx, &ec2.AuthorizeSecurityGroupEgressInput{
+			GroupId:       securityGroup.GroupId,
+			IpPermissions: []*ec2.IpPermission{permission},
+		}); err != nil {
+			if errCode(err) != "InvalidPermission.Duplicate" {
+				return fmt.Errorf("authorizing security group egress, %w", err)
+			}
+			continue
+		}
+		logging.FromContext(ctx).Infof("Created egress rule %s for security group %s", permission.String(), aws.StringValue(discovery.Name(substrate)))
+	}
+	keys := []string{}
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := s.EC2.RevokeSecurityGroupEgressWithContext(ctx, &ec2.RevokeSecurityGroupEgressInput{
+			GroupId:       securityGroup.GroupId,
+			IpPermissions: []*ec2.IpPermission{extra[key]},
+		}); err != nil {
+			if errCode(err) != "InvalidPermission.NotFound" {
+				return fmt.Errorf("revoking security group egress, %w", err)
+			}
+			continue
+		}
+		logging.FromContext(ctx).Infof("Revoked egress rule %s for security group %s", extra[key].String(), aws.StringValue(discovery.Name(substrate)))
+	}
+	return nil
+}
+
+// flattenPermissions splits the permissions EC2 describes, which group every
+// range sharing a protocol and ports, into one permission per IPv4 range or
+// prefix list. IPv6 ranges aren't managed by the substrate and are left alone
+func flattenPermissions(permissions []*ec2.IpPermission) []*ec2.IpPermission {
+	flattened := []*ec2.IpPermission{}
+	for _, permission := range permissions {
+		for _, ipRange := range permission.IpRanges {
+			flattened = append(flattened, &ec2.IpPermission{
+				IpProtocol: permission.IpProtocol, FromPort: permission.FromPort, ToPort: permission.ToPort,
+				IpRanges: []*ec2.IpRange{{CidrIp: ipRange.CidrIp}},
+			})
+		}
+		for _, prefixList := range permission.PrefixListIds {
+			flattened = append(flattened, &ec2.IpPermission{
+				IpProtocol: permission.IpProtocol, FromPort: permission.FromPort, ToPort: permission.ToPort,
+				PrefixListIds: []*ec2.PrefixListId{{PrefixListId: prefixList.PrefixListId}},
+			})
+		}
+	}
+	return flattened
+}
+
+// permissionKey identifies a permission with a single range or prefix list,
+// EC2 omits the ports of rules allowing every protocol
+func permissionKey(permission *ec2.IpPermission) string {
+	destination := ""
+	if len(permission.IpRanges) > 0 {
+		destination = aws.StringValue(permission.IpRanges[0].CidrIp)
+	} else if len(permission.PrefixListIds) > 0 {
+		destination = aws.StringValue(permission.PrefixListIds[0].PrefixListId)
+	}
+	if aws.StringValue(permission.IpProtocol) == "-1" {
+		return fmt.Sprintf("-1/%s", destination)
+	}
+	return fmt.Sprintf("%s/%d-%d/%s", aws.StringValue(permission.IpProtocol), aws.Int64Value(permission.FromPort), aws.Int64Value(permission.ToPort), destination)
+}
+
+func egressPermissions(rules []v1alpha1.EgressRuleSpec) []*ec2.IpPermission {
+	permissions := []*ec2.IpPermission{}
+	for _, rule := range rules {
+		permission := &ec2.IpPermission{IpProtocol: aws.String(v1alpha1.EgressProtocolTCP), FromPort: aws.Int64(0), ToPort: aws.Int64(65535)}
+		switch rule.Protocol {
+		case v1alpha1.EgressProtocolAll:
+			permission = &ec2.IpPermission{IpProtocol: aws.String("-1")}
+		case v1alpha1.EgressProtocolUDP:
+			permission.IpProtocol = aws.String(v1alpha1.EgressProtocolUDP)
+		}
+		if rule.Port != nil {
+			permission.FromPort, permission.ToPort = rule.Port, rule.Port
+		}
+		if rule.CIDR != "" {
+			permission.IpRanges = []*ec2.IpRange{{CidrIp: aws.String(rule.CIDR)}}
+		} else {
+			permission.PrefixListIds = []*ec2.PrefixListId{{PrefixListId: aws.String(rule.PrefixListID)}}
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions
 }
 
 func (s *SecurityGroup) ensure(ctx context.Context, substrate *v1alpha1.Substrate) (*ec2.SecurityGroup, error) {
@@ -78,7 +231,7 @@ func (s *SecurityGroup) ensure(ctx context.Context, substrate *v1alpha1.Substrat
 		return nil, fmt.Errorf("creating security group, %w", err)
 	}
 	logging.FromContext(ctx).Infof("Created security group %s", aws.StringValue(createSecurityGroupOutput.GroupId))
-	return &ec2.SecurityGroup{GroupId: createSecurityGroupOutput.GroupId}, nil
+	return &ec2.SecurityGroup{GroupId: createSecurityGroupOutput.GroupId, IpPermissionsEgress: []*ec2.IpPermission{allowAll}}, nil
 }
 
 func (s *SecurityGroup) Delete(ctx context.Context, substrate *v1alpha1.Substrate) (reconcile.Result, error) {
@@ -0,0 +1,167 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infrastructure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/awslabs/kit/substrate/pkg/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (f *fakeEC2) DescribeSecurityGroups(_ *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
+	return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: []*ec2.SecurityGroup{{
+		GroupId: aws.String("sg-1234"), IpPermissions: f.securityGroupIngress, IpPermissionsEgress: f.securityGroupEgress,
+	}}}, nil
+}
+
+func (f *fakeEC2) AuthorizeSecurityGroupIngressWithContext(_ aws.Context, input *ec2.AuthorizeSecurityGroupIngressInput, _ ...request.Option) (*ec2.AuthorizeSecurityGroupIngressOutput, error) {
+	f.ingress = append(f.ingress, input.IpPermissions...)
+	return &ec2.AuthorizeSecurityGroupIngressOutput{}, nil
+}
+
+func (f *fakeEC2) RevokeSecurityGroupIngressWithContext(_ aws.Context, input *ec2.RevokeSecurityGroupIngressInput, _ ...request.Option) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	f.revokedIngress = append(f.revokedIngress, input.IpPermissions...)
+	return &ec2.RevokeSecurityGroupIngressOutput{}, nil
+}
+
+func (f *fakeEC2) AuthorizeSecurityGroupEgressWithContext(_ aws.Context, input *ec2.AuthorizeSecurityGroupEgressInput, _ ...request.Option) (*ec2.AuthorizeSecurityGroupEgressOutput, error) {
+	f.egress = append(f.egress, input.IpPermissions...)
+	return &ec2.AuthorizeSecurityGroupEgressOutput{}, nil
+}
+
+func (f *fakeEC2) RevokeSecurityGroupEgressWithContext(_ aws.Context, input *ec2.RevokeSecurityGroupEgressInput, _ ...request.Option) (*ec2.RevokeSecurityGroupEgressOutput, error) {
+	f.revokedEgress = append(f.revokedEgress, input.IpPermissions...)
+	return &ec2.RevokeSecurityGroupEgressOutput{}, nil
+}
+
+func TestSecurityGroupEgress(t *testing.T) {
+	fake := &fakeEC2{securityGroupEgress: []*ec2.IpPermission{allowAll}}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec: v1alpha1.SubstrateSpec{Egress: []v1alpha1.EgressRuleSpec{
+			{PrefixListID: "pl-63a5400a", Port: aws.Int64(443)},
+			{CIDR: "10.0.0.0/8", Port: aws.Int64(3128)},
+		}},
+		Status: v1alpha1.SubstrateStatus{Infrastructure: v1alpha1.InfrastructureStatus{VPCID: aws.String("vpc-1234")}},
+	}
+	if err := substrate.Validate(context.Background()); err != nil {
+		t.Fatalf("validating substrate, %v", err)
+	}
+	if _, err := (&SecurityGroup{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating security group, %v", err)
+	}
+	if len(fake.egress) != 2 {
+		t.Fatalf("expected 2 egress rules, got %v", fake.egress)
+	}
+	if id := aws.StringValue(fake.egress[0].PrefixListIds[0].PrefixListId); id != "pl-63a5400a" || aws.Int64Value(fake.egress[0].FromPort) != 443 {
+		t.Errorf("expected tcp/443 to pl-63a5400a, got %v", fake.egress[0])
+	}
+	if cidr := aws.StringValue(fake.egress[1].IpRanges[0].CidrIp); cidr != "10.0.0.0/8" || aws.Int64Value(fake.egress[1].ToPort) != 3128 {
+		t.Errorf("expected tcp/3128 to 10.0.0.0/8, got %v", fake.egress[1])
+	}
+	if len(fake.revokedEgress) != 1 || aws.StringValue(fake.revokedEgress[0].IpRanges[0].CidrIp) != "0.0.0.0/0" || aws.StringValue(fake.revokedEgress[0].IpProtocol) != "-1" {
+		t.Errorf("expected the default allow-all egress to be revoked, got %v", fake.revokedEgress)
+	}
+}
+
+func TestSecurityGroupEgressDefault(t *testing.T) {
+	fake := &fakeEC2{securityGroupEgress: []*ec2.IpPermission{allowAll}}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Status:     v1alpha1.SubstrateStatus{Infrastructure: v1alpha1.InfrastructureStatus{VPCID: aws.String("vpc-1234")}},
+	}
+	if _, err := (&SecurityGroup{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating security group, %v", err)
+	}
+	if len(fake.egress) != 0 || len(fake.revokedEgress) != 0 {
+		t.Errorf("expected the default egress to be kept, got %v, revoked %v", fake.egress, fake.revokedEgress)
+	}
+}
+
+func TestSecurityGroupEgressRemoved(t *testing.T) {
+	// EC2 groups the rules sharing a protocol and ports
+	fake := &fakeEC2{securityGroupEgress: []*ec2.IpPermission{{
+		IpProtocol:    aws.String("tcp"),
+		FromPort:      aws.Int64(443),
+		ToPort:        aws.Int64(443),
+		IpRanges:      []*ec2.IpRange{{CidrIp: aws.String("10.0.0.0/8")}},
+		PrefixListIds: []*ec2.PrefixListId{{PrefixListId: aws.String("pl-63a5400a")}},
+	}}}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{Egress: []v1alpha1.EgressRuleSpec{{PrefixListID: "pl-63a5400a", Port: aws.Int64(443)}}},
+		Status:     v1alpha1.SubstrateStatus{Infrastructure: v1alpha1.InfrastructureStatus{VPCID: aws.String("vpc-1234")}},
+	}
+	if _, err := (&SecurityGroup{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating security group, %v", err)
+	}
+	if len(fake.egress) != 0 {
+		t.Errorf("expected no egress rules to be authorized, got %v", fake.egress)
+	}
+	if len(fake.revokedEgress) != 1 || aws.StringValue(fake.revokedEgress[0].IpRanges[0].CidrIp) != "10.0.0.0/8" || len(fake.revokedEgress[0].PrefixListIds) != 0 {
+		t.Errorf("expected tcp/443 to 10.0.0.0/8 to be revoked, got %v", fake.revokedEgress)
+	}
+
+	// Clearing the egress restores the default allow-all
+	fake = &fakeEC2{securityGroupEgress: egressPermissions(substrate.Spec.Egress)}
+	substrate.Spec.Egress = nil
+	if _, err := (&SecurityGroup{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating security group, %v", err)
+	}
+	if len(fake.egress) != 1 || aws.StringValue(fake.egress[0].IpProtocol) != "-1" || aws.StringValue(fake.egress[0].IpRanges[0].CidrIp) != "0.0.0.0/0" {
+		t.Errorf("expected the default allow-all egress to be authorized, got %v", fake.egress)
+	}
+	if len(fake.revokedEgress) != 1 || aws.StringValue(fake.revokedEgress[0].PrefixListIds[0].PrefixListId) != "pl-63a5400a" {
+		t.Errorf("expected tcp/443 to pl-63a5400a to be revoked, got %v", fake.revokedEgress)
+	}
+}
+
+func TestSecurityGroupIngressPortChanged(t *testing.T) {
+	// The group allows the previous API server port
+	fake := &fakeEC2{securityGroupIngress: []*ec2.IpPermission{{
+		IpProtocol: aws.String("tcp"),
+		FromPort:   aws.Int64(443),
+		ToPort:     aws.Int64(443),
+		IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+	}}, securityGroupEgress: []*ec2.IpPermission{allowAll}}
+	substrate := &v1alpha1.Substrate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-substrate"},
+		Spec:       v1alpha1.SubstrateSpec{APIServerPort: aws.Int32(6443)},
+		Status:     v1alpha1.SubstrateStatus{Infrastructure: v1alpha1.InfrastructureStatus{VPCID: aws.String("vpc-1234")}},
+	}
+	if _, err := (&SecurityGroup{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating security group, %v", err)
+	}
+	if len(fake.ingress) != 1 || aws.Int64Value(fake.ingress[0].FromPort) != 6443 || aws.Int64Value(fake.ingress[0].ToPort) != 6443 {
+		t.Errorf("expected tcp/6443 to be authorized, got %v", fake.ingress)
+	}
+	if len(fake.revokedIngress) != 1 || aws.Int64Value(fake.revokedIngress[0].FromPort) != 443 {
+		t.Errorf("expected tcp/443 to be revoked, got %v", fake.revokedIngress)
+	}
+
+	// An unchanged port leaves the ingress alone
+	fake = &fakeEC2{securityGroupIngress: fake.ingress, securityGroupEgress: []*ec2.IpPermission{allowAll}}
+	if _, err := (&SecurityGroup{EC2: fake}).Create(context.Background(), substrate); err != nil {
+		t.Fatalf("creating security group, %v", err)
+	}
+	if len(fake.ingress) != 0 || len(fake.revokedIngress) != 0 {
+		t.Errorf("expected the ingress to be kept, got %v, revoked %v", fake.ingress, fake.revokedIngress)
+	}
+}
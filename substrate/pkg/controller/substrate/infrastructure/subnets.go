@@ -37,6 +37,7 @@ func (s *Subnets) Create(ctx context.Context, substrate *v1alpha1.Substrate) (re
 	if substrate.Status.Infrastructure.VPCID == nil ||
 		substrate.Status.Infrastructure.PrivateRouteTableID == nil ||
 		substrate.Status.Infrastructure.PublicRouteTableID == nil {
+		substrate.StatusConditions().MarkUnknown(v1alpha1.ConditionSubnetsReady, "WaitingForRouteTables", "waiting for the VPC and its route tables")
 		return reconcile.Result{Requeue: true}, nil
 	}
 	subnets := make([]*ec2.Subnet, len(substrate.Spec.Subnets))
@@ -59,6 +60,7 @@ func (s *Subnets) Create(ctx context.Context, substrate *v1alpha1.Substrate) (re
 				aws.StringValue(subnet.SubnetId))
 		}
 	}
+	substrate.StatusConditions().MarkTrue(v1alpha1.ConditionSubnetsReady)
 	return reconcile.Result{}, nil
 }
 
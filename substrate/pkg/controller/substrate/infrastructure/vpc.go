@@ -39,6 +39,7 @@ func (v *VPC) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconc
 	if len(describeVpcsOutput.Vpcs) > 0 {
 		substrate.Status.Infrastructure.VPCID = describeVpcsOutput.Vpcs[0].VpcId
 		logging.FromContext(ctx).Infof("Found vpc %s", aws.StringValue(substrate.Status.Infrastructure.VPCID))
+		substrate.StatusConditions().MarkTrue(v1alpha1.ConditionVPCReady)
 		return reconcile.Result{}, nil
 	}
 	createVpcOutput, err := v.EC2.CreateVpc(&ec2.CreateVpcInput{
@@ -50,6 +51,7 @@ func (v *VPC) Create(ctx context.Context, substrate *v1alpha1.Substrate) (reconc
 	}
 	substrate.Status.Infrastructure.VPCID = createVpcOutput.Vpc.VpcId
 	logging.FromContext(ctx).Infof("Created vpc %s", aws.StringValue(substrate.Status.Infrastructure.VPCID))
+	substrate.StatusConditions().MarkTrue(v1alpha1.ConditionVPCReady)
 	return reconcile.Result{}, err
 }
 
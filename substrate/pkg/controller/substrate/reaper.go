@@ -0,0 +1,338 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package substrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi/resourcegroupstaggingapiiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+	"go.uber.org/multierr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"knative.dev/pkg/logging"
+)
+
+// Reaper deletes the AWS resources tagged as owned by a substrate without
+// the substrate, so resources missing from a lost or corrupted status can
+// still be cleaned up. Resources are found with the regional tagging API,
+// global resources like the instance profile aren't reaped.
+type Reaper struct {
+	Tagging resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI
+	EC2     ec2iface.EC2API
+	ELBV2   elbv2iface.ELBV2API
+	S3      s3iface.S3API
+	// DryRun logs the resources that would be deleted without deleting them
+	DryRun bool
+}
+
+func NewReaper(ctx context.Context) *Reaper {
+	session := session.Must(session.NewSession(&aws.Config{STSRegionalEndpoint: endpoints.RegionalSTSEndpoint}))
+	session.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler("kit.sh"))
+	return &Reaper{
+		Tagging: resourcegroupstaggingapi.New(session),
+		EC2:     ec2.New(session),
+		ELBV2:   elbv2.New(session),
+		S3:      s3.New(session),
+	}
+}
+
+// resourceKind is the service and resource type of a resource's ARN
+type resourceKind struct {
+	service      string
+	resourceType string
+}
+
+// reapStep deletes the resources of one kind, the steps are run in order so
+// resources are deleted before the resources they depend on
+type reapStep struct {
+	resourceKind
+	delete func(r *Reaper, ctx context.Context, ids []string) error
+}
+
+var reapSteps = []reapStep{
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeInstance}, delete: (*Reaper).terminateInstances},
+	{resourceKind: resourceKind{elbv2.ServiceName, "loadbalancer"}, delete: (*Reaper).deleteLoadBalancers},
+	{resourceKind: resourceKind{elbv2.ServiceName, "targetgroup"}, delete: (*Reaper).deleteTargetGroups},
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeLaunchTemplate}, delete: (*Reaper).deleteLaunchTemplates},
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeVpcFlowLog}, delete: (*Reaper).deleteFlowLogs},
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeNatgateway}, delete: (*Reaper).deleteNATGateways},
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeElasticIp}, delete: (*Reaper).releaseAddresses},
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeSecurityGroup}, delete: (*Reaper).deleteSecurityGroups},
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeSubnet}, delete: (*Reaper).deleteSubnets},
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeRouteTable}, delete: (*Reaper).deleteRouteTables},
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeInternetGateway}, delete: (*Reaper).deleteInternetGateways},
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeVpc}, delete: (*Reaper).deleteVPCs},
+	{resourceKind: resourceKind{ec2.ServiceName, ec2.ResourceTypeDhcpOptions}, delete: (*Reaper).deleteDHCPOptions},
+	{resourceKind: resourceKind{s3.ServiceName, "bucket"}, delete: (*Reaper).deleteBuckets},
+}
+
+// dependencyBackoff retries deleting a resource while the resources depending
+// on it are still being deleted, i.e. the network interfaces of terminated
+// instances or the address of a deleted NAT gateway
+var dependencyBackoff = wait.Backoff{Duration: 5 * time.Second, Factor: 1.5, Steps: 10, Cap: time.Minute}
+
+// Reap deletes the resources tagged as owned by the substrate, returning the
+// ARNs of the resources found. Deleting stops at the first resource type that
+// fails, reaping again continues from the remaining resources.
+func (r *Reaper) Reap(ctx context.Context, substrateName string) ([]string, error) {
+	arns, err := r.discover(ctx, substrateName)
+	if err != nil {
+		return nil, err
+	}
+	resources := map[resourceKind][]string{}
+	for _, resourceARN := range arns {
+		kind, id, ok := resourceKindFor(resourceARN)
+		if !ok {
+			logging.FromContext(ctx).Infof("Skipping unsupported resource %s", resourceARN)
+			continue
+		}
+		resources[kind] = append(resources[kind], id)
+	}
+	for _, step := range reapSteps {
+		ids := resources[step.resourceKind]
+		if len(ids) == 0 {
+			continue
+		}
+		if r.DryRun {
+			logging.FromContext(ctx).Infof("Would delete %s %s", step.resourceType, strings.Join(ids, ", "))
+			continue
+		}
+		if err := step.delete(r, ctx, ids); err != nil {
+			return arns, fmt.Errorf("deleting %s, %w", step.resourceType, err)
+		}
+		logging.FromContext(ctx).Infof("Deleted %s %s", step.resourceType, strings.Join(ids, ", "))
+	}
+	return arns, nil
+}
+
+// discover lists the ARNs of the resources tagged with the substrate's owner tag
+func (r *Reaper) discover(ctx context.Context, substrateName string) (arns []string, err error) {
+	input := &resourcegroupstaggingapi.GetResourcesInput{
+		TagFilters: []*resourcegroupstaggingapi.TagFilter{{
+			Key: aws.String(discovery.OwnerTagKey), Values: []*string{aws.String(substrateName)},
+		}},
+	}
+	for {
+		output, err := r.Tagging.GetResourcesWithContext(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("getting resources tagged %s=%s, %w", discovery.OwnerTagKey, substrateName, err)
+		}
+		for _, mapping := range output.ResourceTagMappingList {
+			arns = append(arns, aws.StringValue(mapping.ResourceARN))
+		}
+		if aws.StringValue(output.PaginationToken) == "" {
+			return arns, nil
+		}
+		input.PaginationToken = output.PaginationToken
+	}
+}
+
+// resourceKindFor returns the kind of the resource and the id it's deleted
+// by, load balancers and target groups are deleted by their ARN
+func resourceKindFor(resourceARN string) (resourceKind, string, bool) {
+	parsed, err := arn.Parse(resourceARN)
+	if err != nil {
+		return resourceKind{}, "", false
+	}
+	kind := resourceKind{service: parsed.Service}
+	id := parsed.Resource
+	switch parsed.Service {
+	case s3.ServiceName:
+		kind.resourceType = "bucket"
+	case elbv2.ServiceName:
+		kind.resourceType = strings.SplitN(parsed.Resource, "/", 2)[0]
+		id = resourceARN
+	default:
+		parts := strings.SplitN(parsed.Resource, "/", 2)
+		if len(parts) != 2 {
+			return resourceKind{}, "", false
+		}
+		kind.resourceType, id = parts[0], parts[1]
+	}
+	for _, step := range reapSteps {
+		if step.resourceKind == kind {
+			return kind, id, true
+		}
+	}
+	return resourceKind{}, "", false
+}
+
+func (r *Reaper) terminateInstances(ctx context.Context, ids []string) error {
+	if _, err := r.EC2.TerminateInstancesWithContext(ctx, &ec2.TerminateInstancesInput{InstanceIds: aws.StringSlice(ids)}); err != nil && !notFound(err) {
+		return err
+	}
+	// The instances' network interfaces are removed once they're terminated
+	return r.EC2.WaitUntilInstanceTerminatedWithContext(ctx, &ec2.DescribeInstancesInput{InstanceIds: aws.StringSlice(ids)})
+}
+
+func (r *Reaper) deleteLoadBalancers(ctx context.Context, arns []string) error {
+	return each(arns, func(id string) error {
+		_, err := r.ELBV2.DeleteLoadBalancerWithContext(ctx, &elbv2.DeleteLoadBalancerInput{LoadBalancerArn: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) deleteTargetGroups(ctx context.Context, arns []string) error {
+	return each(arns, func(id string) error {
+		_, err := r.ELBV2.DeleteTargetGroupWithContext(ctx, &elbv2.DeleteTargetGroupInput{TargetGroupArn: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) deleteLaunchTemplates(ctx context.Context, ids []string) error {
+	return each(ids, func(id string) error {
+		_, err := r.EC2.DeleteLaunchTemplateWithContext(ctx, &ec2.DeleteLaunchTemplateInput{LaunchTemplateId: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) deleteFlowLogs(ctx context.Context, ids []string) error {
+	_, err := r.EC2.DeleteFlowLogsWithContext(ctx, &ec2.DeleteFlowLogsInput{FlowLogIds: aws.StringSlice(ids)})
+	if notFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *Reaper) deleteNATGateways(ctx context.Context, ids []string) error {
+	return each(ids, func(id string) error {
+		_, err := r.EC2.DeleteNatGatewayWithContext(ctx, &ec2.DeleteNatGatewayInput{NatGatewayId: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) releaseAddresses(ctx context.Context, ids []string) error {
+	return each(ids, func(id string) error {
+		_, err := r.EC2.ReleaseAddressWithContext(ctx, &ec2.ReleaseAddressInput{AllocationId: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) deleteSecurityGroups(ctx context.Context, ids []string) error {
+	return each(ids, func(id string) error {
+		_, err := r.EC2.DeleteSecurityGroupWithContext(ctx, &ec2.DeleteSecurityGroupInput{GroupId: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) deleteSubnets(ctx context.Context, ids []string) error {
+	return each(ids, func(id string) error {
+		_, err := r.EC2.DeleteSubnetWithContext(ctx, &ec2.DeleteSubnetInput{SubnetId: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) deleteRouteTables(ctx context.Context, ids []string) error {
+	return each(ids, func(id string) error {
+		_, err := r.EC2.DeleteRouteTableWithContext(ctx, &ec2.DeleteRouteTableInput{RouteTableId: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) deleteInternetGateways(ctx context.Context, ids []string) error {
+	return each(ids, func(id string) error {
+		output, err := r.EC2.DescribeInternetGatewaysWithContext(ctx, &ec2.DescribeInternetGatewaysInput{InternetGatewayIds: []*string{aws.String(id)}})
+		if err != nil {
+			return err
+		}
+		for _, internetGateway := range output.InternetGateways {
+			for _, attachment := range internetGateway.Attachments {
+				if _, err := r.EC2.DetachInternetGatewayWithContext(ctx, &ec2.DetachInternetGatewayInput{
+					InternetGatewayId: aws.String(id), VpcId: attachment.VpcId,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = r.EC2.DeleteInternetGatewayWithContext(ctx, &ec2.DeleteInternetGatewayInput{InternetGatewayId: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) deleteVPCs(ctx context.Context, ids []string) error {
+	return each(ids, func(id string) error {
+		_, err := r.EC2.DeleteVpcWithContext(ctx, &ec2.DeleteVpcInput{VpcId: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) deleteDHCPOptions(ctx context.Context, ids []string) error {
+	return each(ids, func(id string) error {
+		_, err := r.EC2.DeleteDhcpOptionsWithContext(ctx, &ec2.DeleteDhcpOptionsInput{DhcpOptionsId: aws.String(id)})
+		return err
+	})
+}
+
+func (r *Reaper) deleteBuckets(ctx context.Context, buckets []string) error {
+	return each(buckets, func(bucket string) error {
+		if err := s3manager.NewBatchDeleteWithClient(r.S3).Delete(ctx, s3manager.NewDeleteListIterator(
+			r.S3, &s3.ListObjectsInput{Bucket: aws.String(bucket)}),
+		); err != nil {
+			return fmt.Errorf("deleting objects from bucket %s, %w", bucket, err)
+		}
+		_, err := r.S3.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+		return err
+	})
+}
+
+// each deletes the resources, retrying while their dependencies are deleted.
+// Resources that are already gone are ignored, the tagging API lists deleted
+// resources for a while after they're deleted.
+func each(ids []string, f func(id string) error) error {
+	var errs error
+	for _, id := range ids {
+		id := id
+		err := retry.OnError(dependencyBackoff, dependencyViolation, func() error { return f(id) })
+		if err != nil && !notFound(err) {
+			errs = multierr.Append(errs, fmt.Errorf("%s, %w", id, err))
+		}
+	}
+	return errs
+}
+
+func dependencyViolation(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "DependencyViolation", "InvalidIPAddress.InUse", elbv2.ErrCodeResourceInUseException:
+			return true
+		}
+	}
+	return false
+}
+
+func notFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return strings.Contains(aerr.Code(), "NotFound") || aerr.Code() == s3.ErrCodeNoSuchBucket
+	}
+	return false
+}
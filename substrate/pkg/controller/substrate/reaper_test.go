@@ -0,0 +1,89 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package substrate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi/resourcegroupstaggingapiiface"
+	"github.com/awslabs/kit/substrate/pkg/utils/discovery"
+)
+
+// fakeTagging returns a page of the resources for each call
+type fakeTagging struct {
+	resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI
+	pages  [][]string
+	inputs []*resourcegroupstaggingapi.GetResourcesInput
+}
+
+func (f *fakeTagging) GetResourcesWithContext(_ aws.Context, input *resourcegroupstaggingapi.GetResourcesInput, _ ...request.Option) (*resourcegroupstaggingapi.GetResourcesOutput, error) {
+	f.inputs = append(f.inputs, input)
+	page := len(f.inputs) - 1
+	output := &resourcegroupstaggingapi.GetResourcesOutput{}
+	for _, resourceARN := range f.pages[page] {
+		output.ResourceTagMappingList = append(output.ResourceTagMappingList, &resourcegroupstaggingapi.ResourceTagMapping{ResourceARN: aws.String(resourceARN)})
+	}
+	if page < len(f.pages)-1 {
+		output.PaginationToken = aws.String("next")
+	}
+	return output, nil
+}
+
+func TestReapDryRun(t *testing.T) {
+	tagging := &fakeTagging{pages: [][]string{{
+		"arn:aws:ec2:us-west-2:123456789012:vpc/vpc-1234",
+		"arn:aws:ec2:us-west-2:123456789012:subnet/subnet-1234",
+		"arn:aws:ec2:us-west-2:123456789012:instance/i-1234",
+	}, {
+		"arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/net/kit-test-substrate/1234",
+		"arn:aws:s3:::kit-test-substrate",
+		"arn:aws:ec2:us-west-2:123456789012:elastic-ip/eipalloc-1234",
+		"arn:aws:ec2:us-west-2:123456789012:volume/vol-1234",
+	}}}
+	// Reaping with no EC2, ELB or S3 clients fails if anything is deleted
+	reaper := &Reaper{Tagging: tagging, DryRun: true}
+	arns, err := reaper.Reap(context.Background(), "test-substrate")
+	if err != nil {
+		t.Fatalf("reaping, %v", err)
+	}
+	if expected := append(tagging.pages[0], tagging.pages[1]...); !reflect.DeepEqual(arns, expected) {
+		t.Errorf("expected resources %v, got %v", expected, arns)
+	}
+	if len(tagging.inputs) != 2 || aws.StringValue(tagging.inputs[1].PaginationToken) != "next" {
+		t.Errorf("expected both pages of resources to be listed")
+	}
+	filter := tagging.inputs[0].TagFilters[0]
+	if aws.StringValue(filter.Key) != discovery.OwnerTagKey || aws.StringValueSlice(filter.Values)[0] != "test-substrate" {
+		t.Errorf("expected resources tagged %s=test-substrate, got %v", discovery.OwnerTagKey, filter)
+	}
+
+	for resourceARN, expected := range map[string]string{
+		"arn:aws:ec2:us-west-2:123456789012:instance/i-1234":                                           "i-1234",
+		"arn:aws:s3:::kit-test-substrate":                                                              "kit-test-substrate",
+		"arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/net/kit-test-substrate/1234": "arn:aws:elasticloadbalancing:us-west-2:123456789012:loadbalancer/net/kit-test-substrate/1234",
+	} {
+		if _, id, ok := resourceKindFor(resourceARN); !ok || id != expected {
+			t.Errorf("expected %s to be deleted by %s, got %s", resourceARN, expected, id)
+		}
+	}
+	if _, _, ok := resourceKindFor("arn:aws:ec2:us-west-2:123456789012:volume/vol-1234"); ok {
+		t.Errorf("expected volumes not to be reaped")
+	}
+}
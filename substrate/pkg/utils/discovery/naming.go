@@ -24,3 +24,9 @@ import (
 func Name(substrate *v1alpha1.Substrate, suffixes ...string) *string {
 	return aws.String(strings.Join(append([]string{"kit", substrate.Name}, suffixes...), "-"))
 }
+
+// BucketName is the name of the S3 bucket holding the cluster configuration,
+// see Substrate.BucketName.
+func BucketName(substrate *v1alpha1.Substrate) *string {
+	return aws.String(substrate.BucketName())
+}